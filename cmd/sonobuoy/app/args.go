@@ -18,13 +18,11 @@ package app
 
 import (
 	"fmt"
-	"io/ioutil"
 	"regexp"
 	"strings"
 
 	"github.com/heptio/sonobuoy/pkg/image"
-
-	"gopkg.in/yaml.v2"
+	"github.com/heptio/sonobuoy/pkg/image/docker"
 
 	ops "github.com/heptio/sonobuoy/pkg/client"
 	"github.com/heptio/sonobuoy/pkg/config"
@@ -34,10 +32,20 @@ import (
 )
 
 const (
-	namespaceFlag       = "namespace"
-	sonobuoyImageFlag   = "sonobuoy-image"
-	imagePullPolicyFlag = "image-pull-policy"
-	pluginFlag          = "plugin"
+	namespaceFlag         = "namespace"
+	sonobuoyImageFlag     = "sonobuoy-image"
+	imagePullPolicyFlag   = "image-pull-policy"
+	pluginFlag            = "plugin"
+	imageListFlag         = "image-list"
+	kubernetesVersionFlag = "kubernetes-version"
+	imageSnapshotFlag     = "image-snapshot"
+	forceVersionFlag      = "force-version"
+	excludeFlag           = "exclude"
+	imagesFlag            = "images"
+	registryMapFileFlag   = "registry-map-file"
+
+	kubeConformanceImageFlag        = "kube-conformance-image"
+	kubeConformanceImageVersionFlag = "kube-conformance-image-version"
 )
 
 // AddNamespaceFlag initialises a namespace flag.
@@ -68,11 +76,53 @@ func AddSonobuoyImage(image *string, flags *pflag.FlagSet) {
 	)
 }
 
+// AddIncludeSonobuoyImageFlag initialises a flag adding the sonobuoy image, as given
+// by --sonobuoy-image, to the images a command works on.
+func AddIncludeSonobuoyImageFlag(include *bool, flags *pflag.FlagSet) {
+	flags.BoolVar(
+		include, "include-sonobuoy-image", false,
+		"If true, also include the sonobuoy aggregator and worker image given by --"+sonobuoyImageFlag+". When pushing, it is mirrored to the repo-config's sonobuoyRegistry if set.",
+	)
+}
+
+// AddOutputFileFlag initialises a flag for writing the outcome of each image operation to a file.
+func AddOutputFileFlag(path *string, flags *pflag.FlagSet) {
+	flags.StringVar(
+		path, "output-file", "",
+		"If set, write the action, result and any error of each image to this file, even if some fail. Written as JSON if the file ends with .json, YAML otherwise.",
+	)
+}
+
+// AddTarRateLimitFlag initialises a flag limiting how fast image tars are exported and imported.
+func AddTarRateLimitFlag(limit *string, flags *pflag.FlagSet) {
+	flags.StringVar(
+		limit, "tar-rate-limit", "",
+		"If set, limit writing and reading image tars to this many bytes per second (e.g. '10MB').",
+	)
+}
+
+// AddParallelFlag initialises a flag for how many images to pull or push at once.
+func AddParallelFlag(parallel *int, flags *pflag.FlagSet) {
+	flags.IntVar(
+		parallel, "parallel", 1,
+		"How many images to pull or push at once. Lowered automatically if the docker daemon or a registry reports too many concurrent transfers.",
+	)
+}
+
+// AddConcurrencyPerImageLayersFlag initialises a flag for how many layers of each
+// image the docker daemon is expected to transfer at once.
+func AddConcurrencyPerImageLayersFlag(layers *int, flags *pflag.FlagSet) {
+	flags.IntVar(
+		layers, "concurrency-per-image-layers", 0,
+		"If set, how many layers of each image to transfer at once. Docker only applies this daemon-wide, through its max-concurrent-downloads and max-concurrent-uploads settings in "+docker.DefaultDaemonConfigPath+" (or their defaults when the daemon isn't local), so --parallel is lowered to keep the layers of the images transferred at once within those settings.",
+	)
+}
+
 // AddKubeConformanceImage initialises an image url flag.
 func AddKubeConformanceImage(image *string, flags *pflag.FlagSet) {
 	flags.StringVar(
-		image, "kube-conformance-image", "",
-		"Container image override for the kube conformance image. Overrides --kube-conformance-image-version.",
+		image, kubeConformanceImageFlag, "",
+		"Container image override for the kube conformance image. Takes precedence over --"+kubeConformanceImageVersionFlag+", which is ignored with a warning if both are set.",
 	)
 }
 
@@ -82,7 +132,7 @@ func AddKubeConformanceImageVersion(imageVersion *image.ConformanceImageVersion,
 	help += fmt.Sprintf("Default is 'auto', which will be set to your cluster's version if detected, erroring otherwise.")
 
 	*imageVersion = image.ConformanceImageVersionAuto
-	flags.Var(imageVersion, "kube-conformance-image-version", help)
+	flags.Var(imageVersion, kubeConformanceImageVersionFlag, help)
 }
 
 // AddKubeconfigFlag adds a kubeconfig flag to the provided command.
@@ -93,23 +143,127 @@ func AddKubeconfigFlag(cfg *Kubeconfig, flags *pflag.FlagSet) {
 
 // AddPluginFlag describes which plugin's images to interact with
 func AddPluginFlag(cfg *string, flags *pflag.FlagSet) {
-	// The default is 'e2e' since it's the only plugin enabled at the moment
-	flags.StringVarP(cfg, pluginFlag, "p", "e2e", "Describe which plugin's images to interact (Valid plugins are 'e2e').")
+	flags.StringVarP(cfg, pluginFlag, "p", e2ePluginName, "Describe which plugin's images to interact (Valid plugins are 'e2e', 'systemd-logs'; listing images also accepts 'all').")
+}
+
+// AddKubernetesVersionFlag adds a flag for the Kubernetes version to use instead of
+// querying the cluster for it.
+func AddKubernetesVersionFlag(version *string, flags *pflag.FlagSet) {
+	flags.StringVar(
+		version, kubernetesVersionFlag, "",
+		"The Kubernetes version (e.g. v1.14.0) to use instead of the cluster's version. If set, no cluster is required.",
+	)
+}
+
+// AddForceVersionFlag adds a flag to use the images of the nearest supported
+// Kubernetes version when the version's own images aren't known.
+func AddForceVersionFlag(force *bool, flags *pflag.FlagSet) {
+	flags.BoolVar(
+		force, forceVersionFlag, false,
+		"If true, use the images of the nearest supported Kubernetes version when the version isn't supported, e.g. for pre-release clusters.",
+	)
+}
+
+// AddImageListFlag adds a flag for a file listing the images to operate on.
+func AddImageListFlag(path *string, flags *pflag.FlagSet) {
+	flags.StringVar(
+		path, imageListFlag, "",
+		"Path to a file listing one image per line. If set, those images are used instead of the ones for the cluster's version.",
+	)
+}
+
+// AddExcludeFlag adds a flag for images to leave out of an images operation.
+func AddExcludeFlag(excludes *[]string, flags *pflag.FlagSet) {
+	flags.StringSliceVar(
+		excludes, excludeFlag, []string{},
+		"Images to leave out, by registry key (e.g. Nginx), name (e.g. nginx) or full reference, a glob of references (e.g. '*conformance*') or a regular expression prefixed with 're:'. May be repeated or comma separated.",
+	)
+}
+
+// AddImagesFlag adds a flag for the only images to include in an images operation.
+func AddImagesFlag(includes *[]string, flags *pflag.FlagSet) {
+	flags.StringSliceVar(
+		includes, imagesFlag, []string{},
+		"Only include these images, as patterns like those of --"+excludeFlag+". May be repeated or comma separated.",
+	)
+}
+
+// AddStrictFlag adds a flag turning the warnings about images with mutable tags into an error.
+func AddStrictFlag(strict *bool, flags *pflag.FlagSet) {
+	flags.BoolVar(
+		strict, "strict", false,
+		"If true, fail instead of warning when an image uses ':latest' or another mutable tag rather than being pinned by digest or version.",
+	)
+}
+
+// AddRegistryMapFileFlag adds a flag for a file of rules mapping images to their private destinations.
+func AddRegistryMapFileFlag(path *string, flags *pflag.FlagSet) {
+	flags.StringVar(
+		path, registryMapFileFlag, "",
+		"Path to a file of rules mapping images to their private destinations, one 'source-regex -> dest-template' per line (e.g. 'k8s.gcr.io/(.*) -> mirror.corp/k8s/$1'). Applies to every image, instead of --"+e2eRegistryConfigFlag+".",
+	)
+}
+
+// AddTagTransformFlag adds a flag for a template rebuilding the private destination of each image.
+func AddTagTransformFlag(template *string, flags *pflag.FlagSet) {
+	flags.StringVar(
+		template, "tag-transform", "",
+		"Template for destination images, in which {registry}, {repo} and {tag} are replaced by those of the private image (e.g. '{registry}/{repo}:{tag}-mirrored'). Applied after --registry-rewrite.",
+	)
+}
+
+// AddImageSnapshotFlag adds a flag for a pinned snapshot of the upstream images.
+func AddImageSnapshotFlag(path *string, flags *pflag.FlagSet) {
+	flags.StringVar(
+		path, imageSnapshotFlag, "",
+		"Path to a snapshot written by 'images list -o json'. If set, its images and version are used instead of computing them.",
+	)
 }
 
 // AddE2ERegistryConfigFlag adds a e2eRegistryConfigFlag flag to the provided command.
 func AddE2ERegistryConfigFlag(cfg *string, flags *pflag.FlagSet) {
 	flags.StringVar(
 		cfg, e2eRegistryConfigFlag, "",
-		"Specify a yaml file acting as KUBE_TEST_REPO_LIST, overriding registries for test images.",
+		"Specify a yaml file acting as KUBE_TEST_REPO_LIST, overriding registries for test images. May also be an http(s) URL to fetch it from, configmap://namespace/name[/key] to read it from a cluster ConfigMap, or - to read it from stdin. ${VAR} and $VAR references in it are expanded from the environment.",
 	)
+	addRepoConfigStrictEnvFlag(flags)
+}
+
+// AddE2ERegistryConfigOutFlag adds a flag for writing the effective repo-config to a file.
+func AddE2ERegistryConfigOutFlag(path *string, flags *pflag.FlagSet) {
+	flags.StringVar(
+		path, e2eRegistryConfigOutFlag, "",
+		"If set, write the repo-config the images were resolved with to this file, as a KUBE_TEST_REPO_LIST setting every registry key: those --"+e2eRegistryConfigFlag+" sets, and the defaults for the rest.",
+	)
+}
+
+// addRepoConfigStrictEnvFlag adds a flag to fail on repo-configs referencing unset environment variables
+func addRepoConfigStrictEnvFlag(flags *pflag.FlagSet) {
+	flags.BoolVar(
+		&image.RepoConfigStrictEnv, "e2e-repo-config-strict-env", false,
+		"If true, fail if --"+e2eRegistryConfigFlag+" references an environment variable that isn't set, instead of leaving it empty.",
+	)
+}
+
+// setRepoConfigMapClient gives the image package a cluster client if repoConfig
+// names a ConfigMap. Other repo-configs don't need a cluster.
+func setRepoConfigMapClient(kubeconfig *Kubeconfig, repoConfig string) error {
+	if !image.IsRepoConfigMap(repoConfig) {
+		return nil
+	}
+	client, err := getClient(kubeconfig)
+	if err != nil {
+		return errors.Wrap(err, "couldn't get a cluster client to read the repo-config ConfigMap")
+	}
+	image.RepoConfigMapClient = client.CoreV1()
+	return nil
 }
 
 // AddSonobuoyConfigFlag adds a SonobuoyConfig flag to the provided command.
 func AddSonobuoyConfigFlag(cfg *SonobuoyConfig, flags *pflag.FlagSet) {
 	flags.Var(
 		cfg, "config",
-		"Path to a sonobuoy configuration JSON file. Overrides --mode.",
+		"Path to a sonobuoy configuration JSON file. Overrides --mode. --e2e-repo-config is applied to the e2e plugin on top of it.",
 	)
 }
 
@@ -118,6 +272,15 @@ const (
 	e2eSkipFlag           = "e2e-skip"
 	e2eParallelFlag       = "e2e-parallel"
 	e2eRegistryConfigFlag = "e2e-repo-config"
+	// e2eRegistryConfigOutFlag is where to write the repo-config images were resolved with
+	e2eRegistryConfigOutFlag = "e2e-repo-config-out"
+
+	// e2ePluginName is the name of the plugin running the Kubernetes end-to-end tests
+	e2ePluginName = "e2e"
+	// systemdLogsPluginName is the name of the plugin gathering the nodes' systemd logs
+	systemdLogsPluginName = "systemd-logs"
+	// allPluginsName selects the images of every plugin above, where supported
+	allPluginsName = "all"
 )
 
 // AddE2EConfigFlags adds three arguments: --e2e-focus, --e2e-skip and
@@ -145,8 +308,9 @@ func AddE2EConfigFlags(flags *pflag.FlagSet) *pflag.FlagSet {
 	)
 	e2eFlags.String(
 		e2eRegistryConfigFlag, "",
-		"Specify a yaml file acting as KUBE_TEST_REPO_LIST, overriding registries for test images.",
+		"Specify a yaml file acting as KUBE_TEST_REPO_LIST, overriding registries for test images. May also be an http(s) URL to fetch it from, configmap://namespace/name[/key] to read it from a cluster ConfigMap, or - to read it from stdin. ${VAR} and $VAR references in it are expanded from the environment.",
 	)
+	addRepoConfigStrictEnvFlag(e2eFlags)
 	e2eFlags.MarkHidden(e2eParallelFlag)
 	flags.AddFlagSet(e2eFlags)
 	return e2eFlags
@@ -191,17 +355,12 @@ func GetE2EConfig(mode ops.Mode, flags *pflag.FlagSet) (*ops.E2EConfig, error) {
 		if err != nil {
 			return nil, errors.Wrap(err, "couldn't retrieve registry list flag")
 		}
-		contents, err := ioutil.ReadFile(repoFile)
+		// The contents are validated as yaml to short circuit failures from malformed files.
+		contents, err := image.ReadRepoConfig(repoFile)
 		if err != nil {
 			return nil, errors.Wrap(err, "couldn't read registry list")
 		}
 
-		// Unmarshal just to validate yaml and short circuit failures from malformed files.
-		err = yaml.Unmarshal(contents, map[string]string{})
-		if err != nil {
-			return nil, errors.Wrap(err, "failed to parse yaml registry list:")
-		}
-
 		cfg.CustomRegistries = string(contents)
 	}
 
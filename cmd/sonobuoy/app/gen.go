@@ -27,6 +27,7 @@ import (
 	"github.com/heptio/sonobuoy/pkg/errlog"
 	"github.com/imdario/mergo"
 	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 	"github.com/spf13/pflag"
 	"k8s.io/client-go/discovery"
@@ -77,6 +78,12 @@ func GenFlagSet(cfg *genFlags, rbac RBACMode) *pflag.FlagSet {
 }
 
 func (g *genFlags) Config() (*client.GenConfig, error) {
+	if repoConfig, err := g.e2eflags.GetString(e2eRegistryConfigFlag); err == nil {
+		if err := setRepoConfigMapClient(&g.kubecfg, repoConfig); err != nil {
+			return nil, err
+		}
+	}
+
 	e2ecfg, err := GetE2EConfig(g.mode, g.e2eflags)
 	if err != nil {
 		return nil, errors.Wrap(err, "could not retrieve E2E config")
@@ -98,37 +105,19 @@ func (g *genFlags) Config() (*client.GenConfig, error) {
 		return nil, err
 	}
 
-	var image string
-
-	// --kube-conformance-image overrides --kube-conformance-image-version
-	if g.kubeConformanceImage != "" {
-		image = g.kubeConformanceImage
-	} else {
-		// kubeclient can be null. Prevent a null-pointer exception by gating on
-		// that to retrieve the discovery client
-		var discoveryClient discovery.ServerVersionInterface
-		if kubeclient != nil {
-			discoveryClient = kubeclient.DiscoveryClient
-		}
-
-		// Only the `auto`  value requires the discovery client to be non-nil
-		// if discoveryClient is needed, ErrImageVersionNoClient will be returned and that error can be reported back up
-		imageVersion, err := g.kubeConformanceImageVersion.Get(discoveryClient)
-		if err != nil {
-			if errors.Cause(err) == imagepkg.ErrImageVersionNoClient {
-				return nil, errors.Wrap(err, kubeError.Error())
-			}
-			return nil, err
-		}
+	image, err := g.resolveKubeConformanceImage(kubeclient, kubeError)
+	if err != nil {
+		return nil, err
+	}
 
-		image = fmt.Sprintf("%v:%v",
-			resolveConformanceImage(imageVersion),
-			imageVersion)
+	conf := g.getConfig()
+	if len(e2ecfg.CustomRegistries) > 0 && !selectsPlugin(conf, e2ePluginName) {
+		logrus.Warningf("--%v only applies to the %v plugin, which isn't selected; it will have no effect", e2eRegistryConfigFlag, e2ePluginName)
 	}
 
 	return &client.GenConfig{
 		E2EConfig:            e2ecfg,
-		Config:               g.getConfig(),
+		Config:               conf,
 		Image:                g.sonobuoyImage,
 		Namespace:            g.namespace,
 		EnableRBAC:           rbacEnabled,
@@ -139,6 +128,40 @@ func (g *genFlags) Config() (*client.GenConfig, error) {
 	}, nil
 }
 
+// resolveKubeConformanceImage returns the conformance image to run: the image
+// given by --kube-conformance-image if set, otherwise the default conformance
+// image at the version given by --kube-conformance-image-version.
+func (g *genFlags) resolveKubeConformanceImage(kubeclient *kubernetes.Clientset, kubeError error) (string, error) {
+	// --kube-conformance-image overrides --kube-conformance-image-version
+	if g.kubeConformanceImage != "" {
+		if g.genflags != nil && g.genflags.Changed(kubeConformanceImageVersionFlag) {
+			logrus.Warningf("--%v is set, so --%v %v is ignored", kubeConformanceImageFlag, kubeConformanceImageVersionFlag, g.kubeConformanceImageVersion.String())
+		}
+		return g.kubeConformanceImage, nil
+	}
+
+	// kubeclient can be null. Prevent a null-pointer exception by gating on
+	// that to retrieve the discovery client
+	var discoveryClient discovery.ServerVersionInterface
+	if kubeclient != nil {
+		discoveryClient = kubeclient.DiscoveryClient
+	}
+
+	// Only the `auto`  value requires the discovery client to be non-nil
+	// if discoveryClient is needed, ErrImageVersionNoClient will be returned and that error can be reported back up
+	imageVersion, err := g.kubeConformanceImageVersion.Get(discoveryClient)
+	if err != nil {
+		if errors.Cause(err) == imagepkg.ErrImageVersionNoClient {
+			return "", errors.Wrap(err, kubeError.Error())
+		}
+		return "", err
+	}
+
+	return fmt.Sprintf("%v:%v",
+		resolveConformanceImage(imageVersion),
+		imageVersion), nil
+}
+
 // resolveConformanceImage maps versions before 1.13 to Heptio's image and otherwise
 // to the upstream cnoformance image. Latest is always mapped to the upstream
 // regardless. The comparison is just lexical, e.g. "foo" < "v1.13" and "zip" >
@@ -209,12 +232,24 @@ func getClient(kubeconfig *Kubeconfig) (*kubernetes.Clientset, error) {
 	return client, kubeError
 }
 
+// selectsPlugin reports whether the config runs the named plugin
+func selectsPlugin(conf *config.Config, name string) bool {
+	for _, selection := range conf.PluginSelections {
+		if selection.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
 // getConfig creates a config with the following algorithm:
 // If no config is supplied defaults will be returned.
 // If a config is supplied then the default values will be merged into the supplied config
 //   in order to allow users to supply a minimal config that will still work.
 // Lastly, options provided on the command line will override
 //   any values in the config.
+// The --e2e-repo-config registries aren't part of the config; they are always applied
+//   to the e2e plugin on top of it, since neither the config nor the mode set them.
 func (g *genFlags) getConfig() *config.Config {
 	if g == nil {
 		return config.New()
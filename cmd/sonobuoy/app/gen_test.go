@@ -14,6 +14,7 @@ limitations under the License.
 package app
 
 import (
+	"io/ioutil"
 	"strings"
 	"testing"
 
@@ -21,6 +22,9 @@ import (
 	"github.com/heptio/sonobuoy/pkg/client"
 	"github.com/heptio/sonobuoy/pkg/config"
 	"github.com/heptio/sonobuoy/pkg/plugin"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	testhook "github.com/sirupsen/logrus/hooks/test"
 )
 
 // TestResolveConformanceImage tests the temporary logic of ensuring that given
@@ -73,6 +77,61 @@ func TestResolveConformanceImage(t *testing.T) {
 	}
 }
 
+func TestResolveKubeConformanceImage(t *testing.T) {
+	logrus.SetOutput(ioutil.Discard)
+
+	tcs := []struct {
+		name        string
+		cliInput    string
+		expected    string
+		expectedErr bool
+		warned      bool
+	}{
+		{
+			name:     "Explicit version",
+			cliInput: "--kube-conformance-image-version latest",
+			expected: "gcr.io/google-containers/conformance:latest",
+		}, {
+			name:     "Explicit image",
+			cliInput: "--kube-conformance-image my.registry/conformance:v1.15.1",
+			expected: "my.registry/conformance:v1.15.1",
+		}, {
+			name:     "Explicit image wins over the version with a warning",
+			cliInput: "--kube-conformance-image my.registry/conformance:v1.15.1 --kube-conformance-image-version latest",
+			expected: "my.registry/conformance:v1.15.1",
+			warned:   true,
+		}, {
+			name:        "Auto version needs a client",
+			cliInput:    "--kube-conformance-image-version auto",
+			expectedErr: true,
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			hook := testhook.NewGlobal()
+			defer hook.Reset()
+
+			g := &genFlags{}
+			fs := GenFlagSet(g, EnabledRBACMode)
+			if err := fs.Parse(strings.Split(tc.cliInput, " ")); err != nil {
+				t.Fatalf("Failed to parse CLI input %q: %v", tc.cliInput, err)
+			}
+
+			out, err := g.resolveKubeConformanceImage(nil, errors.New("no client"))
+			if (err != nil) != tc.expectedErr {
+				t.Fatalf("Expected error %v but got %v", tc.expectedErr, err)
+			}
+			if out != tc.expected {
+				t.Errorf("Expected image %q but got %q", tc.expected, out)
+			}
+			if warned := len(hook.Entries) > 0; warned != tc.warned {
+				t.Errorf("Expected warning %v but got entries %v", tc.warned, hook.Entries)
+			}
+		})
+	}
+}
+
 func TestGetConfig(t *testing.T) {
 	defaultPluginSearchPath := config.New().PluginSearchPath
 
@@ -246,3 +305,70 @@ func TestGetConfig(t *testing.T) {
 		})
 	}
 }
+
+func TestE2ERegistryConfigWithSonobuoyConfig(t *testing.T) {
+	contents, err := ioutil.ReadFile("testdata/repo-config.yaml")
+	if err != nil {
+		t.Fatalf("Failed to read repo config: %v", err)
+	}
+
+	tcs := []struct {
+		name              string
+		cliInput          string
+		expectedNamespace string
+		expectedRepos     string
+		expectedSelected  bool
+	}{
+		{
+			name:              "Only the sonobuoy config is set",
+			cliInput:          "--config testdata/sonobuoy.conf",
+			expectedNamespace: "configNS",
+			expectedRepos:     "",
+			expectedSelected:  true,
+		}, {
+			name:              "Only the repo config is set",
+			cliInput:          "--e2e-repo-config testdata/repo-config.yaml",
+			expectedNamespace: "heptio-sonobuoy",
+			expectedRepos:     string(contents),
+			expectedSelected:  true,
+		}, {
+			name:              "Both are set and the repo config is applied on top of the sonobuoy config",
+			cliInput:          "--config testdata/sonobuoy.conf --e2e-repo-config testdata/repo-config.yaml",
+			expectedNamespace: "configNS",
+			expectedRepos:     string(contents),
+			expectedSelected:  true,
+		}, {
+			name:              "Both are set but the sonobuoy config doesn't select the e2e plugin",
+			cliInput:          "--config testdata/sonobuoy-systemd-logs.conf --e2e-repo-config testdata/repo-config.yaml",
+			expectedNamespace: "configNS",
+			expectedRepos:     string(contents),
+			expectedSelected:  false,
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			g := &genFlags{}
+			fs := GenFlagSet(g, EnabledRBACMode)
+			if err := fs.Parse(strings.Split(tc.cliInput, " ")); err != nil {
+				t.Fatalf("Failed to parse CLI input %q: %v", tc.cliInput, err)
+			}
+
+			e2ecfg, err := GetE2EConfig(g.mode, g.e2eflags)
+			if err != nil {
+				t.Fatalf("Unexpected error getting E2E config: %v", err)
+			}
+			conf := g.getConfig()
+
+			if conf.Namespace != tc.expectedNamespace {
+				t.Errorf("Expected namespace %v but got %v", tc.expectedNamespace, conf.Namespace)
+			}
+			if e2ecfg.CustomRegistries != tc.expectedRepos {
+				t.Errorf("Expected custom registries %q but got %q", tc.expectedRepos, e2ecfg.CustomRegistries)
+			}
+			if selected := selectsPlugin(conf, e2ePluginName); selected != tc.expectedSelected {
+				t.Errorf("Expected e2e plugin selected to be %v but got %v", tc.expectedSelected, selected)
+			}
+		})
+	}
+}
@@ -17,13 +17,34 @@ limitations under the License.
 package app
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"os"
-
+	"os/signal"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/c2h5oh/datasize"
 	"github.com/heptio/sonobuoy/pkg/errlog"
 	"github.com/heptio/sonobuoy/pkg/image"
+	"github.com/heptio/sonobuoy/pkg/image/docker"
+	"github.com/heptio/sonobuoy/pkg/image/registry"
 	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"golang.org/x/crypto/ssh/terminal"
+	"gopkg.in/yaml.v2"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
 )
 
 var imagesflags imagesFlags
@@ -34,324 +55,2543 @@ const (
 	defaultE2ERegistries = ""
 )
 
+// exclusiveFlags are the groups of flags which can't be combined, declared per
+// images subcommand with markFlagsExclusive and checked by setupImages
+var exclusiveFlags = map[*cobra.Command][][]string{}
+
+// systemdLogsTarFileName is the file the systemd-logs images are downloaded to
+const systemdLogsTarFileName = "sonobuoy_systemd_logs_images.tar"
+
+// conformanceOnlyFlag limits the e2e images to the conformance image
+const conformanceOnlyFlag = "conformance-only"
+
+// includeDepsFlag adds the images plugins depend on to those they list
+const includeDepsFlag = "include-deps"
+
+// kubernetesVersionsFlag exports the e2e images of several Kubernetes versions at once
+const kubernetesVersionsFlag = "kubernetes-versions"
+
+// destFlag sets where, and in which format, download writes the images
+const destFlag = "dest"
+
+// Supported values of --log-format
+const (
+	logFormatText  = "text"
+	logFormatJSONL = "jsonl"
+)
+
+const (
+	progressAuto  = "auto"
+	progressPlain = "plain"
+	progressNone  = "none"
+)
+
 type imagesFlags struct {
 	e2eRegistryConfig string
 	plugin            string
 	kubeconfig        Kubeconfig
+	extraTags         []string
+	checkPublished    bool
+	strict            bool
+	saveManifest      string
+	imageList         string
+	authRefreshCmd    string
+	allTags           bool
+	kubernetesVersion string
+	allowedRegistries []string
+	noColor           bool
+	imageSnapshot     string
+	output            string
+	batchSize         int
+	platform          string
+	registry          string
+	username          string
+	passwordStdin     bool
+	outputDir         string
+	fromDir           string
+	dockerHubUsername string
+	dockerHubToken    string
+	forceVersion      bool
+	registryRewrites  []string
+	input             string
+	fromTar           string
+	checksum          string
+	tolerateMissing   bool
+	refreshVersion    bool
+	verifySignature   bool
+	cosignKey         string
+	untagSource       bool
+	logFormat         string
+	platforms         []string
+	manifestLists     string
+	manifestListOnly  bool
+	excludes          []string
+	includes          []string
+	createRepos       bool
+	showSize          bool
+	sort              string
+	sortOrder         image.SortOrder
+	connectTimeout    time.Duration
+	upstreamAuth      []string
+	timeoutRetries    []string
+	retries           map[string]int
+	dockerRetries     int
+	readTimeout       time.Duration
+	timings           bool
+	repoConfigOut     string
+	targetOS          string
+	concurrencyReport bool
+	registryCACert    string
+	tagTransform      string
+	conformanceOnly   bool
+	tagsOnly          bool
+	reposOnly         bool
+	pipeThrough       string
+	manifestOnly      bool
+	failFast          bool
+	keepGoing         bool
+	sinceVersion      string
+	targetRegistry    string
+
+	kubernetesVersions []string
+	concurrentVersions int
+	registryMapFile    string
+	pullMirrors        []string
+	dryRun             bool
+	registryAuthFile   string
+	progress           string
+	reproducible       bool
+	dest               string
+	splitSize          string
+	namespace          string
+
+	includeSonobuoyImage bool
+	sonobuoyImage        string
+	outputFile           string
+	tarRateLimit         string
+	tarRateLimitBytes    int64
+	summaryOnly          bool
+	includeDeps          bool
+	parallel             int
+	layersPerImage       int
+}
+
+// imagesCtx is cancelled when an images command is interrupted, stopping its image
+// clients before their next image
+var imagesCtx, cancelImages = context.WithCancel(context.Background())
+
+// interruptCleanupTimeout is how long an interrupted images command has to clean up
+// before the process exits anyway
+const interruptCleanupTimeout = 10 * time.Second
+
+var handleInterruptsOnce sync.Once
+
+// daemonConfigPath is the docker daemon configuration --concurrency-per-image-layers
+// is checked against, when the daemon runs on this machine
+var daemonConfigPath = docker.DefaultDaemonConfigPath
+
+// daemonLimits returns the docker daemon's layer concurrency. Its configuration is
+// only read when the daemon is local: with DOCKER_HOST set, or outside Linux where
+// Docker Desktop runs the daemon in a VM, the file on this machine isn't the one the
+// daemon uses, so the daemon's defaults are assumed.
+func daemonLimits() (docker.DaemonLimits, error) {
+	if !daemonIsLocal() {
+		logrus.Debugf("Docker daemon isn't local, assuming its default layer concurrency")
+		return docker.DefaultDaemonLimits(), nil
+	}
+	return docker.ReadDaemonLimits(daemonConfigPath)
+}
+
+// insecureRegistries returns the docker daemon's insecure-registries, read as
+// daemonLimits reads its layer concurrency. None are assumed if it isn't local.
+func insecureRegistries() ([]string, error) {
+	if !daemonIsLocal() {
+		return nil, nil
+	}
+	return docker.ReadInsecureRegistries(daemonConfigPath)
+}
+
+// daemonIsLocal reports whether the docker daemon reads its configuration from
+// daemonConfigPath on this machine
+func daemonIsLocal() bool {
+	return len(os.Getenv("DOCKER_HOST")) == 0 && runtime.GOOS == "linux"
 }
 
+// imageResults records the outcome of each image operation for --output-file, once
+// an image client has been created
+var imageResults *image.ResultRecorder
+
+// imageReport accumulates the summary printed at the end of each images command
+var imageReport *image.Report
+
+// cleanupRegistryAuth removes the docker config directories made for --registry-auth-file
+// and for logins made by the command, if any
+var cleanupRegistryAuth = func() {}
+
 func NewCmdImages() *cobra.Command {
 	// Main command
 	cmd := &cobra.Command{
-		Use:   "images",
-		Short: "Manage images used in a plugin. Supported plugins are: 'e2e'",
-		Run:   listImages,
-		Args:  cobra.ExactArgs(0),
+		Use:               "images",
+		Short:             "Manage images used in a plugin. Supported plugins are: 'e2e'",
+		RunE:              runImages(listImages),
+		Args:              cobra.ExactArgs(0),
+		PersistentPreRunE: runImages(setupImages),
+		PersistentPostRun: func(cmd *cobra.Command, args []string) { cleanupRegistryAuth() },
 	}
+	cmd.PersistentFlags().BoolVar(
+		&imagesflags.refreshVersion, "refresh", false,
+		"If true, query the cluster's version even if it was cached by a recent invocation.",
+	)
+	cmd.PersistentFlags().BoolVar(
+		&imagesflags.noColor, "no-color", false,
+		"If true, never use colors in output, even on a terminal. Also enabled by setting NO_COLOR or TERM=dumb.",
+	)
+
+	cmd.PersistentFlags().DurationVar(
+		&imagesflags.connectTimeout, "registry-connect-timeout", 30*time.Second,
+		"How long the registry requests sonobuoy makes itself, such as diff, wait to connect, or 0 for no limit; docker pulls and pushes aren't affected.",
+	)
+	cmd.PersistentFlags().DurationVar(
+		&imagesflags.readTimeout, "registry-read-timeout", 0,
+		"How long the registry requests sonobuoy makes itself, such as diff, wait for a response, or 0 for no limit; docker pulls and pushes aren't affected.",
+	)
+	cmd.PersistentFlags().StringSliceVar(
+		&imagesflags.timeoutRetries, "registry-timeout-retries", []string{},
+		"How many times to retry the registry requests sonobuoy makes itself that time out, by HTTP method (e.g. 'head=0,get=5'); docker pulls and pushes use --docker-retries.",
+	)
+	cmd.PersistentFlags().IntVar(
+		&imagesflags.dockerRetries, "docker-retries", numDockerRetries,
+		"How many times to retry a docker pull or push that fails, whatever the failure, backing off between attempts.",
+	)
+	cmd.PersistentFlags().StringVar(
+		&imagesflags.targetOS, "os", image.OSLinux,
+		"OS of the nodes to resolve the e2e test images for, linux or windows, which a windows --platform implies.",
+	)
+	cmd.PersistentFlags().StringVar(
+		&imagesflags.registryCACert, "registry-ca-cert", "",
+		"Path to a PEM encoded CA certificate to trust for the registry requests sonobuoy makes itself, such as diff; docker pulls and pushes ignore it and need it installed as /etc/docker/certs.d/<registry>/ca.crt.",
+	)
+	cmd.PersistentFlags().BoolVar(
+		&imagesflags.keepGoing, "keep-going", true,
+		"If true (the default), attempt every image even after one fails, exiting non-zero at the end if any failed.",
+	)
+	cmd.PersistentFlags().BoolVar(
+		&imagesflags.failFast, "fail-fast", false,
+		"If true, stop at the first image that fails and exit non-zero, instead of keeping going.",
+	)
+	cmd.PersistentFlags().StringVar(
+		&imagesflags.registryAuthFile, "registry-auth-file", "",
+		"Path to a file of registry credentials in the docker config.json format, such as a podman or skopeo auth.json. If set, its credentials are used for every pull, push and registry request instead of those of the docker client.",
+	)
+	cmd.PersistentFlags().StringVar(
+		&imagesflags.logFormat, "log-format", logFormatText,
+		"Log format, text or jsonl; jsonl writes logs and progress events to stdout as one JSON object per line, and the results to stderr.",
+	)
+	cmd.PersistentFlags().StringVar(
+		&imagesflags.progress, "progress", progressAuto,
+		"Progress output. One of: auto, plain, none. With auto, progress is logged in color on a terminal; plain never uses colors and adds a [n/total] line per image to stderr, for CI logs; none only prints warnings, errors and the final results.",
+	)
+	cmd.PersistentFlags().BoolVar(
+		&imagesflags.summaryOnly, "summary-only", false,
+		"If true, print no per-image progress, only warnings, errors and the summary of images succeeded, failed and skipped, bytes written and time taken that closes every command.",
+	)
 
 	AddKubeconfigFlag(&imagesflags.kubeconfig, cmd.Flags())
+	AddKubernetesVersionFlag(&imagesflags.kubernetesVersion, cmd.Flags())
+	AddForceVersionFlag(&imagesflags.forceVersion, cmd.Flags())
+	AddImageSnapshotFlag(&imagesflags.imageSnapshot, cmd.Flags())
 	AddPluginFlag(&imagesflags.plugin, cmd.Flags())
+	AddExcludeFlag(&imagesflags.excludes, cmd.Flags())
+	AddImagesFlag(&imagesflags.includes, cmd.Flags())
+	AddStrictFlag(&imagesflags.strict, cmd.Flags())
+	AddE2ERegistryConfigOutFlag(&imagesflags.repoConfigOut, cmd.Flags())
+	cmd.Flags().BoolVar(
+		&imagesflags.checkPublished, "check-published", false,
+		"If true, check each image's registry and warn about any image whose tag isn't published.",
+	)
+	cmd.Flags().StringVarP(
+		&imagesflags.output, "output", "o", "text",
+		"Output format. One of: text, json, table. The json output can be passed to --image-snapshot.",
+	)
+	cmd.Flags().BoolVar(
+		&imagesflags.showSize, "show-size", false,
+		"If true, add a column with each image's size to -o table, as present in the local docker client.",
+	)
+	cmd.Flags().StringVar(
+		&imagesflags.sort, "sort", "",
+		"If set, the order to list the images in, for stable diffs across versions. One of: name, registry, size (largest first, as present in the local docker client). Ties are ordered by full reference. Defaults to the full reference.",
+	)
+	cmd.Flags().StringVar(
+		&imagesflags.sinceVersion, "since-version", "",
+		"If set, list only the images the Kubernetes version needs that this older version (e.g. v1.13.0) didn't, to mirror just the new ones when upgrading.",
+	)
+	cmd.Flags().BoolVar(
+		&imagesflags.tagsOnly, "tags-only", false,
+		"If true, print only the unique tags of the images.",
+	)
+	cmd.Flags().BoolVar(
+		&imagesflags.reposOnly, "repos-only", false,
+		"If true, print only the unique repositories of the images, without their tags (e.g. to create them in a registry ahead of a push).",
+	)
+	cmd.Flags().StringVarP(
+		&imagesflags.namespace, namespaceFlag, "n", "",
+		"If set, list the images the sonobuoy run deployed in this namespace is using, read from its pods, instead of those the Kubernetes version needs. With -o table or json, each pod and container is shown along with the image it resolved to.",
+	)
+
+	markFlagsExclusive(cmd,
+		[]string{"fail-fast", "keep-going"},
+		[]string{imageSnapshotFlag, kubernetesVersionFlag},
+		[]string{"tags-only", "repos-only"},
+		[]string{"tags-only", "output"},
+		[]string{"repos-only", "output"},
+		[]string{"sort", "tags-only"},
+		[]string{"sort", "repos-only"},
+		[]string{"sort", namespaceFlag},
+		[]string{"since-version", imageSnapshotFlag},
+		[]string{namespaceFlag, kubernetesVersionFlag},
+		[]string{namespaceFlag, imageSnapshotFlag},
+		[]string{namespaceFlag, "since-version"},
+	)
 
 	// Pull command
 	pullCmd := &cobra.Command{
 		Use:   "pull",
 		Short: "Pulls images to local docker client for a specific plugin",
-		Run:   pullImages,
+		RunE:  runImages(pullImages),
 		Args:  cobra.ExactArgs(0),
 	}
 	AddKubeconfigFlag(&imagesflags.kubeconfig, pullCmd.Flags())
+	AddKubernetesVersionFlag(&imagesflags.kubernetesVersion, pullCmd.Flags())
+	AddForceVersionFlag(&imagesflags.forceVersion, pullCmd.Flags())
+	AddImageSnapshotFlag(&imagesflags.imageSnapshot, pullCmd.Flags())
 	AddPluginFlag(&imagesflags.plugin, pullCmd.Flags())
+	AddOutputFileFlag(&imagesflags.outputFile, pullCmd.Flags())
+	AddExcludeFlag(&imagesflags.excludes, pullCmd.Flags())
+	AddImagesFlag(&imagesflags.includes, pullCmd.Flags())
+	AddStrictFlag(&imagesflags.strict, pullCmd.Flags())
+	AddIncludeSonobuoyImageFlag(&imagesflags.includeSonobuoyImage, pullCmd.Flags())
+	AddParallelFlag(&imagesflags.parallel, pullCmd.Flags())
+	AddConcurrencyPerImageLayersFlag(&imagesflags.layersPerImage, pullCmd.Flags())
+	pullCmd.Flags().BoolVar(
+		&imagesflags.includeDeps, includeDepsFlag, false,
+		"If true, also pull the images the plugin's pods run that it doesn't list, such as the conformance image and the sonobuoy worker sidecar given by --"+sonobuoyImageFlag+", so that the pulled set is self-contained.",
+	)
+	AddSonobuoyImage(&imagesflags.sonobuoyImage, pullCmd.Flags())
+	pullCmd.Flags().BoolVar(
+		&imagesflags.timings, "timings", false,
+		"If true, print how long each image took, and a summary sorted by the slowest image at the end.",
+	)
+	AddImageListFlag(&imagesflags.imageList, pullCmd.Flags())
+	pullCmd.Flags().StringSliceVar(
+		&imagesflags.pullMirrors, "pull-mirror", []string{},
+		"Pull the images of a registry host from a mirror instead, in the form source-host=mirror-host (e.g. 'k8s.gcr.io=mirror.corp:5000'), tagging them with their upstream names. May be repeated or comma separated.",
+	)
+	pullCmd.Flags().StringVar(
+		&imagesflags.targetRegistry, "target-registry", "",
+		"If set, push each pulled image to this registry host under the same repository and tag, e.g. to pre-warm a pull-through cache.",
+	)
+	pullCmd.Flags().StringSliceVar(
+		&imagesflags.allowedRegistries, "allowed-registries", []string{},
+		"If set, only push to these registry hosts with --target-registry (e.g. 'registry.corp.example:5000'). The pull is aborted before any image is pulled if the target registry is another.",
+	)
+	pullCmd.Flags().BoolVar(
+		&imagesflags.manifestOnly, "manifest-only", false,
+		"If true, only check that each image's manifest exists in its upstream registry and print its digest, without pulling any layers. Uses the credentials saved by 'docker login'. To check a mirror, use push --manifest-only.",
+	)
+	pullCmd.Flags().BoolVar(
+		&imagesflags.allTags, "all-tags", false,
+		"If true, pull every tag of each image's repository rather than just the tag for the cluster's version.",
+	)
+	pullCmd.Flags().StringVar(
+		&imagesflags.e2eRegistryConfig, e2eRegistryConfigFlag, "",
+		"If set, pull each image as the images section of this repo-config, as given to push, says: for its platform, by its digest and logging in with the credentials in the environment variable its authRef names. The repo-config's registries only apply to push.",
+	)
+	addRepoConfigStrictEnvFlag(pullCmd.Flags())
+	pullCmd.Flags().StringVar(
+		&imagesflags.platform, "platform", "",
+		"Platform to pull images for, in the form os/arch[/variant] (e.g. linux/arm64). Pulling fails for any image that isn't for this platform.",
+	)
+	pullCmd.Flags().BoolVar(
+		&imagesflags.verifySignature, "verify-signature", false,
+		"If true, verify each image's cosign signature against --cosign-key and remove any that fails, using the cosign CLI, which must be on the PATH.",
+	)
+	pullCmd.Flags().StringVar(
+		&imagesflags.cosignKey, "cosign-key", "",
+		"Path to the public key images must be signed with for --verify-signature.",
+	)
+	pullCmd.Flags().StringVar(
+		&imagesflags.dockerHubUsername, "docker-hub-username", os.Getenv("SONOBUOY_DOCKER_HUB_USERNAME"),
+		"Docker Hub username to log in with before pulling, for this command only, raising its rate limit on pulls. Defaults to $SONOBUOY_DOCKER_HUB_USERNAME.",
+	)
+	pullCmd.Flags().StringVar(
+		&imagesflags.dockerHubToken, "docker-hub-token", "",
+		"Docker Hub access token for --docker-hub-username. Defaults to $SONOBUOY_DOCKER_HUB_TOKEN, which should be preferred to keep it out of the process list.",
+	)
+	pullCmd.Flags().StringSliceVar(
+		&imagesflags.upstreamAuth, "upstream-auth", []string{},
+		"Credentials for pulling from upstream registries, in the form host=VAR (e.g. 'gcr.io=GCR_TOKEN'), where the environment variable VAR holds username:password, or an access token (e.g. from 'gcloud auth print-access-token') for Google's registries. The registry is logged in to before the first pull from it, for this command only. May be repeated or comma separated.",
+	)
+	pullCmd.Flags().StringVar(
+		&imagesflags.outputDir, "output-dir", "",
+		"If set, export each image to its own tar in this directory as soon as it's pulled, along with an "+image.IndexFileName+" of them, as download --output-dir does. Images already present locally are exported too.",
+	)
+
+	markFlagsExclusive(pullCmd,
+		[]string{imageSnapshotFlag, imageListFlag},
+		[]string{imageSnapshotFlag, kubernetesVersionFlag},
+		[]string{includeDepsFlag, imageSnapshotFlag},
+		[]string{includeDepsFlag, imageListFlag},
+		[]string{"manifest-only", "all-tags"},
+		[]string{"manifest-only", "platform"},
+		[]string{"manifest-only", "verify-signature"},
+		[]string{"manifest-only", "timings"},
+		[]string{"output-dir", "all-tags"},
+		[]string{"output-dir", "manifest-only"},
+		[]string{"target-registry", "all-tags"},
+		[]string{"target-registry", "manifest-only"},
+		[]string{"pull-mirror", "all-tags"},
+		[]string{"pull-mirror", "manifest-only"},
+	)
 
 	// Download command
 	downloadCmd := &cobra.Command{
 		Use:   "download",
 		Short: "Saves downloaded images from local docker client to a tar file",
-		Run:   downloadImages,
+		RunE:  runImages(downloadImages),
 		Args:  cobra.ExactArgs(0),
 	}
 	AddKubeconfigFlag(&imagesflags.kubeconfig, downloadCmd.Flags())
+	AddKubernetesVersionFlag(&imagesflags.kubernetesVersion, downloadCmd.Flags())
+	AddForceVersionFlag(&imagesflags.forceVersion, downloadCmd.Flags())
+	AddImageSnapshotFlag(&imagesflags.imageSnapshot, downloadCmd.Flags())
 	AddPluginFlag(&imagesflags.plugin, downloadCmd.Flags())
+	AddExcludeFlag(&imagesflags.excludes, downloadCmd.Flags())
+	AddImagesFlag(&imagesflags.includes, downloadCmd.Flags())
+	AddIncludeSonobuoyImageFlag(&imagesflags.includeSonobuoyImage, downloadCmd.Flags())
+	AddSonobuoyImage(&imagesflags.sonobuoyImage, downloadCmd.Flags())
+	AddTarRateLimitFlag(&imagesflags.tarRateLimit, downloadCmd.Flags())
+	AddImageListFlag(&imagesflags.imageList, downloadCmd.Flags())
+	downloadCmd.Flags().StringSliceVar(
+		&imagesflags.platforms, "platform", []string{},
+		"If set, pull each image for these platforms (e.g. 'linux/amd64,linux/arm64') and export every variant, along with their manifest lists for push --manifest-lists.",
+	)
+	downloadCmd.Flags().BoolVar(
+		&imagesflags.dryRun, "dry-run", false,
+		"If true, only list the images that would be saved, their total size as reported by the local docker client, and the files they'd be saved to, without saving them.",
+	)
+	downloadCmd.Flags().IntVar(
+		&imagesflags.batchSize, "batch-size", 0,
+		"If set, export the images in numbered tar parts of at most this many images each, instead of a single tar.",
+	)
+	downloadCmd.Flags().StringVar(
+		&imagesflags.splitSize, "split-size", "",
+		"If set, export the images in numbered tar parts of at most this size each (e.g. '4000MB'), for transfer media with size limits, along with an "+image.IndexFileName+" of which part holds each image for load --from-dir. Sizes are binary, so 1GB is 1024MB; FAT32 holds files smaller than 4GB. Images are packed largest first, and a part is repacked if its tar turns out larger than the limit; an image larger than the limit gets a part of its own.",
+	)
+	downloadCmd.Flags().StringVar(
+		&imagesflags.outputDir, "output-dir", "",
+		"If set, export each image to its own tar in this directory along with an "+image.IndexFileName+" of them. Images already exported unchanged are skipped.",
+	)
+	downloadCmd.Flags().BoolVar(
+		&imagesflags.tolerateMissing, "tolerate-missing", false,
+		"If true, skip images that aren't present in the local docker client instead of failing, and report which were skipped.",
+	)
+	downloadCmd.Flags().BoolVar(
+		&imagesflags.conformanceOnly, conformanceOnlyFlag, false,
+		"If true, export only the e2e plugin's conformance image for the Kubernetes version, without its test dependencies.",
+	)
+	downloadCmd.Flags().StringSliceVar(
+		&imagesflags.kubernetesVersions, kubernetesVersionsFlag, []string{},
+		"If set, export the e2e images of each of these Kubernetes versions (e.g. 'v1.17.0,v1.18.0') to its own tar, instead of those of a single version.",
+	)
+	downloadCmd.Flags().IntVar(
+		&imagesflags.concurrentVersions, "concurrent-versions", 1,
+		"The number of versions given by --"+kubernetesVersionsFlag+" to export at once.",
+	)
+	downloadCmd.Flags().StringVar(
+		&imagesflags.pipeThrough, "pipe-through", "",
+		"If set, stream the saved images through this command (e.g. 'zstd -T0'), run without a shell, and write its output under the usual tar name.",
+	)
+	downloadCmd.Flags().BoolVar(
+		&imagesflags.reproducible, "reproducible", false,
+		"If true, repack each tar so that the same images always produce a byte-identical file, with entries sorted by name and timestamps and ownership cleared. Needs room for a second copy of the tar while repacking.",
+	)
+	downloadCmd.Flags().StringVar(
+		&imagesflags.dest, destFlag, "",
+		"If set, write the images here instead of the default tar. 'oci:///path/to/layout' writes an OCI image layout directory, 'docker-archive:///path/to/file.tar' writes a docker save tar.",
+	)
+
+	markFlagsExclusive(downloadCmd,
+		[]string{imageSnapshotFlag, imageListFlag},
+		[]string{imageSnapshotFlag, kubernetesVersionFlag},
+		[]string{conformanceOnlyFlag, imageSnapshotFlag},
+		[]string{conformanceOnlyFlag, imageListFlag},
+		[]string{"batch-size", "output-dir"},
+		[]string{"platform", "tolerate-missing"},
+		[]string{"dry-run", "platform"},
+		[]string{"dry-run", kubernetesVersionsFlag},
+		[]string{kubernetesVersionsFlag, kubernetesVersionFlag},
+		[]string{kubernetesVersionsFlag, imageSnapshotFlag},
+		[]string{kubernetesVersionsFlag, imageListFlag},
+		[]string{kubernetesVersionsFlag, conformanceOnlyFlag},
+		[]string{kubernetesVersionsFlag, "batch-size"},
+		[]string{kubernetesVersionsFlag, "output-dir"},
+		[]string{kubernetesVersionsFlag, "platform"},
+		[]string{kubernetesVersionsFlag, "tolerate-missing"},
+		[]string{destFlag, "batch-size"},
+		[]string{destFlag, "output-dir"},
+		[]string{destFlag, kubernetesVersionsFlag},
+		[]string{"split-size", "batch-size"},
+		[]string{"split-size", "output-dir"},
+		[]string{"split-size", destFlag},
+		[]string{"split-size", kubernetesVersionsFlag},
+		[]string{"split-size", conformanceOnlyFlag},
+		[]string{"reproducible", "pipe-through"},
+	)
 
 	// Push command
 	pushCmd := &cobra.Command{
 		Use:   "push",
 		Short: "Pushes images to docker registry for a specific plugin",
-		Run:   pushImages,
+		RunE:  runImages(pushImages),
 		Args:  cobra.ExactArgs(0),
 	}
 	AddE2ERegistryConfigFlag(&imagesflags.e2eRegistryConfig, pushCmd.Flags())
+	AddE2ERegistryConfigOutFlag(&imagesflags.repoConfigOut, pushCmd.Flags())
 	AddKubeconfigFlag(&imagesflags.kubeconfig, pushCmd.Flags())
+	AddKubernetesVersionFlag(&imagesflags.kubernetesVersion, pushCmd.Flags())
+	AddForceVersionFlag(&imagesflags.forceVersion, pushCmd.Flags())
+	AddImageSnapshotFlag(&imagesflags.imageSnapshot, pushCmd.Flags())
 	AddPluginFlag(&imagesflags.plugin, pushCmd.Flags())
-	pushCmd.MarkFlagRequired(e2eRegistryConfigFlag)
+	AddOutputFileFlag(&imagesflags.outputFile, pushCmd.Flags())
+	AddExcludeFlag(&imagesflags.excludes, pushCmd.Flags())
+	AddImagesFlag(&imagesflags.includes, pushCmd.Flags())
+	AddIncludeSonobuoyImageFlag(&imagesflags.includeSonobuoyImage, pushCmd.Flags())
+	AddParallelFlag(&imagesflags.parallel, pushCmd.Flags())
+	AddConcurrencyPerImageLayersFlag(&imagesflags.layersPerImage, pushCmd.Flags())
+	AddSonobuoyImage(&imagesflags.sonobuoyImage, pushCmd.Flags())
+	AddRegistryMapFileFlag(&imagesflags.registryMapFile, pushCmd.Flags())
+	pushCmd.Flags().BoolVar(
+		&imagesflags.timings, "timings", false,
+		"If true, print how long each image took, and a summary sorted by the slowest image at the end.",
+	)
+	pushCmd.Flags().BoolVar(
+		&imagesflags.concurrencyReport, "concurrency-report", false,
+		"If true, print the throughput of the push at the end, in images per minute and bytes per second, and how busy each of the --parallel workers was. The bytes are the local sizes of the images, which overstates them for layers the registry already has.",
+	)
+	pushCmd.Flags().BoolVar(
+		&imagesflags.createRepos, "create-repos", false,
+		"If true, create the destination repositories before pushing, for registries that reject pushes to repositories that don't exist. Supports Amazon ECR, using the aws CLI, and Harbor projects; other registries are pushed to as is.",
+	)
+	pushCmd.Flags().StringSliceVar(
+		&imagesflags.extraTags, "extra-tag", []string{},
+		"Additional tags to push for each image (e.g. 'stable'). May be repeated or comma separated.",
+	)
+	pushCmd.Flags().StringVar(
+		&imagesflags.saveManifest, "save-manifest", "",
+		"If set, write a manifest of each pushed image and its digest to this file. Written as JSON if the file ends with .json, YAML otherwise.",
+	)
+	pushCmd.Flags().StringVar(
+		&imagesflags.authRefreshCmd, "auth-refresh-command", "",
+		"Shell command to refresh registry credentials when a push is rejected as unauthorized, after which the push is retried once. The registry host is available as $REGISTRY.",
+	)
+	pushCmd.Flags().StringSliceVar(
+		&imagesflags.allowedRegistries, "allowed-registries", []string{},
+		"If set, only push to these registry hosts (e.g. 'registry.corp.example:5000'). The push is aborted before any image is pushed if a destination is on another registry.",
+	)
+	pushCmd.Flags().StringSliceVar(
+		&imagesflags.registryRewrites, "registry-rewrite", []string{},
+		"Rewrite the registry host of destination images, in the form old=new (e.g. 'private.io=mirror.corp:5000'). May be repeated or comma separated.",
+	)
+	pushCmd.Flags().StringVar(
+		&imagesflags.manifestLists, "manifest-lists", "",
+		"Manifest lists written by download --platform. If set, the platform variants of each image are pushed and a multi-arch manifest list is created for them. Requires docker manifest support.",
+	)
+	pushCmd.Flags().BoolVar(
+		&imagesflags.manifestListOnly, "manifest-list-only", false,
+		"If true, push no images, and instead create and push a multi-arch manifest list for each private image from its variants for --platform, already pushed under its tag with the platform appended (e.g. '1.0-linux-arm64'). Requires docker manifest support.",
+	)
+	pushCmd.Flags().StringSliceVar(
+		&imagesflags.platforms, "platform", []string{},
+		"The platforms (e.g. 'linux/amd64,linux/arm64') of the variants to list with --manifest-list-only.",
+	)
+	AddTagTransformFlag(&imagesflags.tagTransform, pushCmd.Flags())
+	pushCmd.Flags().BoolVar(
+		&imagesflags.manifestOnly, "manifest-only", false,
+		"If true, only check that each image's manifest exists in the registry --e2e-repo-config mirrors it to and print its digest, without pushing anything, as a fast health check of the mirror. Uses the credentials saved by 'docker login'.",
+	)
+	pushCmd.Flags().BoolVar(
+		&imagesflags.untagSource, "untag-source", false,
+		"If true, remove the local upstream tag of each image once it has been pushed, keeping only the private tags.",
+	)
+
+	markFlagsExclusive(pushCmd,
+		[]string{imageSnapshotFlag, kubernetesVersionFlag},
+		[]string{registryMapFileFlag, e2eRegistryConfigFlag},
+		[]string{registryMapFileFlag, e2eRegistryConfigOutFlag},
+		[]string{"manifest-only", "manifest-lists"},
+		[]string{"manifest-only", "extra-tag"},
+		[]string{"manifest-only", "untag-source"},
+		[]string{"manifest-only", "platform"},
+		[]string{"manifest-only", "timings"},
+		[]string{"manifest-only", "concurrency-report"},
+		[]string{"manifest-only", "create-repos"},
+		[]string{"manifest-only", "save-manifest"},
+		[]string{"manifest-lists", "extra-tag"},
+		[]string{"manifest-lists", "untag-source"},
+		[]string{"manifest-lists", "concurrency-report"},
+		[]string{"manifest-list-only", "manifest-lists"},
+		[]string{"manifest-list-only", "manifest-only"},
+		[]string{"manifest-list-only", "extra-tag"},
+		[]string{"manifest-list-only", "untag-source"},
+		[]string{"manifest-list-only", "concurrency-report"},
+	)
 
 	// Delete command
 	deleteCmd := &cobra.Command{
 		Use:   "delete",
 		Short: "Deletes all images downloaded to local docker client",
-		Run:   deleteImages,
+		RunE:  runImages(deleteImages),
 		Args:  cobra.ExactArgs(0),
 	}
 	AddE2ERegistryConfigFlag(&imagesflags.e2eRegistryConfig, deleteCmd.Flags())
 	AddKubeconfigFlag(&imagesflags.kubeconfig, deleteCmd.Flags())
+	AddKubernetesVersionFlag(&imagesflags.kubernetesVersion, deleteCmd.Flags())
+	AddForceVersionFlag(&imagesflags.forceVersion, deleteCmd.Flags())
 	AddPluginFlag(&imagesflags.plugin, deleteCmd.Flags())
+	AddOutputFileFlag(&imagesflags.outputFile, deleteCmd.Flags())
+	AddExcludeFlag(&imagesflags.excludes, deleteCmd.Flags())
+	AddImagesFlag(&imagesflags.includes, deleteCmd.Flags())
+	AddRegistryMapFileFlag(&imagesflags.registryMapFile, deleteCmd.Flags())
+	AddTagTransformFlag(&imagesflags.tagTransform, deleteCmd.Flags())
+	deleteCmd.Flags().StringVar(
+		&imagesflags.fromTar, "from-tar", "",
+		"If set, delete exactly the images in this tar, as written by download, instead of those of the Kubernetes version. Its manifest is read; nothing is loaded.",
+	)
+
+	markFlagsExclusive(deleteCmd,
+		[]string{registryMapFileFlag, e2eRegistryConfigFlag},
+		[]string{"from-tar", kubernetesVersionFlag},
+		[]string{"from-tar", e2eRegistryConfigFlag},
+		[]string{"from-tar", registryMapFileFlag},
+		[]string{"from-tar", imagesFlag},
+		[]string{"from-tar", excludeFlag},
+	)
+
+	// Diff command
+	diffCmd := &cobra.Command{
+		Use:   "diff",
+		Short: "Compares images in the docker registry for a specific plugin against upstream",
+		RunE:  runImages(diffImages),
+		Args:  cobra.ExactArgs(0),
+	}
+	AddE2ERegistryConfigFlag(&imagesflags.e2eRegistryConfig, diffCmd.Flags())
+	AddKubeconfigFlag(&imagesflags.kubeconfig, diffCmd.Flags())
+	AddKubernetesVersionFlag(&imagesflags.kubernetesVersion, diffCmd.Flags())
+	AddForceVersionFlag(&imagesflags.forceVersion, diffCmd.Flags())
+	AddImageSnapshotFlag(&imagesflags.imageSnapshot, diffCmd.Flags())
+	AddPluginFlag(&imagesflags.plugin, diffCmd.Flags())
+	AddRegistryMapFileFlag(&imagesflags.registryMapFile, diffCmd.Flags())
+	AddTagTransformFlag(&imagesflags.tagTransform, diffCmd.Flags())
+
+	markFlagsExclusive(diffCmd,
+		[]string{imageSnapshotFlag, kubernetesVersionFlag},
+		[]string{registryMapFileFlag, e2eRegistryConfigFlag},
+	)
+
+	// Resolve command
+	resolveCmd := &cobra.Command{
+		Use:   "resolve",
+		Short: "Shows where each image for a specific plugin would be mirrored to, without contacting docker or any registry",
+		RunE:  runImages(resolveImages),
+		Args:  cobra.ExactArgs(0),
+	}
+	AddE2ERegistryConfigFlag(&imagesflags.e2eRegistryConfig, resolveCmd.Flags())
+	AddKubeconfigFlag(&imagesflags.kubeconfig, resolveCmd.Flags())
+	AddKubernetesVersionFlag(&imagesflags.kubernetesVersion, resolveCmd.Flags())
+	AddForceVersionFlag(&imagesflags.forceVersion, resolveCmd.Flags())
+	AddPluginFlag(&imagesflags.plugin, resolveCmd.Flags())
+	AddRegistryMapFileFlag(&imagesflags.registryMapFile, resolveCmd.Flags())
+	AddTagTransformFlag(&imagesflags.tagTransform, resolveCmd.Flags())
+
+	markFlagsExclusive(resolveCmd,
+		[]string{registryMapFileFlag, e2eRegistryConfigFlag},
+	)
+
+	// Summary command
+	summaryCmd := &cobra.Command{
+		Use:   "summary",
+		Short: "Shows how many images for a specific plugin come from each registry",
+		RunE:  runImages(summarizeImages),
+		Args:  cobra.ExactArgs(0),
+	}
+	AddKubeconfigFlag(&imagesflags.kubeconfig, summaryCmd.Flags())
+	AddKubernetesVersionFlag(&imagesflags.kubernetesVersion, summaryCmd.Flags())
+	AddForceVersionFlag(&imagesflags.forceVersion, summaryCmd.Flags())
+	AddImageSnapshotFlag(&imagesflags.imageSnapshot, summaryCmd.Flags())
+	AddPluginFlag(&imagesflags.plugin, summaryCmd.Flags())
+	AddExcludeFlag(&imagesflags.excludes, summaryCmd.Flags())
+	AddImagesFlag(&imagesflags.includes, summaryCmd.Flags())
+	summaryCmd.Flags().BoolVar(
+		&imagesflags.showSize, "show-size", false,
+		"If true, also show the total size of each registry's images, as present in the local docker client.",
+	)
+
+	markFlagsExclusive(summaryCmd,
+		[]string{imageSnapshotFlag, kubernetesVersionFlag},
+	)
+
+	// Load command
+	loadCmd := &cobra.Command{
+		Use:   "load",
+		Short: "Loads images exported with download into the local docker client",
+		RunE:  runImages(loadImages),
+		Args:  cobra.ExactArgs(0),
+	}
+	loadCmd.Flags().StringVar(
+		&imagesflags.fromDir, "from-dir", "",
+		"The directory the images were exported to with download --output-dir.",
+	)
+	loadCmd.Flags().StringVar(
+		&imagesflags.input, "input", "",
+		"The tar the images were exported to with download.",
+	)
+	loadCmd.Flags().StringVar(
+		&imagesflags.checksum, "checksum", "",
+		"The expected SHA-256 checksum of --input; if not set, the .sha256 file download writes beside the tar is used when present.",
+	)
+	AddTarRateLimitFlag(&imagesflags.tarRateLimit, loadCmd.Flags())
+
+	markFlagsExclusive(loadCmd,
+		[]string{"from-dir", "input"},
+	)
+
+	// Validate-tar command
+	validateTarCmd := &cobra.Command{
+		Use:   "validate-tar <file>",
+		Short: "Checks a tar written by download is a well-formed docker archive and lists its images, without loading it",
+		RunE:  runImages(validateTar),
+		Args:  cobra.ExactArgs(1),
+	}
+
+	// GC command
+	gcCmd := &cobra.Command{
+		Use:   "gc",
+		Short: "Removes dangling (untagged) images left in the local docker client by mirroring",
+		RunE:  runImages(gcImages),
+		Args:  cobra.ExactArgs(0),
+	}
+	gcCmd.Flags().BoolVar(
+		&imagesflags.dryRun, "dry-run", false,
+		"If true, only list the dangling images and the space removing them would reclaim.",
+	)
+
+	// Login command
+	loginCmd := &cobra.Command{
+		Use:   "login",
+		Short: "Stores credentials for a docker registry so later pushes reuse them",
+		RunE:  runImages(login),
+		Args:  cobra.ExactArgs(0),
+	}
+	loginCmd.Flags().StringVar(
+		&imagesflags.registry, "registry", "",
+		"The registry host to log in to (e.g. 'registry.corp.example:5000').",
+	)
+	loginCmd.Flags().StringVar(
+		&imagesflags.username, "username", "",
+		"The username to log in with.",
+	)
+	loginCmd.Flags().BoolVar(
+		&imagesflags.passwordStdin, "password-stdin", false,
+		"If true, read the password from stdin instead of prompting for it.",
+	)
+	loginCmd.MarkFlagRequired("registry")
+	loginCmd.MarkFlagRequired("username")
+
+	// Logout command
+	logoutCmd := &cobra.Command{
+		Use:   "logout",
+		Short: "Removes the stored credentials for a docker registry",
+		RunE:  runImages(logout),
+		Args:  cobra.ExactArgs(0),
+	}
+	logoutCmd.Flags().StringVar(
+		&imagesflags.registry, "registry", "",
+		"The registry host to log out of.",
+	)
+	logoutCmd.MarkFlagRequired("registry")
 
 	cmd.AddCommand(pullCmd)
 	cmd.AddCommand(pushCmd)
 	cmd.AddCommand(downloadCmd)
 	cmd.AddCommand(deleteCmd)
+	cmd.AddCommand(diffCmd)
+	cmd.AddCommand(resolveCmd)
+	cmd.AddCommand(summaryCmd)
+	cmd.AddCommand(loadCmd)
+	cmd.AddCommand(validateTarCmd)
+	cmd.AddCommand(gcCmd)
+	cmd.AddCommand(loginCmd)
+	cmd.AddCommand(logoutCmd)
 
 	return cmd
 }
 
-func listImages(cmd *cobra.Command, args []string) {
-
-	switch imagesflags.plugin {
-	case "e2e":
+// runImages adapts an images subcommand handler to cobra's RunE. Errors the handler
+// returns are logged, each error of an aggregate separately, and then returned so
+// that the process exits non-zero. Cobra's own reporting is silenced for them, since
+// they aren't usage errors.
+func runImages(run func(cmd *cobra.Command, args []string) error) func(cmd *cobra.Command, args []string) error {
+	return func(cmd *cobra.Command, args []string) error {
+		imageReport = image.NewReport()
+		err := run(cmd, args)
+		if imagesCtx.Err() != nil {
+			// Whatever the operation in flight failed with, it was because it was interrupted
+			err = image.ErrCanceled
+		}
+		if writeErr := writeImageResults(imagesflags.outputFile); writeErr != nil {
+			err = utilerrors.Flatten(utilerrors.NewAggregate([]error{err, writeErr}))
+		}
+		writeImageReport()
+		if err == nil {
+			return nil
+		}
 
-		if len(imagesflags.e2eRegistryConfig) > 0 {
-			// Check if the e2e file exists
-			if _, err := os.Stat(imagesflags.e2eRegistryConfig); err != nil {
-				errlog.LogError(errors.Errorf("file does not exist or cannot be opened: %v", imagesflags.e2eRegistryConfig))
-				os.Exit(1)
+		cleanupRegistryAuth()
+		cmd.SilenceErrors = true
+		cmd.SilenceUsage = true
+		if agg, ok := err.(utilerrors.Aggregate); ok {
+			for _, e := range agg.Errors() {
+				errlog.LogError(e)
 			}
+		} else {
+			errlog.LogError(err)
 		}
+		return err
+	}
+}
 
-		cfg, err := imagesflags.kubeconfig.Get()
-		if err != nil {
-			errlog.LogError(errors.Wrap(err, "couldn't get REST client"))
-			os.Exit(1)
+// handleInterrupts cancels imagesCtx on the first SIGINT or SIGTERM, so the command
+// stops after cleaning up the operation in flight. The process exits once
+// interruptCleanupTimeout has passed, or at once on a second signal.
+func handleInterrupts() {
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-signals
+		logrus.Warning("Cancelling; interrupt again to exit without cleaning up")
+		cancelImages()
+		select {
+		case <-signals:
+		case <-time.After(interruptCleanupTimeout):
 		}
+		cleanupRegistryAuth()
+		os.Exit(130)
+	}()
+}
 
-		sbc, err := getSonobuoyClient(cfg)
+// setupImages checks the flags given to an images subcommand, configures logging
+// and handles interrupts
+func setupImages(cmd *cobra.Command, args []string) error {
+	handleInterruptsOnce.Do(handleInterrupts)
+	if err := checkCommandExclusiveFlags(cmd); err != nil {
+		return err
+	}
+	if err := setRepoConfigMapClient(&imagesflags.kubeconfig, imagesflags.e2eRegistryConfig); err != nil {
+		return err
+	}
+	if len(imagesflags.registryAuthFile) > 0 {
+		// The docker CLI and registry.DockerConfigPath both read credentials from $DOCKER_CONFIG
+		dir, cleanup, err := registry.DockerConfigDir(imagesflags.registryAuthFile)
 		if err != nil {
-			errlog.LogError(errors.Wrap(err, "could not create sonobuoy client"))
-			os.Exit(1)
+			return errors.Wrap(err, "invalid --registry-auth-file")
 		}
+		cleanupRegistryAuth = cleanup
+		os.Setenv("DOCKER_CONFIG", dir)
+	}
 
-		version, err := sbc.Version()
-		if err != nil {
-			errlog.LogError(errors.Wrap(err, "couldn't get Sonobuoy client"))
-			os.Exit(1)
+	if len(imagesflags.tarRateLimit) > 0 {
+		var limit datasize.ByteSize
+		if err := limit.UnmarshalText([]byte(imagesflags.tarRateLimit)); err != nil || limit == 0 {
+			return errors.Errorf("invalid --tar-rate-limit %q, expected a size per second such as 10MB", imagesflags.tarRateLimit)
 		}
+		imagesflags.tarRateLimitBytes = int64(limit.Bytes())
+	}
 
-		// Get list of images that match the version
-		registry, err := image.NewRegistryList("", version)
+	if len(imagesflags.sort) > 0 {
+		order, err := image.ParseSortOrder(imagesflags.sort)
 		if err != nil {
-			errlog.LogError(errors.Wrap(err, "couldn't init Registry List"))
-			os.Exit(1)
+			return errors.Wrap(err, "invalid --sort")
 		}
+		imagesflags.sortOrder = order
+	}
 
-		images, err := registry.GetImageConfigs()
-		if err != nil {
-			errlog.LogError(errors.Wrap(err, "couldn't get images for version"))
-			os.Exit(1)
-		}
+	retries, err := registry.ParseRetries(imagesflags.timeoutRetries)
+	if err != nil {
+		return errors.Wrap(err, "invalid --registry-timeout-retries")
+	}
+	imagesflags.retries = retries
+	if imagesflags.dockerRetries < 0 {
+		return errors.Errorf("invalid --docker-retries %d, expected 0 or more", imagesflags.dockerRetries)
+	}
+
+	targetOS, err := resolveTargetOS(imagesflags.targetOS, cmd.Flags().Changed("os"), append([]string{imagesflags.platform}, imagesflags.platforms...))
+	if err != nil {
+		return err
+	}
+	image.TargetOS = targetOS
+
+	switch imagesflags.progress {
+	case progressAuto, progressPlain:
+	case progressNone:
+		logrus.SetLevel(logrus.WarnLevel)
+	default:
+		return errors.Errorf("unsupported progress %q, expected %v, %v or %v", imagesflags.progress, progressAuto, progressPlain, progressNone)
+	}
+	if imagesflags.summaryOnly {
+		logrus.SetLevel(logrus.WarnLevel)
+	}
 
-		for _, v := range images {
-			fmt.Println(v.GetE2EImage())
+	switch imagesflags.logFormat {
+	case logFormatText:
+		if imagesflags.progress == progressPlain || colorDisabled(imagesflags.noColor, os.Getenv) {
+			logrus.SetFormatter(&logrus.TextFormatter{DisableColors: true})
 		}
+	case logFormatJSONL:
+		logrus.SetFormatter(&logrus.JSONFormatter{})
+		logrus.SetOutput(os.Stdout)
 	default:
-		errlog.LogError(errors.Errorf("Unsupported plugin: %v", imagesflags.plugin))
-		os.Exit(1)
+		return errors.Errorf("unsupported log format %q, expected %v or %v", imagesflags.logFormat, logFormatText, logFormatJSONL)
 	}
+	return nil
 }
 
-func pullImages(cmd *cobra.Command, args []string) {
+func listImages(cmd *cobra.Command, args []string) error {
+	if len(imagesflags.namespace) > 0 {
+		return listRunImages()
+	}
+
 	switch imagesflags.plugin {
-	case "e2e":
+	case e2ePluginName, systemdLogsPluginName, allPluginsName:
 
-		cfg, err := imagesflags.kubeconfig.Get()
-		if err != nil {
-			errlog.LogError(errors.Wrap(err, "couldn't get REST client"))
-			os.Exit(1)
+		if len(imagesflags.e2eRegistryConfig) > 0 {
+			// Check the e2e repo-config can be read before doing any work
+			if _, err := image.ReadRepoConfig(imagesflags.e2eRegistryConfig); err != nil {
+				return err
+			}
 		}
 
-		sbc, err := getSonobuoyClient(cfg)
+		version, err := getPluginVersion()
 		if err != nil {
-			errlog.LogError(errors.Wrap(err, "could not create sonobuoy client"))
-			os.Exit(1)
+			return err
 		}
 
-		version, err := sbc.Version()
+		// Get list of images that match the version
+		images, err := getUpstreamImages(version)
 		if err != nil {
-			errlog.LogError(errors.Wrap(err, "couldn't get Sonobuoy client"))
-			os.Exit(1)
+			return err
+		}
+		if err := writeRepoConfigOut(version); err != nil {
+			return err
 		}
 
-		upstreamImages, err := image.GetImages(defaultE2ERegistries, version)
-		if err != nil {
-			errlog.LogError(errors.Wrap(err, "couldn't init upstream registry list"))
-			os.Exit(1)
+		if len(imagesflags.sinceVersion) > 0 {
+			baseline, err := getUpstreamImages(imagesflags.sinceVersion)
+			if err != nil {
+				return errors.Wrapf(err, "couldn't get images for --since-version %v", imagesflags.sinceVersion)
+			}
+			images = image.AddedImages(baseline, images)
 		}
 
-		// Init client
-		imageClient := image.NewImageClient()
+		if err := checkMutableTags(images, imagesflags.strict); err != nil {
+			return err
+		}
 
-		// Pull all images
-		errs := imageClient.PullImages(upstreamImages, numDockerRetries)
-		for _, err := range errs {
-			errlog.LogError(err)
+		if imagesflags.checkPublished {
+			warnUnpublished(images)
+		}
+
+		switch imagesflags.output {
+		case "text":
+			lines, _ := listedImages(images, false)
+			switch {
+			case imagesflags.tagsOnly:
+				lines, err = referenceComponents(lines, func(ref registry.Reference) string { return ref.Tag })
+			case imagesflags.reposOnly:
+				lines, err = referenceComponents(lines, registry.Reference.Name)
+			}
+			if err != nil {
+				return err
+			}
+			for _, line := range lines {
+				fmt.Println(line)
+			}
+		case "json":
+			if len(imagesflags.sortOrder) > 0 {
+				return errors.New("--sort doesn't apply to -o json, where the images are keyed by name")
+			}
+			if err := image.NewSnapshot(version, images).Write(os.Stdout); err != nil {
+				return err
+			}
+		case "table":
+			refs, sizes := listedImages(images, imagesflags.showSize)
+			if !imagesflags.showSize {
+				sizes = nil
+			}
+			if err := writeImageTable(os.Stdout, refs, sizes); err != nil {
+				return err
+			}
+		default:
+			return errors.Errorf("Unsupported output format: %v", imagesflags.output)
 		}
+		return nil
+	default:
+		return errors.Errorf("Unsupported plugin: %v", imagesflags.plugin)
+	}
+}
 
+// listRunImages lists the images of the sonobuoy run in the namespace given by --namespace
+func listRunImages() error {
+	client, err := getClient(&imagesflags.kubeconfig)
+	if err != nil {
+		return errors.Wrap(err, "couldn't get a cluster client")
+	}
+	images, err := image.RunImages(client.CoreV1(), imagesflags.namespace)
+	if err != nil {
+		return err
+	}
+
+	switch imagesflags.output {
+	case "text":
+		seen := map[string]bool{}
+		refs := []string{}
+		for _, img := range images {
+			if !seen[img.Image] {
+				seen[img.Image] = true
+				refs = append(refs, img.Image)
+			}
+		}
+		sort.Strings(refs)
+		for _, ref := range refs {
+			fmt.Println(ref)
+		}
+	case "json":
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return errors.Wrap(enc.Encode(images), "couldn't encode run images")
+	case "table":
+		w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+		fmt.Fprintln(w, "POD\tCONTAINER\tIMAGE\tIMAGE ID")
+		for _, img := range images {
+			id := img.ImageID
+			if id == "" {
+				id = "-"
+			}
+			fmt.Fprintf(w, "%v\t%v\t%v\t%v\n", img.Pod, img.Container, img.Image, id)
+		}
+		return w.Flush()
 	default:
-		errlog.LogError(errors.Errorf("Unsupported plugin: %v", imagesflags.plugin))
-		os.Exit(1)
+		return errors.Errorf("Unsupported output format: %v", imagesflags.output)
 	}
+	return nil
 }
 
-func downloadImages(cmd *cobra.Command, args []string) {
+func pullImages(cmd *cobra.Command, args []string) error {
 	switch imagesflags.plugin {
-	case "e2e":
+	case e2ePluginName, systemdLogsPluginName:
 
-		cfg, err := imagesflags.kubeconfig.Get()
+		version, err := getPluginVersion()
 		if err != nil {
-			errlog.LogError(errors.Wrap(err, "couldn't get REST client"))
-			os.Exit(1)
+			return err
 		}
 
-		sbc, err := getSonobuoyClient(cfg)
+		upstreamImages, err := getUpstreamImages(version)
 		if err != nil {
-			errlog.LogError(errors.Wrap(err, "could not create sonobuoy client"))
-			os.Exit(1)
+			return errors.Wrap(err, "couldn't init upstream registry list")
 		}
 
-		version, err := sbc.Version()
-		if err != nil {
-			errlog.LogError(errors.Wrap(err, "couldn't get Sonobuoy client"))
-			os.Exit(1)
+		if err := checkMutableTags(upstreamImages, imagesflags.strict); err != nil {
+			return err
 		}
 
-		upstreamImages, err := image.GetImages(defaultE2ERegistries, version)
-		if err != nil {
-			errlog.LogError(errors.Wrap(err, "couldn't init upstream registry list"))
-			os.Exit(1)
+		if imagesflags.manifestOnly {
+			return checkManifests(upstreamImages)
+		}
+
+		if len(imagesflags.targetRegistry) > 0 {
+			targets := image.RetargetRegistry(upstreamImages, imagesflags.targetRegistry)
+			if err := image.CheckAllowedRegistries(upstreamImages, targets, imagesflags.allowedRegistries); err != nil {
+				return err
+			}
 		}
 
-		images := []string{}
-		for _, v := range upstreamImages {
-			images = append(images, v.GetE2EImage())
+		if len(imagesflags.e2eRegistryConfig) > 0 {
+			upstreamImages, err = image.WithImageOverrides(upstreamImages, imagesflags.e2eRegistryConfig)
+			if err != nil {
+				return err
+			}
 		}
 
 		// Init client
-		imageClient := image.NewImageClient()
-
-		fileName, err := imageClient.DownloadImages(images, version)
+		timings, progress := newTimingRecorder()
+		imageClient, err := withParallel(newImageClient(progress...).WithAuthRefs(os.Getenv), func(l docker.DaemonLimits) int { return l.MaxConcurrentDownloads })
 		if err != nil {
-			errlog.LogError(err)
-			os.Exit(1)
+			return err
+		}
+		imageClient, err = withTemporaryLogins(imageClient)
+		if err != nil {
+			return err
+		}
+
+		if len(imagesflags.dockerHubUsername) > 0 {
+			token := imagesflags.dockerHubToken
+			if len(token) == 0 {
+				token = os.Getenv("SONOBUOY_DOCKER_HUB_TOKEN")
+			}
+			if err := imageClient.LoginForCommand(registry.DefaultHost, imagesflags.dockerHubUsername, token); err != nil {
+				return err
+			}
+		}
+
+		if len(imagesflags.upstreamAuth) > 0 {
+			creds, err := image.ParseUpstreamAuth(imagesflags.upstreamAuth, os.Getenv)
+			if err != nil {
+				return errors.Wrap(err, "invalid --upstream-auth")
+			}
+			imageClient = imageClient.WithPullCredentials(creds)
+		}
+
+		if imagesflags.verifySignature {
+			if len(imagesflags.cosignKey) == 0 {
+				return errors.New("--verify-signature requires --cosign-key")
+			}
+			if _, err := os.Stat(imagesflags.cosignKey); err != nil {
+				return errors.Wrap(err, "invalid --cosign-key")
+			}
+			verifier := image.CosignVerifier{Key: imagesflags.cosignKey}
+			if err := verifier.Check(); err != nil {
+				return errors.Wrap(err, "--verify-signature")
+			}
+			imageClient = imageClient.WithSignatureVerifier(verifier)
+		}
+
+		if len(imagesflags.pullMirrors) > 0 {
+			mirrors, err := image.ParseRegistryRewrites(imagesflags.pullMirrors)
+			if err != nil {
+				return errors.Wrap(err, "invalid --pull-mirror")
+			}
+			imageClient = imageClient.WithPullMirrors(mirrors)
+		}
+
+		if len(imagesflags.outputDir) > 0 {
+			imageClient = imageClient.WithExportDir(imagesflags.outputDir)
+		}
+
+		// Pull all images
+		pullOpts := docker.PullOptions{AllTags: imagesflags.allTags, Platform: imagesflags.platform}
+		pulled, errs := imageClient.PullImages(upstreamImages, pullOpts, imagesflags.dockerRetries)
+		for _, r := range pulled {
+			fmt.Fprintf(resultsOut(), "pulled %v (id=%v, size=%v)\n", r.Image, r.ID, datasize.ByteSize(r.Size).HumanReadable())
+		}
+		if timings != nil {
+			timings.WriteSummary(resultsOut())
+		}
+		if rateLimited(errs) {
+			logrus.Warningf("Pulls were refused by a registry rate limit. Docker Hub limits anonymous pulls; authenticate with --docker-hub-username and $SONOBUOY_DOCKER_HUB_TOKEN, or 'sonobuoy images login --registry %v', to raise the limit.", registry.DefaultHost)
+		}
+
+		if len(imagesflags.outputDir) > 0 {
+			fmt.Fprintln(resultsOut(), filepath.Join(imagesflags.outputDir, image.IndexFileName))
 		}
 
-		fmt.Println(fileName)
+		if len(imagesflags.targetRegistry) > 0 && !(imagesflags.failFast && len(errs) > 0) {
+			errs = append(errs, pushToTargetRegistry(imageClient, upstreamImages)...)
+		}
+		return utilerrors.NewAggregate(errs)
 
 	default:
-		errlog.LogError(errors.Errorf("Unsupported plugin: %v", imagesflags.plugin))
-		os.Exit(1)
+		return errors.Errorf("Unsupported plugin: %v", imagesflags.plugin)
 	}
 }
 
-func pushImages(cmd *cobra.Command, args []string) {
-
-	switch imagesflags.plugin {
-	case "e2e":
+func downloadImages(cmd *cobra.Command, args []string) error {
+	if imagesflags.conformanceOnly && imagesflags.plugin != e2ePluginName {
+		return errors.Errorf("--%v only applies to the %v plugin", conformanceOnlyFlag, e2ePluginName)
+	}
 
-		if len(imagesflags.e2eRegistryConfig) > 0 {
-			// Check if the e2e file exists
-			if _, err := os.Stat(imagesflags.e2eRegistryConfig); err != nil {
-				errlog.LogError(errors.Errorf("file does not exist or cannot be opened: %v", imagesflags.e2eRegistryConfig))
-				os.Exit(1)
-			}
+	if len(imagesflags.kubernetesVersions) > 0 {
+		if imagesflags.plugin != e2ePluginName {
+			return errors.Errorf("--%v only applies to the %v plugin", kubernetesVersionsFlag, e2ePluginName)
 		}
+		return downloadVersions()
+	}
 
-		// Check if the e2e file exists
-		if _, err := os.Stat(imagesflags.e2eRegistryConfig); os.IsNotExist(err) {
-			errlog.LogError(errors.Errorf("file does not exist or cannot be opened: %v", imagesflags.e2eRegistryConfig))
-			os.Exit(1)
+	var dest image.Destination
+	if len(imagesflags.dest) > 0 {
+		var err error
+		if dest, err = image.ParseDestination(imagesflags.dest); err != nil {
+			return errors.Wrapf(err, "invalid --%v", destFlag)
 		}
+		if dest.Format == image.DestinationOCI && len(imagesflags.pipeThrough) > 0 {
+			return errors.Errorf("--pipe-through can't be combined with an oci:// --%v", destFlag)
+		}
+	}
+
+	switch imagesflags.plugin {
+	case e2ePluginName, systemdLogsPluginName:
 
-		cfg, err := imagesflags.kubeconfig.Get()
+		version, err := getPluginVersion()
 		if err != nil {
-			errlog.LogError(errors.Wrap(err, "couldn't get REST client"))
-			os.Exit(1)
+			return err
 		}
 
-		sbc, err := getSonobuoyClient(cfg)
+		upstreamImages, err := getUpstreamImages(version)
 		if err != nil {
-			errlog.LogError(errors.Wrap(err, "could not create sonobuoy client"))
-			os.Exit(1)
+			return errors.Wrap(err, "couldn't init upstream registry list")
 		}
 
-		version, err := sbc.Version()
+		images := image.UniqueImages(upstreamImages)
+
+		layout, err := downloadLayout(version, dest)
 		if err != nil {
-			errlog.LogError(errors.Wrap(err, "couldn't get Sonobuoy client"))
-			os.Exit(1)
+			return err
+		}
+
+		// Init client
+		imageClient := newImageClient()
+		if len(imagesflags.pipeThrough) > 0 {
+			imageClient = imageClient.WithPipeThrough(imagesflags.pipeThrough)
+		}
+		if imagesflags.reproducible {
+			imageClient = imageClient.WithReproducible()
+		}
+
+		if imagesflags.tolerateMissing {
+			var missing []string
+			images, missing, err = imageClient.PresentImages(images)
+			if err != nil {
+				return err
+			}
+			for _, img := range missing {
+				logrus.Warningf("Skipping image %v, which isn't present locally", img)
+			}
+			if len(images) == 0 {
+				return errors.New("none of the images are present locally")
+			}
+		}
+
+		if imagesflags.dryRun {
+			return planDownload(imageClient, images, version, layout)
+		}
+
+		if len(imagesflags.platforms) > 0 {
+			lists, errs := imageClient.PullPlatforms(upstreamImages, imagesflags.platforms, imagesflags.dockerRetries)
+			if len(errs) > 0 {
+				return utilerrors.NewAggregate(errs)
+			}
+			images = lists.Images()
+
+			listsPath := filepath.Join(imagesflags.outputDir, image.ManifestListsFileName(version))
+			if err := lists.Write(listsPath); err != nil {
+				return err
+			}
+			fmt.Fprintln(resultsOut(), listsPath)
+		}
+
+		switch {
+		case len(layout.Dir) > 0:
+			idx, errs := imageClient.DownloadImagesToDir(images, layout.Dir)
+
+			var written int64
+			for _, entry := range idx {
+				if info, err := os.Stat(filepath.Join(layout.Dir, entry.File)); err == nil {
+					written += info.Size()
+				}
+			}
+			fmt.Fprintln(resultsOut(), filepath.Join(layout.Dir, image.IndexFileName))
+			printBytes(writtenLabel, written)
+			return utilerrors.NewAggregate(errs)
+
+		case len(dest.Path) > 0:
+			written, err := imageClient.DownloadImagesTo(images, dest)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintln(resultsOut(), written)
+			printBytes(writtenLabel, pathSize(written))
+			return nil
+
+		case layout.MaxSize > 0:
+			idx, errs := imageClient.DownloadImagesSplit(images, version, layout.MaxSize)
+			files := map[string]bool{}
+			for _, entry := range idx {
+				files[entry.File] = true
+			}
+			var written int64
+			for _, fileName := range sortedFileNames(files) {
+				fmt.Fprintln(resultsOut(), fileName)
+				if info, err := os.Stat(fileName); err == nil {
+					written += info.Size()
+				}
+			}
+			fmt.Fprintln(resultsOut(), image.IndexFileName)
+			printBytes(writtenLabel, written)
+			return utilerrors.NewAggregate(errs)
 		}
 
-		upstreamImages, err := image.GetImages("", version)
+		var fileNames []string
+		switch {
+		case len(layout.FileName) > 0:
+			var fileName string
+			fileName, err = imageClient.DownloadImagesToFile(images, layout.FileName)
+			fileNames = []string{fileName}
+		case layout.BatchSize > 0:
+			fileNames, err = imageClient.DownloadImageBatches(images, version, layout.BatchSize)
+		default:
+			var fileName string
+			fileName, err = imageClient.DownloadImages(images, version)
+			fileNames = []string{fileName}
+		}
 		if err != nil {
-			errlog.LogError(errors.Wrap(err, "couldn't init upstream registry list"))
-			os.Exit(1)
+			return err
+		}
+
+		var written int64
+		for _, fileName := range fileNames {
+			fmt.Fprintln(resultsOut(), fileName)
+			if info, err := os.Stat(fileName); err == nil {
+				written += info.Size()
+			}
 		}
+		printBytes(writtenLabel, written)
+		return nil
 
-		privateImages, err := image.GetImages(imagesflags.e2eRegistryConfig, version)
+	default:
+		return errors.Errorf("Unsupported plugin: %v", imagesflags.plugin)
+	}
+}
+
+// planDownload prints the images download would save, their total size and the
+// files they'd be saved to in layout, without saving them.
+func planDownload(imageClient image.ImageClient, images []string, version string, layout image.PlanOptions) error {
+	plan := imageClient.PlanDownload(images, version, layout)
+	plan.Write(os.Stdout)
+	if missing := plan.Missing(); len(missing) > 0 {
+		return errors.Errorf("%d images aren't present locally and couldn't be saved: %v", len(missing), strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// downloadLayout returns how download saves the images, as chosen by its flags:
+// to --output-dir, to --dest, split by --split-size, to the systemd-logs or
+// conformance tar, in batches of --batch-size, or to the default tar, in that
+// order. Only the option of the chosen layout is set. Both download and its
+// --dry-run plan use it, so the plan matches what download does.
+func downloadLayout(version string, dest image.Destination) (image.PlanOptions, error) {
+	switch {
+	case len(imagesflags.outputDir) > 0:
+		return image.PlanOptions{Dir: imagesflags.outputDir}, nil
+	case len(dest.Path) > 0:
+		return image.PlanOptions{FileName: dest.Path}, nil
+	case len(imagesflags.splitSize) > 0:
+		if imagesflags.plugin == systemdLogsPluginName {
+			return image.PlanOptions{}, errors.Errorf("--split-size isn't supported for the %v images", systemdLogsPluginName)
+		}
+		size, err := parseSplitSize()
 		if err != nil {
-			errlog.LogError(errors.Wrap(err, "couldn't init upstream registry list"))
-			os.Exit(1)
+			return image.PlanOptions{}, err
 		}
+		return image.PlanOptions{MaxSize: size}, nil
+	case imagesflags.plugin == systemdLogsPluginName:
+		if imagesflags.batchSize > 0 {
+			return image.PlanOptions{}, errors.Errorf("--batch-size isn't supported for the %v images", systemdLogsPluginName)
+		}
+		return image.PlanOptions{FileName: systemdLogsTarFileName}, nil
+	case imagesflags.conformanceOnly:
+		return image.PlanOptions{FileName: conformanceTarFileName(version)}, nil
+	default:
+		return image.PlanOptions{BatchSize: imagesflags.batchSize}, nil
+	}
+}
 
-		// Init client
-		imageClient := image.NewImageClient()
+// parseSplitSize returns the bytes of --split-size
+func parseSplitSize() (int64, error) {
+	var size datasize.ByteSize
+	if err := size.UnmarshalText([]byte(imagesflags.splitSize)); err != nil || size == 0 {
+		return 0, errors.Errorf("invalid --split-size %q, expected a size such as 4000MB", imagesflags.splitSize)
+	}
+	if size >= fat32FileLimit {
+		logrus.Warningf("--split-size %v is 4GB or more, too large for files on FAT32 media", imagesflags.splitSize)
+	}
+	return int64(size.Bytes()), nil
+}
 
-		// Push all images
-		errs := imageClient.PushImages(upstreamImages, privateImages, numDockerRetries)
-		for _, err := range errs {
-			errlog.LogError(err)
+// fat32FileLimit is the size FAT32 files must be smaller than
+const fat32FileLimit = 4 * datasize.GB
+
+// listedImages returns the unique references of images in the --sort order, and
+// their sizes in the local docker client if withSizes is set or they're sorted by size.
+func listedImages(images map[string]image.Config, withSizes bool) ([]string, map[string]int64) {
+	refs := image.UniqueImages(images)
+	var sizes map[string]int64
+	if withSizes || imagesflags.sortOrder == image.SortBySize {
+		sizes = newImageClient().ImageSizes(refs)
+	}
+	if len(imagesflags.sortOrder) > 0 {
+		refs = image.SortedImages(images, imagesflags.sortOrder, sizes)
+	}
+	return refs, sizes
+}
+
+// sortedFileNames returns the names in files in sorted order
+func sortedFileNames(files map[string]bool) []string {
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// pathSize returns the size of the file at p, or of every file under p if it's a directory
+func pathSize(p string) int64 {
+	var size int64
+	filepath.Walk(p, func(_ string, info os.FileInfo, err error) error {
+		if err == nil && info.Mode().IsRegular() {
+			size += info.Size()
 		}
+		return nil
+	})
+	return size
+}
 
-	default:
-		errlog.LogError(errors.Errorf("Unsupported plugin: %v", imagesflags.plugin))
-		os.Exit(1)
+// downloadVersions exports the e2e images of each version given by
+// --kubernetes-versions to its own tar, several at once if --concurrent-versions is set.
+func downloadVersions() error {
+	images := map[string][]string{}
+	versions := []string{}
+	for _, version := range imagesflags.kubernetesVersions {
+		if imagesflags.forceVersion {
+			nearest, err := image.NearestSupportedVersion(version)
+			if err != nil {
+				return err
+			}
+			if nearest != version {
+				logrus.Warningf("Kubernetes %v isn't supported; using the images of %v instead", version, nearest)
+			}
+			version = nearest
+		}
+		if _, ok := images[version]; ok {
+			continue
+		}
+
+		upstreamImages, err := getUpstreamImages(version)
+		if err != nil {
+			return errors.Wrapf(err, "couldn't init upstream registry list for %v", version)
+		}
+		images[version] = image.UniqueImages(upstreamImages)
+		versions = append(versions, version)
+	}
+
+	imageClient := newImageClient()
+	if len(imagesflags.pipeThrough) > 0 {
+		imageClient = imageClient.WithPipeThrough(imagesflags.pipeThrough)
+	}
+	if imagesflags.reproducible {
+		imageClient = imageClient.WithReproducible()
 	}
 
+	fileNames, errs := imageClient.DownloadVersions(images, imagesflags.concurrentVersions)
+
+	var written int64
+	for _, version := range versions {
+		fileName, ok := fileNames[version]
+		if !ok {
+			continue
+		}
+		fmt.Fprintln(resultsOut(), fileName)
+		if info, err := os.Stat(fileName); err == nil {
+			written += info.Size()
+		}
+	}
+	printBytes(writtenLabel, written)
+	return utilerrors.NewAggregate(errs)
 }
 
-func deleteImages(cmd *cobra.Command, args []string) {
+func pushImages(cmd *cobra.Command, args []string) error {
+
 	switch imagesflags.plugin {
-	case "e2e":
+	case e2ePluginName, systemdLogsPluginName:
+
+		switch {
+		case len(imagesflags.registryMapFile) > 0:
+		case imagesflags.plugin == e2ePluginName && len(imagesflags.e2eRegistryConfig) == 0:
+			return errors.Errorf("--%v or --%v is required to push the %v images", e2eRegistryConfigFlag, registryMapFileFlag, e2ePluginName)
+		case imagesflags.plugin == systemdLogsPluginName && len(imagesflags.registryRewrites) == 0:
+			return errors.Errorf("--registry-rewrite or --%v is required to push the %v images", registryMapFileFlag, systemdLogsPluginName)
+		}
 
-		cfg, err := imagesflags.kubeconfig.Get()
-		if err != nil {
-			errlog.LogError(errors.Wrap(err, "couldn't get REST client"))
-			os.Exit(1)
+		if len(imagesflags.e2eRegistryConfig) > 0 {
+			// Check the e2e repo-config can be read before doing any work
+			if _, err := image.ReadRepoConfig(imagesflags.e2eRegistryConfig); err != nil {
+				return err
+			}
 		}
 
-		sbc, err := getSonobuoyClient(cfg)
+		version, err := getPluginVersion()
 		if err != nil {
-			errlog.LogError(errors.Wrap(err, "could not create sonobuoy client"))
-			os.Exit(1)
+			return err
 		}
 
-		version, err := sbc.Version()
+		upstreamImages, err := getUpstreamImages(version)
 		if err != nil {
-			errlog.LogError(errors.Wrap(err, "couldn't get Sonobuoy client"))
-			os.Exit(1)
+			return errors.Wrap(err, "couldn't init upstream registry list")
 		}
 
-		images, err := image.GetImages(imagesflags.e2eRegistryConfig, version)
+		privateImages, err := getPrivateImages(version)
 		if err != nil {
-			errlog.LogError(errors.Wrap(err, "couldn't init registry list"))
-			os.Exit(1)
+			return errors.Wrap(err, "couldn't init private registry list")
+		}
+		if err := writeRepoConfigOut(version); err != nil {
+			return err
+		}
+
+		if err := image.CheckAllowedRegistries(upstreamImages, privateImages, imagesflags.allowedRegistries); err != nil {
+			return err
+		}
+
+		if imagesflags.manifestOnly {
+			return checkManifests(privateImages)
+		}
+		if len(imagesflags.platforms) > 0 && !imagesflags.manifestListOnly {
+			return errors.New("--platform only applies to push with --manifest-list-only")
 		}
 
 		// Init client
-		imageClient := image.NewImageClient()
+		timings, progress := newTimingRecorder()
+		imageClient, err := withTemporaryLogins(newImageClient(progress...).WithAuthRefs(os.Getenv))
+		if err != nil {
+			return err
+		}
+		if len(imagesflags.authRefreshCmd) > 0 {
+			imageClient = imageClient.WithAuthRefresher(image.CommandAuthRefresher{Command: imagesflags.authRefreshCmd})
+		}
+		if imagesflags.createRepos {
+			registryClient, err := newRegistryClient()
+			if err != nil {
+				return err
+			}
+			imageClient = imageClient.WithRepoCreators(image.ECRRepoCreator{}, image.HarborRepoCreator{Client: registryClient})
+		}
+		imageClient, err = withParallel(imageClient, func(l docker.DaemonLimits) int { return l.MaxConcurrentUploads })
+		if err != nil {
+			return err
+		}
+		var concurrency *image.ConcurrencyRecorder
+		if imagesflags.concurrencyReport {
+			concurrency = image.NewConcurrencyRecorder()
+			imageClient = imageClient.WithConcurrencyRecorder(concurrency)
+		}
 
-		errs := imageClient.DeleteImages(images, numDockerRetries)
-		for _, err := range errs {
-			errlog.LogError(err)
+		// Push all images
+		var pushed []docker.PushResult
+		var errs []error
+		if imagesflags.manifestListOnly {
+			errs = imageClient.PushManifestListsOnly(upstreamImages, privateImages, imagesflags.platforms, imagesflags.dockerRetries)
+		} else if len(imagesflags.manifestLists) > 0 {
+			lists, err := image.ReadManifestLists(imagesflags.manifestLists)
+			if err != nil {
+				return err
+			}
+			pushed, errs = imageClient.PushManifestLists(lists, upstreamImages, privateImages, imagesflags.dockerRetries)
+		} else {
+			pushed, errs = imageClient.PushImages(upstreamImages, privateImages, imagesflags.extraTags, imagesflags.dockerRetries)
+		}
+		for _, result := range pushed {
+			imageReport.AddBytes(result.Size)
+		}
+		if timings != nil {
+			timings.WriteSummary(resultsOut())
+		}
+		if concurrency != nil {
+			concurrency.Summary().Write(resultsOut())
 		}
 
-	default:
-		errlog.LogError(errors.Errorf("Unsupported plugin: %v", imagesflags.plugin))
-		os.Exit(1)
-	}
+		if imagesflags.untagSource {
+			errs = append(errs, imageClient.UntagSources(upstreamImages, privateImages, imagesflags.extraTags, pushed, numDockerRetries)...)
+		}
+
+		if len(imagesflags.saveManifest) > 0 {
+			// Prefer the digests reported by the registry during the push, falling
+			// back to those recorded by the local docker client.
+			digests := map[string]string{}
+			unknown := []string{}
+			for _, result := range pushed {
+				if len(result.Digest) > 0 {
+					digests[result.Image] = result.Digest
+				} else {
+					unknown = append(unknown, result.Image)
+				}
+			}
+
+			recorded, digestErrs := imageClient.GetDigests(unknown)
+			errs = append(errs, digestErrs...)
+			for img, digest := range recorded {
+				digests[img] = digest
+			}
+
+			if err := writeDigestManifest(imagesflags.saveManifest, digests); err != nil {
+				errs = append(errs, err)
+			}
+		}
+		return utilerrors.NewAggregate(errs)
+
+	default:
+		return errors.Errorf("Unsupported plugin: %v", imagesflags.plugin)
+	}
+
+}
+
+func deleteImages(cmd *cobra.Command, args []string) error {
+	if len(imagesflags.fromTar) > 0 {
+		images, err := image.ArchiveImages(imagesflags.fromTar)
+		if err != nil {
+			return err
+		}
+
+		imageClient := newImageClient()
+		return utilerrors.NewAggregate(imageClient.DeleteImageRefs(images, numDockerRetries))
+	}
+
+	switch imagesflags.plugin {
+	case e2ePluginName, systemdLogsPluginName:
+
+		version, err := getPluginVersion()
+		if err != nil {
+			return err
+		}
+
+		images, err := getPrivateImages(version)
+		if err != nil {
+			return errors.Wrap(err, "couldn't init registry list")
+		}
+
+		// Init client
+		imageClient := newImageClient()
+
+		return utilerrors.NewAggregate(imageClient.DeleteImages(images, numDockerRetries))
+
+	default:
+		return errors.Errorf("Unsupported plugin: %v", imagesflags.plugin)
+	}
+}
+
+// getClusterVersion returns the Kubernetes version to use images for, mapped to
+// the nearest supported version if --force-version is set. Only querying the
+// cluster's version requires a reachable cluster.
+func getClusterVersion() (string, error) {
+	version, err := getRequestedVersion()
+	if err != nil || !imagesflags.forceVersion {
+		return version, err
+	}
+
+	nearest, err := image.NearestSupportedVersion(version)
+	if err != nil {
+		return "", err
+	}
+	if nearest != version {
+		logrus.Warningf("Kubernetes %v isn't supported; using the images of %v instead", version, nearest)
+	}
+	return nearest, nil
+}
+
+// getRequestedVersion returns the version given by --kubernetes-version or recorded
+// in --image-snapshot, or otherwise the version of the cluster. The cluster's version
+// is cached for an hour unless --refresh is set.
+func getRequestedVersion() (string, error) {
+	if len(imagesflags.kubernetesVersion) > 0 {
+		return imagesflags.kubernetesVersion, nil
+	}
+	if len(imagesflags.imageSnapshot) > 0 {
+		snapshot, err := image.LoadSnapshot(imagesflags.imageSnapshot)
+		if err != nil {
+			return "", err
+		}
+		return snapshot.Version, nil
+	}
+
+	cfg, err := imagesflags.kubeconfig.Get()
+	if err != nil {
+		return "", errors.Wrap(err, "couldn't get REST client")
+	}
+
+	cachePath, cacheErr := versionCachePath()
+	cache := versionCache{}
+	if cacheErr == nil {
+		cache = readVersionCache(cachePath)
+		if version, ok := cache.get(cfg.Host, time.Now()); ok && !imagesflags.refreshVersion {
+			return version, nil
+		}
+	}
+
+	sbc, err := getSonobuoyClient(cfg)
+	if err != nil {
+		return "", errors.Wrap(err, "could not create sonobuoy client")
+	}
+
+	version, err := sbc.Version()
+	if err != nil {
+		return "", errors.Wrap(err, "couldn't get Sonobuoy client")
+	}
+
+	if cacheErr == nil {
+		if err := cache.write(cachePath, cfg.Host, version, time.Now()); err != nil {
+			logrus.Debugf("Couldn't cache the cluster version: %v", err)
+		}
+	}
+	return version, nil
+}
+
+// pushToTargetRegistry pushes the images present locally to --target-registry,
+// keeping their repositories and tags. Images that failed to pull are left out,
+// since their pull errors were already reported.
+func pushToTargetRegistry(imageClient image.ImageClient, upstreamImages map[string]image.Config) []error {
+	present, _, err := imageClient.PresentImages(image.UniqueImages(upstreamImages))
+	if err != nil {
+		return []error{err}
+	}
+	isPresent := map[string]bool{}
+	for _, img := range present {
+		isPresent[img] = true
+	}
+
+	sources := map[string]image.Config{}
+	for k, v := range upstreamImages {
+		if isPresent[v.GetE2EImage()] {
+			sources[k] = v
+		}
+	}
+
+	pushed, errs := imageClient.PushImages(sources, image.RetargetRegistry(sources, imagesflags.targetRegistry), nil, imagesflags.dockerRetries)
+	for _, r := range pushed {
+		fmt.Fprintf(resultsOut(), "pushed %v\n", r.Image)
+	}
+	return errs
+}
+
+// checkManifests prints whether each image's manifest exists in its registry,
+// returning an error unless they all do.
+func checkManifests(images map[string]image.Config) error {
+	registryClient, err := newRegistryClient()
+	if err != nil {
+		return err
+	}
+
+	statuses, errs := image.CheckManifests(images, registryClient)
+
+	missing := 0
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "IMAGE\tDIGEST")
+	for _, status := range statuses {
+		digest := status.Digest
+		if !status.Found {
+			digest = "missing"
+			missing++
+		}
+		fmt.Fprintf(w, "%v\t%v\n", status.Image, digest)
+	}
+	w.Flush()
+
+	if missing > 0 {
+		errs = append(errs, errors.Errorf("%d of %d images are missing from their registries", missing, len(statuses)))
+	}
+	return utilerrors.NewAggregate(errs)
+}
+
+// resolveTargetOS returns the OS to resolve images for: targetOS if it was given
+// explicitly, which every platform must be for, and otherwise the OS of the
+// platforms. Images for windows and other OSes differ, so can't be mixed.
+func resolveTargetOS(targetOS string, explicit bool, platforms []string) (string, error) {
+	windows, other := false, false
+	for _, platform := range platforms {
+		if len(platform) == 0 {
+			continue
+		}
+		platformOS := strings.Split(platform, "/")[0]
+		if explicit && platformOS != targetOS {
+			return "", errors.Errorf("--platform %v isn't for --os %v", platform, targetOS)
+		}
+		if platformOS == image.OSWindows {
+			windows = true
+		} else {
+			other = true
+		}
+	}
+	switch {
+	case explicit:
+		return targetOS, nil
+	case windows && other:
+		return "", errors.New("--platform can't mix windows with other OSes, since their images differ")
+	case windows:
+		return image.OSWindows, nil
+	}
+	return targetOS, nil
+}
+
+// writeRepoConfigOut writes the repo-config the images of the version are resolved
+// with to --e2e-repo-config-out, if it was given.
+func writeRepoConfigOut(version string) error {
+	if len(imagesflags.repoConfigOut) == 0 {
+		return nil
+	}
+	contents, err := image.EffectiveRepoConfig(imagesflags.e2eRegistryConfig, version)
+	if err != nil {
+		return err
+	}
+	return errors.Wrapf(ioutil.WriteFile(imagesflags.repoConfigOut, contents, 0644), "couldn't write %v", imagesflags.repoConfigOut)
+}
+
+// getPrivateImages returns the plugin's images as mapped by --registry-map-file
+// or mirrored by --e2e-repo-config, less any given by --exclude, with the
+// destinations --registry-rewrite and --tag-transform make of them. The
+// systemd-logs images aren't affected by the repo-config, so they are returned as
+// upstream before being rewritten.
+func getPrivateImages(version string) (map[string]image.Config, error) {
+	images, err := getMirroredImages(version)
+	if err != nil {
+		return nil, err
+	}
+
+	rewrites, err := image.ParseRegistryRewrites(imagesflags.registryRewrites)
+	if err != nil {
+		return nil, err
+	}
+	images = image.RewriteRegistries(images, rewrites)
+
+	if len(imagesflags.tagTransform) == 0 {
+		return images, nil
+	}
+	upstreamImages, err := getUpstreamImages(version)
+	if err != nil {
+		return nil, err
+	}
+	return image.TransformDestinations(upstreamImages, images, imagesflags.tagTransform)
+}
+
+// getMirroredImages returns the plugin's images as mapped by --registry-map-file
+// or mirrored by --e2e-repo-config, less any given by --exclude.
+func getMirroredImages(version string) (map[string]image.Config, error) {
+	if len(imagesflags.registryMapFile) > 0 {
+		m, err := image.LoadRegistryMap(imagesflags.registryMapFile)
+		if err != nil {
+			return nil, err
+		}
+		images, err := getUpstreamImages(version)
+		if err != nil {
+			return nil, err
+		}
+		return m.Apply(images)
+	}
+	if imagesflags.plugin == systemdLogsPluginName {
+		return getUpstreamImages(version)
+	}
+	images, err := image.GetImages(imagesflags.e2eRegistryConfig, version)
+	if err != nil {
+		return nil, err
+	}
+	images, err = withSonobuoyImage(images, imagesflags.e2eRegistryConfig)
+	if err != nil {
+		return nil, err
+	}
+	return filterImages(images)
+}
+
+// filterImages returns the images matching --images, if given, less any matching --exclude.
+func filterImages(images map[string]image.Config) (map[string]image.Config, error) {
+	images, err := image.IncludeImages(images, imagesflags.includes)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid --%v pattern", imagesFlag)
+	}
+	images, err = image.ExcludeImages(images, imagesflags.excludes)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid --%v pattern", excludeFlag)
+	}
+	return images, nil
+}
+
+// withSonobuoyImage adds the sonobuoy image to images if --include-sonobuoy-image
+// was given, as mirrored by repoConfig if set.
+func withSonobuoyImage(images map[string]image.Config, repoConfig string) (map[string]image.Config, error) {
+	if !imagesflags.includeSonobuoyImage {
+		return images, nil
+	}
+	sonobuoyImages, err := image.GetSonobuoyImages(repoConfig, imagesflags.sonobuoyImage)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range sonobuoyImages {
+		images[k] = v
+	}
+	return images, nil
+}
+
+// conformanceTarFileName returns the file the conformance image for version is downloaded to
+func conformanceTarFileName(version string) string {
+	return fmt.Sprintf("kubernetes_conformance_image_%s.tar", version)
+}
+
+// getPluginVersion returns the Kubernetes version the plugin's images depend on,
+// or an empty version for plugins whose images don't depend on it.
+func getPluginVersion() (string, error) {
+	if imagesflags.plugin == systemdLogsPluginName {
+		return "", nil
+	}
+	return getClusterVersion()
+}
+
+// getUpstreamImages returns the images pinned in --image-snapshot or listed in
+// --image-list if provided, the conformance image if --conformance-only is set,
+// otherwise the plugin's upstream images for the given version, with the images
+// they depend on if --include-deps is set. The sonobuoy image is added if
+// --include-sonobuoy-image is set, and the result filtered by --images and --exclude.
+func getUpstreamImages(version string) (map[string]image.Config, error) {
+	var images map[string]image.Config
+	var err error
+	switch {
+	case len(imagesflags.imageSnapshot) > 0:
+		images, err = image.GetImagesFromSnapshot(imagesflags.imageSnapshot)
+	case len(imagesflags.imageList) > 0:
+		images, err = image.GetImagesFromList(imagesflags.imageList)
+	case imagesflags.conformanceOnly && imagesflags.plugin == e2ePluginName:
+		images, err = image.GetConformanceImages(resolveConformanceImage(version), version)
+	case imagesflags.includeDeps:
+		images, err = image.PluginImagesWithDeps(upstreamPluginImages(version), version)
+	default:
+		images, err = upstreamPluginImages(version).Images(version)
+	}
+	if err != nil {
+		return nil, err
+	}
+	images, err = withSonobuoyImage(images, defaultE2ERegistries)
+	if err != nil {
+		return nil, err
+	}
+	return filterImages(images)
+}
+
+// upstreamPluginImages returns the provider of the upstream images of --plugin,
+// or of every plugin, for the given version.
+func upstreamPluginImages(version string) image.PluginImageProvider {
+	e2e := image.E2EPluginImages{
+		RepoConfig:            defaultE2ERegistries,
+		ConformanceRepository: resolveConformanceImage(version),
+		SonobuoyImage:         imagesflags.sonobuoyImage,
+	}
+	systemdLogs := image.SystemdLogsPluginImages{SonobuoyImage: imagesflags.sonobuoyImage}
+	switch imagesflags.plugin {
+	case systemdLogsPluginName:
+		return systemdLogs
+	case allPluginsName:
+		return image.MultiPluginImages{e2e, systemdLogs}
+	default:
+		return e2e
+	}
+}
+
+// mutableTags are the tags conventionally moved to newer images, so a reference
+// using one may resolve to a different image from one day to the next
+var mutableTags = map[string]bool{
+	"latest":  true,
+	"stable":  true,
+	"edge":    true,
+	"nightly": true,
+	"dev":     true,
+	"canary":  true,
+	"master":  true,
+	"main":    true,
+}
+
+// mutableImages returns the sorted references of images with a mutable tag.
+// Images pinned by digest aren't mutable whatever their tag.
+func mutableImages(images map[string]image.Config) []string {
+	mutable := []string{}
+	for _, img := range image.UniqueImages(images) {
+		ref, err := registry.ParseReference(img)
+		if err != nil || len(ref.Digest) > 0 {
+			continue
+		}
+		if mutableTags[strings.ToLower(ref.Tag)] {
+			mutable = append(mutable, img)
+		}
+	}
+	return mutable
+}
+
+// checkMutableTags warns about each image with a mutable tag, recommending it be
+// pinned by digest, or fails if strict is set.
+func checkMutableTags(images map[string]image.Config, strict bool) error {
+	mutable := mutableImages(images)
+	if len(mutable) == 0 {
+		return nil
+	}
+	if strict {
+		return errors.Errorf("images with mutable tags aren't allowed with --strict: %v", strings.Join(mutable, ", "))
+	}
+	for _, img := range mutable {
+		logrus.Warningf("Image %v uses a mutable tag and may change between runs; pin it by digest for reproducible results", img)
+	}
+	return nil
+}
+
+// warnUnpublished logs a warning for each image whose manifest can't be found in its registry
+func warnUnpublished(images map[string]image.Config) {
+	registryClient, err := newRegistryClient()
+	if err != nil {
+		logrus.Warningf("Couldn't check whether images are published: %v", err)
+		return
+	}
+	for _, v := range images {
+		_, err := registryClient.Digest(v.GetE2EImage())
+		switch {
+		case errors.Cause(err) == registry.ErrNotFound:
+			logrus.Warningf("Image %v is not published; pulling it will fail", v.GetE2EImage())
+		case err != nil:
+			logrus.Warningf("Couldn't check whether image %v is published: %v", v.GetE2EImage(), err)
+		}
+	}
+}
+
+// checkDestinationFlags checks that the private destinations of the images are given
+// by exactly one of --e2e-repo-config and --registry-map-file, and that a repo-config
+// can be read before doing any work.
+func checkDestinationFlags() error {
+	if len(imagesflags.registryMapFile) > 0 {
+		return nil
+	}
+	if len(imagesflags.e2eRegistryConfig) == 0 {
+		return errors.Errorf("--%v or --%v is required", e2eRegistryConfigFlag, registryMapFileFlag)
+	}
+	_, err := image.ReadRepoConfig(imagesflags.e2eRegistryConfig)
+	return err
+}
+
+func diffImages(cmd *cobra.Command, args []string) error {
+	switch imagesflags.plugin {
+	case "e2e":
+
+		if err := checkDestinationFlags(); err != nil {
+			return err
+		}
+
+		version, err := getClusterVersion()
+		if err != nil {
+			return err
+		}
+
+		upstreamImages, err := getUpstreamImages(version)
+		if err != nil {
+			return errors.Wrap(err, "couldn't init upstream registry list")
+		}
+
+		privateImages, err := getPrivateImages(version)
+		if err != nil {
+			return errors.Wrap(err, "couldn't init private registry list")
+		}
+
+		registryClient, err := newRegistryClient()
+		if err != nil {
+			return err
+		}
+
+		diffs, errs := image.DiffImages(upstreamImages, privateImages, registryClient)
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+		fmt.Fprintln(w, "UPSTREAM\tDESTINATION\tSTATUS")
+		for _, d := range diffs {
+			fmt.Fprintf(w, "%v\t%v\t%v\n", d.Upstream, d.Private, d.Status)
+		}
+		w.Flush()
+		return utilerrors.NewAggregate(errs)
+
+	default:
+		return errors.Errorf("Unsupported plugin: %v", imagesflags.plugin)
+	}
+}
+
+func summarizeImages(cmd *cobra.Command, args []string) error {
+	switch imagesflags.plugin {
+	case e2ePluginName, systemdLogsPluginName:
+
+		version, err := getPluginVersion()
+		if err != nil {
+			return err
+		}
+
+		images, err := getUpstreamImages(version)
+		if err != nil {
+			return errors.Wrap(err, "couldn't init upstream registry list")
+		}
+
+		summaries, err := image.SummarizeByRegistry(images)
+		if err != nil {
+			return err
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+		if !imagesflags.showSize {
+			fmt.Fprintln(w, "REGISTRY\tIMAGES")
+			total := 0
+			for _, s := range summaries {
+				fmt.Fprintf(w, "%v\t%v\n", s.Host, len(s.Images))
+				total += len(s.Images)
+			}
+			fmt.Fprintf(w, "TOTAL\t%v\n", total)
+			return w.Flush()
+		}
+
+		summaries, err = newImageClient().AddSizes(summaries)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(w, "REGISTRY\tIMAGES\tSIZE\tNOT PRESENT")
+		var total, missing int
+		var size int64
+		for _, s := range summaries {
+			fmt.Fprintf(w, "%v\t%v\t%v\t%v\n", s.Host, len(s.Images), datasize.ByteSize(s.Size).HumanReadable(), s.Missing)
+			total += len(s.Images)
+			missing += s.Missing
+			size += s.Size
+		}
+		fmt.Fprintf(w, "TOTAL\t%v\t%v\t%v\n", total, datasize.ByteSize(size).HumanReadable(), missing)
+		return w.Flush()
+
+	default:
+		return errors.Errorf("Unsupported plugin: %v", imagesflags.plugin)
+	}
+}
+
+func resolveImages(cmd *cobra.Command, args []string) error {
+	switch imagesflags.plugin {
+	case "e2e":
+
+		if err := checkDestinationFlags(); err != nil {
+			return err
+		}
+
+		version, err := getClusterVersion()
+		if err != nil {
+			return err
+		}
+
+		mappings, err := image.ResolveMappings(imagesflags.e2eRegistryConfig, version)
+		if err != nil {
+			return errors.Wrap(err, "couldn't resolve images")
+		}
+		privateImages, err := getPrivateImages(version)
+		if err != nil {
+			return errors.Wrap(err, "couldn't resolve images")
+		}
+		for i, m := range mappings {
+			if private, ok := privateImages[m.Name]; ok {
+				mappings[i].Private = private.GetE2EImage()
+			}
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+		fmt.Fprintln(w, "NAME\tREGISTRY KEY\tUPSTREAM\tDESTINATION")
+		for _, m := range mappings {
+			fmt.Fprintf(w, "%v\t%v\t%v\t%v\n", m.Name, m.RegistryKey, m.Upstream, m.Private)
+		}
+		return w.Flush()
+
+	default:
+		return errors.Errorf("Unsupported plugin: %v", imagesflags.plugin)
+	}
+}
+
+func loadImages(cmd *cobra.Command, args []string) error {
+	if (len(imagesflags.fromDir) > 0) == (len(imagesflags.input) > 0) {
+		return errors.New("exactly one of --from-dir and --input must be set")
+	}
+	if len(imagesflags.checksum) > 0 && len(imagesflags.input) == 0 {
+		return errors.New("--checksum can only be used with --input")
+	}
+
+	imageClient := newImageClient()
+	if len(imagesflags.input) > 0 {
+		return imageClient.LoadImages(imagesflags.input, imagesflags.checksum)
+	}
+
+	return utilerrors.NewAggregate(imageClient.LoadImagesFromDir(imagesflags.fromDir))
+}
+
+func validateTar(cmd *cobra.Command, args []string) error {
+	images, err := image.ArchiveImages(args[0])
+	if err != nil {
+		return err
+	}
+
+	for _, img := range images {
+		fmt.Println(img)
+	}
+	return nil
+}
+
+func gcImages(cmd *cobra.Command, args []string) error {
+	imageClient := newImageClient()
+	removed, errs := imageClient.RemoveDangling(imagesflags.dryRun, numDockerRetries)
+
+	verb, total := "removed", "Reclaimed"
+	if imagesflags.dryRun {
+		verb, total = "would remove", "Would reclaim"
+	}
+	for _, img := range removed {
+		fmt.Fprintf(resultsOut(), "%v %v (size=%v)\n", verb, img.ID, datasize.ByteSize(img.Size).HumanReadable())
+	}
+	fmt.Fprintf(resultsOut(), "%v: %v\n", total, datasize.ByteSize(image.DanglingSize(removed)).HumanReadable())
+	return utilerrors.NewAggregate(errs)
+}
+
+func login(cmd *cobra.Command, args []string) error {
+	password, err := readPassword(imagesflags.passwordStdin)
+	if err != nil {
+		return err
+	}
+
+	imageClient := newImageClient()
+	return imageClient.Login(imagesflags.registry, imagesflags.username, password)
+}
+
+func logout(cmd *cobra.Command, args []string) error {
+	imageClient := newImageClient()
+	return imageClient.Logout(imagesflags.registry)
+}
+
+// readPassword reads a password from stdin, prompting for it without echo if
+// stdin is a terminal and fromStdin isn't set.
+func readPassword(fromStdin bool) (string, error) {
+	fd := int(os.Stdin.Fd())
+	if !fromStdin && terminal.IsTerminal(fd) {
+		fmt.Fprint(os.Stderr, "Password: ")
+		b, err := terminal.ReadPassword(fd)
+		fmt.Fprintln(os.Stderr)
+		if err != nil {
+			return "", errors.Wrap(err, "couldn't read password")
+		}
+		return string(b), nil
+	}
+
+	b, err := ioutil.ReadAll(os.Stdin)
+	if err != nil {
+		return "", errors.Wrap(err, "couldn't read password from stdin")
+	}
+	password := strings.TrimRight(string(b), "\r\n")
+	if len(password) == 0 {
+		return "", errors.New("no password given on stdin")
+	}
+	return password, nil
+}
+
+// rateLimited reports whether any of errs was caused by a registry rate limit
+func rateLimited(errs []error) bool {
+	for _, err := range errs {
+		if errors.Cause(err) == docker.ErrRateLimited {
+			return true
+		}
+	}
+	return false
+}
+
+// newRegistryClient returns a registry client using --registry-connect-timeout, --registry-read-timeout
+// and --registry-ca-cert
+func newRegistryClient() (*registry.Client, error) {
+	opts := registry.ClientOptions{
+		ConnectTimeout: imagesflags.connectTimeout,
+		ReadTimeout:    imagesflags.readTimeout,
+		Retries:        imagesflags.retries,
+	}
+	if len(imagesflags.registryCACert) > 0 {
+		pool, err := registry.LoadCACert(imagesflags.registryCACert)
+		if err != nil {
+			return nil, err
+		}
+		opts.RootCAs = pool
+	}
+	registryClient := registry.NewClientWithOptions(opts)
+
+	creds, err := registry.LoadDockerConfig(registry.DockerConfigPath())
+	if err != nil {
+		return nil, err
+	}
+	registryClient.Credentials = creds
+	return registryClient, nil
+}
+
+// writeImageTable writes the images as aligned columns of their registry, repository
+// and tag. If sizes isn't nil a size column is added, with - for images it lacks.
+func writeImageTable(out io.Writer, images []string, sizes map[string]int64) error {
+	w := tabwriter.NewWriter(out, 0, 8, 2, ' ', 0)
+	if sizes != nil {
+		fmt.Fprintln(w, "REGISTRY\tREPOSITORY\tTAG\tSIZE")
+	} else {
+		fmt.Fprintln(w, "REGISTRY\tREPOSITORY\tTAG")
+	}
+
+	for _, img := range images {
+		ref, err := registry.ParseReference(img)
+		if err != nil {
+			return err
+		}
+		if sizes == nil {
+			fmt.Fprintf(w, "%v\t%v\t%v\n", ref.Host, ref.Repository, ref.Tag)
+			continue
+		}
+		size := "-"
+		if s, ok := sizes[img]; ok {
+			size = datasize.ByteSize(s).HumanReadable()
+		}
+		fmt.Fprintf(w, "%v\t%v\t%v\t%v\n", ref.Host, ref.Repository, ref.Tag, size)
+	}
+	return w.Flush()
+}
+
+// referenceComponents parses each image reference and returns the unique, sorted
+// results of component for them.
+func referenceComponents(images []string, component func(registry.Reference) string) ([]string, error) {
+	seen := map[string]bool{}
+	components := []string{}
+	for _, img := range images {
+		ref, err := registry.ParseReference(img)
+		if err != nil {
+			return nil, err
+		}
+		if c := component(ref); !seen[c] {
+			seen[c] = true
+			components = append(components, c)
+		}
+	}
+	sort.Strings(components)
+	return components, nil
+}
+
+// markFlagsExclusive declares groups of cmd's flags which can't be combined
+func markFlagsExclusive(cmd *cobra.Command, groups ...[]string) {
+	exclusiveFlags[cmd] = append(exclusiveFlags[cmd], groups...)
+}
+
+// checkCommandExclusiveFlags checks the exclusive flags declared on cmd, along
+// with those of its parents whose flags are all persistent and so inherited by it
+func checkCommandExclusiveFlags(cmd *cobra.Command) error {
+	groups := exclusiveFlags[cmd]
+	for c := cmd.Parent(); c != nil; c = c.Parent() {
+	nextGroup:
+		for _, group := range exclusiveFlags[c] {
+			for _, name := range group {
+				if c.PersistentFlags().Lookup(name) == nil {
+					continue nextGroup
+				}
+			}
+			groups = append(groups, group)
+		}
+	}
+	return checkExclusiveFlags(cmd.Flags(), groups)
+}
+
+// checkExclusiveFlags returns an error if more than one flag of any group was set
+func checkExclusiveFlags(flags *pflag.FlagSet, groups [][]string) error {
+	for _, group := range groups {
+		set := []string{}
+		for _, name := range group {
+			if flags.Changed(name) {
+				set = append(set, "--"+name)
+			}
+		}
+		if len(set) > 1 {
+			return errors.Errorf("flags %v can't be used together", strings.Join(set, ", "))
+		}
+	}
+	return nil
+}
+
+// newImageClient returns an image client reporting progress to each of progress,
+// as JSON Lines if --log-format=jsonl was given and as plain lines on stderr if
+// --progress=plain was. Neither is written with --progress=none.
+func newImageClient(progress ...image.ProgressFunc) image.ImageClient {
+	switch {
+	case imagesflags.progress == progressNone, imagesflags.summaryOnly:
+	case imagesflags.logFormat == logFormatJSONL:
+		progress = append(progress, image.ProgressJSONWriter(os.Stdout))
+	case imagesflags.progress == progressPlain:
+		progress = append(progress, image.ProgressWriter(os.Stderr))
+	}
+
+	if len(imagesflags.outputFile) > 0 {
+		if imageResults == nil {
+			imageResults = image.NewResultRecorder()
+		}
+		progress = append(progress, imageResults.Record)
+	}
+	if imageReport != nil {
+		progress = append(progress, imageReport.Record)
+	}
+
+	imageClient := image.NewImageClient().WithContext(imagesCtx)
+	if imagesflags.tarRateLimitBytes > 0 {
+		imageClient = imageClient.WithRateLimit(imagesflags.tarRateLimitBytes)
+	}
+	if len(progress) > 0 {
+		imageClient = imageClient.WithProgress(image.MultiProgress(progress...))
+	}
+	if imagesflags.failFast || !imagesflags.keepGoing {
+		imageClient = imageClient.WithFailFast()
+	}
+	return imageClient
+}
+
+// withTemporaryLogins returns a copy of imageClient which logs in to registries
+// under a temporary copy of the docker config, which is removed when the command
+// finishes, so credentials given for the command aren't left in the user's config.
+func withTemporaryLogins(imageClient image.ImageClient) (image.ImageClient, error) {
+	config, err := registry.NewTemporaryDockerConfig(registry.DockerConfigPath())
+	if err != nil {
+		return imageClient, err
+	}
+	cleanup := cleanupRegistryAuth
+	cleanupRegistryAuth = func() {
+		config.Remove()
+		cleanup()
+	}
+	os.Setenv("DOCKER_CONFIG", config.Dir)
+	return imageClient.WithTemporaryLogins(config), nil
+}
+
+// withParallel returns a copy of imageClient transferring --parallel images at once.
+// If --concurrency-per-image-layers is set, that is lowered so the layers of the
+// images transferred at once fit within the docker daemon's limit, as chosen by limit.
+func withParallel(imageClient image.ImageClient, limit func(docker.DaemonLimits) int) (image.ImageClient, error) {
+	if imagesflags.parallel < 1 {
+		return imageClient, errors.Errorf("invalid --parallel %d, expected at least 1", imagesflags.parallel)
+	}
+	if imagesflags.layersPerImage < 0 {
+		return imageClient, errors.Errorf("invalid --concurrency-per-image-layers %d, expected at least 0", imagesflags.layersPerImage)
+	}
+
+	parallel := imagesflags.parallel
+	if imagesflags.layersPerImage > 0 {
+		limits, err := daemonLimits()
+		if err != nil {
+			return imageClient, err
+		}
+		daemonLimit := limit(limits)
+		if imagesflags.layersPerImage > daemonLimit {
+			logrus.Warningf("The docker daemon transfers at most %d layers at once, fewer than --concurrency-per-image-layers %d; raise max-concurrent-downloads or max-concurrent-uploads in the daemon's configuration", daemonLimit, imagesflags.layersPerImage)
+		}
+		parallel = image.ParallelWithinDaemonLimit(parallel, imagesflags.layersPerImage, daemonLimit)
+		if parallel < imagesflags.parallel {
+			logrus.Infof("Transferring %d images at once to stay within the docker daemon's limit of %d layers", parallel, daemonLimit)
+		}
+	}
+	return imageClient.WithParallel(parallel), nil
+}
+
+// newTimingRecorder returns a recorder for the image client's progress if --timings
+// was given, or nil.
+func newTimingRecorder() (*image.TimingRecorder, []image.ProgressFunc) {
+	if !imagesflags.timings {
+		return nil, nil
+	}
+	timings := image.NewTimingRecorder(resultsOut())
+	return timings, []image.ProgressFunc{timings.Record}
+}
+
+// colorDisabled reports whether output should be plain, either because --no-color
+// was given or the environment asks for it following https://no-color.org.
+func colorDisabled(noColor bool, getenv func(string) string) bool {
+	if noColor {
+		return true
+	}
+	return getenv("NO_COLOR") != "" || getenv("TERM") == "dumb"
+}
+
+// writtenLabel is the label of the bytes of image files printBytes prints. Bytes
+// sent over the network by pulls aren't reported, since the docker CLI doesn't
+// report them.
+const writtenLabel = "Written"
+
+// resultsOut is where image operations print their results, such as the images
+// pulled and the files written: stdout, unless --log-format jsonl keeps it for
+// JSON lines, in which case stderr.
+func resultsOut() io.Writer {
+	if imagesflags.logFormat == logFormatJSONL {
+		return os.Stderr
+	}
+	return os.Stdout
+}
+
+// printBytes prints the bytes of image files an operation wrote under label,
+// unless --summary-only was given, and adds them to its report.
+func printBytes(label string, n int64) {
+	if imageReport != nil {
+		imageReport.AddBytes(n)
+	}
+	if !imagesflags.summaryOnly {
+		fmt.Fprintf(resultsOut(), "%v: %v\n", label, datasize.ByteSize(n).HumanReadable())
+	}
+}
+
+// writeImageReport prints the summary of the images operation: to stdout as one
+// JSON object with --log-format jsonl, otherwise to stderr, leaving stdout to the
+// files and images the command prints. Commands that didn't operate on any images
+// print nothing.
+func writeImageReport() {
+	if imageReport == nil || imageReport.Empty() {
+		return
+	}
+	summary := imageReport.Summary()
+	if imagesflags.logFormat == logFormatJSONL {
+		json.NewEncoder(os.Stdout).Encode(struct {
+			Summary image.ReportSummary `json:"summary"`
+		}{summary})
+		return
+	}
+	summary.Write(os.Stderr)
+}
+
+// writeImageResults writes the outcome of each image operation recorded by the
+// image clients to path, as JSON if it ends with .json and YAML otherwise. Nothing
+// is written if path is empty or no image client was created.
+func writeImageResults(path string) error {
+	if len(path) == 0 || imageResults == nil {
+		return nil
+	}
+
+	results := imageResults.Results()
+	var b []byte
+	var err error
+	if filepath.Ext(path) == ".json" {
+		b, err = json.MarshalIndent(results, "", "  ")
+	} else {
+		b, err = yaml.Marshal(results)
+	}
+	if err != nil {
+		return errors.Wrap(err, "couldn't encode image results")
+	}
+
+	return errors.Wrapf(ioutil.WriteFile(path, b, 0644), "couldn't write image results %v", path)
+}
+
+// writeDigestManifest writes the image -> digest mapping to a JSON or YAML file,
+// depending on the file extension.
+func writeDigestManifest(path string, digests map[string]string) error {
+	var b []byte
+	var err error
+	if filepath.Ext(path) == ".json" {
+		b, err = json.MarshalIndent(digests, "", "  ")
+	} else {
+		b, err = yaml.Marshal(digests)
+	}
+	if err != nil {
+		return errors.Wrap(err, "couldn't encode image manifest")
+	}
+
+	return errors.Wrapf(ioutil.WriteFile(path, b, 0644), "couldn't write image manifest %v", path)
 }
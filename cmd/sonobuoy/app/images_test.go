@@ -0,0 +1,811 @@
+/*
+Copyright the Sonobuoy contributors 2019
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package app
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/heptio/sonobuoy/pkg/image"
+	"github.com/heptio/sonobuoy/pkg/image/registry"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+)
+
+func TestGetClusterVersion(t *testing.T) {
+	defer func(flags imagesFlags) { imagesflags = flags }(imagesflags)
+
+	imagesflags = imagesFlags{kubernetesVersion: "v1.14.0"}
+	imagesflags.kubeconfig.Set("/does/not/exist")
+
+	version, err := getClusterVersion()
+	if err != nil {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+	if version != "v1.14.0" {
+		t.Fatalf("Expected version v1.14.0 but got %v", version)
+	}
+}
+
+func TestImagesHandlersReturnErrors(t *testing.T) {
+	defer func(flags imagesFlags) { imagesflags = flags }(imagesflags)
+
+	handlers := map[string]func(cmd *cobra.Command, args []string) error{
+		"list":     listImages,
+		"pull":     pullImages,
+		"download": downloadImages,
+		"push":     pushImages,
+		"delete":   deleteImages,
+		"diff":     diffImages,
+		"summary":  summarizeImages,
+		"resolve":  resolveImages,
+	}
+
+	for name, handler := range handlers {
+		t.Run(name, func(t *testing.T) {
+			imagesflags = imagesFlags{plugin: "unknown"}
+			err := handler(&cobra.Command{}, nil)
+			if err == nil || !strings.Contains(err.Error(), "Unsupported plugin") {
+				t.Errorf("Expected an unsupported plugin error but got %v", err)
+			}
+		})
+	}
+}
+
+func TestRunImages(t *testing.T) {
+	tests := map[string]struct {
+		err         error
+		wantSilence bool
+	}{
+		"success": {
+			err: nil,
+		},
+		"single error": {
+			err:         errors.New("failed"),
+			wantSilence: true,
+		},
+		"aggregate": {
+			err:         utilerrors.NewAggregate([]error{errors.New("a"), errors.New("b")}),
+			wantSilence: true,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			cmd := &cobra.Command{}
+			err := runImages(func(*cobra.Command, []string) error { return tc.err })(cmd, nil)
+			if (err == nil) != (tc.err == nil) {
+				t.Errorf("Expected error %v but got %v", tc.err, err)
+			}
+			if cmd.SilenceErrors != tc.wantSilence || cmd.SilenceUsage != tc.wantSilence {
+				t.Errorf("Expected errors and usage silenced: %v, got %v and %v", tc.wantSilence, cmd.SilenceErrors, cmd.SilenceUsage)
+			}
+		})
+	}
+}
+
+func TestColorDisabled(t *testing.T) {
+	tests := map[string]struct {
+		noColor bool
+		env     map[string]string
+		want    bool
+	}{
+		"colors by default": {
+			env:  map[string]string{"TERM": "xterm-256color"},
+			want: false,
+		},
+		"no-color flag": {
+			noColor: true,
+			env:     map[string]string{"TERM": "xterm-256color"},
+			want:    true,
+		},
+		"NO_COLOR set": {
+			env:  map[string]string{"NO_COLOR": "1", "TERM": "xterm-256color"},
+			want: true,
+		},
+		"NO_COLOR empty": {
+			env:  map[string]string{"NO_COLOR": "", "TERM": "xterm-256color"},
+			want: false,
+		},
+		"dumb terminal": {
+			env:  map[string]string{"TERM": "dumb"},
+			want: true,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			getenv := func(key string) string { return tc.env[key] }
+			if got := colorDisabled(tc.noColor, getenv); got != tc.want {
+				t.Errorf("Expected %v but got %v", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestRunImagesCanceled(t *testing.T) {
+	defer func(ctx context.Context) { imagesCtx = ctx }(imagesCtx)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	imagesCtx = ctx
+	cancel()
+
+	err := runImages(func(*cobra.Command, []string) error {
+		return errors.New("Error response from daemon: Get https://k8s.gcr.io/v2/: net/http: request canceled")
+	})(&cobra.Command{}, nil)
+	if err != image.ErrCanceled {
+		t.Errorf("Expected error %v but got %v", image.ErrCanceled, err)
+	}
+}
+
+func TestWriteImageResults(t *testing.T) {
+	defer func(r *image.ResultRecorder) { imageResults = r }(imageResults)
+
+	dir, err := ioutil.TempDir("", "sonobuoy-results")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	imageResults = nil
+	if err := writeImageResults(filepath.Join(dir, "unused.json")); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "unused.json")); !os.IsNotExist(err) {
+		t.Errorf("Expected no results file without an image client, got %v", err)
+	}
+
+	imageResults = image.NewResultRecorder()
+	imageResults.Record(image.ImageProgress{Name: "foo.io/a:1.0", Operation: image.OperationDelete, Status: image.ProgressStarted})
+	imageResults.Record(image.ImageProgress{Name: "foo.io/a:1.0", Operation: image.OperationDelete, Status: image.ProgressFailed, Err: errors.New("delete failed")})
+
+	tests := map[string]string{
+		"results.json": `[
+  {
+    "image": "foo.io/a:1.0",
+    "action": "delete",
+    "result": "failed",
+    "error": "delete failed"
+  }
+]`,
+		"results.yaml": `- image: foo.io/a:1.0
+  action: delete
+  result: failed
+  error: delete failed
+`,
+	}
+
+	for file, want := range tests {
+		t.Run(file, func(t *testing.T) {
+			path := filepath.Join(dir, file)
+			if err := writeImageResults(path); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			got, err := ioutil.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != want {
+				t.Errorf("Expected results\n%v\nbut got\n%v", want, string(got))
+			}
+		})
+	}
+}
+
+func TestSetupImagesProgress(t *testing.T) {
+	defer func(flags imagesFlags) { imagesflags = flags }(imagesflags)
+	defer logrus.SetLevel(logrus.GetLevel())
+	defer logrus.SetFormatter(logrus.StandardLogger().Formatter)
+
+	tests := map[string]struct {
+		progress  string
+		wantLevel logrus.Level
+		wantErr   bool
+	}{
+		"auto": {
+			progress:  progressAuto,
+			wantLevel: logrus.InfoLevel,
+		},
+		"plain": {
+			progress:  progressPlain,
+			wantLevel: logrus.InfoLevel,
+		},
+		"none": {
+			progress:  progressNone,
+			wantLevel: logrus.WarnLevel,
+		},
+		"unsupported": {
+			progress: "tty",
+			wantErr:  true,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			logrus.SetLevel(logrus.InfoLevel)
+			// Creating the command resets the flags to their defaults
+			cmd := NewCmdImages()
+			imagesflags = imagesFlags{progress: tc.progress, logFormat: logFormatText}
+
+			err := setupImages(cmd, nil)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("Expected error: %v, got %v", tc.wantErr, err)
+			}
+			if tc.wantErr {
+				return
+			}
+			if got := logrus.GetLevel(); got != tc.wantLevel {
+				t.Errorf("Expected log level %v but got %v", tc.wantLevel, got)
+			}
+		})
+	}
+}
+
+func TestGetClusterVersionFromSnapshot(t *testing.T) {
+	defer func(flags imagesFlags) { imagesflags = flags }(imagesflags)
+
+	imagesflags = imagesFlags{imageSnapshot: "testdata/images-snapshot.json"}
+	imagesflags.kubeconfig.Set("/does/not/exist")
+
+	version, err := getClusterVersion()
+	if err != nil {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+	if version != "v1.13.0" {
+		t.Fatalf("Expected version v1.13.0 but got %v", version)
+	}
+
+	images, err := getUpstreamImages(version)
+	if err != nil {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+	if len(images) != 2 {
+		t.Fatalf("Expected 2 images but got %v", images)
+	}
+}
+
+func TestGetClusterVersionForced(t *testing.T) {
+	defer func(flags imagesFlags) { imagesflags = flags }(imagesflags)
+
+	imagesflags = imagesFlags{kubernetesVersion: "v1.16.0", forceVersion: true}
+
+	version, err := getClusterVersion()
+	if err != nil {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+	if version != "v1.14.0" {
+		t.Fatalf("Expected version v1.14.0 but got %v", version)
+	}
+}
+
+func TestCheckExclusiveFlags(t *testing.T) {
+	groups := [][]string{{"a", "b", "c"}, {"a", "d"}}
+
+	tests := map[string]struct {
+		args    []string
+		wantErr string
+	}{
+		"none set": {},
+		"one of each group": {
+			args: []string{"--b=1", "--d=1"},
+		},
+		"two of a group": {
+			args:    []string{"--a=1", "--c=1"},
+			wantErr: "flags --a, --c can't be used together",
+		},
+		"flag shared between groups": {
+			args:    []string{"--a=1", "--d=1"},
+			wantErr: "flags --a, --d can't be used together",
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			flags := pflag.NewFlagSet("test", pflag.ContinueOnError)
+			for _, name := range []string{"a", "b", "c", "d"} {
+				flags.String(name, "", "")
+			}
+			if err := flags.Parse(tc.args); err != nil {
+				t.Fatalf("Unexpected error parsing flags: %v", err)
+			}
+
+			err := checkExclusiveFlags(flags, groups)
+			switch {
+			case tc.wantErr == "" && err != nil:
+				t.Errorf("Expected no error but got %v", err)
+			case tc.wantErr != "" && (err == nil || err.Error() != tc.wantErr):
+				t.Errorf("Expected error %q but got %v", tc.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestSystemdLogsImages(t *testing.T) {
+	defer func(flags imagesFlags) { imagesflags = flags }(imagesflags)
+
+	imagesflags = imagesFlags{plugin: systemdLogsPluginName}
+	imagesflags.kubeconfig.Set("/does/not/exist")
+
+	// The cluster isn't needed for images that don't depend on its version
+	version, err := getPluginVersion()
+	if err != nil {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+
+	for name, get := range map[string]func(string) (map[string]image.Config, error){
+		"upstream": getUpstreamImages,
+		"private":  getPrivateImages,
+	} {
+		images, err := get(version)
+		if err != nil {
+			t.Fatalf("Expected no error getting %v images but got %v", name, err)
+		}
+		got := image.UniqueImages(images)
+		if len(got) != 1 || got[0] != image.SystemdLogsImage {
+			t.Errorf("Expected %v images [%v] but got %v", name, image.SystemdLogsImage, got)
+		}
+	}
+}
+
+func TestAllPluginImages(t *testing.T) {
+	defer func(flags imagesFlags) { imagesflags = flags }(imagesflags)
+
+	imagesflags = imagesFlags{plugin: allPluginsName, kubernetesVersion: "v1.14.0"}
+	version, err := getPluginVersion()
+	if err != nil {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+
+	all, err := getUpstreamImages(version)
+	if err != nil {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+	e2e, err := image.GetImages(defaultE2ERegistries, version)
+	if err != nil {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+
+	want := map[string]bool{image.SystemdLogsImage: true}
+	for _, img := range image.UniqueImages(e2e) {
+		want[img] = true
+	}
+	got := image.UniqueImages(all)
+	if len(got) != len(want) {
+		t.Fatalf("Expected %d images but got %d", len(want), len(got))
+	}
+	for _, img := range got {
+		if !want[img] {
+			t.Errorf("Unexpected image %v", img)
+		}
+	}
+}
+
+func TestIncludeSonobuoyImage(t *testing.T) {
+	defer func(flags imagesFlags) { imagesflags = flags }(imagesflags)
+
+	dir, err := ioutil.TempDir("", "sonobuoy-repo-config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	repoConfig := filepath.Join(dir, "repo-config.yaml")
+	if err := ioutil.WriteFile(repoConfig, []byte("sonobuoyRegistry: private.io/heptio\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	imagesflags = imagesFlags{
+		plugin:               e2ePluginName,
+		kubernetesVersion:    "v1.14.0",
+		e2eRegistryConfig:    repoConfig,
+		includeSonobuoyImage: true,
+		sonobuoyImage:        "gcr.io/heptio-images/sonobuoy:v0.14.0",
+	}
+
+	for name, want := range map[string]string{
+		"upstream": "gcr.io/heptio-images/sonobuoy:v0.14.0",
+		"private":  "private.io/heptio/sonobuoy:v0.14.0",
+	} {
+		get := getUpstreamImages
+		if name == "private" {
+			get = getPrivateImages
+		}
+		images, err := get("v1.14.0")
+		if err != nil {
+			t.Fatalf("Expected no error getting %v images but got %v", name, err)
+		}
+		img, ok := images["Sonobuoy"]
+		if !ok {
+			t.Fatalf("Expected %v images to include the sonobuoy image", name)
+		}
+		if got := img.GetE2EImage(); got != want {
+			t.Errorf("Expected %v sonobuoy image %v but got %v", name, want, got)
+		}
+	}
+}
+
+func TestConformanceOnlyImages(t *testing.T) {
+	defer func(flags imagesFlags) { imagesflags = flags }(imagesflags)
+
+	tests := map[string]struct {
+		version string
+		want    string
+	}{
+		"upstream image": {
+			version: "v1.14.1",
+			want:    "gcr.io/google-containers/conformance:v1.14.1",
+		},
+		"heptio image before v1.13": {
+			version: "v1.12.3",
+			want:    "gcr.io/heptio-images/kube-conformance:v1.12.3",
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			imagesflags = imagesFlags{plugin: e2ePluginName, conformanceOnly: true}
+
+			images, err := getUpstreamImages(tc.version)
+			if err != nil {
+				t.Fatalf("Expected no error but got %v", err)
+			}
+			got := image.UniqueImages(images)
+			if len(got) != 1 || got[0] != tc.want {
+				t.Errorf("Expected images [%v] but got %v", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestReferenceComponents(t *testing.T) {
+	images := []string{
+		"gcr.io/kubernetes-e2e-test-images/dnsutils:1.1",
+		"gcr.io/kubernetes-e2e-test-images/dnsutils:1.0",
+		"docker.io/library/nginx:1.14-alpine",
+		"busybox:1.29",
+	}
+
+	tests := map[string]struct {
+		component func(registry.Reference) string
+		want      []string
+	}{
+		"tags": {
+			component: func(ref registry.Reference) string { return ref.Tag },
+			want:      []string{"1.0", "1.1", "1.14-alpine", "1.29"},
+		},
+		"repos": {
+			component: registry.Reference.Name,
+			want: []string{
+				"docker.io/library/busybox",
+				"docker.io/library/nginx",
+				"gcr.io/kubernetes-e2e-test-images/dnsutils",
+			},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := referenceComponents(images, tc.component)
+			if err != nil {
+				t.Fatalf("Expected no error but got %v", err)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("Expected %v but got %v", tc.want, got)
+			}
+		})
+	}
+
+	if _, err := referenceComponents([]string{"Invalid/Image"}, registry.Reference.Name); err == nil {
+		t.Error("Expected an error for an invalid reference")
+	}
+}
+
+func TestWriteImageTable(t *testing.T) {
+	images := []string{
+		"gcr.io/kubernetes-e2e-test-images/dnsutils:1.1",
+		"docker.io/library/nginx:1.14-alpine",
+	}
+
+	tests := map[string]struct {
+		sizes map[string]int64
+		want  string
+	}{
+		"without sizes": {
+			want: "REGISTRY   REPOSITORY                           TAG\n" +
+				"gcr.io     kubernetes-e2e-test-images/dnsutils  1.1\n" +
+				"docker.io  library/nginx                        1.14-alpine\n",
+		},
+		"with sizes": {
+			sizes: map[string]int64{"docker.io/library/nginx:1.14-alpine": 2048},
+			want: "REGISTRY   REPOSITORY                           TAG          SIZE\n" +
+				"gcr.io     kubernetes-e2e-test-images/dnsutils  1.1          -\n" +
+				"docker.io  library/nginx                        1.14-alpine  2.0 KB\n",
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			var out bytes.Buffer
+			if err := writeImageTable(&out, images, tc.sizes); err != nil {
+				t.Fatalf("Expected no error but got %v", err)
+			}
+			if out.String() != tc.want {
+				t.Errorf("Expected\n%v\nbut got\n%v", tc.want, out.String())
+			}
+		})
+	}
+}
+
+func TestIncludeDeps(t *testing.T) {
+	defer func(flags imagesFlags) { imagesflags = flags }(imagesflags)
+
+	const worker = "gcr.io/heptio-images/sonobuoy:v0.14.0"
+	for _, includeDeps := range []bool{false, true} {
+		imagesflags = imagesFlags{
+			plugin:        systemdLogsPluginName,
+			includeDeps:   includeDeps,
+			sonobuoyImage: worker,
+		}
+
+		images, err := getUpstreamImages("")
+		if err != nil {
+			t.Fatalf("Expected no error but got %v", err)
+		}
+		want := []string{image.SystemdLogsImage}
+		if includeDeps {
+			want = []string{image.SystemdLogsImage, worker}
+		}
+		if got := image.UniqueImages(images); !reflect.DeepEqual(got, want) {
+			t.Errorf("Expected images %v with --include-deps=%v but got %v", want, includeDeps, got)
+		}
+	}
+}
+
+func TestCheckMutableTags(t *testing.T) {
+	logrus.SetOutput(ioutil.Discard)
+
+	dir, err := ioutil.TempDir("", "sonobuoy-image-list")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	list := filepath.Join(dir, "images.txt")
+	contents := "gcr.io/heptio-images/sonobuoy:v0.14.0\nbusybox\nquay.io/coreos/etcd:STABLE\nregistry.k8s.io/pause:latest\n"
+	if err := ioutil.WriteFile(list, []byte(contents), 0644); err != nil {
+		t.Fatal(err)
+	}
+	images, err := image.GetImagesFromList(list)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"docker.io/library/busybox:latest", "quay.io/coreos/etcd:STABLE", "registry.k8s.io/pause:latest"}
+	if got := mutableImages(images); !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected mutable images %v but got %v", want, got)
+	}
+
+	if err := checkMutableTags(images, false); err != nil {
+		t.Errorf("Expected only warnings but got %v", err)
+	}
+	if err := checkMutableTags(images, true); err == nil {
+		t.Error("Expected an error with strict but got nil")
+	}
+	pinned := map[string]image.Config{"sonobuoy": images["gcr.io/heptio-images/sonobuoy:v0.14.0"]}
+	if err := checkMutableTags(pinned, true); err != nil {
+		t.Errorf("Expected no error for pinned images but got %v", err)
+	}
+}
+
+func TestResolveTargetOS(t *testing.T) {
+	tests := map[string]struct {
+		targetOS  string
+		explicit  bool
+		platforms []string
+		want      string
+		wantErr   bool
+	}{
+		"default": {
+			targetOS:  image.OSLinux,
+			platforms: []string{""},
+			want:      image.OSLinux,
+		},
+		"explicit windows": {
+			targetOS:  image.OSWindows,
+			explicit:  true,
+			platforms: []string{"windows/amd64"},
+			want:      image.OSWindows,
+		},
+		"implied by platform": {
+			targetOS:  image.OSLinux,
+			platforms: []string{"", "windows/amd64"},
+			want:      image.OSWindows,
+		},
+		"linux platforms": {
+			targetOS:  image.OSLinux,
+			platforms: []string{"linux/amd64", "linux/arm64"},
+			want:      image.OSLinux,
+		},
+		"platform for another OS": {
+			targetOS:  image.OSWindows,
+			explicit:  true,
+			platforms: []string{"linux/amd64"},
+			wantErr:   true,
+		},
+		"mixed platforms": {
+			targetOS:  image.OSLinux,
+			platforms: []string{"linux/amd64", "windows/amd64"},
+			wantErr:   true,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := resolveTargetOS(tc.targetOS, tc.explicit, tc.platforms)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("expected error %v, got %v", tc.wantErr, err)
+			}
+			if got != tc.want {
+				t.Errorf("Expected OS %q but got %q", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestDownloadLayout(t *testing.T) {
+	defer func(flags imagesFlags) { imagesflags = flags }(imagesflags)
+
+	tests := map[string]struct {
+		flags   imagesFlags
+		dest    image.Destination
+		want    image.PlanOptions
+		wantErr bool
+	}{
+		"default": {
+			flags: imagesFlags{plugin: e2ePluginName},
+		},
+		"batches": {
+			flags: imagesFlags{plugin: e2ePluginName, batchSize: 5},
+			want:  image.PlanOptions{BatchSize: 5},
+		},
+		"split before conformance only": {
+			flags: imagesFlags{plugin: e2ePluginName, conformanceOnly: true, splitSize: "1KB"},
+			want:  image.PlanOptions{MaxSize: 1024},
+		},
+		"conformance only": {
+			flags: imagesFlags{plugin: e2ePluginName, conformanceOnly: true, batchSize: 5},
+			want:  image.PlanOptions{FileName: conformanceTarFileName("v1.14.0")},
+		},
+		"output dir before dest": {
+			flags: imagesFlags{plugin: e2ePluginName, outputDir: "images", splitSize: "1KB"},
+			dest:  image.Destination{Path: "images.tar"},
+			want:  image.PlanOptions{Dir: "images"},
+		},
+		"dest": {
+			flags: imagesFlags{plugin: e2ePluginName, splitSize: "1KB"},
+			dest:  image.Destination{Path: "images.tar"},
+			want:  image.PlanOptions{FileName: "images.tar"},
+		},
+		"systemd-logs": {
+			flags: imagesFlags{plugin: systemdLogsPluginName},
+			want:  image.PlanOptions{FileName: systemdLogsTarFileName},
+		},
+		"systemd-logs split": {
+			flags:   imagesFlags{plugin: systemdLogsPluginName, splitSize: "1KB"},
+			wantErr: true,
+		},
+		"systemd-logs batches": {
+			flags:   imagesFlags{plugin: systemdLogsPluginName, batchSize: 5},
+			wantErr: true,
+		},
+		"invalid split size": {
+			flags:   imagesFlags{plugin: e2ePluginName, splitSize: "lots"},
+			wantErr: true,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			imagesflags = tc.flags
+			got, err := downloadLayout("v1.14.0", tc.dest)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("Expected error %v but got %v", tc.wantErr, err)
+			}
+			if !tc.wantErr && got != tc.want {
+				t.Errorf("Expected layout %+v but got %+v", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestCheckCommandExclusiveFlags(t *testing.T) {
+	tests := map[string]struct {
+		command string
+		args    []string
+		wantErr string
+	}{
+		"pull, no conflict": {
+			command: "pull",
+			args:    []string{"--image-list=images.txt", "--timings"},
+		},
+		"pull, own flags": {
+			command: "pull",
+			args:    []string{"--manifest-only", "--all-tags"},
+			wantErr: "flags --manifest-only, --all-tags can't be used together",
+		},
+		"pull, inherited persistent flags": {
+			command: "pull",
+			args:    []string{"--fail-fast", "--keep-going"},
+			wantErr: "flags --fail-fast, --keep-going can't be used together",
+		},
+		"pull, list-only group not inherited": {
+			command: "pull",
+			args:    []string{"--output-file=out.txt"},
+		},
+		"list, own flags": {
+			command: "images",
+			args:    []string{"--tags-only", "--repos-only"},
+			wantErr: "flags --tags-only, --repos-only can't be used together",
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			root := NewCmdImages()
+			cmd := root
+			if tc.command != root.Name() {
+				var err error
+				if cmd, _, err = root.Find([]string{tc.command}); err != nil {
+					t.Fatalf("Unexpected error finding %v: %v", tc.command, err)
+				}
+			}
+			if err := cmd.ParseFlags(tc.args); err != nil {
+				t.Fatalf("Unexpected error parsing flags: %v", err)
+			}
+
+			err := checkCommandExclusiveFlags(cmd)
+			switch {
+			case tc.wantErr == "" && err != nil:
+				t.Errorf("Expected no error but got %v", err)
+			case tc.wantErr != "" && (err == nil || err.Error() != tc.wantErr):
+				t.Errorf("Expected error %q but got %v", tc.wantErr, err)
+			}
+		})
+	}
+}
+
+// TestExclusiveFlagsDefined makes sure every exclusive group only names flags
+// of the subcommand it's declared on
+func TestExclusiveFlagsDefined(t *testing.T) {
+	root := NewCmdImages()
+	for _, cmd := range append([]*cobra.Command{root}, root.Commands()...) {
+		for _, group := range exclusiveFlags[cmd] {
+			for _, name := range group {
+				if cmd.Flags().Lookup(name) == nil && cmd.PersistentFlags().Lookup(name) == nil {
+					t.Errorf("%v: exclusive flag --%v isn't defined", cmd.Name(), name)
+				}
+			}
+		}
+	}
+}
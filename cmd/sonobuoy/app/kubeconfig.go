@@ -17,9 +17,14 @@ limitations under the License.
 package app
 
 import (
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
 	"github.com/spf13/pflag"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/util/homedir"
 	// Add auth providers
 	_ "k8s.io/client-go/plugin/pkg/client/auth"
 )
@@ -43,16 +48,41 @@ func (c *Kubeconfig) String() string {
 // Type needed for pflag.Value
 func (c *Kubeconfig) Type() string { return "Kubeconfig" }
 
-// Set sets the explicit path of the loader to the provided config file
+// Set sets the explicit path of the loader to the provided config file. A leading ~
+// is expanded to the home directory and relative paths are made absolute, so the
+// path means the same regardless of where it is later loaded from.
 func (c *Kubeconfig) Set(str string) error {
 	if c.ClientConfigLoadingRules == nil {
 		c.ClientConfigLoadingRules = clientcmd.NewDefaultClientConfigLoadingRules()
 	}
 
-	c.ExplicitPath = str
+	path, err := resolvePath(str)
+	if err != nil {
+		return err
+	}
+	c.ExplicitPath = path
 	return nil
 }
 
+// resolvePath expands a leading ~ in path and makes it absolute
+func resolvePath(path string) (string, error) {
+	if path == "" {
+		return path, nil
+	}
+	if path == "~" || strings.HasPrefix(path, "~/") {
+		home := homedir.HomeDir()
+		if home == "" {
+			return "", errors.Errorf("couldn't expand %v: home directory unknown", path)
+		}
+		path = filepath.Join(home, strings.TrimPrefix(path, "~"))
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", errors.Wrapf(err, "couldn't resolve path %v", path)
+	}
+	return abs, nil
+}
+
 // Get returns a rest Config, possibly based on a provided config
 func (c *Kubeconfig) Get() (*rest.Config, error) {
 
@@ -60,6 +90,15 @@ func (c *Kubeconfig) Get() (*rest.Config, error) {
 		c.ClientConfigLoadingRules = clientcmd.NewDefaultClientConfigLoadingRules()
 	}
 
+	// $KUBECONFIG entries are often written with a ~, which isn't expanded by every shell
+	for n, path := range c.Precedence {
+		resolved, err := resolvePath(path)
+		if err != nil {
+			return nil, err
+		}
+		c.Precedence[n] = resolved
+	}
+
 	configOverrides := &clientcmd.ConfigOverrides{}
 	kubeConfig := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(c, configOverrides)
 	return kubeConfig.ClientConfig()
@@ -0,0 +1,115 @@
+/*
+Copyright the Sonobuoy contributors 2019
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package app
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const testKubeconfig = `apiVersion: v1
+kind: Config
+clusters:
+- name: test
+  cluster:
+    server: https://test.example:6443
+contexts:
+- name: test
+  context:
+    cluster: test
+    user: test
+current-context: test
+users:
+- name: test
+  user:
+    token: secret
+`
+
+func TestKubeconfigPaths(t *testing.T) {
+	home, err := ioutil.TempDir("", "sonobuoy-home")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer os.RemoveAll(home)
+	if err := os.MkdirAll(filepath.Join(home, ".kube"), 0755); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(home, ".kube", "config"), []byte(testKubeconfig), 0644); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	defer os.Setenv("HOME", os.Getenv("HOME"))
+	os.Setenv("HOME", home)
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer os.Chdir(wd)
+
+	tests := map[string]struct {
+		dir      string
+		path     string
+		wantPath string
+	}{
+		"home directory": {
+			dir:      wd,
+			path:     "~/.kube/config",
+			wantPath: filepath.Join(home, ".kube", "config"),
+		},
+		"relative to the working directory": {
+			dir:      home,
+			path:     ".kube/config",
+			wantPath: filepath.Join(home, ".kube", "config"),
+		},
+		"absolute": {
+			dir:      wd,
+			path:     filepath.Join(home, ".kube", "config"),
+			wantPath: filepath.Join(home, ".kube", "config"),
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			if err := os.Chdir(tc.dir); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			var kubeconfig Kubeconfig
+			if err := kubeconfig.Set(tc.path); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if kubeconfig.ExplicitPath != tc.wantPath {
+				t.Errorf("Expected path %v but got %v", tc.wantPath, kubeconfig.ExplicitPath)
+			}
+
+			// The config loads the same from any directory
+			if err := os.Chdir(os.TempDir()); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			cfg, err := kubeconfig.Get()
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if cfg.Host != "https://test.example:6443" {
+				t.Errorf("Expected host https://test.example:6443 but got %v", cfg.Host)
+			}
+		})
+	}
+}
@@ -23,13 +23,20 @@ import (
 	"time"
 
 	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 	"github.com/spf13/pflag"
+	"k8s.io/api/core/v1"
 
 	"github.com/heptio/sonobuoy/pkg/client"
 	"github.com/heptio/sonobuoy/pkg/errlog"
+	"github.com/heptio/sonobuoy/pkg/image"
+	"github.com/heptio/sonobuoy/pkg/image/registry"
 )
 
+// registryPreflightTimeout limits checking that a private registry can be reached
+const registryPreflightTimeout = 10 * time.Second
+
 type runFlags struct {
 	genFlags
 	skipPreflight bool
@@ -98,6 +105,17 @@ func submitSonobuoyRun(cmd *cobra.Command, args []string) {
 	}
 
 	if !runflags.skipPreflight {
+		registryClient := registry.NewClientWithOptions(registry.ClientOptions{
+			ConnectTimeout: registryPreflightTimeout,
+			ReadTimeout:    registryPreflightTimeout,
+		})
+		insecure, err := insecureRegistries()
+		if err != nil {
+			logrus.Warningf("Couldn't read the docker daemon's insecure registries: %v", err)
+		}
+		registryClient.InsecureRegistries = insecure
+		warnUnreachableRegistries(runCfg, registryClient)
+
 		if errs := sbc.PreflightChecks(&client.PreflightConfig{Namespace: runflags.namespace}); len(errs) > 0 {
 			errlog.LogError(errors.New("Preflight checks failed"))
 			for _, err := range errs {
@@ -112,3 +130,24 @@ func submitSonobuoyRun(cmd *cobra.Command, args []string) {
 		os.Exit(1)
 	}
 }
+
+// warnUnreachableRegistries warns about each registry of the e2e repo-config that
+// can't be reached from this host. With the IfNotPresent pull policy, nodes pull
+// images they don't have from these registries, so an unreachable one here
+// suggests the nodes may not reach it either.
+func warnUnreachableRegistries(cfg *client.RunConfig, registryClient *registry.Client) {
+	if cfg.ImagePullPolicy != string(v1.PullIfNotPresent) || len(cfg.E2EConfig.CustomRegistries) == 0 {
+		return
+	}
+
+	hosts, err := image.RepoConfigHosts([]byte(cfg.E2EConfig.CustomRegistries))
+	if err != nil {
+		logrus.Warningf("Couldn't check whether the private registries are reachable: %v", err)
+		return
+	}
+	for _, host := range hosts {
+		if err := registryClient.Ping(host); err != nil {
+			logrus.Warningf("%v; with the %v pull policy, nodes may not be able to pull images they don't already have", err, v1.PullIfNotPresent)
+		}
+	}
+}
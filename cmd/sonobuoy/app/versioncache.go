@@ -0,0 +1,84 @@
+/*
+Copyright the Sonobuoy contributors 2019
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package app
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// versionCacheTTL is how long a cached cluster version is used before querying the cluster again
+const versionCacheTTL = time.Hour
+
+// cachedVersion is a cluster's version as of when it was queried
+type cachedVersion struct {
+	Version   string    `json:"version"`
+	Retrieved time.Time `json:"retrieved"`
+}
+
+// versionCache maps API server hosts to their cached versions
+type versionCache map[string]cachedVersion
+
+// versionCachePath returns the file cluster versions are cached in
+func versionCachePath() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "sonobuoy", "versions.json"), nil
+}
+
+// readVersionCache reads the version cache at path. A missing or unreadable cache is empty.
+func readVersionCache(path string) versionCache {
+	cache := versionCache{}
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return cache
+	}
+	if err := json.Unmarshal(contents, &cache); err != nil {
+		return versionCache{}
+	}
+	return cache
+}
+
+// get returns the cached version of the cluster at host, if it was retrieved within the TTL
+func (c versionCache) get(host string, now time.Time) (string, bool) {
+	cached, ok := c[host]
+	if !ok || now.Sub(cached.Retrieved) > versionCacheTTL || now.Before(cached.Retrieved) {
+		return "", false
+	}
+	return cached.Version, true
+}
+
+// write records the version of the cluster at host and writes the cache to path
+func (c versionCache) write(path, host, version string, now time.Time) error {
+	c[host] = cachedVersion{Version: version, Retrieved: now}
+
+	b, err := json.Marshal(c)
+	if err != nil {
+		return errors.Wrap(err, "couldn't encode version cache")
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return errors.Wrap(err, "couldn't create version cache directory")
+	}
+	return errors.Wrap(ioutil.WriteFile(path, b, 0644), "couldn't write version cache")
+}
@@ -0,0 +1,69 @@
+/*
+Copyright the Sonobuoy contributors 2019
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package app
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestVersionCache(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sonobuoy-version-cache")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "sonobuoy", "versions.json")
+	now := time.Date(2019, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	if _, ok := readVersionCache(path).get("https://a.example:6443", now); ok {
+		t.Fatal("Expected a missing cache to be empty")
+	}
+
+	if err := readVersionCache(path).write(path, "https://a.example:6443", "v1.14.1", now); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := readVersionCache(path).write(path, "https://b.example:6443", "v1.13.5", now); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	tests := map[string]struct {
+		host    string
+		at      time.Time
+		want    string
+		wantHit bool
+	}{
+		"cached":        {host: "https://a.example:6443", at: now.Add(time.Minute), want: "v1.14.1", wantHit: true},
+		"other cluster": {host: "https://b.example:6443", at: now.Add(time.Minute), want: "v1.13.5", wantHit: true},
+		"unknown":       {host: "https://c.example:6443", at: now},
+		"expired":       {host: "https://a.example:6443", at: now.Add(versionCacheTTL + time.Second)},
+	}
+
+	cache := readVersionCache(path)
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, ok := cache.get(tc.host, tc.at)
+			if ok != tc.wantHit || got != tc.want {
+				t.Errorf("Expected (%q, %v) but got (%q, %v)", tc.want, tc.wantHit, got, ok)
+			}
+		})
+	}
+}
@@ -0,0 +1,220 @@
+/*
+Copyright the Sonobuoy contributors 2019
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package image
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/heptio/sonobuoy/pkg/image/exec"
+	"github.com/pkg/errors"
+)
+
+const (
+	// archiveManifest lists the images of a docker-archive along with their config and layers
+	archiveManifest = "manifest.json"
+	// archiveRepositories is the legacy index of a docker-archive's tags
+	archiveRepositories = "repositories"
+)
+
+// archiveManifestEntry is an image in a docker-archive's manifest.json
+type archiveManifestEntry struct {
+	Config   string   `json:"Config"`
+	RepoTags []string `json:"RepoTags"`
+	Layers   []string `json:"Layers"`
+}
+
+// ArchiveImages reads the docker-archive tar at path, as written by docker save,
+// and returns the images it contains, sorted. The tar may be compressed, as
+// described by decompressed.
+// Nothing is loaded into docker; an error is returned if the index of the tar is
+// missing or malformed, or refers to files the tar doesn't contain.
+func ArchiveImages(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "couldn't open %v", path)
+	}
+	defer f.Close()
+
+	r, err := decompressed(f)
+	if err != nil {
+		return nil, errors.Wrapf(err, "couldn't read %v", path)
+	}
+	defer r.Close()
+
+	var manifest []archiveManifestEntry
+	var repositories map[string]map[string]string
+	files := map[string]bool{}
+
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, errors.Wrapf(err, "%v is not a valid tar", path)
+		}
+		files[hdr.Name] = true
+
+		switch hdr.Name {
+		case archiveManifest:
+			if err := json.NewDecoder(tr).Decode(&manifest); err != nil {
+				return nil, errors.Wrapf(err, "malformed %v in %v", archiveManifest, path)
+			}
+		case archiveRepositories:
+			if err := json.NewDecoder(tr).Decode(&repositories); err != nil {
+				return nil, errors.Wrapf(err, "malformed %v in %v", archiveRepositories, path)
+			}
+		}
+	}
+
+	if !files[archiveManifest] {
+		return nil, errors.Errorf("%v is not a docker archive: no %v", path, archiveManifest)
+	}
+
+	images := []string{}
+	for _, entry := range manifest {
+		referenced := append([]string{entry.Config}, entry.Layers...)
+		for _, name := range referenced {
+			if !files[name] {
+				return nil, errors.Errorf("%v refers to %v which is missing from %v", archiveManifest, name, path)
+			}
+		}
+		images = append(images, entry.RepoTags...)
+	}
+
+	tagged := map[string]bool{}
+	for _, img := range images {
+		tagged[img] = true
+	}
+	for repo, tags := range repositories {
+		for tag := range tags {
+			if img := fmt.Sprintf("%s:%s", repo, tag); !tagged[img] {
+				return nil, errors.Errorf("%v lists %v which isn't in %v", archiveRepositories, img, archiveManifest)
+			}
+		}
+	}
+
+	sort.Strings(images)
+	return images, nil
+}
+
+// Compression formats of image tars, as detected from their first bytes
+const (
+	compressionNone  = ""
+	compressionGzip  = "gzip"
+	compressionBzip2 = "bzip2"
+	compressionXz    = "xz"
+	compressionZstd  = "zstd"
+)
+
+// compressionMagic are the first bytes of each compression format
+var compressionMagic = []struct {
+	format string
+	magic  []byte
+}{
+	{compressionGzip, []byte{0x1f, 0x8b}},
+	{compressionBzip2, []byte("BZh")},
+	{compressionXz, []byte{0xfd, '7', 'z', 'X', 'Z', 0x00}},
+	{compressionZstd, []byte{0x28, 0xb5, 0x2f, 0xfd}},
+}
+
+// decompressCommands decompress the formats Go can't read itself to stdout
+var decompressCommands = map[string][]string{
+	compressionXz:   {"xz", "-dc"},
+	compressionZstd: {"zstd", "-dc"},
+}
+
+// detectCompression returns the compression format of the contents of br, going
+// by their first bytes rather than any file name, or compressionNone for none.
+func detectCompression(br *bufio.Reader) (string, error) {
+	for _, c := range compressionMagic {
+		magic, err := br.Peek(len(c.magic))
+		if err == io.EOF {
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		if bytes.Equal(magic, c.magic) {
+			return c.format, nil
+		}
+	}
+	return compressionNone, nil
+}
+
+// fileCompression returns the compression format of the file at path
+func fileCompression(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", errors.Wrapf(err, "couldn't open %v", path)
+	}
+	defer f.Close()
+	format, err := detectCompression(bufio.NewReader(f))
+	return format, errors.Wrapf(err, "couldn't read %v", path)
+}
+
+// decompressed returns a reader of the decompressed contents of r, or of r
+// unchanged if it isn't compressed. gzip and bzip2 are decompressed in-process,
+// xz and zstd by their command line tools.
+func decompressed(r io.Reader) (io.ReadCloser, error) {
+	br := bufio.NewReader(r)
+	format, err := detectCompression(br)
+	if err != nil {
+		return nil, err
+	}
+	switch format {
+	case compressionGzip:
+		return gzip.NewReader(br)
+	case compressionBzip2:
+		return ioutil.NopCloser(bzip2.NewReader(br)), nil
+	case compressionXz, compressionZstd:
+		return decompressCommand(br, decompressCommands[format]), nil
+	}
+	return ioutil.NopCloser(br), nil
+}
+
+// decompressCommand streams r through command, returning its output. Closing the
+// reader early stops the command.
+func decompressCommand(r io.Reader, command []string) io.ReadCloser {
+	pr, pw := io.Pipe()
+	var stderr bytes.Buffer
+	cmd := exec.Command(command[0], command[1:]...).
+		SetStdin(r).
+		SetStdout(pw).
+		SetStderr(&stderr)
+
+	go func() {
+		err := cmd.Run()
+		if err != nil {
+			err = errors.Wrapf(err, "%v failed: %v", strings.Join(command, " "), strings.TrimSpace(stderr.String()))
+		}
+		pw.CloseWithError(err)
+	}()
+	return pr
+}
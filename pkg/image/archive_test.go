@@ -0,0 +1,185 @@
+/*
+Copyright the Sonobuoy contributors 2019
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package image
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+	"reflect"
+	"testing"
+)
+
+// writeArchive writes a tar at path containing files, gzip compressed if compress is set
+func writeArchive(t *testing.T, path string, files map[string]string, compress bool) {
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	var w io.Writer = f
+	if compress {
+		gz := gzip.NewWriter(f)
+		defer gz.Close()
+		w = gz
+	}
+
+	tw := tar.NewWriter(w)
+	defer tw.Close()
+	for name, contents := range files {
+		if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(contents))}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(contents)); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestArchiveImages(t *testing.T) {
+	manifest := `[
+		{"Config": "abc.json", "RepoTags": ["k8s.gcr.io/pause:3.1"], "Layers": ["l1/layer.tar"]},
+		{"Config": "def.json", "RepoTags": ["docker.io/library/nginx:1.14-alpine"], "Layers": ["l1/layer.tar", "l2/layer.tar"]}
+	]`
+	valid := map[string]string{
+		"manifest.json": manifest,
+		"repositories":  `{"k8s.gcr.io/pause": {"3.1": "l1"}}`,
+		"abc.json":      "{}",
+		"def.json":      "{}",
+		"l1/layer.tar":  "",
+		"l2/layer.tar":  "",
+	}
+	without := func(name string) map[string]string {
+		files := map[string]string{}
+		for k, v := range valid {
+			if k != name {
+				files[k] = v
+			}
+		}
+		return files
+	}
+
+	tests := map[string]struct {
+		files     map[string]string
+		compress  bool
+		notTar    bool
+		want      []string
+		expectErr bool
+	}{
+		"valid archive": {
+			files: valid,
+			want:  []string{"docker.io/library/nginx:1.14-alpine", "k8s.gcr.io/pause:3.1"},
+		},
+		"gzip compressed": {
+			files:    valid,
+			compress: true,
+			want:     []string{"docker.io/library/nginx:1.14-alpine", "k8s.gcr.io/pause:3.1"},
+		},
+		"without repositories": {
+			files: without("repositories"),
+			want:  []string{"docker.io/library/nginx:1.14-alpine", "k8s.gcr.io/pause:3.1"},
+		},
+		"missing manifest": {
+			files:     without("manifest.json"),
+			expectErr: true,
+		},
+		"missing layer": {
+			files:     without("l2/layer.tar"),
+			expectErr: true,
+		},
+		"missing config": {
+			files:     without("abc.json"),
+			expectErr: true,
+		},
+		"malformed manifest": {
+			files:     map[string]string{"manifest.json": "{"},
+			expectErr: true,
+		},
+		"repositories not in manifest": {
+			files: map[string]string{
+				"manifest.json": `[]`,
+				"repositories":  `{"k8s.gcr.io/pause": {"3.1": "l1"}}`,
+			},
+			expectErr: true,
+		},
+		"not a tar": {
+			notTar:    true,
+			expectErr: true,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			defer chdirTemp(t)()
+			if tc.notTar {
+				f, err := os.Create("images.tar")
+				if err != nil {
+					t.Fatal(err)
+				}
+				f.WriteString("not a tar archive, just some text that is long enough to be read")
+				f.Close()
+			} else {
+				writeArchive(t, "images.tar", tc.files, tc.compress)
+			}
+
+			got, err := ArchiveImages("images.tar")
+			if tc.expectErr {
+				if err == nil {
+					t.Fatal("Expected an error but got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("Expected %v but got %v", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestDetectCompression(t *testing.T) {
+	tests := map[string]struct {
+		contents []byte
+		want     string
+	}{
+		"empty":      {contents: nil, want: compressionNone},
+		"plain tar":  {contents: []byte("manifest.json\x00"), want: compressionNone},
+		"gzip":       {contents: []byte{0x1f, 0x8b, 0x08}, want: compressionGzip},
+		"bzip2":      {contents: []byte("BZh91AY"), want: compressionBzip2},
+		"xz":         {contents: []byte{0xfd, '7', 'z', 'X', 'Z', 0x00, 0x00}, want: compressionXz},
+		"zstd":       {contents: []byte{0x28, 0xb5, 0x2f, 0xfd, 0x04}, want: compressionZstd},
+		"short gzip": {contents: []byte{0x1f}, want: compressionNone},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := detectCompression(bufio.NewReader(bytes.NewReader(tc.contents)))
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if got != tc.want {
+				t.Errorf("Expected %q but got %q", tc.want, got)
+			}
+		})
+	}
+}
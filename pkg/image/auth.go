@@ -0,0 +1,196 @@
+/*
+Copyright the Sonobuoy contributors 2019
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package image
+
+import (
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/heptio/sonobuoy/pkg/image/exec"
+	"github.com/heptio/sonobuoy/pkg/image/registry"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// tokenUsername is the username Google's registries expect along with an OAuth
+// access token, such as one printed by 'gcloud auth print-access-token'
+const tokenUsername = "oauth2accesstoken"
+
+// AuthRefresher refreshes the credentials the docker client uses for a registry,
+// e.g. after a short-lived registry token expired during a long push.
+type AuthRefresher interface {
+	Refresh(registryHost string) error
+}
+
+// CommandAuthRefresher refreshes credentials by running a shell command, such as
+// a credential helper piped into `docker login`. The registry host is available
+// to the command as $REGISTRY.
+type CommandAuthRefresher struct {
+	Command string
+}
+
+// Refresh runs the refresh command for the given registry host
+func (c CommandAuthRefresher) Refresh(registryHost string) error {
+	log.Infof("Refreshing credentials for registry: %s ...", registryHost)
+	cmd := exec.Command("sh", "-c", c.Command)
+	cmd.SetEnv(append(os.Environ(), "REGISTRY="+registryHost)...)
+	return errors.Wrapf(exec.RunLoggingOutputOnFail(cmd), "couldn't refresh credentials for %v", registryHost)
+}
+
+// ParseUpstreamAuth parses credentials for upstream registries given as host=VAR,
+// where the environment variable VAR, looked up with getenv, holds either
+// username:password or an access token for Google's registries. Keeping the
+// secrets in the environment keeps them out of the process list.
+func ParseUpstreamAuth(values []string, getenv func(string) string) (registry.CredentialStore, error) {
+	creds := registry.CredentialStore{}
+	for _, v := range values {
+		parts := strings.SplitN(v, "=", 2)
+		if len(parts) != 2 || len(parts[0]) == 0 || len(parts[1]) == 0 {
+			return nil, errors.Errorf("invalid upstream auth %q, expected host=VAR", v)
+		}
+		host, variable := parts[0], parts[1]
+
+		c, err := credentialsFromEnv(variable, host, getenv)
+		if err != nil {
+			return nil, err
+		}
+		creds[host] = c
+	}
+	return creds, nil
+}
+
+// credentialsFromEnv returns the credentials for host held by the environment
+// variable, as username:password or an access token for Google's registries
+func credentialsFromEnv(variable, host string, getenv func(string) string) (registry.Credentials, error) {
+	secret := getenv(variable)
+	if len(secret) == 0 {
+		return registry.Credentials{}, errors.Errorf("$%v, given for the credentials of %v, is empty", variable, host)
+	}
+	if n := strings.Index(secret, ":"); n >= 0 {
+		return registry.Credentials{Username: secret[:n], Password: secret[n+1:]}, nil
+	}
+	return registry.Credentials{Username: tokenUsername, Password: secret}, nil
+}
+
+// WithPullCredentials returns a copy of the client which logs in to the registry
+// of each image it pulls with the credentials creds has for the registry's host,
+// if any, before the first pull from it. Docker keeps the credentials in its
+// config, as with 'docker login', unless the client has temporary logins.
+func (i ImageClient) WithPullCredentials(creds registry.CredentialStore) ImageClient {
+	i.pullLogins = &pullLogins{creds: creds, done: map[string]error{}}
+	return i
+}
+
+// pullLogins logs in to each registry with credentials once, however many images
+// are pulled from it. It's safe for concurrent use.
+type pullLogins struct {
+	creds registry.CredentialStore
+	mu    sync.Mutex
+	// done is the result of logging in to each host logged in to
+	done map[string]error
+}
+
+// loginForPull logs in to the registry of img if there are credentials for it
+// and it hasn't been logged in to already
+func (i ImageClient) loginForPull(img string) error {
+	if i.pullLogins == nil {
+		return nil
+	}
+	ref, err := registry.ParseReference(img)
+	if err != nil {
+		return nil
+	}
+	creds, ok := i.pullLogins.creds.Get(ref.Host)
+	if !ok {
+		return nil
+	}
+
+	i.pullLogins.mu.Lock()
+	defer i.pullLogins.mu.Unlock()
+	if err, done := i.pullLogins.done[ref.Host]; done {
+		return err
+	}
+	log.Infof("Logging in to registry %v for pulls", ref.Host)
+	err = i.LoginForCommand(ref.Host, creds.Username, creds.Password)
+	i.pullLogins.done[ref.Host] = err
+	return err
+}
+
+// WithTemporaryLogins returns a copy of the client which makes the logins it needs
+// for pulls and pushes in config, docker's config for this command only, so the
+// credentials are removed along with it rather than kept in the user's config.
+func (i ImageClient) WithTemporaryLogins(config *registry.TemporaryDockerConfig) ImageClient {
+	i.loginConfig = config
+	return i
+}
+
+// LoginForCommand logs in to a registry for the pulls and pushes that follow. With
+// temporary logins, the credentials are kept only in their config.
+func (i ImageClient) LoginForCommand(registryHost, username, password string) error {
+	if i.loginConfig != nil {
+		if err := i.loginConfig.StoreInFile(registryHost); err != nil {
+			return errors.Wrapf(err, "couldn't log in to %v", registryHost)
+		}
+	}
+	return errors.Wrapf(i.dockerClient.Login(registryHost, username, password), "couldn't log in to %v", registryHost)
+}
+
+// WithAuthRefs returns a copy of the client which, before pulling or pushing an
+// image whose override has an authRef, logs in to the image's registry with the
+// credentials held by the environment variable it names, looked up with getenv.
+// Without it, pulling or pushing such an image fails.
+func (i ImageClient) WithAuthRefs(getenv func(string) string) ImageClient {
+	i.authRefLogins = &authRefLogins{getenv: getenv, done: map[string]error{}}
+	return i
+}
+
+// authRefLogins logs in to each registry once for each authRef used with it. It's
+// safe for concurrent use.
+type authRefLogins struct {
+	getenv func(string) string
+	mu     sync.Mutex
+	// done is the result of logging in to each host with each authRef, by host and authRef
+	done map[string]error
+}
+
+// loginForAuthRef logs in to the registry of img with the credentials its
+// override's authRef names, if any, unless already logged in with them
+func (i ImageClient) loginForAuthRef(img Config) error {
+	authRef := img.Override().AuthRef
+	if len(authRef) == 0 {
+		return nil
+	}
+	if i.authRefLogins == nil {
+		return errors.Errorf("image %v has authRef %v, but the client wasn't given the environment to resolve it", img.GetE2EImage(), authRef)
+	}
+
+	host := img.host()
+	key := host + " " + authRef
+	i.authRefLogins.mu.Lock()
+	defer i.authRefLogins.mu.Unlock()
+	if err, done := i.authRefLogins.done[key]; done {
+		return err
+	}
+	creds, err := credentialsFromEnv(authRef, host, i.authRefLogins.getenv)
+	if err == nil {
+		log.Infof("Logging in to registry %v with $%v", host, authRef)
+		err = i.LoginForCommand(host, creds.Username, creds.Password)
+	}
+	i.authRefLogins.done[key] = err
+	return err
+}
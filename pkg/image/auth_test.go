@@ -0,0 +1,131 @@
+/*
+Copyright the Sonobuoy contributors 2019
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package image
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/heptio/sonobuoy/pkg/image/docker"
+	"github.com/heptio/sonobuoy/pkg/image/registry"
+	"github.com/sirupsen/logrus"
+)
+
+func TestParseUpstreamAuth(t *testing.T) {
+	env := map[string]string{
+		"GCR_TOKEN": "ya29.token",
+		"QUAY_AUTH": "robot:secret:with:colons",
+	}
+	getenv := func(k string) string { return env[k] }
+
+	tests := map[string]struct {
+		values  []string
+		want    registry.CredentialStore
+		wantErr bool
+	}{
+		"token and username:password": {
+			values: []string{"gcr.io=GCR_TOKEN", "quay.io=QUAY_AUTH"},
+			want: registry.CredentialStore{
+				"gcr.io":  {Username: "oauth2accesstoken", Password: "ya29.token"},
+				"quay.io": {Username: "robot", Password: "secret:with:colons"},
+			},
+		},
+		"missing variable": {
+			values:  []string{"gcr.io"},
+			wantErr: true,
+		},
+		"empty variable": {
+			values:  []string{"gcr.io=UNSET"},
+			wantErr: true,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := ParseUpstreamAuth(tc.values, getenv)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("expected error %v, got %v", tc.wantErr, err)
+			}
+			if !tc.wantErr && !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("Expected credentials %v but got %v", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestPullCredentials(t *testing.T) {
+	logrus.SetOutput(ioutil.Discard)
+
+	images := map[string]Config{
+		"A": {registry: "gcr.io/heptio-images", name: "a", version: "1.0"},
+		"B": {registry: "gcr.io/google-containers", name: "b", version: "1.0"},
+		"C": {registry: "quay.io/coreos", name: "c", version: "1.0"},
+	}
+	logins := []string{}
+	imgClient := ImageClient{dockerClient: FakeDockerClient{logins: &logins}}.
+		WithPullCredentials(registry.CredentialStore{"gcr.io": {Username: "oauth2accesstoken", Password: "token"}})
+
+	if _, errs := imgClient.PullImages(images, docker.PullOptions{}, 0); len(errs) != 0 {
+		t.Fatalf("unexpected errors: %v", errs)
+	}
+	// Only the registry with credentials is logged in to, once
+	if want := []string{"gcr.io oauth2accesstoken:token"}; !reflect.DeepEqual(logins, want) {
+		t.Errorf("Expected logins %v but got %v", want, logins)
+	}
+}
+
+func TestTemporaryPullCredentials(t *testing.T) {
+	logrus.SetOutput(ioutil.Discard)
+
+	dir, err := ioutil.TempDir("", "docker-config")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	config, err := registry.NewTemporaryDockerConfig(filepath.Join(dir, "config.json"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer config.Remove()
+
+	images := map[string]Config{
+		"A": {registry: "gcr.io/heptio-images", name: "a", version: "1.0"},
+	}
+	logins := []string{}
+	imgClient := ImageClient{dockerClient: FakeDockerClient{logins: &logins}}.
+		WithPullCredentials(registry.CredentialStore{"gcr.io": {Username: "oauth2accesstoken", Password: "token"}}).
+		WithTemporaryLogins(config)
+
+	if _, errs := imgClient.PullImages(images, docker.PullOptions{}, 0); len(errs) != 0 {
+		t.Fatalf("unexpected errors: %v", errs)
+	}
+	if want := []string{"gcr.io oauth2accesstoken:token"}; !reflect.DeepEqual(logins, want) {
+		t.Errorf("Expected logins %v but got %v", want, logins)
+	}
+	// The login is kept in the temporary config rather than a credential helper
+	contents, err := ioutil.ReadFile(filepath.Join(config.Dir, "config.json"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.Contains(string(contents), `"gcr.io": ""`) {
+		t.Errorf("Expected gcr.io to be stored in the temporary config, got %s", contents)
+	}
+}
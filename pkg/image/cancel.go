@@ -0,0 +1,41 @@
+/*
+Copyright the Sonobuoy contributors 2019
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package image
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+)
+
+// ErrCanceled is the error to report in place of whatever the operations in flight
+// failed with once their context was cancelled, e.g. by the user interrupting them.
+var ErrCanceled = errors.New("operation cancelled")
+
+// WithContext returns a copy of the client which stops working through a set of
+// images once ctx is done. The docker command in flight is left to exit on its
+// own, as it does when interrupted along with sonobuoy; tar files it was writing
+// are removed.
+func (i ImageClient) WithContext(ctx context.Context) ImageClient {
+	i.ctx = ctx
+	return i
+}
+
+// canceled reports whether the client's context is done
+func (i ImageClient) canceled() bool {
+	return i.ctx != nil && i.ctx.Err() != nil
+}
@@ -0,0 +1,52 @@
+/*
+Copyright the Sonobuoy contributors 2019
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package image
+
+import (
+	"context"
+	"testing"
+
+	"github.com/heptio/sonobuoy/pkg/image/docker"
+)
+
+func TestWithContextCanceled(t *testing.T) {
+	defer chdirTemp(t)()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	pulls := []string{}
+	imgClient := ImageClient{
+		dockerClient: FakeDockerClient{pulls: &pulls},
+	}.WithContext(ctx)
+
+	if _, errs := imgClient.PullImages(imgs, docker.PullOptions{}, 0); len(errs) != 0 || len(pulls) != 1 {
+		t.Fatalf("Expected 1 pull without errors before cancelling but got %d pulls and %v", len(pulls), errs)
+	}
+
+	cancel()
+	pulls = pulls[:0]
+	if _, errs := imgClient.PullImages(imgs, docker.PullOptions{}, 0); len(errs) != 0 || len(pulls) != 0 {
+		t.Errorf("Expected no pulls after cancelling but got %d pulls and %v", len(pulls), errs)
+	}
+
+	files, err := imgClient.DownloadImageBatches([]string{"a", "b"}, "v1.14.0", 1)
+	if err != ErrCanceled {
+		t.Errorf("Expected error %v but got %v", ErrCanceled, err)
+	}
+	if len(files) != 0 {
+		t.Errorf("Expected no tar files written after cancelling but got %v", files)
+	}
+}
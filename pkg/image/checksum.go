@@ -0,0 +1,140 @@
+/*
+Copyright the Sonobuoy contributors 2019
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package image
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// checksumSuffix is the suffix of a tar's sibling checksum file, in the format written by sha256sum
+const checksumSuffix = ".sha256"
+
+// ErrChecksumMismatch is the cause of errors from a tar not matching its expected checksum
+var ErrChecksumMismatch = errors.New("checksum mismatch")
+
+// VerifyChecksum checks the SHA-256 checksum of the file at path. The expected
+// checksum is given in hex, optionally prefixed by "sha256:". If it is empty, the
+// checksum is read from a sibling file named path+".sha256" instead; if there is no
+// such file, nothing is verified.
+func VerifyChecksum(path, expected string) error {
+	if expected == "" {
+		contents, err := ioutil.ReadFile(path + checksumSuffix)
+		if os.IsNotExist(err) {
+			return nil
+		}
+		if err != nil {
+			return errors.Wrapf(err, "couldn't read checksum of %v", path)
+		}
+		fields := strings.Fields(string(contents))
+		if len(fields) == 0 {
+			return errors.Errorf("checksum file %v is empty", path+checksumSuffix)
+		}
+		expected = fields[0]
+	}
+	expected = strings.ToLower(strings.TrimPrefix(expected, "sha256:"))
+
+	got, err := fileChecksum(path)
+	if err != nil {
+		return err
+	}
+	if got != expected {
+		return errors.WithMessage(ErrChecksumMismatch, "file "+path+" has checksum "+got+", expected "+expected)
+	}
+	return nil
+}
+
+// fileChecksum returns the hex SHA-256 checksum of the file at path
+func fileChecksum(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", errors.Wrapf(err, "couldn't open %v", path)
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", errors.Wrapf(err, "couldn't read %v", path)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// writeChecksumFile writes the checksum of the file at path to its sibling checksum
+// file, as "sha256sum path" would, so that "sha256sum -c" run beside it checks it too.
+func writeChecksumFile(path, checksum string) error {
+	line := checksum + "  " + filepath.Base(path) + "\n"
+	if err := ioutil.WriteFile(path+checksumSuffix, []byte(line), 0644); err != nil {
+		return errors.Wrapf(err, "couldn't write checksum of %v", path)
+	}
+	return nil
+}
+
+// LoadImages loads the images in a tar file into the local docker client, first
+// verifying the tar against checksum as described by VerifyChecksum.
+func (i ImageClient) LoadImages(path, checksum string) error {
+	progress := ImageProgress{Name: path, Operation: OperationLoad, Status: ProgressStarted, Current: 1, Total: 1}
+	i.report(progress)
+
+	err := i.loadTar(path, checksum)
+	i.reportResult(progress, err)
+	return err
+}
+
+// loadTar verifies a tar's checksum and loads it. docker load decompresses gzip,
+// bzip2 and xz tars itself; zstd ones, as written by download --pipe-through
+// 'zstd', are decompressed on the way in.
+func (i ImageClient) loadTar(path, checksum string) error {
+	if err := VerifyChecksum(path, checksum); err != nil {
+		return errors.Wrapf(err, "not loading %v", path)
+	}
+	format, err := fileCompression(path)
+	if err != nil {
+		return errors.Wrapf(err, "not loading %v", path)
+	}
+	load := i.dockerClient.Load
+	switch {
+	case format == compressionZstd:
+		load = i.loadDecompressed
+	case i.rateLimit > 0:
+		load = i.loadLimited
+	}
+	return errors.Wrapf(load(path), "couldn't load %v", path)
+}
+
+// loadDecompressed loads the decompressed contents of the tar at path, at no more
+// than the rate limit if there is one
+func (i ImageClient) loadDecompressed(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return errors.Wrap(err, "couldn't open tar file")
+	}
+	defer f.Close()
+
+	r, err := decompressed(i.limitReader(f))
+	if err != nil {
+		return errors.Wrap(err, "couldn't read tar file")
+	}
+	defer r.Close()
+	return i.dockerClient.LoadFrom(r)
+}
@@ -0,0 +1,115 @@
+/*
+Copyright the Sonobuoy contributors 2019
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package image
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+// helloSHA256 is the SHA-256 checksum of "hello"
+const helloSHA256 = "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"
+
+func TestLoadImagesVerifiesChecksum(t *testing.T) {
+	tests := map[string]struct {
+		checksum     string
+		checksumFile string
+		wantLoaded   bool
+		wantMismatch bool
+	}{
+		"no checksum": {
+			wantLoaded: true,
+		},
+		"checksum matches": {
+			checksum:   "sha256:" + helloSHA256,
+			wantLoaded: true,
+		},
+		"checksum mismatch": {
+			checksum:     "0000",
+			wantMismatch: true,
+		},
+		"checksum file matches": {
+			checksumFile: helloSHA256 + "  images.tar\n",
+			wantLoaded:   true,
+		},
+		"checksum file mismatch": {
+			checksumFile: "0000  images.tar\n",
+			wantMismatch: true,
+		},
+		"checksum flag wins over file": {
+			checksum:     helloSHA256,
+			checksumFile: "0000  images.tar\n",
+			wantLoaded:   true,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "sonobuoy-load")
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			defer os.RemoveAll(dir)
+
+			path := filepath.Join(dir, "images.tar")
+			if err := ioutil.WriteFile(path, []byte("hello"), 0644); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if tc.checksumFile != "" {
+				if err := ioutil.WriteFile(path+checksumSuffix, []byte(tc.checksumFile), 0644); err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+			}
+
+			loaded := []string{}
+			imgClient := ImageClient{dockerClient: FakeDockerClient{loaded: &loaded}}
+			err = imgClient.LoadImages(path, tc.checksum)
+
+			if got := errors.Cause(err) == ErrChecksumMismatch; got != tc.wantMismatch {
+				t.Fatalf("Expected mismatch %v but got %v", tc.wantMismatch, err)
+			}
+			if got := len(loaded) == 1; got != tc.wantLoaded {
+				t.Errorf("Expected loaded %v but got %v", tc.wantLoaded, loaded)
+			}
+		})
+	}
+}
+
+func TestWriteChecksumFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sonobuoy-checksum")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "images.tar")
+	if err := writeChecksumFile(path, helloSHA256); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	got, err := ioutil.ReadFile(path + checksumSuffix)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// The format of sha256sum, with the tar named relative to the checksum file
+	if want := helloSHA256 + "  images.tar\n"; string(got) != want {
+		t.Errorf("Expected checksum file %q but got %q", want, got)
+	}
+}
@@ -0,0 +1,161 @@
+/*
+Copyright the Sonobuoy contributors 2019
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package image
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/c2h5oh/datasize"
+)
+
+// ConcurrencyRecorder records the throughput of the images an ImageClient works
+// through, and how busy each of its workers was, to show whether transferring
+// several images at once helps.
+type ConcurrencyRecorder struct {
+	mu      sync.Mutex
+	now     func() time.Time
+	first   time.Time
+	last    time.Time
+	images  int
+	bytes   int64
+	workers []workerStats
+}
+
+// workerStats is what a worker of a ConcurrencyRecorder has done
+type workerStats struct {
+	busy   bool
+	images int
+	worked time.Duration
+}
+
+// ConcurrencySummary is the throughput recorded by a ConcurrencyRecorder
+type ConcurrencySummary struct {
+	Images  int
+	Bytes   int64
+	Elapsed time.Duration
+	Workers []WorkerUtilization
+}
+
+// WorkerUtilization is how much a worker did, and the fraction of the elapsed time
+// it spent working
+type WorkerUtilization struct {
+	Images      int
+	Busy        time.Duration
+	Utilization float64
+}
+
+// NewConcurrencyRecorder returns an empty ConcurrencyRecorder
+func NewConcurrencyRecorder() *ConcurrencyRecorder {
+	return &ConcurrencyRecorder{now: time.Now}
+}
+
+// WithConcurrencyRecorder returns a copy of the client recording the images it
+// pushes, and the workers pushing them, to r.
+func (i ImageClient) WithConcurrencyRecorder(r *ConcurrencyRecorder) ImageClient {
+	i.concurrency = r
+	return i
+}
+
+// begin starts an image on the lowest numbered idle worker, returning the worker
+// and when it started.
+func (r *ConcurrencyRecorder) begin() (int, time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := r.now()
+	if r.first.IsZero() {
+		r.first = now
+	}
+	for n := range r.workers {
+		if !r.workers[n].busy {
+			r.workers[n].busy = true
+			return n, now
+		}
+	}
+	r.workers = append(r.workers, workerStats{busy: true})
+	return len(r.workers) - 1, now
+}
+
+// finish ends the image a worker started at started
+func (r *ConcurrencyRecorder) finish(worker int, started time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := r.now()
+	r.last = now
+	r.images++
+	w := &r.workers[worker]
+	w.busy = false
+	w.images++
+	w.worked += now.Sub(started)
+}
+
+// AddBytes adds n to the bytes transferred
+func (r *ConcurrencyRecorder) AddBytes(n int64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.bytes += n
+}
+
+// Summary returns the throughput recorded so far
+func (r *ConcurrencyRecorder) Summary() ConcurrencySummary {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	s := ConcurrencySummary{Images: r.images, Bytes: r.bytes, Workers: []WorkerUtilization{}}
+	if r.images > 0 {
+		s.Elapsed = r.last.Sub(r.first)
+	}
+	for _, w := range r.workers {
+		u := WorkerUtilization{Images: w.images, Busy: w.worked}
+		if s.Elapsed > 0 {
+			u.Utilization = float64(w.worked) / float64(s.Elapsed)
+		}
+		s.Workers = append(s.Workers, u)
+	}
+	return s
+}
+
+// ImagesPerMinute is the rate images were worked through
+func (s ConcurrencySummary) ImagesPerMinute() float64 {
+	if s.Elapsed <= 0 {
+		return 0
+	}
+	return float64(s.Images) / s.Elapsed.Minutes()
+}
+
+// BytesPerSecond is the rate bytes were transferred
+func (s ConcurrencySummary) BytesPerSecond() float64 {
+	if s.Elapsed <= 0 {
+		return 0
+	}
+	return float64(s.Bytes) / s.Elapsed.Seconds()
+}
+
+// Write writes the throughput to w, followed by a table of each worker's utilization
+func (s ConcurrencySummary) Write(w io.Writer) {
+	fmt.Fprintf(w, "Throughput: %.1f images/minute, %s/s over %v with %d workers\n",
+		s.ImagesPerMinute(), datasize.ByteSize(s.BytesPerSecond()).HumanReadable(), roundElapsed(s.Elapsed), len(s.Workers))
+
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "WORKER\tIMAGES\tBUSY\tUTILIZATION")
+	for n, u := range s.Workers {
+		fmt.Fprintf(tw, "%d\t%d\t%v\t%.0f%%\n", n+1, u.Images, roundElapsed(u.Busy), 100*u.Utilization)
+	}
+	tw.Flush()
+}
@@ -0,0 +1,90 @@
+/*
+Copyright the Sonobuoy contributors 2019
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package image
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestConcurrencyRecorder(t *testing.T) {
+	r := NewConcurrencyRecorder()
+	clock := time.Date(2019, 5, 1, 12, 0, 0, 0, time.UTC)
+	r.now = func() time.Time { return clock }
+	advance := func(d time.Duration) { clock = clock.Add(d) }
+
+	// Two workers for the first 20s, then one alone for 10s
+	a, aStarted := r.begin()
+	b, bStarted := r.begin()
+	r.AddBytes(45 * 1024 * 1024)
+	advance(20 * time.Second)
+	r.finish(b, bStarted)
+	c, cStarted := r.begin()
+	r.finish(a, aStarted)
+	advance(10 * time.Second)
+	r.finish(c, cStarted)
+	if b != 1 || c != 1 {
+		t.Fatalf("Expected the idle worker to be reused, got workers %d, %d and %d", a, b, c)
+	}
+
+	s := r.Summary()
+	if s.Images != 3 || s.Elapsed != 30*time.Second {
+		t.Fatalf("Unexpected summary %+v", s)
+	}
+	if got := s.ImagesPerMinute(); got != 6 {
+		t.Errorf("Expected 6 images/minute but got %v", got)
+	}
+	if got := s.BytesPerSecond(); got != 1.5*1024*1024 {
+		t.Errorf("Expected 1.5MB/s but got %v", got)
+	}
+
+	var out bytes.Buffer
+	s.Write(&out)
+	want := `Throughput: 6.0 images/minute, 1.5 MB/s over 30s with 2 workers
+WORKER  IMAGES  BUSY  UTILIZATION
+1       1       20s   67%
+2       2       30s   100%
+`
+	if out.String() != want {
+		t.Errorf("Expected report:\n%s\nbut got:\n%s", want, out.String())
+	}
+}
+
+func TestPushImagesConcurrencyRecorder(t *testing.T) {
+	private := map[string]Config{
+		"test": {name: "test1", registry: "private.io/sonobuoy", version: "x.y"},
+	}
+	r := NewConcurrencyRecorder()
+	imgClient := ImageClient{dockerClient: FakeDockerClient{}}.WithParallel(2).WithConcurrencyRecorder(r)
+
+	if _, errs := imgClient.PushImages(imgs, private, []string{"stable"}, 0); len(errs) != 0 {
+		t.Fatalf("Expected no errors but got %v", errs)
+	}
+
+	s := r.Summary()
+	if s.Images != 2 || s.Bytes != 2*fakeImageSize {
+		t.Errorf("Expected 2 images of %d bytes but got %+v", fakeImageSize, s)
+	}
+	images := 0
+	for _, w := range s.Workers {
+		images += w.Images
+	}
+	if images != 2 || len(s.Workers) > 2 {
+		t.Errorf("Expected 2 images across at most 2 workers but got %+v", s.Workers)
+	}
+}
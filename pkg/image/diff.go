@@ -0,0 +1,106 @@
+/*
+Copyright the Sonobuoy contributors 2019
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package image
+
+import (
+	"github.com/heptio/sonobuoy/pkg/image/registry"
+	"github.com/pkg/errors"
+)
+
+// DiffStatus describes how a private image compares to its upstream image
+type DiffStatus string
+
+const (
+	// DiffMatching means the private image exists with the same digest as upstream
+	DiffMatching DiffStatus = "matching"
+	// DiffDifferent means the private image exists but its digest differs from upstream
+	DiffDifferent DiffStatus = "different-digest"
+	// DiffMissing means the private image doesn't exist
+	DiffMissing DiffStatus = "missing"
+)
+
+// Digester looks up the digest of an image in its registry
+type Digester interface {
+	Digest(image string) (string, error)
+}
+
+// PlatformDigester looks up the digest of an image in its registry and, for a
+// multi-arch image, the digests of the platform manifests its manifest list holds
+type PlatformDigester interface {
+	Digester
+	PlatformDigests(image string) ([]string, error)
+}
+
+// ImageDiff is the comparison of one private image against its upstream image
+type ImageDiff struct {
+	Upstream string
+	Private  string
+	Status   DiffStatus
+}
+
+// DiffImages compares each private image against its upstream counterpart in
+// their registries, without pulling or pushing anything. Images whose private
+// and upstream references are the same are skipped. A private image matches a
+// multi-arch upstream image if it is the manifest list or any platform manifest
+// in it, since docker pull and push mirror a single platform.
+func DiffImages(upstreamImages, privateImages map[string]Config, digester PlatformDigester) ([]ImageDiff, []error) {
+	errs := []error{}
+	diffs := []ImageDiff{}
+	seen := map[string]bool{}
+
+	for _, k := range sortedKeys(upstreamImages) {
+		upstreamImg, privateImg := upstreamImages[k], privateImages[k]
+		upstream, private := upstreamImg.GetE2EImage(), privateImg.GetE2EImage()
+		if upstream == private || seen[private] {
+			continue
+		}
+		seen[private] = true
+
+		privateDigest, err := digester.Digest(private)
+		if errors.Cause(err) == registry.ErrNotFound {
+			diffs = append(diffs, ImageDiff{Upstream: upstream, Private: private, Status: DiffMissing})
+			continue
+		}
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		upstreamDigest, err := digester.Digest(upstream)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		status := DiffMatching
+		if privateDigest != upstreamDigest {
+			platformDigests, err := digester.PlatformDigests(upstream)
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			status = DiffDifferent
+			for _, d := range platformDigests {
+				if d == privateDigest {
+					status = DiffMatching
+				}
+			}
+		}
+		diffs = append(diffs, ImageDiff{Upstream: upstream, Private: private, Status: status})
+	}
+	return diffs, errs
+}
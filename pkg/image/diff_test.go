@@ -0,0 +1,99 @@
+/*
+Copyright the Sonobuoy contributors 2019
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package image
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/heptio/sonobuoy/pkg/image/registry"
+	"github.com/pkg/errors"
+)
+
+// fakeDigester returns digests from a map, and ErrNotFound for anything else
+type fakeDigester map[string]string
+
+func (f fakeDigester) Digest(image string) (string, error) {
+	if d, ok := f[image]; ok {
+		if d == "error" {
+			return "", errors.New("registry unavailable")
+		}
+		return d, nil
+	}
+	return "", registry.ErrNotFound
+}
+
+// PlatformDigests returns the digests listed under an image's digest followed by
+// "list:", as for a manifest list, and none otherwise
+func (f fakeDigester) PlatformDigests(image string) ([]string, error) {
+	d, err := f.Digest(image)
+	if err != nil || !strings.HasPrefix(d, "list:") {
+		return nil, err
+	}
+	return strings.Split(strings.TrimPrefix(d, "list:"), ","), nil
+}
+
+func TestDiffImages(t *testing.T) {
+	upstream := map[string]Config{
+		"a":      {registry: "gcr.io/e2e", name: "a", version: "1.0"},
+		"b":      {registry: "gcr.io/e2e", name: "b", version: "1.0"},
+		"c":      {registry: "gcr.io/e2e", name: "c", version: "1.0"},
+		"d":      {registry: "gcr.io/e2e", name: "d", version: "1.0"},
+		"multi":  {registry: "gcr.io/e2e", name: "multi", version: "1.0"},
+		"stale":  {registry: "gcr.io/e2e", name: "stale", version: "1.0"},
+		"public": {registry: "docker.io/library", name: "busybox", version: "1.29"},
+	}
+	private := map[string]Config{
+		"a":      {registry: "private.io/e2e", name: "a", version: "1.0"},
+		"b":      {registry: "private.io/e2e", name: "b", version: "1.0"},
+		"c":      {registry: "private.io/e2e", name: "c", version: "1.0"},
+		"d":      {registry: "private.io/e2e", name: "d", version: "1.0"},
+		"multi":  {registry: "private.io/e2e", name: "multi", version: "1.0"},
+		"stale":  {registry: "private.io/e2e", name: "stale", version: "1.0"},
+		"public": {registry: "docker.io/library", name: "busybox", version: "1.29"},
+	}
+	digester := fakeDigester{
+		"gcr.io/e2e/a:1.0":     "sha256:aaa",
+		"private.io/e2e/a:1.0": "sha256:aaa",
+		"gcr.io/e2e/b:1.0":     "sha256:bbb",
+		"private.io/e2e/b:1.0": "sha256:old",
+		"gcr.io/e2e/c:1.0":     "sha256:ccc",
+		"private.io/e2e/d:1.0": "error",
+		// A manifest list upstream, mirrored for a single platform
+		"gcr.io/e2e/multi:1.0":     "list:sha256:amd64,sha256:arm64",
+		"private.io/e2e/multi:1.0": "sha256:amd64",
+		"gcr.io/e2e/stale:1.0":     "list:sha256:amd64,sha256:arm64",
+		"private.io/e2e/stale:1.0": "sha256:old",
+	}
+
+	got, errs := DiffImages(upstream, private, digester)
+	if len(errs) != 1 {
+		t.Fatalf("Expected 1 error but got %v", errs)
+	}
+
+	want := []ImageDiff{
+		{Upstream: "gcr.io/e2e/a:1.0", Private: "private.io/e2e/a:1.0", Status: DiffMatching},
+		{Upstream: "gcr.io/e2e/b:1.0", Private: "private.io/e2e/b:1.0", Status: DiffDifferent},
+		{Upstream: "gcr.io/e2e/c:1.0", Private: "private.io/e2e/c:1.0", Status: DiffMissing},
+		{Upstream: "gcr.io/e2e/multi:1.0", Private: "private.io/e2e/multi:1.0", Status: DiffMatching},
+		{Upstream: "gcr.io/e2e/stale:1.0", Private: "private.io/e2e/stale:1.0", Status: DiffDifferent},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("Expected %v but got %v", want, got)
+	}
+}
@@ -0,0 +1,65 @@
+/*
+Copyright the Sonobuoy contributors 2019
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package image
+
+import (
+	"path/filepath"
+
+	"github.com/c2h5oh/datasize"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// ErrInsufficientSpace is returned when the images to save wouldn't fit on the destination's disk
+var ErrInsufficientSpace = errors.New("insufficient disk space")
+
+// errFreeSpaceUnknown is returned by freeSpace on platforms where it can't be determined
+var errFreeSpaceUnknown = errors.New("free disk space unknown on this platform")
+
+// freeSpace returns the bytes available to the current user in the filesystem holding dir
+var freeSpace = availableBytes
+
+// checkDiskSpace returns ErrInsufficientSpace if the images, as reported by the local
+// docker client, are larger than the space available for fileName. Images that
+// can't be inspected aren't counted, since saving them will fail anyway.
+func (i ImageClient) checkDiskSpace(images []string, fileName string) error {
+	var needed int64
+	for _, img := range images {
+		info, err := i.dockerClient.Inspect(img)
+		if err != nil {
+			continue
+		}
+		needed += info.Size
+	}
+
+	dir := filepath.Dir(fileName)
+	available, err := freeSpace(dir)
+	if err != nil {
+		logrus.Warningf("Couldn't check free disk space in %v: %v", dir, err)
+		return nil
+	}
+
+	if needed > available {
+		return errors.WithMessage(ErrInsufficientSpace, errors.Errorf("saving to %v needs about %v but only %v is available",
+			fileName, humanSize(needed), humanSize(available)).Error())
+	}
+	return nil
+}
+
+func humanSize(n int64) string {
+	return datasize.ByteSize(n).HumanReadable()
+}
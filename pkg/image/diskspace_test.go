@@ -0,0 +1,81 @@
+/*
+Copyright the Sonobuoy contributors 2019
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package image
+
+import (
+	"os"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+func TestDownloadChecksDiskSpace(t *testing.T) {
+	defer func(f func(string) (int64, error)) { freeSpace = f }(freeSpace)
+	images := []string{"foo.io/sonobuoy/a:1.0", "foo.io/sonobuoy/b:1.0"}
+
+	tests := map[string]struct {
+		available int64
+		err       error
+		wantErr   error
+	}{
+		"enough space": {
+			available: 2 * fakeImageSize,
+		},
+		"not enough space": {
+			available: 2*fakeImageSize - 1,
+			wantErr:   ErrInsufficientSpace,
+		},
+		"free space unknown": {
+			err: errFreeSpaceUnknown,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			defer chdirTemp(t)()
+			freeSpace = func(string) (int64, error) { return tc.available, tc.err }
+
+			imgClient := ImageClient{dockerClient: FakeDockerClient{}}
+			fileName, err := imgClient.DownloadImages(images, "v1.14.0")
+			if errors.Cause(err) != tc.wantErr {
+				t.Fatalf("Expected error %v but got %v", tc.wantErr, err)
+			}
+			if tc.wantErr != nil {
+				if _, err := os.Stat(getTarFileName("v1.14.0", 0) + ".tmp"); !os.IsNotExist(err) {
+					t.Errorf("Expected nothing to be written when there isn't enough space")
+				}
+				return
+			}
+			if _, err := os.Stat(fileName); err != nil {
+				t.Errorf("Expected tar to be written: %v", err)
+			}
+		})
+	}
+}
+
+func TestAvailableBytes(t *testing.T) {
+	available, err := availableBytes(os.TempDir())
+	if err == errFreeSpaceUnknown {
+		t.Skip(err)
+	}
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if available <= 0 {
+		t.Errorf("Expected available space to be positive, got %d", available)
+	}
+}
@@ -17,60 +17,200 @@ limitations under the License.
 package docker
 
 import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+
 	"github.com/heptio/sonobuoy/pkg/image/exec"
+	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
 )
 
+// ErrUnauthorized is the cause of errors from registries rejecting the credentials used
+var ErrUnauthorized = errors.New("registry authentication failed")
+
+// ErrRateLimited is the cause of errors from registries refusing requests because
+// too many were made, such as Docker Hub's limit on anonymous pulls
+var ErrRateLimited = errors.New("registry rate limit exceeded")
+
+// ErrTooManyConcurrent is the cause of errors from the docker daemon or a registry
+// refusing a transfer because too many are running at once
+var ErrTooManyConcurrent = errors.New("too many concurrent transfers")
+
+// ErrImageNotFound is the cause of errors from inspecting images that aren't present locally
+var ErrImageNotFound = errors.New("image not present locally")
+
+// unauthorizedMessages are fragments of docker CLI output indicating an authentication failure
+var unauthorizedMessages = []string{
+	"unauthorized",
+	"authentication required",
+	"requested access to the resource is denied",
+	"no basic auth credentials",
+}
+
+// pushResultRegexp matches the line docker push prints once the manifest has been
+// uploaded, e.g. "1.0: digest: sha256:0123... size: 527"
+var pushResultRegexp = regexp.MustCompile(`(?m)^\S+: digest: (\S+) size: (\d+)\s*$`)
+
 type Docker interface {
-	PullIfNotPresent(image string, retries int) error
-	Pull(image string, retries int) error
-	Push(image string, retries int) error
+	PullIfNotPresent(image string, opts PullOptions, retries int) (bool, error)
+	Pull(image string, opts PullOptions, retries int) error
+	Push(image string, retries int) (PushResult, error)
 	Tag(src, dest string, retries int) error
 	Rmi(image string, retries int) error
 	Save(images []string, filename string) error
+	SaveTo(images []string, w io.Writer) error
+	Load(filename string) error
+	LoadFrom(r io.Reader) error
+	Inspect(image string) (ImageInfo, error)
+	DanglingImages() ([]string, error)
+	Login(registry, username, password string) error
+	Logout(registry string) error
+	ManifestCreate(list string, images []string) error
+	ManifestPush(list string, retries int) error
 }
 
+// PullOptions holds the options for pulling an image
+type PullOptions struct {
+	// AllTags pulls every tagged image in the repository; the image should be given without a tag
+	AllTags bool
+	// Platform is the platform to pull the image for, in the form os/arch[/variant].
+	// If empty, the platform of the docker daemon is used.
+	Platform string
+	// Layers, if set, is called with the progress of the layers docker reported
+	// in the last attempt at the pull, whether or not it succeeded.
+	Layers func(LayerProgress)
+}
+
+// ImageInfo holds the details docker reports about a local image
+type ImageInfo struct {
+	ID           string   `json:"Id"`
+	Size         int64    `json:"Size"`
+	Architecture string   `json:"Architecture"`
+	Os           string   `json:"Os"`
+	Variant      string   `json:"Variant"`
+	RepoTags     []string `json:"RepoTags"`
+	RepoDigests  []string `json:"RepoDigests"`
+}
+
+// PushResult holds the details the registry reported for a pushed image
+type PushResult struct {
+	// Image is the image reference that was pushed
+	Image string `json:"image"`
+	// Digest is the digest of the image manifest in the registry
+	Digest string `json:"digest"`
+	// Size is the size of the image manifest in bytes
+	Size int64 `json:"size"`
+	// Layers is the progress of the layers docker reported
+	Layers LayerProgress `json:"-"`
+}
+
+// LocalDocker implements Docker by running the local docker CLI
 type LocalDocker struct {
+	// Cmder creates the docker commands to run. If nil, exec.DefaultCmder is used.
+	Cmder exec.Cmder
+}
+
+// command returns a docker command with the given arguments
+func (l LocalDocker) command(args ...string) exec.Cmd {
+	cmder := l.Cmder
+	if cmder == nil {
+		cmder = exec.DefaultCmder
+	}
+	return cmder.Command("docker", args...)
+}
+
+// run runs a docker command, retrying up to retries times with backoff unless the
+// registry rejected the credentials, which retrying won't fix. It returns the
+// combined output of the last attempt.
+func (l LocalDocker) run(retries int, args ...string) (string, error) {
+	return exec.RetryWithOutput(func() exec.Cmd { return l.command(args...) }, retries, isRetryable)
 }
 
 // PullIfNotPresent will pull an image if it is not present locally
 // retrying up to retries times
-// returns errors from pulling
-func (l LocalDocker) PullIfNotPresent(image string, retries int) error {
+// returns whether the image was pulled and errors from pulling
+func (l LocalDocker) PullIfNotPresent(image string, opts PullOptions, retries int) (bool, error) {
 	// TODO(bentheelder): switch most (all) of the logging here to debug level
 	// once we have configurable log levels
 	// if this did not return an error, then the image exists locally
-	cmd := exec.Command("docker", "inspect", "--type=image", image)
+	cmd := l.command("inspect", "--type=image", image)
 	if err := cmd.Run(); err == nil {
 		log.Infof("Image: %s present locally", image)
-		return nil
+		return false, nil
 	}
 	// otherwise try to pull it
-	return l.Pull(image, retries)
+	if err := l.Pull(image, opts, retries); err != nil {
+		return false, err
+	}
+	return true, nil
 }
 
-// Pull pulls an image, retrying up to retries times
-func (l LocalDocker) Pull(image string, retries int) error {
+// Pull pulls an image, retrying up to retries times. If the registry refuses the
+// pull because of its rate limit, the returned error's cause is ErrRateLimited; if
+// it rejects the credentials, the pull isn't retried and the cause is ErrUnauthorized.
+// If the daemon or registry refused it because too many transfers were running,
+// the cause is ErrTooManyConcurrent. If the last attempt failed after layers were
+// reported, the error also records how far it got, as returned by PartialProgress.
+func (l LocalDocker) Pull(image string, opts PullOptions, retries int) error {
 	log.Infof("Pulling image: %s ...", image)
-	return exec.RunLoggingOutputOnFail(exec.Command("docker", "pull", image), retries)
+	args := []string{"pull"}
+	if opts.AllTags {
+		args = append(args, "--all-tags")
+	}
+	if len(opts.Platform) > 0 {
+		args = append(args, "--platform", opts.Platform)
+	}
+	args = append(args, image)
+	out, err := l.run(retries, args...)
+	if err != nil && isTooManyConcurrent(out) {
+		err = errors.WithMessage(ErrTooManyConcurrent, err.Error())
+	} else if err != nil && isRateLimited(out) {
+		err = errors.WithMessage(ErrRateLimited, err.Error())
+	} else if err != nil && isUnauthorized(out) {
+		err = errors.WithMessage(ErrUnauthorized, err.Error())
+	}
+	if opts.Layers != nil {
+		opts.Layers(parseLayerProgress(out, pullCompleteStatuses))
+	}
+	return withLayerProgress(err, out, pullCompleteStatuses)
 }
 
-// Push pushes an image, retrying up to retries times
-func (l LocalDocker) Push(image string, retries int) error {
+// Push pushes an image, retrying up to retries times, and returns the digest and
+// size reported by the registry. If the registry rejects the credentials, the push
+// isn't retried and the returned error's cause is ErrUnauthorized. As with Pull,
+// the error of a push that stopped part way records the layers completed.
+func (l LocalDocker) Push(image string, retries int) (PushResult, error) {
 	log.Infof("Pushing image: %s ...", image)
-	return exec.RunLoggingOutputOnFail(exec.Command("docker", "push", image), retries)
+	out, err := l.run(retries, "push", image)
+	if err != nil {
+		if isUnauthorized(out) {
+			err = errors.WithMessage(ErrUnauthorized, err.Error())
+		} else if isTooManyConcurrent(out) {
+			err = errors.WithMessage(ErrTooManyConcurrent, err.Error())
+		}
+		return PushResult{}, withLayerProgress(err, out, pushCompleteStatuses)
+	}
+	result := parsePushResult(image, out)
+	result.Layers = parseLayerProgress(out, pushCompleteStatuses)
+	return result, nil
 }
 
 // Tag tags an image, retrying up to retries times
 func (l LocalDocker) Tag(src, dest string, retries int) error {
 	log.Infof("Tagging image: %s as %s ...", src, dest)
-	return exec.RunLoggingOutputOnFail(exec.Command("docker", "tag", src, dest), retries)
+	_, err := l.run(retries, "tag", src, dest)
+	return err
 }
 
 // Rmi removes an image, retrying up to retries times
 func (l LocalDocker) Rmi(image string, retries int) error {
 	log.Infof("Deleting image: %s ...", image)
-	return exec.RunLoggingOutputOnFail(exec.Command("docker", "rmi", image), retries)
+	_, err := l.run(retries, "rmi", image)
+	return err
 }
 
 // Save exports a set of images to a tar file
@@ -83,5 +223,141 @@ func (l LocalDocker) Save(images []string, filename string) error {
 	args := append([]string{"save"}, images...)
 	args = append(args, "--output", filename)
 
-	return exec.RunLoggingOutputOnFail(exec.Command("docker", args...), 0)
+	return exec.RunLoggingOutputOnFail(l.command(args...))
+}
+
+// SaveTo exports a set of images as a tar stream written to w
+func (l LocalDocker) SaveTo(images []string, w io.Writer) error {
+	log.Info("Saving images: ...")
+
+	var stderr bytes.Buffer
+	cmd := l.command(append([]string{"save"}, images...)...)
+	cmd.SetStdout(w)
+	cmd.SetStderr(&stderr)
+	if err := cmd.Run(); err != nil {
+		return errors.Wrap(err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
+
+// Load imports the images in a tar file written by Save
+func (l LocalDocker) Load(filename string) error {
+	log.Infof("Loading images from: %s ...", filename)
+	return exec.RunLoggingOutputOnFail(l.command("load", "--input", filename))
+}
+
+// LoadFrom imports the images in a tar stream written by SaveTo
+func (l LocalDocker) LoadFrom(r io.Reader) error {
+	log.Info("Loading images from stream ...")
+	cmd := l.command("load")
+	cmd.SetStdin(r)
+	return exec.RunLoggingOutputOnFail(cmd)
+}
+
+// Inspect returns the details of a local image
+func (l LocalDocker) Inspect(image string) (ImageInfo, error) {
+	info := ImageInfo{}
+	out, err := exec.Output(l.command("image", "inspect", "--format", "{{json .}}", image))
+	if err != nil {
+		if strings.Contains(strings.ToLower(err.Error()), "no such image") {
+			return info, errors.WithMessage(ErrImageNotFound, image)
+		}
+		return info, errors.Wrapf(err, "couldn't inspect image %v", image)
+	}
+
+	if err := json.Unmarshal(out, &info); err != nil {
+		return info, errors.Wrapf(err, "couldn't decode details of image %v", image)
+	}
+	return info, nil
+}
+
+// DanglingImages returns the IDs of the local images that have no tag, shown by
+// docker as <none>:<none>, such as those left behind when a tag moves to a newer image.
+func (l LocalDocker) DanglingImages() ([]string, error) {
+	out, err := exec.Output(l.command("images", "--quiet", "--no-trunc", "--filter", "dangling=true"))
+	if err != nil {
+		return nil, errors.Wrap(err, "couldn't list dangling images")
+	}
+
+	seen := map[string]bool{}
+	ids := []string{}
+	for _, id := range strings.Fields(string(out)) {
+		if !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
+
+// Login stores credentials for a registry with the docker client, so that later
+// pushes and pulls use them. The password is passed on stdin rather than as an argument.
+func (l LocalDocker) Login(registry, username, password string) error {
+	log.Infof("Logging in to registry: %s ...", registry)
+	cmd := l.command("login", "--username", username, "--password-stdin", registry)
+	cmd.SetStdin(strings.NewReader(password))
+	return exec.RunLoggingOutputOnFail(cmd)
+}
+
+// Logout removes the docker client's stored credentials for a registry
+func (l LocalDocker) Logout(registry string) error {
+	log.Infof("Logging out of registry: %s ...", registry)
+	return exec.RunLoggingOutputOnFail(l.command("logout", registry))
+}
+
+// ManifestCreate creates a local manifest list referencing the images, which must
+// already be pushed. An existing local list of the same name is replaced.
+func (l LocalDocker) ManifestCreate(list string, images []string) error {
+	log.Infof("Creating manifest list: %s ...", list)
+	args := append([]string{"manifest", "create", "--amend", list}, images...)
+	return exec.RunLoggingOutputOnFail(l.command(args...))
+}
+
+// ManifestPush pushes a manifest list created by ManifestCreate, removing the local copy
+func (l LocalDocker) ManifestPush(list string, retries int) error {
+	log.Infof("Pushing manifest list: %s ...", list)
+	_, err := l.run(retries, "manifest", "push", "--purge", list)
+	return err
+}
+
+// parsePushResult extracts the pushed digest and size from docker push output.
+// Fields that can't be found are left empty.
+func parsePushResult(image, output string) PushResult {
+	result := PushResult{Image: image}
+	match := pushResultRegexp.FindStringSubmatch(output)
+	if match == nil {
+		log.Warnf("couldn't find the digest of pushed image %v in docker output", image)
+		return result
+	}
+	result.Digest = match[1]
+	result.Size, _ = strconv.ParseInt(match[2], 10, 64)
+	return result
+}
+
+// isRateLimited reports whether docker CLI output indicates a registry rate limit was hit
+func isRateLimited(output string) bool {
+	output = strings.ToLower(output)
+	return strings.Contains(output, "toomanyrequests") || strings.Contains(output, "429 too many requests")
+}
+
+// isTooManyConcurrent reports whether docker CLI output indicates a transfer was
+// refused because too many were running at once
+func isTooManyConcurrent(output string) bool {
+	return strings.Contains(strings.ToLower(output), "too many concurrent")
+}
+
+// isRetryable reports whether a failed docker command is worth retrying given its output
+func isRetryable(output string) bool {
+	return !isUnauthorized(output)
+}
+
+// isUnauthorized reports whether docker CLI output indicates an authentication failure
+func isUnauthorized(output string) bool {
+	output = strings.ToLower(output)
+	for _, msg := range unauthorizedMessages {
+		if strings.Contains(output, msg) {
+			return true
+		}
+	}
+	return false
 }
@@ -0,0 +1,505 @@
+/*
+Copyright the Sonobuoy contributors 2019
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package docker
+
+import (
+	"io"
+	"io/ioutil"
+	"reflect"
+	"testing"
+
+	"github.com/heptio/sonobuoy/pkg/image/exec"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// fakeCmder records every command it runs instead of executing it. Commands
+// fail as many times as configured in failures, keyed by docker subcommand.
+type fakeCmder struct {
+	runs     [][]string
+	failures map[string]int
+	output   map[string]string
+	stdin    []string
+}
+
+func (f *fakeCmder) Command(name string, args ...string) exec.Cmd {
+	return &fakeCmd{cmder: f, args: append([]string{name}, args...)}
+}
+
+type fakeCmd struct {
+	cmder  *fakeCmder
+	args   []string
+	stdin  io.Reader
+	stdout io.Writer
+	stderr io.Writer
+}
+
+func (c *fakeCmd) Run() error {
+	c.cmder.runs = append(c.cmder.runs, c.args)
+	if c.stdin != nil {
+		b, _ := ioutil.ReadAll(c.stdin)
+		c.cmder.stdin = append(c.cmder.stdin, string(b))
+	}
+	subcommand := c.args[1]
+	if out, ok := c.cmder.output[subcommand]; ok && c.stdout != nil {
+		io.WriteString(c.stdout, out)
+	}
+	if c.cmder.failures[subcommand] > 0 {
+		c.cmder.failures[subcommand]--
+		return errors.Errorf("%v failed", subcommand)
+	}
+	return nil
+}
+
+func (c *fakeCmd) SetEnv(...string) exec.Cmd      { return c }
+func (c *fakeCmd) SetStdin(r io.Reader) exec.Cmd  { c.stdin = r; return c }
+func (c *fakeCmd) SetStdout(w io.Writer) exec.Cmd { c.stdout = w; return c }
+func (c *fakeCmd) SetStderr(w io.Writer) exec.Cmd { c.stderr = w; return c }
+
+func newFakeCmder(failures map[string]int) *fakeCmder {
+	return &fakeCmder{failures: failures}
+}
+
+func TestPullIfNotPresent(t *testing.T) {
+	logrus.SetOutput(ioutil.Discard)
+
+	tests := map[string]struct {
+		failures map[string]int
+		wantRuns [][]string
+		wantErr  bool
+	}{
+		"image present locally": {
+			failures: map[string]int{},
+			wantRuns: [][]string{
+				{"docker", "inspect", "--type=image", "foo.io/test:1.0"},
+			},
+		},
+		"image missing is pulled": {
+			failures: map[string]int{"inspect": 1},
+			wantRuns: [][]string{
+				{"docker", "inspect", "--type=image", "foo.io/test:1.0"},
+				{"docker", "pull", "foo.io/test:1.0"},
+			},
+		},
+		"pull failure is returned": {
+			failures: map[string]int{"inspect": 1, "pull": 1},
+			wantRuns: [][]string{
+				{"docker", "inspect", "--type=image", "foo.io/test:1.0"},
+				{"docker", "pull", "foo.io/test:1.0"},
+			},
+			wantErr: true,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			cmder := newFakeCmder(tc.failures)
+			d := LocalDocker{Cmder: cmder}
+
+			_, err := d.PullIfNotPresent("foo.io/test:1.0", PullOptions{}, 0)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("expected error %v, got %v", tc.wantErr, err)
+			}
+			if !reflect.DeepEqual(cmder.runs, tc.wantRuns) {
+				t.Errorf("expected commands %v, got %v", tc.wantRuns, cmder.runs)
+			}
+		})
+	}
+}
+
+func TestRetries(t *testing.T) {
+	logrus.SetOutput(ioutil.Discard)
+
+	tests := map[string]struct {
+		failures map[string]int
+		output   string
+		retries  int
+		wantRuns int
+		wantErr  bool
+	}{
+		"succeeds first time": {
+			failures: map[string]int{},
+			retries:  1,
+			wantRuns: 1,
+		},
+		"succeeds after retry": {
+			failures: map[string]int{"push": 1},
+			retries:  1,
+			wantRuns: 2,
+		},
+		"fails after retries": {
+			failures: map[string]int{"push": 2},
+			retries:  1,
+			wantRuns: 2,
+			wantErr:  true,
+		},
+		"no retries requested": {
+			failures: map[string]int{"push": 1},
+			retries:  0,
+			wantRuns: 1,
+			wantErr:  true,
+		},
+		"unauthorized isn't retried": {
+			failures: map[string]int{"push": 2},
+			output:   "unauthorized: authentication required",
+			retries:  1,
+			wantRuns: 1,
+			wantErr:  true,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			cmder := newFakeCmder(tc.failures)
+			cmder.output = map[string]string{"push": tc.output}
+			d := LocalDocker{Cmder: cmder}
+
+			_, err := d.Push("foo.io/test:1.0", tc.retries)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("expected error %v, got %v", tc.wantErr, err)
+			}
+			if len(cmder.runs) != tc.wantRuns {
+				t.Errorf("expected %d runs, got %d", tc.wantRuns, len(cmder.runs))
+			}
+		})
+	}
+}
+
+func TestInspect(t *testing.T) {
+	cmder := newFakeCmder(map[string]int{})
+	cmder.output = map[string]string{
+		"image": `{"Id":"sha256:abc","Size":1024,"Architecture":"amd64","Os":"linux","RepoTags":["foo.io/test:1.0"]}`,
+	}
+	d := LocalDocker{Cmder: cmder}
+
+	got, err := d.Inspect("foo.io/test:1.0")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := ImageInfo{ID: "sha256:abc", Size: 1024, Architecture: "amd64", Os: "linux", RepoTags: []string{"foo.io/test:1.0"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %+v, got %+v", want, got)
+	}
+
+	wantArgs := []string{"docker", "image", "inspect", "--format", "{{json .}}", "foo.io/test:1.0"}
+	if !reflect.DeepEqual(cmder.runs[0], wantArgs) {
+		t.Errorf("expected command %v, got %v", wantArgs, cmder.runs[0])
+	}
+}
+
+func TestDanglingImages(t *testing.T) {
+	cmder := newFakeCmder(map[string]int{})
+	cmder.output = map[string]string{
+		"images": "sha256:abc\nsha256:def\nsha256:abc\n",
+	}
+	d := LocalDocker{Cmder: cmder}
+
+	got, err := d.DanglingImages()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := []string{"sha256:abc", "sha256:def"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+
+	wantArgs := []string{"docker", "images", "--quiet", "--no-trunc", "--filter", "dangling=true"}
+	if !reflect.DeepEqual(cmder.runs[0], wantArgs) {
+		t.Errorf("expected command %v, got %v", wantArgs, cmder.runs[0])
+	}
+}
+
+func TestPushUnauthorized(t *testing.T) {
+	logrus.SetOutput(ioutil.Discard)
+
+	tests := map[string]struct {
+		output           string
+		wantUnauthorized bool
+	}{
+		"expired token": {
+			output:           "Get https://foo.io/v2/: unauthorized: authentication required",
+			wantUnauthorized: true,
+		},
+		"access denied": {
+			output:           "denied: requested access to the resource is denied",
+			wantUnauthorized: true,
+		},
+		"network error": {
+			output:           "net/http: TLS handshake timeout",
+			wantUnauthorized: false,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			cmder := newFakeCmder(map[string]int{"push": 1})
+			cmder.output = map[string]string{"push": tc.output}
+			d := LocalDocker{Cmder: cmder}
+
+			_, err := d.Push("foo.io/test:1.0", 0)
+			if err == nil {
+				t.Fatal("expected error, got nil")
+			}
+			if got := errors.Cause(err) == ErrUnauthorized; got != tc.wantUnauthorized {
+				t.Errorf("expected unauthorized %v, got %v (%v)", tc.wantUnauthorized, got, err)
+			}
+		})
+	}
+}
+
+func TestPushResult(t *testing.T) {
+	logrus.SetOutput(ioutil.Discard)
+
+	tests := map[string]struct {
+		output string
+		want   PushResult
+	}{
+		"digest reported": {
+			output: "The push refers to repository [foo.io/test]\n" +
+				"5f70bf18a086: Pushed\n" +
+				"1.0: digest: sha256:4b7b3f6ba8a8a56f0a01e8fe16597b0d3c1effc5ee2e6c0b3590bd3a41265c7e size: 527\n",
+			want: PushResult{
+				Image:  "foo.io/test:1.0",
+				Digest: "sha256:4b7b3f6ba8a8a56f0a01e8fe16597b0d3c1effc5ee2e6c0b3590bd3a41265c7e",
+				Size:   527,
+				Layers: LayerProgress{Completed: []string{"5f70bf18a086"}, Incomplete: []string{}},
+			},
+		},
+		"no digest in output": {
+			output: "The push refers to repository [foo.io/test]\n",
+			want:   PushResult{Image: "foo.io/test:1.0", Layers: LayerProgress{Completed: []string{}, Incomplete: []string{}}},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			cmder := newFakeCmder(map[string]int{})
+			cmder.output = map[string]string{"push": tc.output}
+			d := LocalDocker{Cmder: cmder}
+
+			got, err := d.Push("foo.io/test:1.0", 0)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("expected %+v, got %+v", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestPullLayers(t *testing.T) {
+	logrus.SetOutput(ioutil.Discard)
+
+	cmder := newFakeCmder(map[string]int{})
+	cmder.output = map[string]string{"pull": "a3ed95caeb02: Pulling fs layer\n" +
+		"a3ed95caeb02: Pull complete\n" +
+		"5f70bf18a086: Already exists\n"}
+	d := LocalDocker{Cmder: cmder}
+
+	var got LayerProgress
+	opts := PullOptions{Layers: func(p LayerProgress) { got = p }}
+	if err := d.Pull("foo.io/test:1.0", opts, 0); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := LayerProgress{Completed: []string{"a3ed95caeb02", "5f70bf18a086"}, Incomplete: []string{}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected layers %+v, got %+v", want, got)
+	}
+}
+
+func TestPullRateLimited(t *testing.T) {
+	logrus.SetOutput(ioutil.Discard)
+
+	tests := map[string]struct {
+		output          string
+		wantRateLimited bool
+	}{
+		"docker hub limit": {
+			output:          "Error response from daemon: toomanyrequests: You have reached your pull rate limit.",
+			wantRateLimited: true,
+		},
+		"http status": {
+			output:          "error pulling image configuration: 429 Too Many Requests",
+			wantRateLimited: true,
+		},
+		"not found": {
+			output:          "Error response from daemon: manifest for foo.io/test:1.0 not found",
+			wantRateLimited: false,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			cmder := newFakeCmder(map[string]int{"pull": 1})
+			cmder.output = map[string]string{"pull": tc.output}
+			d := LocalDocker{Cmder: cmder}
+
+			err := d.Pull("foo.io/test:1.0", PullOptions{}, 0)
+			if err == nil {
+				t.Fatal("expected error, got nil")
+			}
+			if got := errors.Cause(err) == ErrRateLimited; got != tc.wantRateLimited {
+				t.Errorf("expected rate limited %v, got %v (%v)", tc.wantRateLimited, got, err)
+			}
+		})
+	}
+}
+
+func TestPartialProgress(t *testing.T) {
+	logrus.SetOutput(ioutil.Discard)
+
+	tests := map[string]struct {
+		subcommand string
+		output     string
+		want       LayerProgress
+		wantNone   bool
+	}{
+		"pull interrupted by daemon restart": {
+			subcommand: "pull",
+			output: "1.0: Pulling from test\n" +
+				"a3ed95caeb02: Already exists\n" +
+				"5f70bf18a086: Pulling fs layer\n" +
+				"e0c8b4ba40ec: Pulling fs layer\n" +
+				"5f70bf18a086: Download complete\n" +
+				"5f70bf18a086: Pull complete\n" +
+				"unexpected EOF\n",
+			want: LayerProgress{Completed: []string{"a3ed95caeb02", "5f70bf18a086"}, Incomplete: []string{"e0c8b4ba40ec"}},
+		},
+		"push rate limited part way": {
+			subcommand: "push",
+			output: "The push refers to repository [foo.io/test]\n" +
+				"5f70bf18a086: Preparing\n" +
+				"e0c8b4ba40ec: Preparing\n" +
+				"5f70bf18a086: Layer already exists\n" +
+				"toomanyrequests: too many requests\n",
+			want: LayerProgress{Completed: []string{"5f70bf18a086"}, Incomplete: []string{"e0c8b4ba40ec"}},
+		},
+		"failed before any layers": {
+			subcommand: "pull",
+			output:     "Error response from daemon: manifest for foo.io/test:1.0 not found",
+			wantNone:   true,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			cmder := newFakeCmder(map[string]int{tc.subcommand: 1})
+			cmder.output = map[string]string{tc.subcommand: tc.output}
+			d := LocalDocker{Cmder: cmder}
+
+			var err error
+			if tc.subcommand == "pull" {
+				err = d.Pull("foo.io/test:1.0", PullOptions{}, 0)
+			} else {
+				_, err = d.Push("foo.io/test:1.0", 0)
+			}
+			if err == nil {
+				t.Fatal("expected error, got nil")
+			}
+
+			got, ok := PartialProgress(errors.Wrap(err, "couldn't transfer image"))
+			if ok == tc.wantNone {
+				t.Fatalf("expected progress recorded %v, got %v (%v)", !tc.wantNone, ok, err)
+			}
+			if !tc.wantNone && !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("expected progress %+v, got %+v", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestCommandArgs(t *testing.T) {
+	tests := map[string]struct {
+		run      func(d LocalDocker) error
+		wantArgs []string
+	}{
+		"tag": {
+			run:      func(d LocalDocker) error { return d.Tag("a.io/x:1", "b.io/x:1", 0) },
+			wantArgs: []string{"docker", "tag", "a.io/x:1", "b.io/x:1"},
+		},
+		"pull all tags": {
+			run:      func(d LocalDocker) error { return d.Pull("a.io/x", PullOptions{AllTags: true}, 0) },
+			wantArgs: []string{"docker", "pull", "--all-tags", "a.io/x"},
+		},
+		"pull platform": {
+			run:      func(d LocalDocker) error { return d.Pull("a.io/x:1", PullOptions{Platform: "linux/arm64"}, 0) },
+			wantArgs: []string{"docker", "pull", "--platform", "linux/arm64", "a.io/x:1"},
+		},
+		"save to writer": {
+			run:      func(d LocalDocker) error { return d.SaveTo([]string{"a.io/x:1", "a.io/y:2"}, ioutil.Discard) },
+			wantArgs: []string{"docker", "save", "a.io/x:1", "a.io/y:2"},
+		},
+		"load": {
+			run:      func(d LocalDocker) error { return d.Load("in.tar") },
+			wantArgs: []string{"docker", "load", "--input", "in.tar"},
+		},
+		"logout": {
+			run:      func(d LocalDocker) error { return d.Logout("a.io") },
+			wantArgs: []string{"docker", "logout", "a.io"},
+		},
+		"manifest create": {
+			run: func(d LocalDocker) error {
+				return d.ManifestCreate("a.io/x:1", []string{"a.io/x:1-linux-amd64", "a.io/x:1-linux-arm64"})
+			},
+			wantArgs: []string{"docker", "manifest", "create", "--amend", "a.io/x:1", "a.io/x:1-linux-amd64", "a.io/x:1-linux-arm64"},
+		},
+		"manifest push": {
+			run:      func(d LocalDocker) error { return d.ManifestPush("a.io/x:1", 0) },
+			wantArgs: []string{"docker", "manifest", "push", "--purge", "a.io/x:1"},
+		},
+		"rmi": {
+			run:      func(d LocalDocker) error { return d.Rmi("a.io/x:1", 0) },
+			wantArgs: []string{"docker", "rmi", "a.io/x:1"},
+		},
+		"save": {
+			run:      func(d LocalDocker) error { return d.Save([]string{"a.io/x:1", "a.io/y:2"}, "out.tar") },
+			wantArgs: []string{"docker", "save", "a.io/x:1", "a.io/y:2", "--output", "out.tar"},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			cmder := newFakeCmder(map[string]int{})
+			if err := tc.run(LocalDocker{Cmder: cmder}); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(cmder.runs) != 1 || !reflect.DeepEqual(cmder.runs[0], tc.wantArgs) {
+				t.Errorf("expected command %v, got %v", tc.wantArgs, cmder.runs)
+			}
+		})
+	}
+}
+
+func TestLogin(t *testing.T) {
+	cmder := newFakeCmder(map[string]int{})
+	d := LocalDocker{Cmder: cmder}
+
+	if err := d.Login("a.io", "user", "s3cret"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	wantArgs := []string{"docker", "login", "--username", "user", "--password-stdin", "a.io"}
+	if len(cmder.runs) != 1 || !reflect.DeepEqual(cmder.runs[0], wantArgs) {
+		t.Errorf("expected command %v, got %v", wantArgs, cmder.runs)
+	}
+	if !reflect.DeepEqual(cmder.stdin, []string{"s3cret"}) {
+		t.Errorf("expected the password on stdin, got %v", cmder.stdin)
+	}
+}
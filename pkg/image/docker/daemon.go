@@ -0,0 +1,99 @@
+/*
+Copyright the Sonobuoy contributors 2019
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package docker
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// DefaultDaemonConfigPath is where the docker daemon reads its configuration from on Linux
+const DefaultDaemonConfigPath = "/etc/docker/daemon.json"
+
+// The docker daemon's defaults for the layers it transfers at once
+const (
+	defaultMaxConcurrentDownloads = 3
+	defaultMaxConcurrentUploads   = 5
+)
+
+// DaemonLimits are how many layers the docker daemon transfers at once, across
+// every pull or push it is running. They can only be changed in the daemon's
+// configuration, not per pull or push.
+type DaemonLimits struct {
+	MaxConcurrentDownloads int `json:"max-concurrent-downloads"`
+	MaxConcurrentUploads   int `json:"max-concurrent-uploads"`
+}
+
+// DefaultDaemonLimits returns the layer concurrency the docker daemon uses when its
+// configuration doesn't set any.
+func DefaultDaemonLimits() DaemonLimits {
+	return DaemonLimits{
+		MaxConcurrentDownloads: defaultMaxConcurrentDownloads,
+		MaxConcurrentUploads:   defaultMaxConcurrentUploads,
+	}
+}
+
+// ReadDaemonLimits returns the layer concurrency set in the docker daemon
+// configuration at path, or the daemon's defaults for any it doesn't set. A file
+// that is missing or can't be read gives the daemon's defaults.
+func ReadDaemonLimits(path string) (DaemonLimits, error) {
+	limits := DaemonLimits{}
+	b, err := ioutil.ReadFile(path)
+	switch {
+	case os.IsNotExist(err):
+	case err != nil:
+		log.Debugf("Couldn't read docker daemon config %v, assuming the daemon's defaults: %v", path, err)
+	default:
+		if err := json.Unmarshal(b, &limits); err != nil {
+			return limits, errors.Wrapf(err, "couldn't parse docker daemon config %v", path)
+		}
+	}
+
+	if limits.MaxConcurrentDownloads <= 0 {
+		limits.MaxConcurrentDownloads = defaultMaxConcurrentDownloads
+	}
+	if limits.MaxConcurrentUploads <= 0 {
+		limits.MaxConcurrentUploads = defaultMaxConcurrentUploads
+	}
+	return limits, nil
+}
+
+// ReadInsecureRegistries returns the insecure-registries set in the docker daemon
+// configuration at path: the registries it may reach over plain http. A file that
+// is missing or can't be read gives none.
+func ReadInsecureRegistries(path string) ([]string, error) {
+	b, err := ioutil.ReadFile(path)
+	switch {
+	case os.IsNotExist(err):
+		return nil, nil
+	case err != nil:
+		log.Debugf("Couldn't read docker daemon config %v, assuming no insecure registries: %v", path, err)
+		return nil, nil
+	}
+
+	var config struct {
+		InsecureRegistries []string `json:"insecure-registries"`
+	}
+	if err := json.Unmarshal(b, &config); err != nil {
+		return nil, errors.Wrapf(err, "couldn't parse docker daemon config %v", path)
+	}
+	return config.InsecureRegistries, nil
+}
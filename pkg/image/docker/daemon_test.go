@@ -0,0 +1,132 @@
+/*
+Copyright the Sonobuoy contributors 2019
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package docker
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestReadDaemonLimits(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sonobuoy-daemon-config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	tests := map[string]struct {
+		config  string
+		want    DaemonLimits
+		wantErr bool
+	}{
+		"missing file": {
+			want: DaemonLimits{MaxConcurrentDownloads: 3, MaxConcurrentUploads: 5},
+		},
+		"downloads set": {
+			config: `{"max-concurrent-downloads": 10, "storage-driver": "overlay2"}`,
+			want:   DaemonLimits{MaxConcurrentDownloads: 10, MaxConcurrentUploads: 5},
+		},
+		"both set": {
+			config: `{"max-concurrent-downloads": 6, "max-concurrent-uploads": 2}`,
+			want:   DaemonLimits{MaxConcurrentDownloads: 6, MaxConcurrentUploads: 2},
+		},
+		"unreadable": {
+			config: "dir",
+			want:   DaemonLimits{MaxConcurrentDownloads: 3, MaxConcurrentUploads: 5},
+		},
+		"invalid": {
+			config:  `{"max-concurrent-downloads": "lots"}`,
+			wantErr: true,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(dir, "missing.json")
+			switch {
+			case tc.config == "dir":
+				path = filepath.Join(dir, name)
+				if err := os.Mkdir(path, 0755); err != nil {
+					t.Fatal(err)
+				}
+			case len(tc.config) > 0:
+				path = filepath.Join(dir, name+".json")
+				if err := ioutil.WriteFile(path, []byte(tc.config), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			got, err := ReadDaemonLimits(path)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("expected error %v, got %v", tc.wantErr, err)
+			}
+			if !tc.wantErr && got != tc.want {
+				t.Errorf("expected %+v, got %+v", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestReadInsecureRegistries(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sonobuoy-daemon-config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	tests := map[string]struct {
+		config  string
+		want    []string
+		wantErr bool
+	}{
+		"missing file": {},
+		"none set": {
+			config: `{"max-concurrent-downloads": 10}`,
+		},
+		"set": {
+			config: `{"insecure-registries": ["registry.local:5000", "10.0.0.0/8"]}`,
+			want:   []string{"registry.local:5000", "10.0.0.0/8"},
+		},
+		"invalid": {
+			config:  `{"insecure-registries": "registry.local"}`,
+			wantErr: true,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(dir, "missing.json")
+			if len(tc.config) > 0 {
+				path = filepath.Join(dir, name+".json")
+				if err := ioutil.WriteFile(path, []byte(tc.config), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			got, err := ReadInsecureRegistries(path)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("expected error %v, got %v", tc.wantErr, err)
+			}
+			if !tc.wantErr && !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("expected %v, got %v", tc.want, got)
+			}
+		})
+	}
+}
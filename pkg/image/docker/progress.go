@@ -0,0 +1,125 @@
+/*
+Copyright the Sonobuoy contributors 2019
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package docker
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// layerStatusRegexp matches the status lines docker pull and push print for each
+// layer, e.g. "a3ed95caeb02: Pull complete"
+var layerStatusRegexp = regexp.MustCompile(`(?m)^([0-9a-f]{12}): (.+?)\s*$`)
+
+// Statuses of a layer once it needs no more work, by operation
+var (
+	pullCompleteStatuses = map[string]bool{"Pull complete": true, "Already exists": true}
+	pushCompleteStatuses = map[string]bool{"Pushed": true, "Layer already exists": true}
+)
+
+// LayerProgress is how far a pull or push got through the layers of an image
+type LayerProgress struct {
+	// Completed are the layers transferred or already present, in the order they completed
+	Completed []string
+	// Incomplete are the layers that were started but didn't complete, in the order
+	// docker first reported them
+	Incomplete []string
+}
+
+// Total is the number of layers docker reported
+func (p LayerProgress) Total() int {
+	return len(p.Completed) + len(p.Incomplete)
+}
+
+// parseLayerProgress returns the progress of each layer reported in the output of a
+// pull or push, using the statuses meaning a layer is complete.
+func parseLayerProgress(output string, complete map[string]bool) LayerProgress {
+	order := []string{}
+	done := map[string]bool{}
+	completed := []string{}
+	for _, m := range layerStatusRegexp.FindAllStringSubmatch(output, -1) {
+		layer, status := m[1], m[2]
+		if _, seen := done[layer]; !seen {
+			order = append(order, layer)
+			done[layer] = false
+		}
+		if complete[status] && !done[layer] {
+			done[layer] = true
+			completed = append(completed, layer)
+		}
+	}
+
+	p := LayerProgress{Completed: completed, Incomplete: []string{}}
+	for _, layer := range order {
+		if !done[layer] {
+			p.Incomplete = append(p.Incomplete, layer)
+		}
+	}
+	return p
+}
+
+// TransferError is returned when a pull or push fails after docker began
+// transferring layers, such as when the daemon restarts mid-pull, so that callers
+// know how far it got.
+type TransferError struct {
+	Progress LayerProgress
+	err      error
+}
+
+func (e *TransferError) Error() string {
+	msg := fmt.Sprintf("%v (stopped after %d of %d layers completed", e.err, len(e.Progress.Completed), e.Progress.Total())
+	if len(e.Progress.Incomplete) > 0 {
+		msg += "; incomplete: " + strings.Join(e.Progress.Incomplete, ", ")
+	}
+	return msg + ")"
+}
+
+// Cause returns the error docker failed with, so that errors.Cause sees through
+// the progress to ErrRateLimited or ErrUnauthorized.
+func (e *TransferError) Cause() error {
+	return e.err
+}
+
+// withLayerProgress annotates err with the layer progress in output, if docker got
+// as far as reporting any layers.
+func withLayerProgress(err error, output string, complete map[string]bool) error {
+	if err == nil {
+		return nil
+	}
+	p := parseLayerProgress(output, complete)
+	if p.Total() == 0 {
+		return err
+	}
+	return &TransferError{Progress: p, err: err}
+}
+
+// PartialProgress returns the layer progress of a failed pull or push, if the
+// error records any.
+func PartialProgress(err error) (LayerProgress, bool) {
+	for err != nil {
+		if e, ok := err.(*TransferError); ok {
+			return e.Progress, true
+		}
+		cause, ok := err.(interface{ Cause() error })
+		if !ok {
+			break
+		}
+		err = cause.Cause()
+	}
+	return LayerProgress{}, false
+}
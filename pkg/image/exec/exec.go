@@ -27,8 +27,10 @@ import (
 	"bytes"
 	"io"
 	"os"
+	"strings"
 	"time"
 
+	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
 )
 
@@ -75,34 +77,93 @@ func CombinedOutputLines(cmd Cmd) (lines []string, err error) {
 	return lines, err
 }
 
+// Output is like os/exec's cmd.Output(), but over our Cmd interface.
+// It returns the stdout of cmd; stderr is included in the error if the command fails.
+func Output(cmd Cmd) ([]byte, error) {
+	var stdout, stderr bytes.Buffer
+	cmd.SetStdout(&stdout)
+	cmd.SetStderr(&stderr)
+	if err := cmd.Run(); err != nil {
+		return stdout.Bytes(), errors.Wrap(err, strings.TrimSpace(stderr.String()))
+	}
+	return stdout.Bytes(), nil
+}
+
 // InheritOutput sets cmd's output to write to the current process's stdout and stderr
 func InheritOutput(cmd Cmd) {
 	cmd.SetStderr(os.Stderr)
 	cmd.SetStdout(os.Stdout)
 }
 
+// Retry backoff doubles from initialRetryBackoff for each retry, up to maxRetryBackoff
+const (
+	initialRetryBackoff = time.Second
+	maxRetryBackoff     = 30 * time.Second
+)
+
+// sleep waits between retries; tests replace it to avoid waiting
+var sleep = time.Sleep
+
+// Retryable reports whether a failed command is worth retrying, given its combined
+// stdout and stderr. Failures that can't resolve themselves, such as a registry
+// rejecting credentials, shouldn't be retried.
+type Retryable func(output string) bool
+
 // RunLoggingOutputOnFail runs the cmd, logging error output if Run returns an error
-func RunLoggingOutputOnFail(cmd Cmd, retries int) error {
+func RunLoggingOutputOnFail(cmd Cmd) error {
+	_, err := RunWithOutput(cmd)
+	return err
+}
+
+// RunWithOutput is like RunLoggingOutputOnFail, but also returns the combined
+// stdout and stderr so callers can inspect why it failed
+func RunWithOutput(cmd Cmd) (string, error) {
+	return RetryWithOutput(func() Cmd { return cmd }, 0, nil)
+}
+
+// RetryWithOutput runs the command made by newCmd, retrying up to retries times
+// with exponential backoff while it fails and retryable, if set, reports the failure
+// is worth retrying. A Cmd can only be run once, so each attempt runs a new one.
+// The combined stdout and stderr of the last attempt is returned, and logged if it failed.
+func RetryWithOutput(newCmd func() Cmd, retries int, retryable Retryable) (string, error) {
 	var buff bytes.Buffer
-	cmd.SetStdout(&buff)
-	cmd.SetStderr(&buff)
-	err := cmd.Run()
-	if err != nil {
-		// retry pulling up to retries times if necessary
-		for i := 0; i < retries; i++ {
-			time.Sleep(time.Second * time.Duration(i+1))
-			err = cmd.Run()
-			if err == nil {
-				return nil
-			}
+	attempt := func() error {
+		buff.Reset()
+		cmd := newCmd()
+		cmd.SetStdout(&buff)
+		cmd.SetStderr(&buff)
+		return cmd.Run()
+	}
+
+	err := attempt()
+	tries := 0
+	for ; err != nil && tries < retries; tries++ {
+		if retryable != nil && !retryable(buff.String()) {
+			break
 		}
+		sleep(retryBackoff(tries))
+		err = attempt()
+	}
 
-		// All retries failed or none were requested
-		log.Errorf("failed with following error after %d retries:", retries)
-		scanner := bufio.NewScanner(&buff)
+	if err != nil {
+		// All retries failed, none were requested or the failure isn't retryable
+		log.Errorf("failed with following error after %d retries:", tries)
+		scanner := bufio.NewScanner(bytes.NewReader(buff.Bytes()))
 		for scanner.Scan() {
 			log.Error(scanner.Text())
 		}
 	}
-	return err
+	return buff.String(), err
+}
+
+// retryBackoff returns how long to wait before the given 0-based retry
+func retryBackoff(retry int) time.Duration {
+	backoff := initialRetryBackoff
+	for n := 0; n < retry && backoff < maxRetryBackoff; n++ {
+		backoff *= 2
+	}
+	if backoff > maxRetryBackoff {
+		return maxRetryBackoff
+	}
+	return backoff
 }
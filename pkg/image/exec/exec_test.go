@@ -0,0 +1,134 @@
+/*
+Copyright the Sonobuoy contributors 2019
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package exec
+
+import (
+	"io"
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// onceCmd fails if run more than once, like os/exec.Cmd
+type onceCmd struct {
+	ran    bool
+	fail   bool
+	output string
+	stdout io.Writer
+}
+
+func (c *onceCmd) Run() error {
+	if c.ran {
+		return errors.New("exec: already started")
+	}
+	c.ran = true
+	io.WriteString(c.stdout, c.output)
+	if c.fail {
+		return errors.New("exit status 1")
+	}
+	return nil
+}
+
+func (c *onceCmd) SetEnv(...string) Cmd      { return c }
+func (c *onceCmd) SetStdin(io.Reader) Cmd    { return c }
+func (c *onceCmd) SetStdout(w io.Writer) Cmd { c.stdout = w; return c }
+func (c *onceCmd) SetStderr(io.Writer) Cmd   { return c }
+
+func TestRetryWithOutput(t *testing.T) {
+	logrus.SetOutput(ioutil.Discard)
+	defer func(s func(time.Duration)) { sleep = s }(sleep)
+
+	notUnauthorized := func(output string) bool { return !strings.Contains(output, "unauthorized") }
+
+	tests := map[string]struct {
+		failures  int
+		output    string
+		retries   int
+		retryable Retryable
+		wantRuns  int
+		wantSlept []time.Duration
+		wantErr   bool
+	}{
+		"succeeds first time": {
+			retries:   3,
+			wantRuns:  1,
+			wantSlept: []time.Duration{},
+		},
+		"succeeds after retries": {
+			failures:  2,
+			retries:   3,
+			wantRuns:  3,
+			wantSlept: []time.Duration{time.Second, 2 * time.Second},
+		},
+		"fails after retries": {
+			failures:  5,
+			retries:   3,
+			wantRuns:  4,
+			wantSlept: []time.Duration{time.Second, 2 * time.Second, 4 * time.Second},
+			wantErr:   true,
+		},
+		"failure not retryable": {
+			failures:  5,
+			output:    "unauthorized: authentication required",
+			retries:   3,
+			retryable: notUnauthorized,
+			wantRuns:  1,
+			wantSlept: []time.Duration{},
+			wantErr:   true,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			slept := []time.Duration{}
+			sleep = func(d time.Duration) { slept = append(slept, d) }
+
+			runs := 0
+			newCmd := func() Cmd {
+				runs++
+				return &onceCmd{fail: runs <= tc.failures, output: tc.output}
+			}
+
+			out, err := RetryWithOutput(newCmd, tc.retries, tc.retryable)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("expected error %v, got %v", tc.wantErr, err)
+			}
+			if out != tc.output {
+				t.Errorf("expected output %q, got %q", tc.output, out)
+			}
+			if runs != tc.wantRuns {
+				t.Errorf("expected %d runs, got %d", tc.wantRuns, runs)
+			}
+			if !reflect.DeepEqual(slept, tc.wantSlept) {
+				t.Errorf("expected backoff %v, got %v", tc.wantSlept, slept)
+			}
+		})
+	}
+}
+
+func TestRetryBackoff(t *testing.T) {
+	for retry, want := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second, 16 * time.Second, 30 * time.Second, 30 * time.Second} {
+		if got := retryBackoff(retry); got != want {
+			t.Errorf("expected backoff %v for retry %d, got %v", want, retry, got)
+		}
+	}
+}
@@ -0,0 +1,142 @@
+/*
+Copyright the Sonobuoy contributors 2019
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package image
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// regexpPatternPrefix marks an image pattern as a regular expression rather than a glob
+const regexpPatternPrefix = "re:"
+
+// imagePattern matches images by their registry key, name or reference
+type imagePattern struct {
+	// exact is the key, name or reference matched, if the pattern has no wildcards
+	exact string
+	// re matches the full reference of images, for globs and regular expressions
+	re *regexp.Regexp
+}
+
+// parseImagePattern parses an image pattern. Patterns prefixed with "re:" are regular
+// expressions matched anywhere in an image's reference. Patterns containing *, ? or
+// [ are globs matched against the whole reference, where * also matches slashes.
+// Any other pattern must equal an image's registry key, name or reference.
+func parseImagePattern(pattern string) (imagePattern, error) {
+	if strings.HasPrefix(pattern, regexpPatternPrefix) {
+		re, err := regexp.Compile(strings.TrimPrefix(pattern, regexpPatternPrefix))
+		if err != nil {
+			return imagePattern{}, errors.Wrapf(err, "invalid regular expression %q", pattern)
+		}
+		return imagePattern{re: re}, nil
+	}
+	if !strings.ContainsAny(pattern, "*?[") {
+		return imagePattern{exact: pattern}, nil
+	}
+
+	re, err := globRegexp(pattern)
+	if err != nil {
+		return imagePattern{}, errors.Wrapf(err, "invalid glob %q", pattern)
+	}
+	return imagePattern{re: re}, nil
+}
+
+// globRegexp returns a regular expression matching the same strings as a glob
+func globRegexp(glob string) (*regexp.Regexp, error) {
+	var b strings.Builder
+	b.WriteString("^")
+	for n := 0; n < len(glob); n++ {
+		switch c := glob[n]; c {
+		case '*':
+			b.WriteString(".*")
+		case '?':
+			b.WriteString(".")
+		case '[':
+			end := strings.IndexByte(glob[n+1:], ']')
+			if end < 0 {
+				return nil, errors.New("unterminated character class")
+			}
+			class := glob[n+1 : n+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			b.WriteString("[" + class + "]")
+			n += end + 1
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	b.WriteString("$")
+	return regexp.Compile(b.String())
+}
+
+// matches reports whether the pattern matches the image with the registry key
+func (p imagePattern) matches(key string, c Config) bool {
+	if p.re != nil {
+		return p.re.MatchString(c.GetE2EImage())
+	}
+	return p.exact == key || p.exact == c.name || p.exact == c.GetE2EImage()
+}
+
+// filterImages returns the images for which any of patterns matching equals keep
+func filterImages(images map[string]Config, patterns []string, keep bool) (map[string]Config, error) {
+	parsed := make([]imagePattern, 0, len(patterns))
+	for _, pattern := range patterns {
+		p, err := parseImagePattern(pattern)
+		if err != nil {
+			return nil, err
+		}
+		parsed = append(parsed, p)
+	}
+
+	filtered := map[string]Config{}
+	for k, v := range images {
+		matched := false
+		for _, p := range parsed {
+			if p.matches(k, v) {
+				matched = true
+				break
+			}
+		}
+		if matched == keep {
+			filtered[k] = v
+		}
+	}
+	return filtered, nil
+}
+
+// ExcludeImages returns the images not matching any of excludes. An exclude may be
+// an image's registry key (e.g. Nginx), name (e.g. nginx) or full reference, a glob
+// of references (e.g. *conformance*) or a regular expression prefixed with "re:"
+// (e.g. re:^k8s\.gcr\.io/).
+func ExcludeImages(images map[string]Config, excludes []string) (map[string]Config, error) {
+	if len(excludes) == 0 {
+		return images, nil
+	}
+	return filterImages(images, excludes, false)
+}
+
+// IncludeImages returns the images matching any of includes, which are patterns as
+// described by ExcludeImages. All images are returned if there are no includes.
+func IncludeImages(images map[string]Config, includes []string) (map[string]Config, error) {
+	if len(includes) == 0 {
+		return images, nil
+	}
+	return filterImages(images, includes, true)
+}
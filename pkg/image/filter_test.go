@@ -0,0 +1,144 @@
+/*
+Copyright the Sonobuoy contributors 2019
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package image
+
+import (
+	"reflect"
+	"testing"
+)
+
+var filterTestImages = map[string]Config{
+	"Nginx":       {name: "nginx", registry: "docker.io/library", version: "1.14-alpine"},
+	"Etcd":        {name: "etcd", registry: "k8s.gcr.io", version: "3.3.10"},
+	"Pause":       {name: "pause", registry: "k8s.gcr.io", version: "3.1"},
+	"Agnhost":     {name: "agnhost", registry: "gcr.io/kubernetes-e2e-test-images", version: "2.2"},
+	"Conformance": {name: "conformance", registry: "gcr.io/google-containers", version: "v1.14.0"},
+}
+
+func TestExcludeImages(t *testing.T) {
+	tests := map[string]struct {
+		excludes []string
+		want     []string
+		wantErr  bool
+	}{
+		"nothing excluded": {
+			want: []string{"Agnhost", "Conformance", "Etcd", "Nginx", "Pause"},
+		},
+		"by key": {
+			excludes: []string{"Nginx"},
+			want:     []string{"Agnhost", "Conformance", "Etcd", "Pause"},
+		},
+		"by name": {
+			excludes: []string{"etcd", "pause"},
+			want:     []string{"Agnhost", "Conformance", "Nginx"},
+		},
+		"by reference": {
+			excludes: []string{"gcr.io/kubernetes-e2e-test-images/agnhost:2.2"},
+			want:     []string{"Conformance", "Etcd", "Nginx", "Pause"},
+		},
+		"no match": {
+			excludes: []string{"busybox"},
+			want:     []string{"Agnhost", "Conformance", "Etcd", "Nginx", "Pause"},
+		},
+		"glob across path segments": {
+			excludes: []string{"*conformance*"},
+			want:     []string{"Agnhost", "Etcd", "Nginx", "Pause"},
+		},
+		"glob of registry": {
+			excludes: []string{"k8s.gcr.io/*"},
+			want:     []string{"Agnhost", "Conformance", "Nginx"},
+		},
+		"glob with character class": {
+			excludes: []string{"k8s.gcr.io/[!e]*"},
+			want:     []string{"Agnhost", "Conformance", "Etcd", "Nginx"},
+		},
+		"glob must match whole reference": {
+			excludes: []string{"nginx*"},
+			want:     []string{"Agnhost", "Conformance", "Etcd", "Nginx", "Pause"},
+		},
+		"regular expression": {
+			excludes: []string{`re:^gcr\.io/`},
+			want:     []string{"Etcd", "Nginx", "Pause"},
+		},
+		"invalid glob": {
+			excludes: []string{"k8s.gcr.io/[a-z"},
+			wantErr:  true,
+		},
+		"invalid regular expression": {
+			excludes: []string{"re:etcd(["},
+			wantErr:  true,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			images, err := ExcludeImages(filterTestImages, tc.excludes)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("Expected error %v but got %v", tc.wantErr, err)
+			}
+			if tc.wantErr {
+				return
+			}
+			if got := sortedKeys(images); !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("Expected images %v but got %v", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestIncludeImages(t *testing.T) {
+	tests := map[string]struct {
+		includes []string
+		want     []string
+		wantErr  bool
+	}{
+		"everything included": {
+			want: []string{"Agnhost", "Conformance", "Etcd", "Nginx", "Pause"},
+		},
+		"by key and glob": {
+			includes: []string{"Nginx", "*conformance*"},
+			want:     []string{"Conformance", "Nginx"},
+		},
+		"regular expression": {
+			includes: []string{"re:(etcd|pause):"},
+			want:     []string{"Etcd", "Pause"},
+		},
+		"no match": {
+			includes: []string{"busybox*"},
+			want:     []string{},
+		},
+		"invalid regular expression": {
+			includes: []string{"re:*"},
+			wantErr:  true,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			images, err := IncludeImages(filterTestImages, tc.includes)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("Expected error %v but got %v", tc.wantErr, err)
+			}
+			if tc.wantErr {
+				return
+			}
+			if got := sortedKeys(images); !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("Expected images %v but got %v", tc.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,76 @@
+/*
+Copyright the Sonobuoy contributors 2019
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package image
+
+import (
+	"github.com/pkg/errors"
+)
+
+// DanglingImage is an untagged local image removed, or to be removed, by RemoveDangling
+type DanglingImage struct {
+	ID   string
+	Size int64
+}
+
+// RemoveDangling removes the local images without a tag, as left behind by repeated
+// pull, tag and push cycles, and returns those removed. If dryRun is set nothing is
+// removed and the images that would be are returned instead. Since images can share
+// layers, their total size is an upper bound on the space reclaimed.
+func (i ImageClient) RemoveDangling(dryRun bool, retries int) ([]DanglingImage, []error) {
+	ids, err := i.dockerClient.DanglingImages()
+	if err != nil {
+		return nil, []error{err}
+	}
+
+	errs := []error{}
+	removed := []DanglingImage{}
+	for n, id := range ids {
+		if i.aborted(errs) {
+			break
+		}
+
+		img := DanglingImage{ID: id}
+		if info, err := i.dockerClient.Inspect(id); err == nil {
+			img.Size = info.Size
+		}
+		if dryRun {
+			removed = append(removed, img)
+			continue
+		}
+
+		progress := ImageProgress{Name: id, Operation: OperationDelete, Status: ProgressStarted, Current: n + 1, Total: len(ids)}
+		i.report(progress)
+		err := i.dockerClient.Rmi(id, retries)
+		if err != nil {
+			err = errors.Wrapf(err, "couldn't delete dangling image: %v", id)
+			errs = append(errs, err)
+		} else {
+			removed = append(removed, img)
+		}
+		i.reportResult(progress, err)
+	}
+	return removed, errs
+}
+
+// DanglingSize returns the total size of images
+func DanglingSize(images []DanglingImage) int64 {
+	var total int64
+	for _, img := range images {
+		total += img.Size
+	}
+	return total
+}
@@ -0,0 +1,70 @@
+/*
+Copyright the Sonobuoy contributors 2019
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package image
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRemoveDangling(t *testing.T) {
+	dangling := []string{"sha256:abc", "sha256:def"}
+
+	tests := map[string]struct {
+		dryRun      bool
+		deleteFails bool
+		wantRemoved int
+		wantDeleted []string
+		wantErrors  int
+	}{
+		"removes dangling images": {
+			wantRemoved: 2,
+			wantDeleted: []string{"sha256:abc", "sha256:def"},
+		},
+		"dry run removes nothing": {
+			dryRun:      true,
+			wantRemoved: 2,
+		},
+		"delete fails": {
+			deleteFails: true,
+			wantErrors:  2,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			var deleted []string
+			imgClient := ImageClient{
+				dockerClient: FakeDockerClient{dangling: dangling, deleteFails: tc.deleteFails, deleted: &deleted},
+			}
+
+			removed, errs := imgClient.RemoveDangling(tc.dryRun, 0)
+			if len(errs) != tc.wantErrors {
+				t.Fatalf("Expected %d errors but got %v", tc.wantErrors, errs)
+			}
+			if len(removed) != tc.wantRemoved {
+				t.Errorf("Expected %d images removed but got %d", tc.wantRemoved, len(removed))
+			}
+			if !reflect.DeepEqual(deleted, tc.wantDeleted) {
+				t.Errorf("Expected deletes %v but got %v", tc.wantDeleted, deleted)
+			}
+			if got, want := DanglingSize(removed), int64(tc.wantRemoved*fakeImageSize); got != want {
+				t.Errorf("Expected size %d but got %d", want, got)
+			}
+		})
+	}
+}
@@ -17,14 +17,40 @@ limitations under the License.
 package image
 
 import (
+	"context"
 	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
 
 	"github.com/heptio/sonobuoy/pkg/image/docker"
+	"github.com/heptio/sonobuoy/pkg/image/registry"
 	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
 )
 
 type ImageClient struct {
-	dockerClient docker.Docker
+	dockerClient  docker.Docker
+	authRefresher AuthRefresher
+	progress      ProgressFunc
+
+	signatureVerifier SignatureVerifier
+	pipeThrough       []string
+	failFast          bool
+	pullMirrors       map[string]string
+	reproducible      bool
+	ctx               context.Context
+	rateLimit         int64
+	repoCreators      []RepoCreator
+	limiter           *concurrencyLimiter
+	exportDir         string
+	pullLogins        *pullLogins
+	concurrency       *ConcurrencyRecorder
+	authRefLogins     *authRefLogins
+	loginConfig       *registry.TemporaryDockerConfig
 }
 
 func NewImageClient() ImageClient {
@@ -33,65 +59,721 @@ func NewImageClient() ImageClient {
 	}
 }
 
-func (i ImageClient) PullImages(images map[string]Config, retries int) []error {
+// WithAuthRefresher returns a copy of the client which, when a push is rejected
+// for invalid credentials, refreshes them and retries the push once.
+func (i ImageClient) WithAuthRefresher(r AuthRefresher) ImageClient {
+	i.authRefresher = r
+	return i
+}
+
+// WithFailFast returns a copy of the client which stops working through a set of
+// images at the first one that fails, rather than attempting every image.
+func (i ImageClient) WithFailFast() ImageClient {
+	i.failFast = true
+	return i
+}
+
+// aborted reports whether to stop working through a set of images given the errors
+// so far, or because the client's context was cancelled
+func (i ImageClient) aborted(errs []error) bool {
+	return i.canceled() || (i.failFast && len(errs) > 0)
+}
+
+// PullResult holds the details the docker daemon reports for a pulled image
+type PullResult struct {
+	// Image is the image reference that was pulled
+	Image string
+	// ID is the ID of the local image
+	ID string
+	// Size is the size of the image in bytes
+	Size int64
+}
+
+// TotalSize returns the combined size of the pulled images
+func TotalSize(results []PullResult) int64 {
+	var total int64
+	for _, r := range results {
+		total += r.Size
+	}
+	return total
+}
+
+// PullImages pulls each image that isn't already present locally. It returns the
+// details of the images that were pulled, as reported by the docker daemon.
+// If opts.Platform is set, every image is checked to be for that platform, since
+// some registries silently serve their default platform instead.
+// If opts.AllTags is set, every tag of each image's repository is pulled instead
+// and neither the details nor the platform of those are checked, which can't be
+// combined with WithExportDir.
+func (i ImageClient) PullImages(images map[string]Config, opts docker.PullOptions, retries int) ([]PullResult, []error) {
+	if opts.AllTags {
+		if len(i.exportDir) > 0 {
+			return []PullResult{}, []error{errors.New("all tags of a repository can't be exported while pulling")}
+		}
+		return []PullResult{}, i.pullRepositories(images, opts, retries)
+	}
+
+	var export *dirExport
+	if len(i.exportDir) > 0 {
+		var err error
+		if export, err = newDirExport(i.exportDir); err != nil {
+			return []PullResult{}, []error{err}
+		}
+	}
+
+	if i.limiter != nil && i.progress != nil {
+		i.progress = synchronized(i.progress)
+	}
+
+	var mu sync.Mutex
 	errs := []error{}
-	for _, v := range images {
-		err := i.dockerClient.PullIfNotPresent(v.GetE2EImage(), retries)
+	pulled := []PullResult{}
+	refs := UniqueImages(images)
+	configs := configsByImage(images)
+	aborted := func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return i.aborted(errs)
+	}
+	i.forEachImage(len(refs), aborted, func(n int) {
+		img := refs[n]
+		progress := ImageProgress{Name: img, Operation: OperationPull, Status: ProgressStarted, Current: n + 1, Total: len(refs)}
+		i.report(progress)
+
+		var result PullResult
+		var ok bool
+		imgOpts := opts
+		imgOpts.Layers = func(layers docker.LayerProgress) { progress.Layers = layers }
+		err := i.loginForAuthRef(configs[img])
+		if err == nil {
+			err = i.transfer(func() error {
+				var err error
+				result, ok, err = i.pullConfig(configs[img], imgOpts, retries)
+				return err
+			})
+		}
+		if err == nil && export != nil {
+			_, err = export.save(i, img)
+		}
+		mu.Lock()
+		defer mu.Unlock()
 		if err != nil {
-			errs = append(errs, errors.Wrapf(err, "couldn't pull image: %v", v.GetE2EImage()))
+			errs = append(errs, err)
+		}
+		if err == nil && !ok {
+			progress.Status = ProgressSkipped
+			i.report(progress)
+			return
+		}
+		i.reportResult(progress, err)
+		if err == nil {
+			pulled = append(pulled, result)
+		}
+	})
+
+	if export != nil {
+		if _, err := export.finish(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return pulled, errs
+}
+
+// pullConfig pulls an image as its override says: for the override's platform,
+// if any, rather than that of opts, and by the override's digest, if any, tagging
+// the image pulled by digest so that it's found by its tag as usual.
+func (i ImageClient) pullConfig(img Config, opts docker.PullOptions, retries int) (PullResult, bool, error) {
+	o := img.Override()
+	if len(o.Platform) > 0 {
+		opts.Platform = o.Platform
+	}
+	if len(o.Digest) == 0 {
+		return i.pull(img.GetE2EImage(), opts, retries)
+	}
+
+	pinned := img.pinnedImage()
+	result, pulled, err := i.pull(pinned, opts, retries)
+	if err != nil {
+		return result, pulled, err
+	}
+	if err := i.dockerClient.Tag(pinned, img.GetE2EImage(), retries); err != nil {
+		return PullResult{}, pulled, errors.Wrapf(err, "couldn't tag image: %v", pinned)
+	}
+	result.Image = img.GetE2EImage()
+	return result, pulled, nil
+}
+
+// pull pulls an image if it isn't present, checking its platform if one was requested.
+// It returns whether the image was pulled and its details if so.
+func (i ImageClient) pull(img string, opts docker.PullOptions, retries int) (PullResult, bool, error) {
+	pulled, err := i.pullIfNotPresent(img, opts, retries)
+	if err != nil {
+		return PullResult{}, false, errors.Wrapf(err, "couldn't pull image: %v", img)
+	}
+	if i.signatureVerifier != nil {
+		if err := i.signatureVerifier.Verify(img); err != nil {
+			// Don't leave an image that failed verification for later commands to use
+			if pulled {
+				if rmErr := i.dockerClient.Rmi(img, retries); rmErr != nil {
+					logrus.Warningf("Couldn't remove image %v, which failed verification: %v", img, rmErr)
+				}
+			}
+			return PullResult{}, pulled, err
+		}
+		logrus.Infof("Signature verified for image: %s", img)
+	}
+	if !pulled && len(opts.Platform) == 0 {
+		return PullResult{}, false, nil
+	}
+
+	info, err := i.dockerClient.Inspect(img)
+	if err != nil {
+		return PullResult{}, pulled, err
+	}
+	if len(opts.Platform) > 0 {
+		if err := checkPlatform(img, info, opts.Platform); err != nil {
+			return PullResult{}, pulled, err
+		}
+	}
+	if !pulled {
+		return PullResult{}, false, nil
+	}
+	return PullResult{Image: img, ID: info.ID, Size: info.Size}, true, nil
+}
+
+// checkPlatform returns an error if the image isn't for the platform, given as os/arch[/variant]
+func checkPlatform(img string, info docker.ImageInfo, platform string) error {
+	parts := strings.Split(platform, "/")
+	if len(parts) < 2 || len(parts) > 3 {
+		return errors.Errorf("invalid platform %q, expected os/arch[/variant]", platform)
+	}
+
+	got := []string{info.Os, info.Architecture}
+	if len(parts) == 3 {
+		got = append(got, info.Variant)
+	}
+	if strings.Join(got, "/") != platform {
+		return errors.Errorf("image %v is for platform %v, not %v; delete the local image if it was pulled for another platform",
+			img, strings.Join(got, "/"), platform)
+	}
+	return nil
+}
+
+// pullImage pulls img, refreshing credentials and retrying once if the registry rejected them.
+// The registry is logged in to first if the client has pull credentials for it.
+func (i ImageClient) pullImage(img string, opts docker.PullOptions, retries int) error {
+	if err := i.loginForPull(img); err != nil {
+		return err
+	}
+	return i.retryOnAuth(img, func() error {
+		return i.dockerClient.Pull(img, opts, retries)
+	})
+}
+
+// pullRepositories pulls the repository of each image, rather than the image itself
+func (i ImageClient) pullRepositories(images map[string]Config, opts docker.PullOptions, retries int) []error {
+	errs := []error{}
+	for _, repo := range uniqueRepositories(images) {
+		if i.aborted(errs) {
+			break
+		}
+		if err := i.pullImage(repo, opts, retries); err != nil {
+			errs = append(errs, errors.Wrapf(err, "couldn't pull repository: %v", repo))
 		}
 	}
 	return errs
 }
 
-func (i ImageClient) PushImages(upstreamImages, privateImages map[string]Config, retries int) []error {
+// PushImages tags each upstream image with its private counterpart and pushes it.
+// Each image in extraTags is additionally tagged and pushed under the same private
+// repository, e.g. a floating alias such as "stable". Identical source/destination
+// pairs are only pushed once. The results of the images successfully pushed are returned.
+func (i ImageClient) PushImages(upstreamImages, privateImages map[string]Config, extraTags []string, retries int) ([]docker.PushResult, []error) {
 	errs := []error{}
-	for k, v := range upstreamImages {
+	done := []docker.PushResult{}
+	plan := pushPlan(upstreamImages, privateImages, extraTags)
+	dests := make([]string, 0, len(plan))
+	for _, p := range plan {
+		dests = append(dests, p.dest)
+	}
+	repoErrs := i.createRepositories(dests)
+	if i.limiter != nil && i.progress != nil {
+		i.progress = synchronized(i.progress)
+	}
+
+	var mu sync.Mutex
+	aborted := func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return i.aborted(errs)
+	}
+	fail := func(progress ImageProgress, err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		errs = append(errs, err)
+		i.reportResult(progress, err)
+	}
+	i.forEachImage(len(plan), aborted, func(n int) {
+		p := plan[n]
+		progress := ImageProgress{Name: p.dest, Operation: OperationPush, Status: ProgressStarted, Current: n + 1, Total: len(plan)}
+		i.report(progress)
+
+		info, err := i.checkPresent(p.src)
+		if err == nil {
+			err = checkOverride(p.src, info, p.config.Override())
+		}
+		if err == nil {
+			err = i.loginForAuthRef(p.config)
+		}
+		if err != nil {
+			fail(progress, err)
+			return
+		}
+		if err := repoErrs[p.dest]; err != nil {
+			fail(progress, err)
+			return
+		}
+
+		if err := i.dockerClient.Tag(p.src, p.dest, retries); err != nil {
+			fail(progress, errors.Wrapf(err, "couldn't tag image: %v", p.src))
+			return
+		}
+
+		var result docker.PushResult
+		err = i.transfer(func() error {
+			var err error
+			result, err = i.push(p.dest, retries)
+			return err
+		})
+		if err != nil {
+			progress.Layers, _ = docker.PartialProgress(err)
+			fail(progress, errors.Wrapf(err, "couldn't push image: %v", p.dest))
+			return
+		}
+		progress.Layers = result.Layers
+		if i.concurrency != nil {
+			i.concurrency.AddBytes(info.Size)
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		i.reportResult(progress, nil)
+		done = append(done, result)
+	})
+	return done, errs
+}
+
+// checkPresent returns the details of img, or a clear error if it hasn't been
+// pulled, rather than leaving tagging it to fail with an obscure docker error.
+func (i ImageClient) checkPresent(img string) (docker.ImageInfo, error) {
+	info, err := i.dockerClient.Inspect(img)
+	if errors.Cause(err) == docker.ErrImageNotFound {
+		return info, errors.Errorf("image %v isn't present locally; run 'sonobuoy images pull' before pushing", img)
+	}
+	return info, err
+}
+
+// checkOverride returns an error if the image to push isn't for the platform or
+// digest its destination's override pins, e.g. because it was pulled without them.
+func checkOverride(img string, info docker.ImageInfo, o ImageOverride) error {
+	if len(o.Platform) > 0 {
+		if err := checkPlatform(img, info, o.Platform); err != nil {
+			return err
+		}
+	}
+	if len(o.Digest) == 0 {
+		return nil
+	}
+	for _, digest := range info.RepoDigests {
+		if strings.HasSuffix(digest, "@"+o.Digest) {
+			return nil
+		}
+	}
+	return errors.Errorf("image %v isn't %v, the digest the repo-config pins; pull it again with the repo-config", img, o.Digest)
+}
+
+// pushPair is a source image and the destination it is tagged and pushed as
+type pushPair struct {
+	src, dest string
+	// config is the destination's Config
+	config Config
+}
+
+// pushPlan returns the images PushImages will tag and push, in order
+func pushPlan(upstreamImages, privateImages map[string]Config, extraTags []string) []pushPair {
+	plan := []pushPair{}
+	planned := map[string]bool{}
+	for _, k := range sortedKeys(upstreamImages) {
+		v := upstreamImages[k]
 		privateImg := privateImages[k]
 
+		pair := v.GetE2EImage() + " " + privateImg.GetE2EImage()
+		if planned[pair] {
+			continue
+		}
+		planned[pair] = true
+
 		// Skip if the source/dest are equal
 		if privateImg.GetE2EImage() == v.GetE2EImage() {
-			fmt.Printf("Skipping public image: %s\n", v.GetE2EImage())
+			logrus.Infof("Skipping public image: %s", v.GetE2EImage())
+			continue
+		}
+
+		dests := []Config{privateImg}
+		for _, tag := range extraTags {
+			dests = append(dests, privateImg.withVersion(tag))
+		}
+
+		for _, dest := range dests {
+			plan = append(plan, pushPair{src: v.GetE2EImage(), dest: dest.GetE2EImage(), config: dest})
+		}
+	}
+	return plan
+}
+
+// CheckAllowedRegistries returns an error naming every destination image that
+// PushImages would push to a registry host not in allowedRegistries. Public images,
+// which aren't pushed, are ignored. An empty allow-list allows every registry.
+func CheckAllowedRegistries(upstreamImages, privateImages map[string]Config, allowedRegistries []string) error {
+	if len(allowedRegistries) == 0 {
+		return nil
+	}
+
+	allowed := map[string]bool{}
+	for _, host := range allowedRegistries {
+		allowed[strings.ToLower(host)] = true
+	}
+
+	disallowed := []string{}
+	for _, k := range sortedKeys(upstreamImages) {
+		upstreamImg, privateImg := upstreamImages[k], privateImages[k]
+		dest := privateImg.GetE2EImage()
+		if dest == upstreamImg.GetE2EImage() {
 			continue
 		}
 
-		err := i.dockerClient.Tag(v.GetE2EImage(), privateImg.GetE2EImage(), retries)
+		ref, err := registry.ParseReference(dest)
 		if err != nil {
-			errs = append(errs, errors.Wrapf(err, "couldn't tag image: %v", v.GetE2EImage()))
+			return errors.Wrapf(err, "couldn't parse destination image %v", dest)
+		}
+		if !allowed[strings.ToLower(ref.Host)] {
+			disallowed = append(disallowed, dest)
 		}
+	}
+
+	if len(disallowed) > 0 {
+		return errors.Errorf("refusing to push to registries not in the allowed list %v: %v",
+			strings.Join(allowedRegistries, ", "), strings.Join(disallowed, ", "))
+	}
+	return nil
+}
 
-		err = i.dockerClient.Push(privateImg.GetE2EImage(), retries)
+// push pushes an image, refreshing credentials and retrying once if the registry
+// rejected them and an AuthRefresher is configured. Authentication failures name
+// the registry that rejected the push and whether any credentials were sent to it.
+func (i ImageClient) push(img string, retries int) (docker.PushResult, error) {
+	var result docker.PushResult
+	err := i.retryOnAuth(img, func() error {
+		var err error
+		result, err = i.dockerClient.Push(img, retries)
+		return err
+	})
+	if errors.Cause(err) != docker.ErrUnauthorized {
+		return result, err
+	}
+
+	ref, parseErr := registry.ParseReference(img)
+	if parseErr != nil {
+		return result, err
+	}
+	return result, unauthorizedPushError(err, ref.Host)
+}
+
+// retryOnAuth runs op, which pulls or pushes img. Network failures are retried by
+// op itself; if the registry of img rejected the credentials instead and an
+// AuthRefresher is configured, the credentials are refreshed and op is run exactly
+// once more, since a refresh only helps if they had expired.
+func (i ImageClient) retryOnAuth(img string, op func() error) error {
+	err := op()
+	if err == nil || errors.Cause(err) != docker.ErrUnauthorized || i.authRefresher == nil {
+		return err
+	}
+
+	ref, parseErr := registry.ParseReference(img)
+	if parseErr != nil {
+		return err
+	}
+	if refreshErr := i.authRefresher.Refresh(ref.Host); refreshErr != nil {
+		return errors.Wrap(err, refreshErr.Error())
+	}
+	return op()
+}
+
+// unauthorizedPushError annotates a rejected push with the registry host and
+// whether the docker config has credentials for it, so the user knows which login to fix.
+func unauthorizedPushError(err error, host string) error {
+	if registry.HasLogin(registry.DockerConfigPath(), host) {
+		return errors.Wrapf(err, "registry %v rejected the credentials provided", host)
+	}
+	return errors.Wrapf(err, "registry %v requires credentials but none were provided; run 'docker login %v'", host, host)
+}
+
+// GetDigests returns the registry digest of each image, as recorded by the local
+// docker client when the image was pulled from or pushed to its registry.
+func (i ImageClient) GetDigests(images []string) (map[string]string, []error) {
+	errs := []error{}
+	digests := map[string]string{}
+	for _, img := range images {
+		info, err := i.dockerClient.Inspect(img)
 		if err != nil {
-			errs = append(errs, errors.Wrapf(err, "couldn't push image: %v", v.GetE2EImage()))
+			errs = append(errs, err)
+			continue
 		}
+
+		digest, err := repoDigest(img, info.RepoDigests)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		digests[img] = digest
 	}
-	return errs
+	return digests, errs
 }
 
+// repoDigest finds the digest for the repository of img among the repo digests
+// docker reports for it, which are of the form repository@digest.
+func repoDigest(img string, repoDigests []string) (string, error) {
+	ref, err := registry.ParseReference(img)
+	if err != nil {
+		return "", err
+	}
+
+	for _, rd := range repoDigests {
+		digestRef, err := registry.ParseReference(rd)
+		if err != nil {
+			continue
+		}
+		if digestRef.Name() == ref.Name() {
+			return digestRef.Digest, nil
+		}
+	}
+	return "", errors.Errorf("no digest recorded for image %v", img)
+}
+
+// PresentImages splits images into those present in the local docker client and
+// those missing from it, preserving their order. An error is returned if an image
+// couldn't be inspected for any other reason, such as the daemon being down.
+func (i ImageClient) PresentImages(images []string) ([]string, []string, error) {
+	present, missing := []string{}, []string{}
+	for _, img := range images {
+		_, err := i.dockerClient.Inspect(img)
+		switch {
+		case errors.Cause(err) == docker.ErrImageNotFound:
+			missing = append(missing, img)
+		case err != nil:
+			return nil, nil, errors.Wrapf(err, "couldn't check whether image %v is present", img)
+		default:
+			present = append(present, img)
+		}
+	}
+	return present, missing, nil
+}
+
+// DownloadImages saves the images to a tar file named after the version.
 func (i ImageClient) DownloadImages(images []string, version string) (string, error) {
-	fileName := getTarFileName(version)
+	return i.saveTar(images, getTarFileName(version, 0), 1, 1)
+}
+
+// DownloadImagesToFile saves the images to the named tar file
+func (i ImageClient) DownloadImagesToFile(images []string, fileName string) (string, error) {
+	return i.saveTar(images, fileName, 1, 1)
+}
+
+// DownloadImageBatches saves the images to numbered tar files named after the
+// version, each holding at most batchSize images, so that large sets of images
+// can be exported and transferred in parts. The files written are returned in order.
+// Completed parts are recorded in a journal until every part is written, so that
+// re-running an interrupted download skips the parts already exported.
+func (i ImageClient) DownloadImageBatches(images []string, version string, batchSize int) ([]string, error) {
+	if batchSize <= 0 {
+		return nil, errors.Errorf("batch size must be positive, got %d", batchSize)
+	}
 
-	err := i.dockerClient.Save(images, fileName)
+	journalPath := getTarFileName(version, 0) + journalSuffix
+	j, err := readJournal(journalPath)
 	if err != nil {
-		return "", errors.Wrap(err, "couldn't save images to tar")
+		return nil, err
+	}
+
+	fileNames := []string{}
+	parts := (len(images) + batchSize - 1) / batchSize
+	for part, start := 1, 0; start < len(images); part, start = part+1, start+batchSize {
+		end := start + batchSize
+		if end > len(images) {
+			end = len(images)
+		}
+		batch := images[start:end]
+		fileName := getTarFileName(version, part)
+		if i.canceled() {
+			return fileNames, ErrCanceled
+		}
+
+		if j.completed(fileName, batch) {
+			i.report(ImageProgress{Name: fileName, Operation: OperationDownload, Status: ProgressSkipped, Current: part, Total: parts})
+			fileNames = append(fileNames, fileName)
+			continue
+		}
+
+		if _, err := i.saveTar(batch, fileName, part, parts); err != nil {
+			return fileNames, errors.Wrapf(err, "couldn't download part %d", part)
+		}
+		fileNames = append(fileNames, fileName)
+
+		j[fileName] = batch
+		if err := j.write(journalPath); err != nil {
+			return fileNames, err
+		}
 	}
 
+	if err := os.Remove(journalPath); err != nil && !os.IsNotExist(err) {
+		return fileNames, errors.Wrap(err, "couldn't remove download journal")
+	}
+	return fileNames, nil
+}
+
+// saveTar saves the images to a tar file, reporting its progress as the given part
+// of parts.
+func (i ImageClient) saveTar(images []string, fileName string, part, parts int) (string, error) {
+	progress := ImageProgress{Name: fileName, Operation: OperationDownload, Status: ProgressStarted, Current: part, Total: parts}
+	i.report(progress)
+
+	err := i.writeTar(images, fileName)
+	i.reportResult(progress, err)
+	if err != nil {
+		return "", err
+	}
 	return fileName, nil
 }
 
+// writeTar writes the images to a temporary file first and only renames it once
+// complete, so a failed download never leaves a truncated tar behind. It fails
+// before writing anything if the images clearly won't fit, unless they're piped
+// through a command whose output size can't be known up front. The tar's checksum
+// is written beside it, for LoadImages to verify.
+func (i ImageClient) writeTar(images []string, fileName string) error {
+	save := i.dockerClient.Save
+	if len(i.pipeThrough) > 0 {
+		save = i.savePiped
+	} else if err := i.checkDiskSpace(images, fileName); err != nil {
+		return err
+	} else if i.rateLimit > 0 {
+		save = i.saveLimited
+	}
+
+	tmpFileName := fileName + ".tmp"
+
+	err := save(images, tmpFileName)
+	if err != nil {
+		os.Remove(tmpFileName)
+		return errors.Wrap(err, "couldn't save images to tar")
+	}
+
+	if i.reproducible {
+		if err := repackTar(tmpFileName); err != nil {
+			os.Remove(tmpFileName)
+			return err
+		}
+	}
+
+	checksum, err := fileChecksum(tmpFileName)
+	if err != nil {
+		os.Remove(tmpFileName)
+		return err
+	}
+	// A checksum file left by an earlier download would no longer match
+	if err := os.Remove(fileName + checksumSuffix); err != nil && !os.IsNotExist(err) {
+		os.Remove(tmpFileName)
+		return errors.Wrap(err, "couldn't remove old checksum file")
+	}
+
+	if err := os.Rename(tmpFileName, fileName); err != nil {
+		os.Remove(tmpFileName)
+		return errors.Wrap(err, "couldn't move tar into place")
+	}
+
+	return writeChecksumFile(fileName, checksum)
+}
+
 func (i ImageClient) DeleteImages(images map[string]Config, retries int) []error {
+	return i.DeleteImageRefs(UniqueImages(images), retries)
+}
+
+// DeleteImageRefs deletes the images from the local docker client by reference,
+// such as those ArchiveImages reads from a tar.
+func (i ImageClient) DeleteImageRefs(refs []string, retries int) []error {
 	errs := []error{}
+	for n, img := range refs {
+		if i.aborted(errs) {
+			break
+		}
+		progress := ImageProgress{Name: img, Operation: OperationDelete, Status: ProgressStarted, Current: n + 1, Total: len(refs)}
+		i.report(progress)
 
-	for _, v := range images {
-		err := i.dockerClient.Rmi(v.GetE2EImage(), retries)
+		err := i.dockerClient.Rmi(img, retries)
 		if err != nil {
-			errs = append(errs, errors.Wrapf(err, "couldn't delete image: %v", v.GetE2EImage()))
+			err = errors.Wrapf(err, "couldn't delete image: %v", img)
+			errs = append(errs, err)
+		}
+		i.reportResult(progress, err)
+	}
+
+	return errs
+}
+
+// UntagSources removes the local upstream tag of each image in upstreamImages once
+// every destination planned for it has been pushed. The image itself is kept by the
+// local docker client under its private tags.
+func (i ImageClient) UntagSources(upstreamImages, privateImages map[string]Config, extraTags []string, pushed []docker.PushResult, retries int) []error {
+	errs := []error{}
+
+	done := map[string]bool{}
+	for _, result := range pushed {
+		done[result.Image] = true
+	}
+
+	sources := []string{}
+	complete := map[string]bool{}
+	for _, p := range pushPlan(upstreamImages, privateImages, extraTags) {
+		if _, seen := complete[p.src]; !seen {
+			sources = append(sources, p.src)
+			complete[p.src] = true
 		}
+		complete[p.src] = complete[p.src] && done[p.dest]
 	}
 
+	for _, src := range sources {
+		if i.aborted(errs) {
+			break
+		}
+		if !complete[src] {
+			continue
+		}
+		if err := i.dockerClient.Rmi(src, retries); err != nil {
+			errs = append(errs, errors.Wrapf(err, "couldn't untag image: %v", src))
+		}
+	}
 	return errs
 }
 
+// Login stores credentials for a registry, to be reused by later pushes and pulls
+func (i ImageClient) Login(registryHost, username, password string) error {
+	return errors.Wrapf(i.dockerClient.Login(registryHost, username, password), "couldn't log in to %v", registryHost)
+}
+
+// Logout removes the stored credentials for a registry
+func (i ImageClient) Logout(registryHost string) error {
+	return errors.Wrapf(i.dockerClient.Logout(registryHost), "couldn't log out of %v", registryHost)
+}
+
 // GetImages gets a map of image Configs
 func GetImages(e2eRegistryConfig, version string) (map[string]Config, error) {
 	// Get list of upstream images that match the version
@@ -104,10 +786,149 @@ func GetImages(e2eRegistryConfig, version string) (map[string]Config, error) {
 	if err != nil {
 		return nil, errors.Wrap(err, "couldn't get images for version")
 	}
+	if err := checkImagesFound(imgs, version); err != nil {
+		return nil, err
+	}
+
+	if e2eRegistryConfig != "" {
+		missing, err := MissingRegistryKeys(e2eRegistryConfig, version)
+		if err != nil {
+			return nil, errors.Wrap(err, "couldn't validate registry list")
+		}
+		for _, key := range missing {
+			logrus.Warningf("%v doesn't set %v, which Kubernetes %v requires; its images will be used from upstream", e2eRegistryConfig, key, version)
+		}
+	}
+	return imgs, nil
+}
+
+// checkImagesFound returns an error if no images are defined for the version, so
+// that commands fail rather than silently doing nothing.
+func checkImagesFound(imgs map[string]Config, version string) error {
+	if len(imgs) == 0 {
+		return errors.Errorf("no images found for version %q; check --kubernetes-version", version)
+	}
+	return nil
+}
+
+// GetImagesFromList gets a map of image Configs from a file listing one image
+// reference per line. Blank lines and lines starting with '#' are ignored.
+func GetImagesFromList(imageList string) (map[string]Config, error) {
+	contents, err := ioutil.ReadFile(imageList)
+	if err != nil {
+		return nil, errors.Wrapf(err, "couldn't read image list %v", imageList)
+	}
+
+	imgs := map[string]Config{}
+	for n, line := range strings.Split(string(contents), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		cfg, err := configFromReference(line)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid image on line %d of %v", n+1, imageList)
+		}
+		imgs[line] = cfg
+	}
 	return imgs, nil
 }
 
-// getTarFileName returns a filename matching the version of Kubernetes images are exported
-func getTarFileName(version string) string {
+// configFromReference returns the image Config for a fully qualified image reference
+func configFromReference(image string) (Config, error) {
+	ref, err := registry.ParseReference(image)
+	if err != nil {
+		return Config{}, err
+	}
+	if ref.Digest != "" {
+		return Config{}, errors.Errorf("image %v: references by digest are not supported", image)
+	}
+
+	return Config{
+		registry: path.Join(ref.Host, path.Dir(ref.Repository)),
+		name:     path.Base(ref.Repository),
+		version:  ref.Tag,
+	}, nil
+}
+
+// AddedImages returns the images in target whose references aren't in baseline,
+// e.g. the images a newer Kubernetes version needs beyond an older one's.
+func AddedImages(baseline, target map[string]Config) map[string]Config {
+	existing := map[string]bool{}
+	for _, v := range baseline {
+		existing[v.GetE2EImage()] = true
+	}
+
+	added := map[string]Config{}
+	for k, v := range target {
+		if !existing[v.GetE2EImage()] {
+			added[k] = v
+		}
+	}
+	return added
+}
+
+// UniqueImages returns the sorted, de-duplicated image references in images.
+// Image sets may contain the same image under several keys.
+func UniqueImages(images map[string]Config) []string {
+	seen := map[string]bool{}
+	refs := []string{}
+	for _, v := range images {
+		ref := v.GetE2EImage()
+		if !seen[ref] {
+			seen[ref] = true
+			refs = append(refs, ref)
+		}
+	}
+	sort.Strings(refs)
+	return refs
+}
+
+// configsByImage returns the Config of each image reference. Of several Configs
+// for one reference, the first by key with an override is used.
+func configsByImage(images map[string]Config) map[string]Config {
+	configs := map[string]Config{}
+	for _, k := range sortedKeys(images) {
+		img := images[k]
+		ref := img.GetE2EImage()
+		if existing, ok := configs[ref]; !ok || existing.Override() == (ImageOverride{}) {
+			configs[ref] = img
+		}
+	}
+	return configs
+}
+
+// uniqueRepositories returns the sorted, de-duplicated repositories of images
+func uniqueRepositories(images map[string]Config) []string {
+	seen := map[string]bool{}
+	repos := []string{}
+	for _, v := range images {
+		repo := path.Join(v.registry, v.name)
+		if !seen[repo] {
+			seen[repo] = true
+			repos = append(repos, repo)
+		}
+	}
+	sort.Strings(repos)
+	return repos
+}
+
+// sortedKeys returns the keys of images in sorted order
+func sortedKeys(images map[string]Config) []string {
+	keys := make([]string, 0, len(images))
+	for k := range images {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// getTarFileName returns a filename matching the version of Kubernetes images are exported.
+// Parts of a download split into batches are numbered from 1; part 0 is an unsplit download.
+func getTarFileName(version string, part int) string {
+	if part > 0 {
+		return fmt.Sprintf("kubernetes_e2e_images_%s_part%03d.tar", version, part)
+	}
 	return fmt.Sprintf("kubernetes_e2e_images_%s.tar", version)
 }
@@ -17,6 +17,13 @@ limitations under the License.
 package image
 
 import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
 	"testing"
 
 	"github.com/heptio/sonobuoy/pkg/image/docker"
@@ -34,37 +41,103 @@ var imgs = map[string]Config{
 type FakeDockerClient struct {
 	imageExists bool
 	pushFails   bool
-	pullFails   bool
-	tagFails    bool
-	saveFails   bool
-	deleteFails bool
+	// unauthorizedPushes is the number of pushes to reject as unauthorized before succeeding
+	unauthorizedPushes *int
+	// unauthorizedPulls is the number of pulls to reject as unauthorized before succeeding
+	unauthorizedPulls *int
+	pullFails         bool
+	tagFails          bool
+	saveFails         bool
+	deleteFails       bool
+	loadFails         bool
+	// architecture is the architecture reported for every image, amd64 if empty
+	architecture string
+	// loaded records the files loaded, if set
+	loaded *[]string
+	// missing are the images that can't be inspected, as if not present locally
+	missing map[string]bool
+	// deleted records the images removed, if set
+	deleted *[]string
+	// savesLeft is the number of saves to succeed before failing, if set
+	savesLeft *int
+	// manifests records the images of each manifest list created, if set
+	manifests *map[string][]string
+	// tagged records the destination of each tag, if set
+	tagged *[]string
+	// logins records the registry of each login, if set
+	logins *[]string
+	// pulledPlatform records the platform of the last pull, if set, and is
+	// reported by Inspect instead of architecture
+	pulledPlatform *string
+	// pulls records the images pulled, if set
+	pulls *[]string
+	// dangling are the IDs of the untagged images listed
+	dangling []string
+	// inspectFails fails every inspect, as if the daemon couldn't be reached
+	inspectFails bool
+	// layers are the layers reported for every pull and push, if set
+	layers []string
+	// savedSize is the bytes a save writes for each image, if set, rather than
+	// just the image's name
+	savedSize int
 }
 
-func (l FakeDockerClient) PullIfNotPresent(image string, retries int) error {
+const fakeImageSize = 1024
+
+func (l FakeDockerClient) PullIfNotPresent(image string, opts docker.PullOptions, retries int) (bool, error) {
 	if l.imageExists {
-		return nil
+		return false, nil
+	}
+	if err := l.Pull(image, opts, retries); err != nil {
+		return false, err
 	}
-	return l.Pull(image, retries)
+	return true, nil
 }
 
-func (l FakeDockerClient) Pull(image string, retries int) error {
+func (l FakeDockerClient) Pull(image string, opts docker.PullOptions, retries int) error {
+	if l.unauthorizedPulls != nil && *l.unauthorizedPulls > 0 {
+		*l.unauthorizedPulls--
+		return errors.WithMessage(docker.ErrUnauthorized, "pull failed")
+	}
 	if l.pullFails {
 		return errors.New("pull failed")
 	}
+	if l.pulls != nil {
+		*l.pulls = append(*l.pulls, image)
+	}
+	if l.pulledPlatform != nil {
+		*l.pulledPlatform = opts.Platform
+	}
+	if l.layers != nil && opts.Layers != nil {
+		opts.Layers(docker.LayerProgress{Completed: l.layers, Incomplete: []string{}})
+	}
 	return nil
 }
 
-func (l FakeDockerClient) Push(image string, retries int) error {
+func (l FakeDockerClient) Push(image string, retries int) (docker.PushResult, error) {
+	if l.unauthorizedPushes != nil && *l.unauthorizedPushes > 0 {
+		*l.unauthorizedPushes--
+		return docker.PushResult{}, errors.WithMessage(docker.ErrUnauthorized, "push failed")
+	}
 	if l.pushFails {
-		return errors.New("push failed")
+		return docker.PushResult{}, errors.New("push failed")
 	}
-	return nil
+	result := docker.PushResult{Image: image, Digest: fakeDigest, Size: fakeImageSize}
+	if l.layers != nil {
+		result.Layers = docker.LayerProgress{Completed: l.layers, Incomplete: []string{}}
+	}
+	return result, nil
 }
 
 func (l FakeDockerClient) Tag(src, dest string, retries int) error {
 	if l.tagFails {
 		return errors.New("tag failed")
 	}
+	if l.tagged != nil {
+		*l.tagged = append(*l.tagged, dest)
+	}
+	// The new tag is present locally from now on
+	delete(l.missing, dest)
 	return nil
 }
 
@@ -72,16 +145,127 @@ func (l FakeDockerClient) Rmi(image string, retries int) error {
 	if l.deleteFails {
 		return errors.New("delete failed")
 	}
+	if l.deleted != nil {
+		*l.deleted = append(*l.deleted, image)
+	}
 	return nil
 }
 
 func (l FakeDockerClient) Save(images []string, filename string) error {
+	contents := []byte(strings.Join(images, "\n"))
+	if l.savedSize > 0 {
+		contents = bytes.Repeat([]byte{0}, l.savedSize*len(images))
+	}
+	// Write a partial file regardless to mimic docker writing output before failing
+	if err := ioutil.WriteFile(filename, contents, 0644); err != nil {
+		return err
+	}
 	if l.saveFails {
 		return errors.New("save failed")
 	}
+	if l.savesLeft != nil {
+		if *l.savesLeft == 0 {
+			return errors.New("save failed")
+		}
+		*l.savesLeft--
+	}
+	return nil
+}
+
+func (l FakeDockerClient) SaveTo(images []string, w io.Writer) error {
+	if _, err := io.WriteString(w, strings.Join(images, "\n")); err != nil {
+		return err
+	}
+	if l.saveFails {
+		return errors.New("save failed")
+	}
+	return nil
+}
+
+func (l FakeDockerClient) Login(registry, username, password string) error {
+	if l.logins != nil {
+		*l.logins = append(*l.logins, registry+" "+username+":"+password)
+	}
 	return nil
 }
 
+func (l FakeDockerClient) LoadFrom(r io.Reader) error {
+	if _, err := ioutil.ReadAll(r); err != nil {
+		return err
+	}
+	if l.loadFails {
+		return errors.New("load failed")
+	}
+	if l.loaded != nil {
+		*l.loaded = append(*l.loaded, "-")
+	}
+	return nil
+}
+
+func (l FakeDockerClient) ManifestCreate(list string, images []string) error {
+	if l.manifests != nil {
+		(*l.manifests)[list] = images
+	}
+	return nil
+}
+
+func (l FakeDockerClient) ManifestPush(list string, retries int) error {
+	if l.pushFails {
+		return errors.New("push failed")
+	}
+	return nil
+}
+
+func (l FakeDockerClient) Logout(registry string) error {
+	return nil
+}
+
+func (l FakeDockerClient) Load(filename string) error {
+	if _, err := os.Stat(filename); err != nil {
+		return err
+	}
+	if l.loadFails {
+		return errors.New("load failed")
+	}
+	if l.loaded != nil {
+		*l.loaded = append(*l.loaded, filename)
+	}
+	return nil
+}
+
+const fakeDigest = "sha256:9c0e4ac8ee2a9ad0c2baa5b4b2d6d0c87e6d5a9b35ef6b7e1f0b1e9c6e8b7a6f"
+
+func (l FakeDockerClient) DanglingImages() ([]string, error) {
+	return l.dangling, nil
+}
+
+func (l FakeDockerClient) Inspect(image string) (docker.ImageInfo, error) {
+	if l.inspectFails {
+		return docker.ImageInfo{}, errors.New("inspect failed")
+	}
+	if l.missing[image] {
+		return docker.ImageInfo{}, errors.WithMessage(docker.ErrImageNotFound, image)
+	}
+	name := image
+	if i := strings.LastIndex(image, ":"); i > 0 {
+		name = image[:i]
+	}
+	arch := l.architecture
+	if arch == "" {
+		arch = "amd64"
+	}
+	if l.pulledPlatform != nil && *l.pulledPlatform != "" {
+		arch = strings.Split(*l.pulledPlatform, "/")[1]
+	}
+	return docker.ImageInfo{
+		ID:           "sha256:" + image,
+		Size:         fakeImageSize,
+		Os:           "linux",
+		Architecture: arch,
+		RepoDigests:  []string{"other.io/sonobuoy/test1@" + fakeDigest, name + "@" + fakeDigest},
+	}, nil
+}
+
 func TestPushImages(t *testing.T) {
 	var privateImgs = map[string]Config{
 		"test": Config{
@@ -94,7 +278,10 @@ func TestPushImages(t *testing.T) {
 	tests := map[string]struct {
 		client         docker.Docker
 		privateImgs    map[string]Config
+		extraTags      []string
 		wantErrorCount int
+		// wantPushed is the number of images pushed, extra tags included
+		wantPushed int
 	}{
 		"simple": {
 			client: FakeDockerClient{
@@ -103,6 +290,7 @@ func TestPushImages(t *testing.T) {
 			},
 			privateImgs:    privateImgs,
 			wantErrorCount: 0,
+			wantPushed:     1,
 		},
 		"tag fails": {
 			client: FakeDockerClient{
@@ -111,14 +299,22 @@ func TestPushImages(t *testing.T) {
 			},
 			privateImgs:    privateImgs,
 			wantErrorCount: 1,
+			wantPushed:     0,
 		},
 		"push fails": {
 			client: FakeDockerClient{
 				pushFails: true,
-				tagFails:  true,
+				tagFails:  false,
+			},
+			privateImgs:    privateImgs,
+			wantErrorCount: 1,
+		},
+		"source image not pulled": {
+			client: FakeDockerClient{
+				missing: map[string]bool{"foo.io/sonobuoy/test1:x.y": true},
 			},
 			privateImgs:    privateImgs,
-			wantErrorCount: 2,
+			wantErrorCount: 1,
 		},
 		"source images equal destination images": {
 			client: FakeDockerClient{
@@ -128,6 +324,25 @@ func TestPushImages(t *testing.T) {
 			privateImgs:    imgs,
 			wantErrorCount: 0,
 		},
+		"extra tags are pushed": {
+			client: FakeDockerClient{
+				pushFails: false,
+				tagFails:  false,
+			},
+			privateImgs:    privateImgs,
+			extraTags:      []string{"stable"},
+			wantErrorCount: 0,
+			wantPushed:     2,
+		},
+		"extra tags fail to push": {
+			client: FakeDockerClient{
+				pushFails: true,
+				tagFails:  false,
+			},
+			privateImgs:    privateImgs,
+			extraTags:      []string{"stable", "latest"},
+			wantErrorCount: 3,
+		},
 	}
 
 	for name, tc := range tests {
@@ -137,18 +352,443 @@ func TestPushImages(t *testing.T) {
 				dockerClient: tc.client,
 			}
 
-			got := imgClient.PushImages(imgs, tc.privateImgs, 0)
+			pushed, got := imgClient.PushImages(imgs, tc.privateImgs, tc.extraTags, 0)
 
 			if len(got) != tc.wantErrorCount {
 				t.Fatalf("Expected errors: %d but got %d", tc.wantErrorCount, len(got))
 			}
+			if len(pushed) != tc.wantPushed {
+				t.Errorf("Expected pushed: %d but got %d", tc.wantPushed, len(pushed))
+			}
+		})
+	}
+}
+func TestPushImagesDeduplicates(t *testing.T) {
+	upstream := map[string]Config{
+		"Nginx":    {name: "nginx", registry: "docker.io/library", version: "1.14-alpine"},
+		"NginxOld": {name: "nginx", registry: "docker.io/library", version: "1.14-alpine"},
+	}
+	private := map[string]Config{
+		"Nginx":    {name: "nginx", registry: "private.io/library", version: "1.14-alpine"},
+		"NginxOld": {name: "nginx", registry: "private.io/library", version: "1.14-alpine"},
+	}
+
+	imgClient := ImageClient{
+		dockerClient: FakeDockerClient{pushFails: true},
+	}
+
+	_, got := imgClient.PushImages(upstream, private, nil, 0)
+	if len(got) != 1 {
+		t.Fatalf("Expected errors: %d but got %d", 1, len(got))
+	}
+}
+
+func TestUntagSources(t *testing.T) {
+	upstream := map[string]Config{
+		"A": {name: "a", registry: "foo.io/sonobuoy", version: "1.0"},
+		"B": {name: "b", registry: "foo.io/sonobuoy", version: "1.0"},
+		"C": {name: "c", registry: "public.io/sonobuoy", version: "1.0"},
+	}
+	private := map[string]Config{
+		"A": {name: "a", registry: "private.io/sonobuoy", version: "1.0"},
+		"B": {name: "b", registry: "private.io/sonobuoy", version: "1.0"},
+		"C": {name: "c", registry: "public.io/sonobuoy", version: "1.0"},
+	}
+
+	tests := map[string]struct {
+		extraTags []string
+		pushed    []string
+		want      []string
+	}{
+		"all pushed": {
+			pushed: []string{"private.io/sonobuoy/a:1.0", "private.io/sonobuoy/b:1.0"},
+			want:   []string{"foo.io/sonobuoy/a:1.0", "foo.io/sonobuoy/b:1.0"},
+		},
+		"failed pushes keep their source": {
+			pushed: []string{"private.io/sonobuoy/b:1.0"},
+			want:   []string{"foo.io/sonobuoy/b:1.0"},
+		},
+		"sources are kept until every extra tag is pushed": {
+			extraTags: []string{"stable"},
+			pushed:    []string{"private.io/sonobuoy/a:1.0", "private.io/sonobuoy/a:stable", "private.io/sonobuoy/b:1.0"},
+			want:      []string{"foo.io/sonobuoy/a:1.0"},
+		},
+		"nothing pushed": {
+			want: []string{},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			deleted := []string{}
+			imgClient := ImageClient{
+				dockerClient: FakeDockerClient{deleted: &deleted},
+			}
+
+			pushed := []docker.PushResult{}
+			for _, img := range tc.pushed {
+				pushed = append(pushed, docker.PushResult{Image: img})
+			}
+
+			errs := imgClient.UntagSources(upstream, private, tc.extraTags, pushed, 0)
+			if len(errs) != 0 {
+				t.Fatalf("Expected no errors but got %v", errs)
+			}
+			if !reflect.DeepEqual(deleted, tc.want) {
+				t.Errorf("Expected untagged images %v but got %v", tc.want, deleted)
+			}
+		})
+	}
+}
+
+func TestPushImagesResults(t *testing.T) {
+	private := map[string]Config{
+		"test": {name: "test1", registry: "private.io/sonobuoy", version: "x.y"},
+	}
+
+	imgClient := ImageClient{
+		dockerClient: FakeDockerClient{},
+	}
+
+	got, errs := imgClient.PushImages(imgs, private, []string{"stable"}, 0)
+	if len(errs) != 0 {
+		t.Fatalf("Expected no errors but got %v", errs)
+	}
+
+	want := []docker.PushResult{
+		{Image: "private.io/sonobuoy/test1:x.y", Digest: fakeDigest, Size: fakeImageSize},
+		{Image: "private.io/sonobuoy/test1:stable", Digest: fakeDigest, Size: fakeImageSize},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected results %+v but got %+v", want, got)
+	}
+}
+
+func TestCheckAllowedRegistries(t *testing.T) {
+	upstream := map[string]Config{
+		"Nginx":   {name: "nginx", registry: "docker.io/library", version: "1.14-alpine"},
+		"Busybox": {name: "busybox", registry: "docker.io/library", version: "1.29"},
+	}
+
+	tests := map[string]struct {
+		private map[string]Config
+		allowed []string
+		wantErr bool
+	}{
+		"no allow-list": {
+			private: map[string]Config{
+				"Nginx":   {name: "nginx", registry: "public.io/library", version: "1.14-alpine"},
+				"Busybox": {name: "busybox", registry: "docker.io/library", version: "1.29"},
+			},
+		},
+		"all destinations allowed": {
+			private: map[string]Config{
+				"Nginx":   {name: "nginx", registry: "private.io/library", version: "1.14-alpine"},
+				"Busybox": {name: "busybox", registry: "Private.io:5000/library", version: "1.29"},
+			},
+			allowed: []string{"private.io", "private.io:5000"},
+		},
+		"public images are not pushed": {
+			private: map[string]Config{
+				"Nginx":   {name: "nginx", registry: "private.io/library", version: "1.14-alpine"},
+				"Busybox": {name: "busybox", registry: "docker.io/library", version: "1.29"},
+			},
+			allowed: []string{"private.io"},
+		},
+		"destination not allowed": {
+			private: map[string]Config{
+				"Nginx":   {name: "nginx", registry: "private.io/library", version: "1.14-alpine"},
+				"Busybox": {name: "busybox", registry: "public.io/library", version: "1.29"},
+			},
+			allowed: []string{"private.io"},
+			wantErr: true,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			err := CheckAllowedRegistries(upstream, tc.private, tc.allowed)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("Expected error %v but got %v", tc.wantErr, err)
+			}
+		})
+	}
+}
+
+type fakeAuthRefresher struct {
+	refreshed []string
+	fails     bool
+}
+
+func (f *fakeAuthRefresher) Refresh(registryHost string) error {
+	f.refreshed = append(f.refreshed, registryHost)
+	if f.fails {
+		return errors.New("refresh failed")
+	}
+	return nil
+}
+
+func TestPushImagesRefreshesAuth(t *testing.T) {
+	var privateImgs = map[string]Config{
+		"test": {name: "test1", registry: "private.io/sonobuoy", version: "x.y"},
+	}
+
+	tests := map[string]struct {
+		unauthorizedPushes int
+		refresher          *fakeAuthRefresher
+		wantErrorCount     int
+		wantRefreshed      []string
+	}{
+		"no refresher configured": {
+			unauthorizedPushes: 1,
+			wantErrorCount:     1,
+		},
+		"refresh succeeds": {
+			unauthorizedPushes: 1,
+			refresher:          &fakeAuthRefresher{},
+			wantErrorCount:     0,
+			wantRefreshed:      []string{"private.io"},
+		},
+		"refresh only retried once": {
+			unauthorizedPushes: 2,
+			refresher:          &fakeAuthRefresher{},
+			wantErrorCount:     1,
+			wantRefreshed:      []string{"private.io"},
+		},
+		"refresh fails": {
+			unauthorizedPushes: 1,
+			refresher:          &fakeAuthRefresher{fails: true},
+			wantErrorCount:     1,
+			wantRefreshed:      []string{"private.io"},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			unauthorized := tc.unauthorizedPushes
+			imgClient := ImageClient{
+				dockerClient: FakeDockerClient{unauthorizedPushes: &unauthorized},
+			}
+			if tc.refresher != nil {
+				imgClient = imgClient.WithAuthRefresher(tc.refresher)
+			}
+
+			_, got := imgClient.PushImages(imgs, privateImgs, nil, 0)
+			if len(got) != tc.wantErrorCount {
+				t.Fatalf("Expected errors: %d but got %d", tc.wantErrorCount, len(got))
+			}
+			if tc.refresher != nil && !reflect.DeepEqual(tc.refresher.refreshed, tc.wantRefreshed) {
+				t.Fatalf("Expected refreshes %v but got %v", tc.wantRefreshed, tc.refresher.refreshed)
+			}
+		})
+	}
+}
+
+func TestPullImagesRefreshesAuth(t *testing.T) {
+	tests := map[string]struct {
+		unauthorizedPulls int
+		refresher         *fakeAuthRefresher
+		wantErrorCount    int
+		wantRefreshed     []string
+	}{
+		"no refresher configured": {
+			unauthorizedPulls: 1,
+			wantErrorCount:    1,
+		},
+		"refresh succeeds": {
+			unauthorizedPulls: 1,
+			refresher:         &fakeAuthRefresher{},
+			wantRefreshed:     []string{"foo.io"},
+		},
+		"refresh only retried once": {
+			unauthorizedPulls: 2,
+			refresher:         &fakeAuthRefresher{},
+			wantErrorCount:    1,
+			wantRefreshed:     []string{"foo.io"},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			unauthorized := tc.unauthorizedPulls
+			imgClient := ImageClient{
+				dockerClient: FakeDockerClient{unauthorizedPulls: &unauthorized},
+			}
+			if tc.refresher != nil {
+				imgClient = imgClient.WithAuthRefresher(tc.refresher)
+			}
+
+			_, got := imgClient.PullImages(imgs, docker.PullOptions{}, 0)
+			if len(got) != tc.wantErrorCount {
+				t.Fatalf("Expected errors: %d but got %d", tc.wantErrorCount, len(got))
+			}
+			if tc.refresher != nil && !reflect.DeepEqual(tc.refresher.refreshed, tc.wantRefreshed) {
+				t.Fatalf("Expected refreshes %v but got %v", tc.wantRefreshed, tc.refresher.refreshed)
+			}
+		})
+	}
+}
+
+func TestPushImagesUnauthorizedError(t *testing.T) {
+	var privateImgs = map[string]Config{
+		"test": {name: "test1", registry: "private.io/sonobuoy", version: "x.y"},
+	}
+
+	tests := map[string]struct {
+		config string
+		want   string
+	}{
+		"logged in": {
+			config: `{"auths": {"private.io": {"auth": "dXNlcjpzZWNyZXQ="}}}`,
+			want:   "registry private.io rejected the credentials provided",
+		},
+		"not logged in": {
+			config: `{"auths": {"other.io": {"auth": "dXNlcjpzZWNyZXQ="}}}`,
+			want:   "registry private.io requires credentials but none were provided",
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			defer chdirTemp(t)()
+			if err := ioutil.WriteFile("config.json", []byte(tc.config), 0600); err != nil {
+				t.Fatal(err)
+			}
+			wd, _ := os.Getwd()
+			defer os.Setenv("DOCKER_CONFIG", os.Getenv("DOCKER_CONFIG"))
+			os.Setenv("DOCKER_CONFIG", wd)
+
+			unauthorized := 1
+			imgClient := ImageClient{
+				dockerClient: FakeDockerClient{unauthorizedPushes: &unauthorized},
+			}
+			_, errs := imgClient.PushImages(imgs, privateImgs, nil, 0)
+			if len(errs) != 1 {
+				t.Fatalf("Expected 1 error but got %d", len(errs))
+			}
+			if !strings.Contains(errs[0].Error(), tc.want) {
+				t.Errorf("Expected error to contain %q but got %q", tc.want, errs[0])
+			}
+			if errors.Cause(errs[0]) != docker.ErrUnauthorized {
+				t.Errorf("Expected cause %v but got %v", docker.ErrUnauthorized, errors.Cause(errs[0]))
+			}
 		})
 	}
 }
+
+func TestUniqueImages(t *testing.T) {
+	images := map[string]Config{
+		"b":   {name: "test2", registry: "foo.io/sonobuoy", version: "x.y"},
+		"a":   {name: "test1", registry: "foo.io/sonobuoy", version: "x.y"},
+		"dup": {name: "test1", registry: "foo.io/sonobuoy", version: "x.y"},
+	}
+
+	want := []string{"foo.io/sonobuoy/test1:x.y", "foo.io/sonobuoy/test2:x.y"}
+	got := UniqueImages(images)
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("Expected %v but got %v", want, got)
+	}
+}
+
+func TestAddedImages(t *testing.T) {
+	baseline, err := GetImages("", "v1.13.0")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	target, err := GetImages("", "v1.14.0")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	added := AddedImages(baseline, target)
+	if len(added) == 0 || len(added) >= len(target) {
+		t.Fatalf("Expected some but not all of the v1.14.0 images to be new, got %d of %d", len(added), len(target))
+	}
+
+	existing := map[string]bool{}
+	for _, img := range UniqueImages(baseline) {
+		existing[img] = true
+	}
+	for _, img := range UniqueImages(added) {
+		if existing[img] {
+			t.Errorf("Expected only new images but got %v, which v1.13.0 has", img)
+		}
+	}
+
+	if got := AddedImages(target, target); len(got) != 0 {
+		t.Errorf("Expected no new images against the same version, got %v", UniqueImages(got))
+	}
+}
+
+func TestGetDigests(t *testing.T) {
+	imgClient := ImageClient{
+		dockerClient: FakeDockerClient{},
+	}
+
+	got, errs := imgClient.GetDigests([]string{"private.io/sonobuoy/test1:x.y", "busybox:1.29"})
+	if len(errs) != 0 {
+		t.Fatalf("Unexpected errors: %v", errs)
+	}
+
+	want := map[string]string{
+		"private.io/sonobuoy/test1:x.y": fakeDigest,
+		"busybox:1.29":                  fakeDigest,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("Expected %v but got %v", want, got)
+	}
+}
+
+func TestGetImagesFromList(t *testing.T) {
+	tests := map[string]struct {
+		contents string
+		want     []string
+		wantErr  bool
+	}{
+		"simple": {
+			contents: "gcr.io/kubernetes-e2e-test-images/dnsutils:1.1\nk8s.gcr.io/pause:3.1\n",
+			want:     []string{"gcr.io/kubernetes-e2e-test-images/dnsutils:1.1", "k8s.gcr.io/pause:3.1"},
+		},
+		"comments, blank lines and short names": {
+			contents: "# CNI images\n\n  busybox:1.29  \nquay.io/calico/node\n",
+			want:     []string{"docker.io/library/busybox:1.29", "quay.io/calico/node:latest"},
+		},
+		"invalid reference": {
+			contents: "gcr.io/Foo/bar:1.0\n",
+			wantErr:  true,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			f, err := ioutil.TempFile("", "image-list")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.Remove(f.Name())
+			f.WriteString(tc.contents)
+			f.Close()
+
+			got, err := GetImagesFromList(f.Name())
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("Expected error %v but got %v", tc.wantErr, err)
+			}
+			if tc.wantErr {
+				return
+			}
+			if !reflect.DeepEqual(UniqueImages(got), tc.want) {
+				t.Fatalf("Expected %v but got %v", tc.want, UniqueImages(got))
+			}
+		})
+	}
+}
+
 func TestPullImages(t *testing.T) {
 	tests := map[string]struct {
-		client         docker.Docker
-		wantErrorCount int
+		client          docker.Docker
+		opts            docker.PullOptions
+		wantErrorCount  int
+		wantTransferred int64
 	}{
 		"simple": {
 			client: FakeDockerClient{
@@ -156,7 +796,8 @@ func TestPullImages(t *testing.T) {
 				pullFails:   false,
 			},
 
-			wantErrorCount: 0,
+			wantErrorCount:  0,
+			wantTransferred: fakeImageSize,
 		},
 		"image exists": {
 			client: FakeDockerClient{
@@ -164,14 +805,56 @@ func TestPullImages(t *testing.T) {
 				pullFails:   false,
 			},
 
-			wantErrorCount: 0,
+			wantErrorCount:  0,
+			wantTransferred: 0,
 		},
 		"error pulling image": {
 			client: FakeDockerClient{
 				imageExists: false,
 				pullFails:   true,
 			},
-			wantErrorCount: 1,
+			wantErrorCount:  1,
+			wantTransferred: 0,
+		},
+		"platform matches": {
+			client:          FakeDockerClient{architecture: "arm64"},
+			opts:            docker.PullOptions{Platform: "linux/arm64"},
+			wantErrorCount:  0,
+			wantTransferred: fakeImageSize,
+		},
+		"platform mismatch": {
+			client:          FakeDockerClient{},
+			opts:            docker.PullOptions{Platform: "linux/arm64"},
+			wantErrorCount:  1,
+			wantTransferred: 0,
+		},
+		"platform mismatch for existing image": {
+			client:          FakeDockerClient{imageExists: true},
+			opts:            docker.PullOptions{Platform: "linux/arm64"},
+			wantErrorCount:  1,
+			wantTransferred: 0,
+		},
+		"invalid platform": {
+			client:          FakeDockerClient{},
+			opts:            docker.PullOptions{Platform: "arm64"},
+			wantErrorCount:  1,
+			wantTransferred: 0,
+		},
+		"all tags": {
+			client: FakeDockerClient{
+				imageExists: true,
+			},
+			opts:            docker.PullOptions{AllTags: true},
+			wantErrorCount:  0,
+			wantTransferred: 0,
+		},
+		"error pulling all tags": {
+			client: FakeDockerClient{
+				pullFails: true,
+			},
+			opts:            docker.PullOptions{AllTags: true},
+			wantErrorCount:  1,
+			wantTransferred: 0,
 		},
 	}
 
@@ -182,11 +865,20 @@ func TestPullImages(t *testing.T) {
 				dockerClient: tc.client,
 			}
 
-			got := imgClient.PullImages(imgs, 0)
+			pulled, got := imgClient.PullImages(imgs, tc.opts, 0)
+			transferred := TotalSize(pulled)
 
 			if len(got) != tc.wantErrorCount {
 				t.Fatalf("Expected errors: %d but got %d", tc.wantErrorCount, len(got))
 			}
+			if transferred != tc.wantTransferred {
+				t.Fatalf("Expected transferred bytes: %d but got %d", tc.wantTransferred, transferred)
+			}
+			for _, r := range pulled {
+				if r.ID != "sha256:"+r.Image {
+					t.Errorf("Expected image %v to have its inspected ID but got %q", r.Image, r.ID)
+				}
+			}
 		})
 	}
 }
@@ -203,7 +895,7 @@ func TestDownloadImages(t *testing.T) {
 			client: FakeDockerClient{
 				saveFails: false,
 			},
-			wantFileName: getTarFileName(k8sVersion),
+			wantFileName: getTarFileName(k8sVersion, 0),
 			wantError:    false,
 		},
 		"fail": {
@@ -217,6 +909,7 @@ func TestDownloadImages(t *testing.T) {
 
 	for name, tc := range tests {
 		t.Run(name, func(t *testing.T) {
+			defer chdirTemp(t)()
 
 			imgClient := ImageClient{
 				dockerClient: tc.client,
@@ -231,9 +924,192 @@ func TestDownloadImages(t *testing.T) {
 			if gotFilename != tc.wantFileName {
 				t.Fatalf("Expected filename: %s but got: %s", tc.wantFileName, gotFilename)
 			}
+
+			files, err := filepath.Glob("*")
+			if err != nil {
+				t.Fatal(err)
+			}
+			var wantFiles []string
+			if !tc.wantError {
+				wantFiles = []string{tc.wantFileName, tc.wantFileName + checksumSuffix}
+			}
+			if !reflect.DeepEqual(files, wantFiles) {
+				t.Fatalf("Expected files %v but got %v", wantFiles, files)
+			}
+			if !tc.wantError {
+				if err := VerifyChecksum(tc.wantFileName, ""); err != nil {
+					t.Errorf("Expected the tar to match its checksum file but got %v", err)
+				}
+			}
 		})
 	}
 }
+
+func TestDownloadImageBatches(t *testing.T) {
+	const k8sVersion = "99.YY.ZZ"
+	images := []string{
+		"foo.io/sonobuoy/a:1.0",
+		"foo.io/sonobuoy/b:1.0",
+		"foo.io/sonobuoy/c:1.0",
+		"foo.io/sonobuoy/d:1.0",
+		"foo.io/sonobuoy/e:1.0",
+	}
+
+	tests := map[string]struct {
+		client    docker.Docker
+		batchSize int
+		wantFiles []string
+		wantError bool
+	}{
+		"uneven batches": {
+			client:    FakeDockerClient{},
+			batchSize: 2,
+			wantFiles: []string{
+				getTarFileName(k8sVersion, 1),
+				getTarFileName(k8sVersion, 2),
+				getTarFileName(k8sVersion, 3),
+			},
+		},
+		"single batch": {
+			client:    FakeDockerClient{},
+			batchSize: 10,
+			wantFiles: []string{getTarFileName(k8sVersion, 1)},
+		},
+		"invalid batch size": {
+			client:    FakeDockerClient{},
+			batchSize: 0,
+			wantFiles: []string{},
+			wantError: true,
+		},
+		"fail": {
+			client:    FakeDockerClient{saveFails: true},
+			batchSize: 2,
+			wantFiles: []string{},
+			wantError: true,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			defer chdirTemp(t)()
+
+			imgClient := ImageClient{
+				dockerClient: tc.client,
+			}
+
+			gotFiles, gotErr := imgClient.DownloadImageBatches(images, k8sVersion, tc.batchSize)
+			if (gotErr != nil) != tc.wantError {
+				t.Fatalf("Expected error %v but got %v", tc.wantError, gotErr)
+			}
+			if !tc.wantError && !reflect.DeepEqual(gotFiles, tc.wantFiles) {
+				t.Fatalf("Expected files %v but got %v", tc.wantFiles, gotFiles)
+			}
+
+			files, err := filepath.Glob("*")
+			if err != nil {
+				t.Fatal(err)
+			}
+			// Each tar is written along with its checksum file
+			if len(files) != 2*len(tc.wantFiles) {
+				t.Fatalf("Expected files %v and their checksums on disk but got %v", tc.wantFiles, files)
+			}
+		})
+	}
+}
+
+func TestDownloadImageBatchesResumes(t *testing.T) {
+	defer chdirTemp(t)()
+
+	const k8sVersion = "99.YY.ZZ"
+	images := []string{
+		"foo.io/sonobuoy/a:1.0",
+		"foo.io/sonobuoy/b:1.0",
+		"foo.io/sonobuoy/c:1.0",
+		"foo.io/sonobuoy/d:1.0",
+		"foo.io/sonobuoy/e:1.0",
+	}
+	journalPath := getTarFileName(k8sVersion, 0) + journalSuffix
+
+	// Interrupt the download after the first part
+	savesLeft := 1
+	imgClient := ImageClient{dockerClient: FakeDockerClient{savesLeft: &savesLeft}}
+	if _, err := imgClient.DownloadImageBatches(images, k8sVersion, 2); err == nil {
+		t.Fatal("Expected the interrupted download to fail")
+	}
+	if _, err := os.Stat(journalPath); err != nil {
+		t.Fatalf("Expected a journal of the interrupted download: %v", err)
+	}
+
+	// Only the two remaining parts are saved when resuming
+	savesLeft = 2
+	gotFiles, err := imgClient.DownloadImageBatches(images, k8sVersion, 2)
+	if err != nil {
+		t.Fatalf("Unexpected error resuming download: %v", err)
+	}
+	wantFiles := []string{
+		getTarFileName(k8sVersion, 1),
+		getTarFileName(k8sVersion, 2),
+		getTarFileName(k8sVersion, 3),
+	}
+	if !reflect.DeepEqual(gotFiles, wantFiles) {
+		t.Fatalf("Expected files %v but got %v", wantFiles, gotFiles)
+	}
+	if _, err := os.Stat(journalPath); !os.IsNotExist(err) {
+		t.Errorf("Expected the journal to be removed once the download completed")
+	}
+
+	// Once complete, downloading again saves every part afresh
+	savesLeft = 0
+	if _, err := imgClient.DownloadImageBatches(images, k8sVersion, 2); err == nil {
+		t.Errorf("Expected parts of a completed download to be saved again")
+	}
+}
+
+func TestPresentImages(t *testing.T) {
+	imgClient := ImageClient{
+		dockerClient: FakeDockerClient{missing: map[string]bool{"foo.io/sonobuoy/b:1.0": true}},
+	}
+
+	images := []string{"foo.io/sonobuoy/a:1.0", "foo.io/sonobuoy/b:1.0", "foo.io/sonobuoy/c:1.0"}
+	present, missing, err := imgClient.PresentImages(images)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if want := []string{"foo.io/sonobuoy/a:1.0", "foo.io/sonobuoy/c:1.0"}; !reflect.DeepEqual(present, want) {
+		t.Errorf("Expected present images %v but got %v", want, present)
+	}
+	if want := []string{"foo.io/sonobuoy/b:1.0"}; !reflect.DeepEqual(missing, want) {
+		t.Errorf("Expected missing images %v but got %v", want, missing)
+	}
+
+	// A daemon that can't be reached isn't mistaken for every image being missing
+	failing := ImageClient{dockerClient: FakeDockerClient{inspectFails: true}}
+	if _, _, err := failing.PresentImages(images); err == nil {
+		t.Error("Expected error when images can't be inspected but got nil")
+	}
+}
+
+// chdirTemp changes to a new temporary directory, returning a func that
+// restores the working directory and removes the temporary one.
+func chdirTemp(t *testing.T) func() {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir, err := ioutil.TempDir("", "sonobuoy-images")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	return func() {
+		os.Chdir(wd)
+		os.RemoveAll(dir)
+	}
+}
+
 func TestDeleteImages(t *testing.T) {
 	tests := map[string]struct {
 		client         docker.Docker
@@ -268,3 +1144,162 @@ func TestDeleteImages(t *testing.T) {
 		})
 	}
 }
+
+func TestDeleteImageRefs(t *testing.T) {
+	deleted := []string{}
+	imgClient := ImageClient{dockerClient: FakeDockerClient{deleted: &deleted}}
+
+	refs := []string{"k8s.gcr.io/pause:3.1", "docker.io/library/nginx:1.14-alpine"}
+	if errs := imgClient.DeleteImageRefs(refs, 0); len(errs) != 0 {
+		t.Fatalf("unexpected errors: %v", errs)
+	}
+	if !reflect.DeepEqual(deleted, refs) {
+		t.Errorf("Expected images %v deleted but got %v", refs, deleted)
+	}
+}
+
+func TestFailFast(t *testing.T) {
+	images := map[string]Config{
+		"a": {registry: "foo.io/sonobuoy", name: "a", version: "1.0"},
+		"b": {registry: "foo.io/sonobuoy", name: "b", version: "1.0"},
+		"c": {registry: "foo.io/sonobuoy", name: "c", version: "1.0"},
+	}
+	private := map[string]Config{
+		"a": {registry: "private.io/sonobuoy", name: "a", version: "1.0"},
+		"b": {registry: "private.io/sonobuoy", name: "b", version: "1.0"},
+		"c": {registry: "private.io/sonobuoy", name: "c", version: "1.0"},
+	}
+
+	tests := map[string]struct {
+		run func(i ImageClient) []error
+	}{
+		"pull": {
+			run: func(i ImageClient) []error {
+				_, errs := i.PullImages(images, docker.PullOptions{}, 0)
+				return errs
+			},
+		},
+		"push": {
+			run: func(i ImageClient) []error {
+				_, errs := i.PushImages(images, private, nil, 0)
+				return errs
+			},
+		},
+		"delete": {
+			run: func(i ImageClient) []error { return i.DeleteImages(images, 0) },
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			imgClient := ImageClient{dockerClient: FakeDockerClient{pullFails: true, pushFails: true, deleteFails: true}}
+
+			if errs := tc.run(imgClient); len(errs) != len(images) {
+				t.Errorf("Expected every image to be attempted, got %d errors: %v", len(errs), errs)
+			}
+			if errs := tc.run(imgClient.WithFailFast()); len(errs) != 1 {
+				t.Errorf("Expected to stop at the first error, got %d errors: %v", len(errs), errs)
+			}
+		})
+	}
+}
+
+func TestCheckImagesFound(t *testing.T) {
+	if err := checkImagesFound(imgs, "v1.14.0"); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	err := checkImagesFound(map[string]Config{}, "v1.14.0")
+	if err == nil || !strings.Contains(err.Error(), `no images found for version "v1.14.0"`) {
+		t.Errorf("Expected error for no images but got %v", err)
+	}
+}
+
+func TestPullImagesWithOverrides(t *testing.T) {
+	images := map[string]Config{
+		"A": {registry: "gcr.io/heptio-images", name: "a", version: "1.0", override: ImageOverride{Digest: fakeDigest}},
+		"B": {registry: "mirror.io/sonobuoy", name: "b", version: "1.0", override: ImageOverride{AuthRef: "MIRROR_AUTH"}},
+		"C": {registry: "quay.io/coreos", name: "c", version: "1.0", override: ImageOverride{Platform: "linux/arm64"}},
+	}
+	env := map[string]string{"MIRROR_AUTH": "user:pass"}
+
+	pulls, tagged, logins := []string{}, []string{}, []string{}
+	platform := ""
+	client := FakeDockerClient{pulls: &pulls, tagged: &tagged, logins: &logins, pulledPlatform: &platform}
+	imgClient := ImageClient{dockerClient: client}
+
+	// Without the environment, the image with an authRef can't be pulled
+	if _, errs := imgClient.PullImages(images, docker.PullOptions{}, 0); len(errs) != 1 {
+		t.Fatalf("Expected an error for the authRef without an environment but got %v", errs)
+	}
+
+	pulls, tagged, logins = []string{}, []string{}, []string{}
+	imgClient = imgClient.WithAuthRefs(func(name string) string { return env[name] })
+	if _, errs := imgClient.PullImages(images, docker.PullOptions{Platform: "linux/amd64"}, 0); len(errs) != 0 {
+		t.Fatalf("unexpected errors: %v", errs)
+	}
+
+	wantPulls := []string{"gcr.io/heptio-images/a@" + fakeDigest, "mirror.io/sonobuoy/b:1.0", "quay.io/coreos/c:1.0"}
+	if !reflect.DeepEqual(pulls, wantPulls) {
+		t.Errorf("Expected pulls %v but got %v", wantPulls, pulls)
+	}
+	if want := []string{"gcr.io/heptio-images/a:1.0"}; !reflect.DeepEqual(tagged, want) {
+		t.Errorf("Expected the image pulled by digest to be tagged %v but got %v", want, tagged)
+	}
+	if want := []string{"mirror.io user:pass"}; !reflect.DeepEqual(logins, want) {
+		t.Errorf("Expected logins %v but got %v", want, logins)
+	}
+	if platform != "linux/arm64" {
+		t.Errorf("Expected the last image to be pulled for its override's platform but got %v", platform)
+	}
+}
+
+func TestPushImagesChecksOverrides(t *testing.T) {
+	tests := map[string]struct {
+		override   ImageOverride
+		wantLogins []string
+		wantErr    bool
+	}{
+		"no override": {
+			wantLogins: []string{},
+		},
+		"matching digest and platform": {
+			override:   ImageOverride{Digest: fakeDigest, Platform: "linux/amd64"},
+			wantLogins: []string{},
+		},
+		"other digest": {
+			override:   ImageOverride{Digest: "sha256:other"},
+			wantLogins: []string{},
+			wantErr:    true,
+		},
+		"other platform": {
+			override:   ImageOverride{Platform: "linux/arm64"},
+			wantLogins: []string{},
+			wantErr:    true,
+		},
+		"auth ref": {
+			override: ImageOverride{AuthRef: "PRIVATE_AUTH"},
+			// A token is logged in with as Google's registries expect
+			wantLogins: []string{"private.io " + tokenUsername + ":token-for-private"},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			private := map[string]Config{
+				"test": {name: "test1", registry: "private.io/sonobuoy", version: "x.y", override: tc.override},
+			}
+			logins := []string{}
+			imgClient := ImageClient{dockerClient: FakeDockerClient{logins: &logins}}.
+				WithAuthRefs(func(name string) string { return map[string]string{"PRIVATE_AUTH": "token-for-private"}[name] })
+
+			_, errs := imgClient.PushImages(imgs, private, nil, 0)
+			if (len(errs) != 0) != tc.wantErr {
+				t.Fatalf("expected error %v, got %v", tc.wantErr, errs)
+			}
+			if !reflect.DeepEqual(logins, tc.wantLogins) {
+				t.Errorf("Expected logins %v but got %v", tc.wantLogins, logins)
+			}
+		})
+	}
+}
@@ -0,0 +1,248 @@
+/*
+Copyright the Sonobuoy contributors 2019
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package image
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// IndexFileName is the name of the index written alongside per-image tars
+const IndexFileName = "index.yaml"
+
+// IndexEntry records the tar an image was saved to
+type IndexEntry struct {
+	// File is the name of the tar, relative to the index
+	File string `yaml:"file"`
+	// ID is the local image ID when the tar was written
+	ID string `yaml:"id"`
+	// Digest is the registry digest of the image, if docker recorded one
+	Digest string `yaml:"digest,omitempty"`
+}
+
+// Index maps each image reference to the tar holding it
+type Index map[string]IndexEntry
+
+// ReadIndex reads the index in dir. A missing index is returned as an empty one.
+func ReadIndex(dir string) (Index, error) {
+	idx := Index{}
+	contents, err := ioutil.ReadFile(filepath.Join(dir, IndexFileName))
+	if os.IsNotExist(err) {
+		return idx, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "couldn't read image index")
+	}
+	if err := yaml.Unmarshal(contents, &idx); err != nil {
+		return nil, errors.Wrap(err, "couldn't decode image index")
+	}
+	return idx, nil
+}
+
+// write writes the index to dir
+func (idx Index) write(dir string) error {
+	b, err := yaml.Marshal(idx)
+	if err != nil {
+		return errors.Wrap(err, "couldn't encode image index")
+	}
+	return errors.Wrap(ioutil.WriteFile(filepath.Join(dir, IndexFileName), b, 0644), "couldn't write image index")
+}
+
+// DownloadImagesToDir saves each image to its own tar in dir and writes an index
+// of them. Images whose tar in an existing index is for the same image ID are
+// left untouched, so only changed images need to be transferred again. The index
+// is updated after each image, so an interrupted download resumes where it stopped.
+func (i ImageClient) DownloadImagesToDir(images []string, dir string) (Index, []error) {
+	export, err := newDirExport(dir)
+	if err != nil {
+		return nil, []error{err}
+	}
+
+	errs := []error{}
+	for n, img := range images {
+		if i.aborted(errs) {
+			break
+		}
+		progress := ImageProgress{Name: img, Operation: OperationDownload, Status: ProgressStarted, Current: n + 1, Total: len(images)}
+		i.report(progress)
+
+		skipped, err := export.save(i, img)
+		if err != nil {
+			errs = append(errs, err)
+		}
+		if skipped {
+			progress.Status = ProgressSkipped
+			i.report(progress)
+			continue
+		}
+		i.reportResult(progress, err)
+	}
+
+	idx, err := export.finish()
+	if err != nil {
+		errs = append(errs, err)
+	}
+	return idx, errs
+}
+
+// WithExportDir returns a copy of the client which saves each image to its own tar
+// in dir as soon as it's pulled, as DownloadImagesToDir does, so that pulling
+// produces a portable bundle in one pass. Images already present locally are
+// exported too.
+func (i ImageClient) WithExportDir(dir string) ImageClient {
+	i.exportDir = dir
+	return i
+}
+
+// dirExport tracks the images saved to their own tars in a directory and the
+// index of them. It's safe for concurrent use.
+type dirExport struct {
+	dir      string
+	mu       sync.Mutex
+	previous Index
+	// partial is the index as of the last completed image, keeping the previous
+	// entries of images not yet reached
+	partial Index
+	idx     Index
+}
+
+// newDirExport creates dir if needed and reads its existing index
+func newDirExport(dir string) (*dirExport, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, errors.Wrapf(err, "couldn't create output directory %v", dir)
+	}
+
+	previous, err := ReadIndex(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	partial := Index{}
+	for img, entry := range previous {
+		partial[img] = entry
+	}
+	return &dirExport{dir: dir, previous: previous, partial: partial, idx: Index{}}, nil
+}
+
+// save saves img to its tar unless it's unchanged since the previous export,
+// recording it in the index. It returns whether the save was skipped.
+func (e *dirExport) save(i ImageClient, img string) (bool, error) {
+	e.mu.Lock()
+	previous := e.previous[img]
+	e.mu.Unlock()
+
+	entry, skipped, err := i.downloadToDir(img, e.dir, previous)
+	if err != nil {
+		return false, err
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.idx[img] = entry
+	if skipped {
+		return true, nil
+	}
+	e.partial[img] = entry
+	return false, e.partial.write(e.dir)
+}
+
+// finish writes the index of the images saved, dropping those not reached
+func (e *dirExport) finish() (Index, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.idx, e.idx.write(e.dir)
+}
+
+// downloadToDir saves an image to its tar in dir unless previous already records
+// a tar of the same image. It returns whether the save was skipped.
+func (i ImageClient) downloadToDir(img, dir string, previous IndexEntry) (IndexEntry, bool, error) {
+	info, err := i.dockerClient.Inspect(img)
+	if err != nil {
+		return IndexEntry{}, false, err
+	}
+
+	entry := IndexEntry{File: tarFileNameForImage(img), ID: info.ID}
+	if digest, err := repoDigest(img, info.RepoDigests); err == nil {
+		entry.Digest = digest
+	}
+
+	if previous.ID == entry.ID && previous.File == entry.File {
+		if _, err := os.Stat(filepath.Join(dir, entry.File)); err == nil {
+			return entry, true, nil
+		}
+	}
+
+	if err := i.writeTar([]string{img}, filepath.Join(dir, entry.File)); err != nil {
+		return IndexEntry{}, false, errors.Wrapf(err, "couldn't download image %v", img)
+	}
+	return entry, false, nil
+}
+
+// LoadImagesFromDir loads each image recorded in the index in dir. Tars with a
+// sibling checksum file are verified against it first. Each tar is loaded once,
+// however many of the images it holds.
+func (i ImageClient) LoadImagesFromDir(dir string) []error {
+	idx, err := ReadIndex(dir)
+	if err != nil {
+		return []error{err}
+	}
+	if len(idx) == 0 {
+		return []error{errors.Errorf("no images indexed in %v", dir)}
+	}
+
+	errs := []error{}
+	imgs := make([]string, 0, len(idx))
+	for img := range idx {
+		imgs = append(imgs, img)
+	}
+	sort.Strings(imgs)
+
+	loaded := map[string]error{}
+	for n, img := range imgs {
+		if i.aborted(errs) {
+			break
+		}
+		progress := ImageProgress{Name: img, Operation: OperationLoad, Status: ProgressStarted, Current: n + 1, Total: len(imgs)}
+		i.report(progress)
+
+		// A tar holding several images, such as a part of a split download, is
+		// only loaded once
+		err, done := loaded[idx[img].File]
+		if !done {
+			err = i.loadTar(filepath.Join(dir, idx[img].File), "")
+			loaded[idx[img].File] = err
+		}
+		if err != nil {
+			err = errors.Wrapf(err, "couldn't load image %v", img)
+			errs = append(errs, err)
+		}
+		i.reportResult(progress, err)
+	}
+	return errs
+}
+
+// tarFileNameForImage returns the name of the tar an image is saved to in an output directory
+func tarFileNameForImage(img string) string {
+	return strings.NewReplacer("/", "_", ":", "_", "@", "_").Replace(img) + ".tar"
+}
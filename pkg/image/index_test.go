@@ -0,0 +1,166 @@
+/*
+Copyright the Sonobuoy contributors 2019
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package image
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/heptio/sonobuoy/pkg/image/docker"
+)
+
+func TestDownloadImagesToDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sonobuoy-images")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	images := []string{"foo.io/sonobuoy/test:1.0", "bar.io/other:2.0"}
+	imgClient := ImageClient{dockerClient: FakeDockerClient{}}
+
+	idx, errs := imgClient.DownloadImagesToDir(images, dir)
+	if len(errs) != 0 {
+		t.Fatalf("unexpected errors: %v", errs)
+	}
+
+	want := Index{
+		"foo.io/sonobuoy/test:1.0": {File: "foo.io_sonobuoy_test_1.0.tar", ID: "sha256:foo.io/sonobuoy/test:1.0", Digest: fakeDigest},
+		"bar.io/other:2.0":         {File: "bar.io_other_2.0.tar", ID: "sha256:bar.io/other:2.0", Digest: fakeDigest},
+	}
+	if !reflect.DeepEqual(idx, want) {
+		t.Fatalf("Expected index %+v but got %+v", want, idx)
+	}
+
+	got, err := ReadIndex(dir)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("Expected written index %+v but got %+v", want, got)
+	}
+
+	// Downloading again leaves unchanged images alone
+	tarPath := filepath.Join(dir, want["bar.io/other:2.0"].File)
+	old := time.Now().Add(-time.Hour).Truncate(time.Second)
+	if err := os.Chtimes(tarPath, old, old); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, errs := imgClient.DownloadImagesToDir(images, dir); len(errs) != 0 {
+		t.Fatalf("unexpected errors: %v", errs)
+	}
+	info, err := os.Stat(tarPath)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !info.ModTime().Equal(old) {
+		t.Errorf("Expected unchanged image not to be rewritten")
+	}
+}
+
+func TestPullImagesWithExportDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sonobuoy-images")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	images := map[string]Config{
+		"Test":  {registry: "foo.io/sonobuoy", name: "test", version: "1.0"},
+		"Other": {registry: "bar.io", name: "other", version: "2.0"},
+	}
+	imgClient := ImageClient{dockerClient: FakeDockerClient{}}.WithExportDir(dir)
+
+	if _, errs := imgClient.PullImages(images, docker.PullOptions{}, 0); len(errs) != 0 {
+		t.Fatalf("unexpected errors: %v", errs)
+	}
+
+	want := Index{
+		"foo.io/sonobuoy/test:1.0": {File: "foo.io_sonobuoy_test_1.0.tar", ID: "sha256:foo.io/sonobuoy/test:1.0", Digest: fakeDigest},
+		"bar.io/other:2.0":         {File: "bar.io_other_2.0.tar", ID: "sha256:bar.io/other:2.0", Digest: fakeDigest},
+	}
+	got, err := ReadIndex(dir)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("Expected written index %+v but got %+v", want, got)
+	}
+	for _, entry := range want {
+		if _, err := os.Stat(filepath.Join(dir, entry.File)); err != nil {
+			t.Errorf("Expected %v to be exported: %v", entry.File, err)
+		}
+	}
+
+	// Images already present are exported too, but those that fail to pull aren't
+	present := ImageClient{dockerClient: FakeDockerClient{imageExists: true}}.WithExportDir(filepath.Join(dir, "present"))
+	if _, errs := present.PullImages(images, docker.PullOptions{}, 0); len(errs) != 0 {
+		t.Fatalf("unexpected errors: %v", errs)
+	}
+	if got, err := ReadIndex(filepath.Join(dir, "present")); err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected index %+v but got %+v, %v", want, got, err)
+	}
+
+	failing := ImageClient{dockerClient: FakeDockerClient{pullFails: true}}.WithExportDir(filepath.Join(dir, "failed"))
+	if _, errs := failing.PullImages(images, docker.PullOptions{}, 0); len(errs) != len(images) {
+		t.Fatalf("Expected %d errors but got %v", len(images), errs)
+	}
+	if got, err := ReadIndex(filepath.Join(dir, "failed")); err != nil || len(got) != 0 {
+		t.Errorf("Expected an empty index but got %+v, %v", got, err)
+	}
+
+	if _, errs := imgClient.PullImages(images, docker.PullOptions{AllTags: true}, 0); len(errs) != 1 {
+		t.Errorf("Expected an error exporting all tags but got %v", errs)
+	}
+}
+
+func TestLoadImagesFromDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sonobuoy-images")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	images := []string{"foo.io/sonobuoy/test:1.0", "bar.io/other:2.0"}
+	if _, errs := (ImageClient{dockerClient: FakeDockerClient{}}).DownloadImagesToDir(images, dir); len(errs) != 0 {
+		t.Fatalf("unexpected errors: %v", errs)
+	}
+
+	loaded := []string{}
+	imgClient := ImageClient{dockerClient: FakeDockerClient{loaded: &loaded}}
+	if errs := imgClient.LoadImagesFromDir(dir); len(errs) != 0 {
+		t.Fatalf("unexpected errors: %v", errs)
+	}
+
+	want := []string{filepath.Join(dir, "bar.io_other_2.0.tar"), filepath.Join(dir, "foo.io_sonobuoy_test_1.0.tar")}
+	if !reflect.DeepEqual(loaded, want) {
+		t.Errorf("Expected loaded files %v but got %v", want, loaded)
+	}
+
+	empty, err := ioutil.TempDir("", "sonobuoy-images")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer os.RemoveAll(empty)
+	if errs := imgClient.LoadImagesFromDir(empty); len(errs) != 1 {
+		t.Errorf("Expected 1 error for a directory without an index but got %v", errs)
+	}
+}
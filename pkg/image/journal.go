@@ -0,0 +1,68 @@
+/*
+Copyright the Sonobuoy contributors 2019
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package image
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+
+	"github.com/pkg/errors"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// journalSuffix is appended to the name of a download to get its journal
+const journalSuffix = ".progress"
+
+// journal records the tar files of a batched download which were completed, and
+// the images in each, so that an interrupted download can be resumed.
+type journal map[string][]string
+
+// readJournal reads the journal at path. A missing journal is returned as an empty one.
+func readJournal(path string) (journal, error) {
+	j := journal{}
+	contents, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return j, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "couldn't read download journal")
+	}
+	if err := yaml.Unmarshal(contents, &j); err != nil {
+		return nil, errors.Wrap(err, "couldn't decode download journal")
+	}
+	return j, nil
+}
+
+// write writes the journal to path
+func (j journal) write(path string) error {
+	b, err := yaml.Marshal(j)
+	if err != nil {
+		return errors.Wrap(err, "couldn't encode download journal")
+	}
+	return errors.Wrap(ioutil.WriteFile(path, b, 0644), "couldn't write download journal")
+}
+
+// completed reports whether fileName was written with exactly the given images
+// and is still present.
+func (j journal) completed(fileName string, images []string) bool {
+	if !reflect.DeepEqual(j[fileName], images) {
+		return false
+	}
+	_, err := os.Stat(fileName)
+	return err == nil
+}
@@ -17,12 +17,40 @@ package image
 
 import (
 	"fmt"
-	"io/ioutil"
+	"reflect"
+	"sort"
+	"strings"
 
 	version "github.com/hashicorp/go-version"
+	"github.com/heptio/sonobuoy/pkg/image/registry"
+	"github.com/pkg/errors"
 	yaml "gopkg.in/yaml.v2"
 )
 
+// supportedMinorVersions are the Kubernetes 1.x minor versions GetImageConfigs knows the images for
+var supportedMinorVersions = []int{13, 14}
+
+const (
+	// OSLinux selects the images of the e2e tests run on Linux nodes, the default
+	OSLinux = "linux"
+	// OSWindows selects the Windows variants of the e2e test images, for clusters
+	// with Windows nodes
+	OSWindows = "windows"
+
+	// windowsRegistry is where every Windows variant of the e2e test images is
+	// published, under the same name and tag as its Linux counterpart.
+	windowsRegistry = "docker.io/e2eteam"
+)
+
+// windowsMinorVersions are the Kubernetes 1.x minor versions whose e2e test images
+// have Windows variants
+var windowsMinorVersions = []int{13, 14}
+
+// TargetOS is the OS of the nodes the e2e test images are resolved for, OSLinux
+// (or empty) or OSWindows. It applies to every RegistryList, so that the images
+// of every command follow it.
+var TargetOS string
+
 // RegistryList holds public and private image registries
 type RegistryList struct {
 	DockerLibraryRegistry string `yaml:"dockerLibraryRegistry"`
@@ -31,9 +59,16 @@ type RegistryList struct {
 	GcRegistry            string `yaml:"gcRegistry"`
 	PrivateRegistry       string `yaml:"privateRegistry"`
 	SampleRegistry        string `yaml:"sampleRegistry"`
+	// SonobuoyRegistry is where the sonobuoy image is mirrored to. It isn't used by
+	// the e2e tests, which ignore it.
+	SonobuoyRegistry string `yaml:"sonobuoyRegistry"`
 
 	K8sVersion *version.Version
-	Images     map[int]Config
+	// Images isn't read from the repo-config, whose images section holds the
+	// ImageOverrides instead.
+	Images map[int]Config `yaml:"-"`
+	// ImageOverrides are the attributes the repo-config sets for images, by name
+	ImageOverrides map[string]ImageOverride
 }
 
 // Config holds an images registry, name, and version
@@ -41,10 +76,18 @@ type Config struct {
 	registry string
 	name     string
 	version  string
+	// override is how the repo-config says to pull and push the image, if at all
+	override ImageOverride
 }
 
-// NewRegistryList returns a default registry or one that matches a config file passed
+// NewRegistryList returns a default registry or one that matches a config file passed.
+// The default registries are those of TargetOS.
 func NewRegistryList(repoConfig, k8sVersion string) (*RegistryList, error) {
+	return newRegistryList(repoConfig, k8sVersion, TargetOS)
+}
+
+// newRegistryList returns the registry list of NewRegistryList for targetOS
+func newRegistryList(repoConfig, k8sVersion, targetOS string) (*RegistryList, error) {
 	registry := &RegistryList{
 		DockerLibraryRegistry: "docker.io/library",
 		E2eRegistry:           "gcr.io/kubernetes-e2e-test-images",
@@ -52,20 +95,31 @@ func NewRegistryList(repoConfig, k8sVersion string) (*RegistryList, error) {
 		GcRegistry:            "k8s.gcr.io",
 		PrivateRegistry:       "gcr.io/k8s-authenticated-test",
 		SampleRegistry:        "gcr.io/google-samples",
+		SonobuoyRegistry:      "gcr.io/heptio-images",
+	}
+	if err := registry.selectOS(targetOS, k8sVersion); err != nil {
+		return nil, err
 	}
 
 	// Load in a config file
 	if repoConfig != "" {
 
-		fileContent, err := ioutil.ReadFile(repoConfig)
+		fileContent, err := ReadRepoConfig(repoConfig)
 		if err != nil {
-			panic(fmt.Errorf("Error reading '%v' file contents: %v", repoConfig, err))
+			return nil, err
 		}
 
 		err = yaml.Unmarshal(fileContent, &registry)
 		if err != nil {
-			panic(fmt.Errorf("Error unmarshalling '%v' YAML file: %v", repoConfig, err))
+			return nil, fmt.Errorf("Error unmarshalling '%v' YAML file: %v", repoConfig, err)
+		}
+		registry.trimRegistries()
+
+		parsed, err := parseRepoConfig(fileContent)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid repo-config %v", repoConfig)
 		}
+		registry.ImageOverrides = parsed.Images
 	}
 
 	// Init images for k8s version & repos configured
@@ -79,21 +133,261 @@ func NewRegistryList(repoConfig, k8sVersion string) (*RegistryList, error) {
 	return registry, nil
 }
 
+// selectOS points the default registries of the e2e test images at the variants
+// for the OS. The sonobuoy image is the same on every OS.
+func (r *RegistryList) selectOS(targetOS, k8sVersion string) error {
+	switch targetOS {
+	case "", OSLinux:
+		return nil
+	case OSWindows:
+	default:
+		return errors.Errorf("unsupported OS %q, expected %v or %v", targetOS, OSLinux, OSWindows)
+	}
+
+	v, err := validateVersion(k8sVersion)
+	if err != nil {
+		return err
+	}
+	if segments := v.Segments(); segments[0] != 1 || !containsInt(windowsMinorVersions, segments[1]) {
+		return errors.Errorf("the e2e test images of Kubernetes %v have no %v variants", k8sVersion, targetOS)
+	}
+	r.DockerLibraryRegistry = windowsRegistry
+	r.E2eRegistry = windowsRegistry
+	r.EtcdRegistry = windowsRegistry
+	r.GcRegistry = windowsRegistry
+	r.PrivateRegistry = windowsRegistry
+	r.SampleRegistry = windowsRegistry
+	return nil
+}
+
+func containsInt(values []int, v int) bool {
+	for _, value := range values {
+		if value == v {
+			return true
+		}
+	}
+	return false
+}
+
+// NearestSupportedVersion returns the Kubernetes version, if its images are known,
+// or otherwise the closest version whose images are known. Ties go to the older version.
+func NearestSupportedVersion(k8sVersion string) (string, error) {
+	v, err := validateVersion(k8sVersion)
+	if err != nil {
+		return "", err
+	}
+
+	segments := v.Segments()
+	minor := segments[1]
+	nearest := supportedMinorVersions[0]
+	for _, supported := range supportedMinorVersions {
+		if supported == minor && segments[0] == 1 {
+			return k8sVersion, nil
+		}
+		if distance(supported, minor) < distance(nearest, minor) {
+			nearest = supported
+		}
+	}
+
+	// Other major versions are compared as being beyond every 1.x version
+	switch {
+	case segments[0] > 1:
+		nearest = supportedMinorVersions[len(supportedMinorVersions)-1]
+	case segments[0] < 1:
+		nearest = supportedMinorVersions[0]
+	}
+	return fmt.Sprintf("v1.%d.0", nearest), nil
+}
+
+func distance(a, b int) int {
+	if a > b {
+		return a - b
+	}
+	return b - a
+}
+
+// RequiredRegistryKeys returns the sorted repo-config keys of the registries that
+// images for the Kubernetes version are pulled from.
+func RequiredRegistryKeys(k8sVersion string) ([]string, error) {
+	imgs, err := registryKeyConfigs(k8sVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	seen := map[string]bool{}
+	keys := []string{}
+	for _, img := range imgs {
+		if !seen[img.registry] {
+			seen[img.registry] = true
+			keys = append(keys, img.registry)
+		}
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+// registryKeyConfigs returns the image Configs for the Kubernetes version with each
+// registry named after its repo-config key, so the registry of each image is its key.
+func registryKeyConfigs(k8sVersion string) (map[string]Config, error) {
+	version, err := validateVersion(k8sVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	keyed := &RegistryList{K8sVersion: version}
+	for key, field := range keyed.registryFields() {
+		field.SetString(key)
+	}
+	return keyed.GetImageConfigs()
+}
+
+// MissingRegistryKeys returns the repo-config keys required for the Kubernetes
+// version that the repo-config doesn't set. Images from those registries would
+// silently be pulled from upstream.
+func MissingRegistryKeys(repoConfig, k8sVersion string) ([]string, error) {
+	fileContent, err := ReadRepoConfig(repoConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	parsed, err := parseRepoConfig(fileContent)
+	if err != nil {
+		return nil, fmt.Errorf("Error unmarshalling '%v' YAML file: %v", repoConfig, err)
+	}
+	set := parsed.Registries
+
+	required, err := RequiredRegistryKeys(k8sVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	missing := []string{}
+	for _, key := range required {
+		if set[key] == "" {
+			missing = append(missing, key)
+		}
+	}
+	return missing, nil
+}
+
 // GetImageConfigs returns the map of imageConfigs
 func (r *RegistryList) GetImageConfigs() (map[string]Config, error) {
+	var configs map[string]Config
 	switch r.K8sVersion.Segments()[0] {
 	case 1:
 		switch r.K8sVersion.Segments()[1] {
 		case 13:
-			return r.v1_13(), nil
+			configs = r.v1_13()
 		case 14:
-			return r.v1_14(), nil
+			configs = r.v1_14()
 		}
 	}
-	return map[string]Config{}, fmt.Errorf("No matching configuration for k8s version: %v", r.K8sVersion)
+	if configs == nil {
+		return map[string]Config{}, fmt.Errorf("No matching configuration for k8s version: %v", r.K8sVersion)
+	}
+	if err := r.applyOverrides(configs); err != nil {
+		return map[string]Config{}, err
+	}
+	return configs, nil
+}
+
+// applyOverrides sets the attributes the repo-config sets for each image on its
+// Config. Overrides of images the version doesn't use are an error, since they're
+// most likely misspelled.
+func (r *RegistryList) applyOverrides(configs map[string]Config) error {
+	authRefs := map[string]string{}
+	for _, key := range sortedOverrideKeys(r.ImageOverrides) {
+		if key == sonobuoyImageKey {
+			continue
+		}
+		img, ok := configs[key]
+		if !ok {
+			return errors.Errorf("repo-config sets %v.%v, but Kubernetes %v has no such image", repoConfigImagesKey, key, r.K8sVersion)
+		}
+		o := r.ImageOverrides[key]
+		if err := o.validate(); err != nil {
+			return errors.Wrapf(err, "invalid %v.%v in repo-config", repoConfigImagesKey, key)
+		}
+
+		// Docker keeps one login per registry host, so the images on a host can't
+		// be pulled or pushed with different credentials in one run.
+		if len(o.AuthRef) > 0 {
+			host := img.host()
+			if ref, ok := authRefs[host]; ok && ref != o.AuthRef {
+				return errors.Errorf("repo-config sets authRef %v and %v for images on %v, but docker can only log in to a registry host once", ref, o.AuthRef, host)
+			}
+			authRefs[host] = o.AuthRef
+		}
+
+		img.override = o
+		configs[key] = img
+	}
+	return nil
+}
+
+// trimRegistries strips trailing slashes from the registries, so a repo-config
+// remapping only the host (e.g. "mirror.io/") still yields each image under its
+// upstream repository and tag rather than an invalid "mirror.io//name:tag".
+func (r *RegistryList) trimRegistries() {
+	for _, field := range r.registryFields() {
+		field.SetString(strings.TrimRight(strings.TrimSpace(field.String()), "/"))
+	}
+}
+
+// registryFields returns the settable registry field of r for each repo-config key
+func (r *RegistryList) registryFields() map[string]reflect.Value {
+	fields := map[string]reflect.Value{}
+	v := reflect.ValueOf(r).Elem()
+	for n := 0; n < v.NumField(); n++ {
+		if key := v.Type().Field(n).Tag.Get("yaml"); key != "" && key != "-" {
+			fields[key] = v.Field(n)
+		}
+	}
+	return fields
 }
 
 // GetE2EImage returns the fully qualified URI to an image (including version)
 func (i *Config) GetE2EImage() string {
 	return fmt.Sprintf("%s/%s:%s", i.registry, i.name, i.version)
 }
+
+// Name returns the image's name within its registry, e.g. nginx
+func (i *Config) Name() string {
+	return i.name
+}
+
+// Registry returns the registry the image is in, e.g. docker.io/library
+func (i *Config) Registry() string {
+	return i.registry
+}
+
+// Version returns the image's tag
+func (i *Config) Version() string {
+	return i.version
+}
+
+// Override returns how the repo-config says to pull and push the image, if at all
+func (i *Config) Override() ImageOverride {
+	return i.override
+}
+
+// pinnedImage returns the image reference by the digest of its override
+func (i *Config) pinnedImage() string {
+	return fmt.Sprintf("%s/%s@%s", i.registry, i.name, i.override.Digest)
+}
+
+// host returns the registry host the image is on
+func (i *Config) host() string {
+	ref, err := registry.ParseReference(i.GetE2EImage())
+	if err != nil {
+		return i.registry
+	}
+	return ref.Host
+}
+
+// withVersion returns a copy of the image config with its version (tag) replaced
+func (i *Config) withVersion(version string) Config {
+	c := *i
+	c.version = version
+	return c
+}
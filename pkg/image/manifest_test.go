@@ -0,0 +1,309 @@
+/*
+Copyright the Sonobuoy contributors 2019
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package image
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestRequiredRegistryKeys(t *testing.T) {
+	got, err := RequiredRegistryKeys("v1.14.0")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := []string{"dockerLibraryRegistry", "e2eRegistry", "etcdRegistry", "gcRegistry", "sampleRegistry"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected keys %v but got %v", want, got)
+	}
+
+	if _, err := RequiredRegistryKeys("v1.2.0"); err == nil {
+		t.Error("Expected error for unsupported version but got nil")
+	}
+}
+
+func TestMissingRegistryKeys(t *testing.T) {
+	tests := map[string]struct {
+		repoConfig string
+		want       []string
+	}{
+		"all keys set": {
+			repoConfig: `dockerLibraryRegistry: private.io/library
+e2eRegistry: private.io/e2e
+etcdRegistry: private.io/coreos
+gcRegistry: private.io/gcr
+sampleRegistry: private.io/samples
+`,
+			want: []string{},
+		},
+		"keys missing": {
+			repoConfig: `dockerLibraryRegistry: private.io/library
+e2eRegistry: private.io/e2e
+privateRegistry: private.io/authenticated
+`,
+			want: []string{"etcdRegistry", "gcRegistry", "sampleRegistry"},
+		},
+	}
+
+	dir, err := ioutil.TempDir("", "sonobuoy-repo-config")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(dir, "repo-config.yaml")
+			if err := ioutil.WriteFile(path, []byte(tc.repoConfig), 0644); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			got, err := MissingRegistryKeys(path, "v1.14.0")
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("Expected missing keys %v but got %v", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestNearestSupportedVersion(t *testing.T) {
+	tests := map[string]struct {
+		version string
+		want    string
+		wantErr bool
+	}{
+		"supported":             {version: "v1.14.2", want: "v1.14.2"},
+		"newer minor":           {version: "v1.16.0", want: "v1.14.0"},
+		"older minor":           {version: "v1.11.3", want: "v1.13.0"},
+		"pre-release of newer":  {version: "v1.15.0-alpha.1", want: "v1.14.0"},
+		"newer major":           {version: "v2.0.0", want: "v1.14.0"},
+		"invalid":               {version: "1.14", wantErr: true},
+		"pre-release supported": {version: "v1.14.0-rc.1", want: "v1.14.0-rc.1"},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := NearestSupportedVersion(tc.version)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("Expected error %v but got %v", tc.wantErr, err)
+			}
+			if got != tc.want {
+				t.Errorf("Expected %v but got %v", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestRegistryOnlyRemap(t *testing.T) {
+	tests := map[string]struct {
+		repoConfig string
+		want       map[string]string
+	}{
+		"host only": {
+			repoConfig: "e2eRegistry: mirror.io/kubernetes-e2e-test-images\ngcRegistry: mirror.io\n",
+			want: map[string]string{
+				"Dnsutils": "mirror.io/kubernetes-e2e-test-images/dnsutils:1.1",
+				"Pause":    "mirror.io/pause:3.1",
+				"Nginx":    "docker.io/library/nginx:1.14-alpine",
+			},
+		},
+		"trailing slashes": {
+			repoConfig: "e2eRegistry: mirror.io/kubernetes-e2e-test-images/\ngcRegistry: \"mirror.io/ \"\n",
+			want: map[string]string{
+				"Dnsutils": "mirror.io/kubernetes-e2e-test-images/dnsutils:1.1",
+				"Pause":    "mirror.io/pause:3.1",
+			},
+		},
+	}
+
+	dir, err := ioutil.TempDir("", "sonobuoy-repo-config")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(dir, "repo-config.yaml")
+			if err := ioutil.WriteFile(path, []byte(tc.repoConfig), 0644); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			images, err := GetImages(path, "v1.14.0")
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			for key, want := range tc.want {
+				img, ok := images[key]
+				if !ok {
+					t.Fatalf("Expected image %v but it wasn't found", key)
+				}
+				if got := img.GetE2EImage(); got != want {
+					t.Errorf("Expected %v image %v but got %v", key, want, got)
+				}
+			}
+		})
+	}
+}
+
+func TestTargetOS(t *testing.T) {
+	defer func(targetOS string) { TargetOS = targetOS }(TargetOS)
+
+	dir, err := ioutil.TempDir("", "sonobuoy-repo-config")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	repoConfig := filepath.Join(dir, "repo-config.yaml")
+	if err := ioutil.WriteFile(repoConfig, []byte("gcRegistry: mirror.io/e2eteam\n"), 0644); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	tests := map[string]struct {
+		targetOS   string
+		repoConfig string
+		version    string
+		want       map[string]string
+		wantErr    bool
+	}{
+		"linux": {
+			targetOS: OSLinux,
+			version:  "v1.14.0",
+			want: map[string]string{
+				"Nginx": "docker.io/library/nginx:1.14-alpine",
+				"Pause": "k8s.gcr.io/pause:3.1",
+			},
+		},
+		"windows": {
+			targetOS: OSWindows,
+			version:  "v1.14.0",
+			want: map[string]string{
+				"Dnsutils": "docker.io/e2eteam/dnsutils:1.1",
+				"Nginx":    "docker.io/e2eteam/nginx:1.14-alpine",
+				"Pause":    "docker.io/e2eteam/pause:3.1",
+			},
+		},
+		"windows with repo-config": {
+			targetOS:   OSWindows,
+			repoConfig: repoConfig,
+			version:    "v1.13.0",
+			want: map[string]string{
+				"Nginx": "docker.io/e2eteam/nginx:1.14-alpine",
+				"Pause": "mirror.io/e2eteam/pause:3.1",
+			},
+		},
+		"windows unsupported version": {
+			targetOS: OSWindows,
+			version:  "v1.12.0",
+			wantErr:  true,
+		},
+		"unsupported OS": {
+			targetOS: "darwin",
+			version:  "v1.14.0",
+			wantErr:  true,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			TargetOS = tc.targetOS
+			images, err := GetImages(tc.repoConfig, tc.version)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("expected error %v, got %v", tc.wantErr, err)
+			}
+			for key, want := range tc.want {
+				img := images[key]
+				if got := img.GetE2EImage(); got != want {
+					t.Errorf("Expected %v image %v but got %v", key, want, got)
+				}
+			}
+		})
+	}
+}
+
+func TestImageOverrides(t *testing.T) {
+	tests := map[string]struct {
+		repoConfig string
+		want       map[string]ImageOverride
+		wantErr    bool
+	}{
+		"overrides": {
+			repoConfig: `e2eRegistry: mirror.io/e2e
+images:
+  Nginx:
+    platform: linux/arm64
+    digest: sha256:abc
+  Dnsutils:
+    authRef: MIRROR_AUTH
+`,
+			want: map[string]ImageOverride{
+				"Nginx":    {Platform: "linux/arm64", Digest: "sha256:abc"},
+				"Dnsutils": {AuthRef: "MIRROR_AUTH"},
+				"Pause":    {},
+			},
+		},
+		"unknown image": {
+			repoConfig: "images:\n  Ngnix:\n    platform: linux/arm64\n",
+			wantErr:    true,
+		},
+		"invalid platform": {
+			repoConfig: "images:\n  Nginx:\n    platform: arm64\n",
+			wantErr:    true,
+		},
+		"invalid digest": {
+			repoConfig: "images:\n  Nginx:\n    digest: abc\n",
+			wantErr:    true,
+		},
+		"different credentials for one host": {
+			repoConfig: "images:\n  Dnsutils:\n    authRef: A\n  Netexec:\n    authRef: B\n",
+			wantErr:    true,
+		},
+	}
+
+	dir, err := ioutil.TempDir("", "sonobuoy-repo-config")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(dir, "repo-config.yaml")
+			if err := ioutil.WriteFile(path, []byte(tc.repoConfig), 0644); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			images, err := GetImages(path, "v1.14.0")
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("expected error %v, got %v", tc.wantErr, err)
+			}
+			for key, want := range tc.want {
+				img := images[key]
+				if got := img.Override(); got != want {
+					t.Errorf("Expected %v override %+v but got %+v", key, want, got)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,51 @@
+/*
+Copyright the Sonobuoy contributors 2019
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package image
+
+import (
+	"github.com/heptio/sonobuoy/pkg/image/registry"
+	"github.com/pkg/errors"
+)
+
+// ManifestStatus is whether an image's manifest exists in its registry
+type ManifestStatus struct {
+	Image string
+	// Digest is the digest of the manifest, if it exists
+	Digest string
+	Found  bool
+}
+
+// CheckManifests looks up the manifest of each image in its registry, without
+// pulling any layers, so that a registry can be checked to have every image.
+// Images that couldn't be checked are reported as errors rather than statuses.
+func CheckManifests(images map[string]Config, digester Digester) ([]ManifestStatus, []error) {
+	errs := []error{}
+	statuses := []ManifestStatus{}
+
+	for _, img := range UniqueImages(images) {
+		digest, err := digester.Digest(img)
+		switch {
+		case errors.Cause(err) == registry.ErrNotFound:
+			statuses = append(statuses, ManifestStatus{Image: img})
+		case err != nil:
+			errs = append(errs, err)
+		default:
+			statuses = append(statuses, ManifestStatus{Image: img, Digest: digest, Found: true})
+		}
+	}
+	return statuses, errs
+}
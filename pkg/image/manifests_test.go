@@ -0,0 +1,48 @@
+/*
+Copyright the Sonobuoy contributors 2019
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package image
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCheckManifests(t *testing.T) {
+	images := map[string]Config{
+		"a":      {registry: "private.io/e2e", name: "a", version: "1.0"},
+		"b":      {registry: "private.io/e2e", name: "b", version: "1.0"},
+		"c":      {registry: "private.io/e2e", name: "c", version: "1.0"},
+		"also-a": {registry: "private.io/e2e", name: "a", version: "1.0"},
+	}
+	digester := fakeDigester{
+		"private.io/e2e/a:1.0": "sha256:aaa",
+		"private.io/e2e/c:1.0": "error",
+	}
+
+	got, errs := CheckManifests(images, digester)
+	if len(errs) != 1 {
+		t.Fatalf("Expected 1 error but got %v", errs)
+	}
+
+	want := []ManifestStatus{
+		{Image: "private.io/e2e/a:1.0", Digest: "sha256:aaa", Found: true},
+		{Image: "private.io/e2e/b:1.0"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("Expected %v but got %v", want, got)
+	}
+}
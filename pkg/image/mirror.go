@@ -0,0 +1,80 @@
+/*
+Copyright the Sonobuoy contributors 2019
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package image
+
+import (
+	"strings"
+
+	"github.com/heptio/sonobuoy/pkg/image/docker"
+	"github.com/heptio/sonobuoy/pkg/image/registry"
+	"github.com/pkg/errors"
+)
+
+// WithPullMirrors returns a copy of the client which pulls images on each registry
+// host in mirrors from its mirror host instead, as parsed by ParseRegistryRewrites.
+// Mirrored images are tagged with their upstream names once pulled, so they're
+// found by later pushes and downloads regardless of the docker daemon's mirror config.
+func (i ImageClient) WithPullMirrors(mirrors map[string]string) ImageClient {
+	i.pullMirrors = mirrors
+	return i
+}
+
+// mirrorOf returns the reference to pull img from, which is img itself unless its
+// registry host is mirrored.
+func (i ImageClient) mirrorOf(img string) string {
+	if len(i.pullMirrors) == 0 {
+		return img
+	}
+	ref, err := registry.ParseReference(img)
+	if err != nil {
+		return img
+	}
+	mirror, ok := i.pullMirrors[ref.Host]
+	if !ok {
+		return img
+	}
+	return mirror + strings.TrimPrefix(ref.String(), ref.Host)
+}
+
+// pullIfNotPresent pulls img, from its mirror if it has one, unless it is
+// already present. It returns whether the image was pulled.
+func (i ImageClient) pullIfNotPresent(img string, opts docker.PullOptions, retries int) (bool, error) {
+	source := i.mirrorOf(img)
+	if source == img {
+		if err := i.loginForPull(img); err != nil {
+			return false, err
+		}
+		var pulled bool
+		err := i.retryOnAuth(img, func() error {
+			var err error
+			pulled, err = i.dockerClient.PullIfNotPresent(img, opts, retries)
+			return err
+		})
+		return pulled, err
+	}
+
+	if _, err := i.dockerClient.Inspect(img); err == nil {
+		return false, nil
+	}
+	if err := i.pullImage(source, opts, retries); err != nil {
+		return false, errors.Wrapf(err, "couldn't pull from mirror %v", source)
+	}
+	if err := i.dockerClient.Tag(source, img, retries); err != nil {
+		return true, errors.Wrapf(err, "couldn't tag mirrored image %v", source)
+	}
+	return true, nil
+}
@@ -0,0 +1,73 @@
+/*
+Copyright the Sonobuoy contributors 2019
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package image
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/heptio/sonobuoy/pkg/image/docker"
+)
+
+func TestPullImagesFromMirrors(t *testing.T) {
+	images := map[string]Config{
+		"Pause": {name: "pause", registry: "k8s.gcr.io", version: "3.1"},
+		"Nginx": {name: "nginx", registry: "docker.io/library", version: "1.14-alpine"},
+	}
+	mirrors := map[string]string{"k8s.gcr.io": "mirror.corp:5000"}
+
+	tests := map[string]struct {
+		missing    map[string]bool
+		wantPulls  []string
+		wantTagged []string
+		wantPulled int
+	}{
+		"mirrored image not present": {
+			missing:    map[string]bool{"k8s.gcr.io/pause:3.1": true},
+			wantPulls:  []string{"docker.io/library/nginx:1.14-alpine", "mirror.corp:5000/pause:3.1"},
+			wantTagged: []string{"k8s.gcr.io/pause:3.1"},
+			wantPulled: 2,
+		},
+		"mirrored image already present": {
+			wantPulls:  []string{"docker.io/library/nginx:1.14-alpine"},
+			wantPulled: 1,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			var pulls, tagged []string
+			imgClient := ImageClient{
+				dockerClient: FakeDockerClient{missing: tc.missing, pulls: &pulls, tagged: &tagged},
+			}.WithPullMirrors(mirrors)
+
+			pulled, errs := imgClient.PullImages(images, docker.PullOptions{}, 0)
+			if len(errs) != 0 {
+				t.Fatalf("Unexpected errors: %v", errs)
+			}
+			if len(pulled) != tc.wantPulled {
+				t.Errorf("Expected %d images pulled but got %d", tc.wantPulled, len(pulled))
+			}
+			if !reflect.DeepEqual(pulls, tc.wantPulls) {
+				t.Errorf("Expected pulls %v but got %v", tc.wantPulls, pulls)
+			}
+			if !reflect.DeepEqual(tagged, tc.wantTagged) {
+				t.Errorf("Expected tags %v but got %v", tc.wantTagged, tagged)
+			}
+		})
+	}
+}
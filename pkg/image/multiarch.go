@@ -0,0 +1,307 @@
+/*
+Copyright the Sonobuoy contributors 2019
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package image
+
+import (
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+
+	"github.com/heptio/sonobuoy/pkg/image/docker"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// ManifestLists maps each multi-arch image to the local image pulled for each of
+// its platforms, so that the manifest list can be rebuilt after a push.
+type ManifestLists map[string]map[string]string
+
+// ManifestListsFileName returns the name of the manifest lists written alongside
+// a multi-platform download.
+func ManifestListsFileName(version string) string {
+	return fmt.Sprintf("kubernetes_e2e_images_%s_manifests.yaml", version)
+}
+
+// ReadManifestLists reads manifest lists written by Write
+func ReadManifestLists(path string) (ManifestLists, error) {
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "couldn't read manifest lists")
+	}
+	lists := ManifestLists{}
+	if err := yaml.Unmarshal(contents, &lists); err != nil {
+		return nil, errors.Wrap(err, "couldn't decode manifest lists")
+	}
+	return lists, nil
+}
+
+// Write writes the manifest lists to path
+func (m ManifestLists) Write(path string) error {
+	b, err := yaml.Marshal(m)
+	if err != nil {
+		return errors.Wrap(err, "couldn't encode manifest lists")
+	}
+	return errors.Wrap(ioutil.WriteFile(path, b, 0644), "couldn't write manifest lists")
+}
+
+// Images returns every platform image in the manifest lists, sorted
+func (m ManifestLists) Images() []string {
+	images := []string{}
+	for _, platforms := range m {
+		for _, img := range platforms {
+			images = append(images, img)
+		}
+	}
+	sort.Strings(images)
+	return images
+}
+
+// validatePlatform returns an error unless platform is of the form os/arch[/variant]
+func validatePlatform(platform string) error {
+	if parts := strings.Split(platform, "/"); len(parts) < 2 || len(parts) > 3 {
+		return errors.Errorf("invalid platform %q, expected os/arch[/variant]", platform)
+	}
+	return nil
+}
+
+// platformVersion returns the tag of an image's variant for a platform, e.g. 1.0-linux-arm64
+func platformVersion(version, platform string) string {
+	return version + "-" + strings.Replace(platform, "/", "-", -1)
+}
+
+// PullPlatforms pulls each image once for every platform, given as os/arch[/variant],
+// and tags each variant with the platform appended to its tag, since the local docker
+// client only keeps one platform per tag. The pulled variants are returned as manifest lists.
+func (i ImageClient) PullPlatforms(images map[string]Config, platforms []string, retries int) (ManifestLists, []error) {
+	for _, platform := range platforms {
+		if err := validatePlatform(platform); err != nil {
+			return nil, []error{err}
+		}
+	}
+
+	errs := []error{}
+	lists := ManifestLists{}
+	keys := uniqueKeys(images)
+	total := len(keys) * len(platforms)
+	n := 0
+	for _, k := range keys {
+		img := images[k]
+		ref := img.GetE2EImage()
+		for _, platform := range platforms {
+			if i.aborted(errs) {
+				return lists, errs
+			}
+			n++
+			dest := img.withVersion(platformVersion(img.version, platform))
+			progress := ImageProgress{Name: dest.GetE2EImage(), Operation: OperationPull, Status: ProgressStarted, Current: n, Total: total}
+			i.report(progress)
+
+			err := i.pullPlatform(ref, dest.GetE2EImage(), platform, retries)
+			i.reportResult(progress, err)
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+
+			if lists[ref] == nil {
+				lists[ref] = map[string]string{}
+			}
+			lists[ref][platform] = dest.GetE2EImage()
+		}
+	}
+	return lists, errs
+}
+
+// pullPlatform pulls the variant of img for platform and tags it as dest
+func (i ImageClient) pullPlatform(img, dest, platform string, retries int) error {
+	if err := i.pullImage(img, docker.PullOptions{Platform: platform}, retries); err != nil {
+		return errors.Wrapf(err, "couldn't pull image %v for platform %v", img, platform)
+	}
+	info, err := i.dockerClient.Inspect(img)
+	if err != nil {
+		return err
+	}
+	if err := checkPlatform(img, info, platform); err != nil {
+		return err
+	}
+	return errors.Wrapf(i.dockerClient.Tag(img, dest, retries), "couldn't tag image: %v", img)
+}
+
+// PushManifestLists pushes the platform variants of each upstream image recorded in
+// lists to its private counterpart, then creates and pushes a manifest list of them
+// under the private image's own tag. The results of the variants pushed are returned.
+func (i ImageClient) PushManifestLists(lists ManifestLists, upstreamImages, privateImages map[string]Config, retries int) ([]docker.PushResult, []error) {
+	errs := []error{}
+	done := []docker.PushResult{}
+
+	keys := manifestListKeys(upstreamImages, privateImages)
+	dests := make([]string, 0, len(keys))
+	for _, k := range keys {
+		dest := privateImages[k]
+		dests = append(dests, dest.GetE2EImage())
+	}
+	repoErrs := i.createRepositories(dests)
+
+	for n, k := range keys {
+		if i.aborted(errs) {
+			break
+		}
+		src, dest := upstreamImages[k], privateImages[k]
+		progress := ImageProgress{Name: dest.GetE2EImage(), Operation: OperationPush, Status: ProgressStarted, Current: n + 1, Total: len(keys)}
+		i.report(progress)
+
+		if err := repoErrs[dest.GetE2EImage()]; err != nil {
+			errs = append(errs, err)
+			i.reportResult(progress, err)
+			continue
+		}
+
+		results, err := i.pushManifestList(lists[src.GetE2EImage()], dest, retries)
+		done = append(done, results...)
+		if err != nil {
+			err = errors.Wrapf(err, "couldn't push image: %v", dest.GetE2EImage())
+			errs = append(errs, err)
+		}
+		i.reportResult(progress, err)
+	}
+	return done, errs
+}
+
+// PushManifestListsOnly creates and pushes a manifest list for each private image
+// from its platform variants, which must already have been pushed under the
+// image's tag with the platform appended, e.g. private.io/a:1.0-linux-arm64, as
+// PushManifestLists does. No image is pushed, so per-arch images pushed
+// separately can be published under a single tag.
+func (i ImageClient) PushManifestListsOnly(upstreamImages, privateImages map[string]Config, platforms []string, retries int) []error {
+	if len(platforms) == 0 {
+		return []error{errors.New("no platforms given for the manifest lists")}
+	}
+	for _, platform := range platforms {
+		if err := validatePlatform(platform); err != nil {
+			return []error{err}
+		}
+	}
+	platforms = append([]string{}, platforms...)
+	sort.Strings(platforms)
+
+	errs := []error{}
+	keys := manifestListKeys(upstreamImages, privateImages)
+	for n, k := range keys {
+		if i.aborted(errs) {
+			break
+		}
+		dest := privateImages[k]
+		progress := ImageProgress{Name: dest.GetE2EImage(), Operation: OperationPush, Status: ProgressStarted, Current: n + 1, Total: len(keys)}
+		i.report(progress)
+
+		variants := make([]string, 0, len(platforms))
+		for _, platform := range platforms {
+			variant := dest.withVersion(platformVersion(dest.version, platform))
+			variants = append(variants, variant.GetE2EImage())
+		}
+
+		err := i.pushManifest(dest.GetE2EImage(), variants, retries)
+		if err != nil {
+			err = errors.Wrapf(err, "couldn't publish %v", dest.GetE2EImage())
+			errs = append(errs, err)
+		}
+		i.reportResult(progress, err)
+	}
+	return errs
+}
+
+// manifestListKeys returns the sorted keys of the images to push manifest lists
+// for, skipping duplicates and public images pushed to themselves.
+func manifestListKeys(upstreamImages, privateImages map[string]Config) []string {
+	keys := []string{}
+	planned := map[string]bool{}
+	for _, k := range sortedKeys(upstreamImages) {
+		src, dest := upstreamImages[k], privateImages[k]
+		pair := src.GetE2EImage() + " " + dest.GetE2EImage()
+		if planned[pair] {
+			continue
+		}
+		planned[pair] = true
+
+		if src.GetE2EImage() == dest.GetE2EImage() {
+			logrus.Infof("Skipping public image: %s", src.GetE2EImage())
+			continue
+		}
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+// pushManifest creates a manifest list of variants as list and pushes it
+func (i ImageClient) pushManifest(list string, variants []string, retries int) error {
+	if err := i.dockerClient.ManifestCreate(list, variants); err != nil {
+		return errors.Wrap(err, "couldn't create manifest list")
+	}
+	return errors.Wrap(i.dockerClient.ManifestPush(list, retries), "couldn't push manifest list")
+}
+
+// pushManifestList tags and pushes each platform variant as dest, then pushes a
+// manifest list of them as dest.
+func (i ImageClient) pushManifestList(platforms map[string]string, dest Config, retries int) ([]docker.PushResult, error) {
+	if len(platforms) == 0 {
+		return nil, errors.New("no platform images recorded in the manifest lists")
+	}
+
+	results := []docker.PushResult{}
+	variants := []string{}
+	for _, platform := range sortedPlatforms(platforms) {
+		variant := dest.withVersion(platformVersion(dest.version, platform))
+		if err := i.dockerClient.Tag(platforms[platform], variant.GetE2EImage(), retries); err != nil {
+			return results, errors.Wrapf(err, "couldn't tag image: %v", platforms[platform])
+		}
+		result, err := i.push(variant.GetE2EImage(), retries)
+		if err != nil {
+			return results, err
+		}
+		results = append(results, result)
+		variants = append(variants, variant.GetE2EImage())
+	}
+
+	return results, i.pushManifest(dest.GetE2EImage(), variants, retries)
+}
+
+// uniqueKeys returns the sorted keys of images, keeping only the first key of
+// each distinct image reference.
+func uniqueKeys(images map[string]Config) []string {
+	keys := []string{}
+	seen := map[string]bool{}
+	for _, k := range sortedKeys(images) {
+		img := images[k]
+		if seen[img.GetE2EImage()] {
+			continue
+		}
+		seen[img.GetE2EImage()] = true
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+func sortedPlatforms(platforms map[string]string) []string {
+	keys := make([]string, 0, len(platforms))
+	for platform := range platforms {
+		keys = append(keys, platform)
+	}
+	sort.Strings(keys)
+	return keys
+}
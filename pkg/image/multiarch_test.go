@@ -0,0 +1,180 @@
+/*
+Copyright the Sonobuoy contributors 2019
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package image
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestPullPlatforms(t *testing.T) {
+	images := map[string]Config{
+		"A": {name: "a", registry: "foo.io/sonobuoy", version: "1.0"},
+		"B": {name: "a", registry: "foo.io/sonobuoy", version: "1.0"},
+	}
+
+	tests := map[string]struct {
+		client         FakeDockerClient
+		platforms      []string
+		want           ManifestLists
+		wantErrorCount int
+	}{
+		"each platform is pulled and tagged": {
+			client:    FakeDockerClient{pulledPlatform: new(string)},
+			platforms: []string{"linux/amd64", "linux/arm64"},
+			want: ManifestLists{
+				"foo.io/sonobuoy/a:1.0": {
+					"linux/amd64": "foo.io/sonobuoy/a:1.0-linux-amd64",
+					"linux/arm64": "foo.io/sonobuoy/a:1.0-linux-arm64",
+				},
+			},
+		},
+		"registry serves the wrong platform": {
+			client:         FakeDockerClient{},
+			platforms:      []string{"linux/amd64", "linux/arm64"},
+			want:           ManifestLists{"foo.io/sonobuoy/a:1.0": {"linux/amd64": "foo.io/sonobuoy/a:1.0-linux-amd64"}},
+			wantErrorCount: 1,
+		},
+		"invalid platform": {
+			client:         FakeDockerClient{},
+			platforms:      []string{"arm64"},
+			wantErrorCount: 1,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			imgClient := ImageClient{dockerClient: tc.client}
+
+			got, errs := imgClient.PullPlatforms(images, tc.platforms, 0)
+			if len(errs) != tc.wantErrorCount {
+				t.Fatalf("Expected errors: %d but got %v", tc.wantErrorCount, errs)
+			}
+			if tc.want != nil && !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("Expected manifest lists %v but got %v", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestPushManifestLists(t *testing.T) {
+	upstream := map[string]Config{
+		"A": {name: "a", registry: "foo.io/sonobuoy", version: "1.0"},
+		"P": {name: "p", registry: "public.io/sonobuoy", version: "1.0"},
+	}
+	private := map[string]Config{
+		"A": {name: "a", registry: "private.io/sonobuoy", version: "1.0"},
+		"P": {name: "p", registry: "public.io/sonobuoy", version: "1.0"},
+	}
+	lists := ManifestLists{
+		"foo.io/sonobuoy/a:1.0": {
+			"linux/arm64": "foo.io/sonobuoy/a:1.0-linux-arm64",
+			"linux/amd64": "foo.io/sonobuoy/a:1.0-linux-amd64",
+		},
+	}
+
+	tagged := []string{}
+	manifests := map[string][]string{}
+	imgClient := ImageClient{dockerClient: FakeDockerClient{tagged: &tagged, manifests: &manifests}}
+
+	pushed, errs := imgClient.PushManifestLists(lists, upstream, private, 0)
+	if len(errs) != 0 {
+		t.Fatalf("Expected no errors but got %v", errs)
+	}
+
+	variants := []string{"private.io/sonobuoy/a:1.0-linux-amd64", "private.io/sonobuoy/a:1.0-linux-arm64"}
+	if !reflect.DeepEqual(tagged, variants) {
+		t.Errorf("Expected variants tagged %v but got %v", variants, tagged)
+	}
+	if len(pushed) != len(variants) {
+		t.Errorf("Expected %d variants pushed but got %v", len(variants), pushed)
+	}
+	want := map[string][]string{"private.io/sonobuoy/a:1.0": variants}
+	if !reflect.DeepEqual(manifests, want) {
+		t.Errorf("Expected manifest lists %v but got %v", want, manifests)
+	}
+
+	// Images without recorded platforms fail
+	if _, errs := imgClient.PushManifestLists(ManifestLists{}, upstream, private, 0); len(errs) != 1 {
+		t.Errorf("Expected 1 error for a missing manifest list but got %v", errs)
+	}
+}
+
+func TestPushManifestListsOnly(t *testing.T) {
+	upstream := map[string]Config{
+		"A": {name: "a", registry: "foo.io/sonobuoy", version: "1.0"},
+		"P": {name: "p", registry: "public.io/sonobuoy", version: "1.0"},
+	}
+	private := map[string]Config{
+		"A": {name: "a", registry: "private.io/sonobuoy", version: "1.0"},
+		"P": {name: "p", registry: "public.io/sonobuoy", version: "1.0"},
+	}
+
+	// Tagging any image fails, since the variants are only referenced
+	manifests := map[string][]string{}
+	imgClient := ImageClient{dockerClient: FakeDockerClient{tagFails: true, manifests: &manifests}}
+
+	if errs := imgClient.PushManifestListsOnly(upstream, private, []string{"linux/arm64", "linux/amd64"}, 0); len(errs) != 0 {
+		t.Fatalf("Expected no errors but got %v", errs)
+	}
+
+	want := map[string][]string{"private.io/sonobuoy/a:1.0": {"private.io/sonobuoy/a:1.0-linux-amd64", "private.io/sonobuoy/a:1.0-linux-arm64"}}
+	if !reflect.DeepEqual(manifests, want) {
+		t.Errorf("Expected manifest lists %v but got %v", want, manifests)
+	}
+
+	for _, platforms := range [][]string{{}, {"arm64"}} {
+		if errs := imgClient.PushManifestListsOnly(upstream, private, platforms, 0); len(errs) != 1 {
+			t.Errorf("Expected 1 error for platforms %v but got %v", platforms, errs)
+		}
+	}
+}
+
+func TestManifestListsRoundTrip(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sonobuoy-manifests")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	lists := ManifestLists{
+		"foo.io/sonobuoy/a:1.0": {
+			"linux/amd64": "foo.io/sonobuoy/a:1.0-linux-amd64",
+			"linux/arm64": "foo.io/sonobuoy/a:1.0-linux-arm64",
+		},
+	}
+	path := filepath.Join(dir, ManifestListsFileName("v1.14.0"))
+	if err := lists.Write(path); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	got, err := ReadManifestLists(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(got, lists) {
+		t.Errorf("Expected %v but got %v", lists, got)
+	}
+
+	wantImages := []string{"foo.io/sonobuoy/a:1.0-linux-amd64", "foo.io/sonobuoy/a:1.0-linux-arm64"}
+	if !reflect.DeepEqual(got.Images(), wantImages) {
+		t.Errorf("Expected images %v but got %v", wantImages, got.Images())
+	}
+}
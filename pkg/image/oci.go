@@ -0,0 +1,322 @@
+/*
+Copyright the Sonobuoy contributors 2019
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package image
+
+import (
+	"archive/tar"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// DestinationFormat is the format images are downloaded in
+type DestinationFormat string
+
+const (
+	// DestinationDockerArchive is a tar as written by docker save
+	DestinationDockerArchive DestinationFormat = "docker-archive"
+	// DestinationOCI is an OCI image layout directory
+	DestinationOCI DestinationFormat = "oci"
+)
+
+const (
+	ociLayoutVersion     = "1.0.0"
+	ociIndexMediaType    = "application/vnd.oci.image.index.v1+json"
+	ociManifestMediaType = "application/vnd.oci.image.manifest.v1+json"
+	ociConfigMediaType   = "application/vnd.oci.image.config.v1+json"
+	ociLayerMediaType    = "application/vnd.oci.image.layer.v1.tar"
+
+	ociRefNameAnnotation   = "org.opencontainers.image.ref.name"
+	ociImageNameAnnotation = "io.containerd.image.name"
+)
+
+// Destination is where, and in which format, images are downloaded
+type Destination struct {
+	Format DestinationFormat
+	Path   string
+}
+
+// ParseDestination parses a download destination of the form oci:///path/to/layout
+// or docker-archive:///path/to/file.tar. A path without a scheme is a docker archive.
+func ParseDestination(dest string) (Destination, error) {
+	format, p := DestinationDockerArchive, dest
+	if n := strings.Index(dest, "://"); n >= 0 {
+		format, p = DestinationFormat(dest[:n]), dest[n+len("://"):]
+	}
+
+	switch format {
+	case DestinationDockerArchive, DestinationOCI:
+	default:
+		return Destination{}, errors.Errorf("unsupported destination scheme %q in %v, expected oci:// or docker-archive://", format, dest)
+	}
+	if p == "" {
+		return Destination{}, errors.Errorf("destination %v has no path", dest)
+	}
+	return Destination{Format: format, Path: p}, nil
+}
+
+// DownloadImagesTo saves the images to dest in its format, returning the file or
+// directory written.
+func (i ImageClient) DownloadImagesTo(images []string, dest Destination) (string, error) {
+	if dest.Format == DestinationOCI {
+		return i.DownloadImagesToOCI(images, dest.Path)
+	}
+	return i.DownloadImagesToFile(images, dest.Path)
+}
+
+// DownloadImagesToOCI saves the images to an OCI image layout in dir, which is
+// created if needed. Each image is listed in the layout's index under its full
+// reference, e.g. oci:dir:k8s.gcr.io/pause:3.1 for skopeo, so that tools such as
+// skopeo and containerd can import it without a docker daemon.
+// The images are saved to a docker archive in dir first, which is removed once
+// converted, so the conversion needs room for a second copy of the images.
+func (i ImageClient) DownloadImagesToOCI(images []string, dir string) (string, error) {
+	if len(i.pipeThrough) > 0 {
+		return "", errors.New("an OCI layout can't be piped through a command")
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", errors.Wrapf(err, "couldn't create OCI layout %v", dir)
+	}
+
+	progress := ImageProgress{Name: dir, Operation: OperationDownload, Status: ProgressStarted, Current: 1, Total: 1}
+	i.report(progress)
+
+	archive := filepath.Join(dir, "docker-archive.tar")
+	err := i.writeTar(images, archive)
+	if err == nil {
+		err = writeOCILayout(archive, dir)
+		os.Remove(archive)
+	}
+	i.reportResult(progress, err)
+	if err != nil {
+		return "", err
+	}
+	return dir, nil
+}
+
+// dockerArchiveManifest is an entry of the manifest.json written by docker save
+type dockerArchiveManifest struct {
+	Config   string
+	RepoTags []string
+	Layers   []string
+}
+
+// ociDescriptor describes a blob of an OCI image layout
+type ociDescriptor struct {
+	MediaType   string            `json:"mediaType"`
+	Digest      string            `json:"digest"`
+	Size        int64             `json:"size"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+type ociManifest struct {
+	SchemaVersion int             `json:"schemaVersion"`
+	MediaType     string          `json:"mediaType"`
+	Config        ociDescriptor   `json:"config"`
+	Layers        []ociDescriptor `json:"layers"`
+}
+
+type ociIndex struct {
+	SchemaVersion int             `json:"schemaVersion"`
+	MediaType     string          `json:"mediaType"`
+	Manifests     []ociDescriptor `json:"manifests"`
+}
+
+// writeOCILayout converts the docker archive at archive into an OCI image layout
+// in dir. Layers shared by several images are only written once.
+func writeOCILayout(archive, dir string) error {
+	f, err := os.Open(archive)
+	if err != nil {
+		return errors.Wrap(err, "couldn't open docker archive")
+	}
+	defer f.Close()
+
+	entries, err := readTarEntries(f)
+	if err != nil {
+		return errors.Wrapf(err, "couldn't read docker archive %v", archive)
+	}
+	byName := map[string]tarEntry{}
+	for _, e := range entries {
+		byName[path.Clean(e.header.Name)] = e
+	}
+
+	l := ociLayoutWriter{dir: dir, src: f, entries: byName, written: map[string]ociDescriptor{}}
+
+	manifests := []dockerArchiveManifest{}
+	if err := l.decode("manifest.json", &manifests); err != nil {
+		return err
+	}
+
+	index := ociIndex{SchemaVersion: 2, MediaType: ociIndexMediaType, Manifests: []ociDescriptor{}}
+	for _, m := range manifests {
+		desc, err := l.writeManifest(m)
+		if err != nil {
+			return err
+		}
+
+		if len(m.RepoTags) == 0 {
+			index.Manifests = append(index.Manifests, desc)
+		}
+		for _, ref := range m.RepoTags {
+			tagged := desc
+			tagged.Annotations = map[string]string{
+				ociRefNameAnnotation:   taggedReference(ref),
+				ociImageNameAnnotation: ref,
+			}
+			index.Manifests = append(index.Manifests, tagged)
+		}
+	}
+
+	if err := writeJSONFile(filepath.Join(dir, "oci-layout"), map[string]string{"imageLayoutVersion": ociLayoutVersion}); err != nil {
+		return err
+	}
+	return writeJSONFile(filepath.Join(dir, "index.json"), index)
+}
+
+// ociLayoutWriter writes the blobs of an OCI image layout from the entries of a
+// docker archive.
+type ociLayoutWriter struct {
+	dir     string
+	src     io.ReaderAt
+	entries map[string]tarEntry
+	// written is the descriptor of each archive entry already written as a blob
+	written map[string]ociDescriptor
+}
+
+// entry returns the archive entry with the given name, following symlinks, which
+// newer versions of docker save use for layers shared by several images.
+func (l ociLayoutWriter) entry(name string) (tarEntry, error) {
+	for hops := 0; hops < 10; hops++ {
+		e, ok := l.entries[path.Clean(name)]
+		if !ok {
+			return tarEntry{}, errors.Errorf("docker archive has no %v", name)
+		}
+		if e.header.Typeflag != tar.TypeSymlink {
+			return e, nil
+		}
+		name = path.Join(path.Dir(name), e.header.Linkname)
+	}
+	return tarEntry{}, errors.Errorf("too many links resolving %v in docker archive", name)
+}
+
+func (l ociLayoutWriter) decode(name string, v interface{}) error {
+	e, err := l.entry(name)
+	if err != nil {
+		return err
+	}
+	if err := json.NewDecoder(io.NewSectionReader(l.src, e.offset, e.header.Size)).Decode(v); err != nil {
+		return errors.Wrapf(err, "couldn't parse %v in docker archive", name)
+	}
+	return nil
+}
+
+// writeManifest writes the config and layers of an image, and its OCI manifest
+func (l ociLayoutWriter) writeManifest(m dockerArchiveManifest) (ociDescriptor, error) {
+	config, err := l.writeEntry(m.Config, ociConfigMediaType)
+	if err != nil {
+		return ociDescriptor{}, err
+	}
+
+	manifest := ociManifest{SchemaVersion: 2, MediaType: ociManifestMediaType, Config: config, Layers: []ociDescriptor{}}
+	for _, layer := range m.Layers {
+		desc, err := l.writeEntry(layer, ociLayerMediaType)
+		if err != nil {
+			return ociDescriptor{}, err
+		}
+		manifest.Layers = append(manifest.Layers, desc)
+	}
+
+	contents, err := json.Marshal(manifest)
+	if err != nil {
+		return ociDescriptor{}, errors.Wrap(err, "couldn't encode OCI manifest")
+	}
+	return l.writeBlob(strings.NewReader(string(contents)), ociManifestMediaType)
+}
+
+// writeEntry writes the contents of an archive entry as a blob
+func (l ociLayoutWriter) writeEntry(name, mediaType string) (ociDescriptor, error) {
+	e, err := l.entry(name)
+	if err != nil {
+		return ociDescriptor{}, err
+	}
+	if desc, ok := l.written[e.header.Name]; ok {
+		return desc, nil
+	}
+
+	desc, err := l.writeBlob(io.NewSectionReader(l.src, e.offset, e.header.Size), mediaType)
+	if err != nil {
+		return ociDescriptor{}, errors.Wrapf(err, "couldn't write %v", name)
+	}
+	l.written[e.header.Name] = desc
+	return desc, nil
+}
+
+// writeBlob writes r to the layout's blobs, named after its digest
+func (l ociLayoutWriter) writeBlob(r io.Reader, mediaType string) (ociDescriptor, error) {
+	blobs := filepath.Join(l.dir, "blobs", "sha256")
+	if err := os.MkdirAll(blobs, 0755); err != nil {
+		return ociDescriptor{}, errors.Wrap(err, "couldn't create blobs directory")
+	}
+
+	tmp, err := ioutil.TempFile(blobs, ".blob")
+	if err != nil {
+		return ociDescriptor{}, errors.Wrap(err, "couldn't create blob")
+	}
+	h := sha256.New()
+	size, err := io.Copy(io.MultiWriter(tmp, h), r)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return ociDescriptor{}, errors.Wrap(err, "couldn't write blob")
+	}
+
+	digest := hex.EncodeToString(h.Sum(nil))
+	if err := os.Rename(tmp.Name(), filepath.Join(blobs, digest)); err != nil {
+		os.Remove(tmp.Name())
+		return ociDescriptor{}, errors.Wrap(err, "couldn't move blob into place")
+	}
+	return ociDescriptor{MediaType: mediaType, Digest: "sha256:" + digest, Size: size}, nil
+}
+
+// writeJSONFile writes v to path as JSON
+func writeJSONFile(path string, v interface{}) error {
+	contents, err := json.Marshal(v)
+	if err != nil {
+		return errors.Wrapf(err, "couldn't encode %v", filepath.Base(path))
+	}
+	return errors.Wrapf(ioutil.WriteFile(path, contents, 0644), "couldn't write %v", path)
+}
+
+// taggedReference returns an image reference with its tag, adding latest if it has
+// none. The full reference, rather than just the tag, names an image in a layout
+// since images from different repositories often share a tag.
+func taggedReference(ref string) string {
+	if n := strings.LastIndex(ref, ":"); n > strings.LastIndex(ref, "/") {
+		return ref
+	}
+	return ref + ":latest"
+}
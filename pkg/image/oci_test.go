@@ -0,0 +1,162 @@
+/*
+Copyright the Sonobuoy contributors 2019
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package image
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseDestination(t *testing.T) {
+	tests := map[string]struct {
+		dest    string
+		want    Destination
+		wantErr bool
+	}{
+		"oci layout": {
+			dest: "oci:///images/layout",
+			want: Destination{Format: DestinationOCI, Path: "/images/layout"},
+		},
+		"docker archive": {
+			dest: "docker-archive:///images/e2e.tar",
+			want: Destination{Format: DestinationDockerArchive, Path: "/images/e2e.tar"},
+		},
+		"no scheme": {
+			dest: "e2e.tar",
+			want: Destination{Format: DestinationDockerArchive, Path: "e2e.tar"},
+		},
+		"unknown scheme": {
+			dest:    "s3://bucket/e2e.tar",
+			wantErr: true,
+		},
+		"no path": {
+			dest:    "oci://",
+			wantErr: true,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := ParseDestination(tc.dest)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("expected error %v, got %v", tc.wantErr, err)
+			}
+			if got != tc.want {
+				t.Errorf("Expected destination %+v but got %+v", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestWriteOCILayout(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sonobuoy-oci")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	archive := filepath.Join(dir, "images.tar")
+	writeOrderedTar(t, archive, []testTarEntry{
+		{"manifest.json", `[
+			{"Config":"a.json","RepoTags":["gcr.io/heptio-images/sonobuoy:v0.14.0"],"Layers":["base/layer.tar","a/layer.tar"]},
+			{"Config":"b.json","RepoTags":["busybox:1.29","busybox"],"Layers":["base/layer.tar"]},
+			{"Config":"c.json","RepoTags":["gcr.io/kubernetes-e2e-test-images/agnhost:v0.14.0"],"Layers":["base/layer.tar"]}
+		]`},
+		{"a.json", `{"architecture":"amd64"}`},
+		{"b.json", `{"architecture":"arm64"}`},
+		{"c.json", `{"architecture":"s390x"}`},
+		{"base/layer.tar", "shared layer"},
+		{"a/layer.tar", "layer a"},
+	}, time.Unix(1500000000, 0))
+
+	layout := filepath.Join(dir, "layout")
+	if err := os.Mkdir(layout, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeOCILayout(archive, layout); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	digest := func(s string) string {
+		sum := sha256.Sum256([]byte(s))
+		return "sha256:" + hex.EncodeToString(sum[:])
+	}
+	readJSON := func(path string, v interface{}) {
+		contents, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := json.Unmarshal(contents, v); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	version := map[string]string{}
+	readJSON(filepath.Join(layout, "oci-layout"), &version)
+	if version["imageLayoutVersion"] != ociLayoutVersion {
+		t.Errorf("Expected layout version %v but got %v", ociLayoutVersion, version)
+	}
+
+	index := ociIndex{}
+	readJSON(filepath.Join(layout, "index.json"), &index)
+	refs := []string{}
+	names := []string{}
+	for _, m := range index.Manifests {
+		refs = append(refs, m.Annotations[ociRefNameAnnotation])
+		names = append(names, m.Annotations[ociImageNameAnnotation])
+	}
+	// Images sharing a tag are told apart by their full reference
+	wantRefs := []string{"gcr.io/heptio-images/sonobuoy:v0.14.0", "busybox:1.29", "busybox:latest", "gcr.io/kubernetes-e2e-test-images/agnhost:v0.14.0"}
+	if !reflect.DeepEqual(refs, wantRefs) {
+		t.Errorf("Expected ref names %v but got %v", wantRefs, refs)
+	}
+	if want := []string{"gcr.io/heptio-images/sonobuoy:v0.14.0", "busybox:1.29", "busybox", "gcr.io/kubernetes-e2e-test-images/agnhost:v0.14.0"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("Expected image names %v but got %v", want, names)
+	}
+	if index.Manifests[1].Digest != index.Manifests[2].Digest {
+		t.Error("Expected tags of the same image to share a manifest")
+	}
+
+	manifest := ociManifest{}
+	readJSON(filepath.Join(layout, "blobs", "sha256", index.Manifests[0].Digest[len("sha256:"):]), &manifest)
+	if manifest.Config.Digest != digest(`{"architecture":"amd64"}`) || manifest.Config.MediaType != ociConfigMediaType {
+		t.Errorf("Unexpected config %+v", manifest.Config)
+	}
+	layers := []string{}
+	for _, l := range manifest.Layers {
+		layers = append(layers, l.Digest)
+	}
+	if want := []string{digest("shared layer"), digest("layer a")}; !reflect.DeepEqual(layers, want) {
+		t.Errorf("Expected layers %v but got %v", want, layers)
+	}
+
+	blobs, err := ioutil.ReadDir(filepath.Join(layout, "blobs", "sha256"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Three configs, two distinct layers and three manifests
+	if len(blobs) != 8 {
+		t.Errorf("Expected 8 blobs but got %d", len(blobs))
+	}
+}
@@ -0,0 +1,85 @@
+/*
+Copyright the Sonobuoy contributors 2019
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package image
+
+import (
+	"sort"
+
+	"github.com/pkg/errors"
+)
+
+// SortOrder is the order images are listed in
+type SortOrder string
+
+const (
+	// SortByName orders images by name, without their registry
+	SortByName SortOrder = "name"
+	// SortByRegistry orders images by the registry they're pulled from
+	SortByRegistry SortOrder = "registry"
+	// SortBySize orders images by their size in the local docker client, largest first
+	SortBySize SortOrder = "size"
+)
+
+// ParseSortOrder returns the SortOrder named by s
+func ParseSortOrder(s string) (SortOrder, error) {
+	switch order := SortOrder(s); order {
+	case SortByName, SortByRegistry, SortBySize:
+		return order, nil
+	default:
+		return "", errors.Errorf("unsupported sort order %q, expected one of: %v, %v, %v", s, SortByName, SortByRegistry, SortBySize)
+	}
+}
+
+// SortConfigs sorts the images by order. Images which are equal in that order are
+// sorted by their full reference, so that the result is the same whatever order
+// the images are given in. For SortBySize, sizes holds the size of each image by
+// reference; images without a size sort as the smallest.
+func SortConfigs(images []Config, order SortOrder, sizes map[string]int64) {
+	sort.SliceStable(images, func(a, b int) bool {
+		x, y := images[a], images[b]
+		switch order {
+		case SortByName:
+			if x.name != y.name {
+				return x.name < y.name
+			}
+		case SortByRegistry:
+			if x.registry != y.registry {
+				return x.registry < y.registry
+			}
+		case SortBySize:
+			if sx, sy := sizes[x.GetE2EImage()], sizes[y.GetE2EImage()]; sx != sy {
+				return sx > sy
+			}
+		}
+		return x.GetE2EImage() < y.GetE2EImage()
+	})
+}
+
+// SortedImages returns the unique image references of images, sorted as SortConfigs does
+func SortedImages(images map[string]Config, order SortOrder, sizes map[string]int64) []string {
+	configs := []Config{}
+	for _, img := range configsByImage(images) {
+		configs = append(configs, img)
+	}
+	SortConfigs(configs, order, sizes)
+
+	refs := make([]string, 0, len(configs))
+	for _, img := range configs {
+		refs = append(refs, img.GetE2EImage())
+	}
+	return refs
+}
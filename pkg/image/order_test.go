@@ -0,0 +1,93 @@
+/*
+Copyright the Sonobuoy contributors 2019
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package image
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSortedImages(t *testing.T) {
+	images := map[string]Config{
+		"Pause":    {registry: "k8s.gcr.io", name: "pause", version: "3.1"},
+		"Etcd":     {registry: "k8s.gcr.io", name: "etcd", version: "3.3.10"},
+		"Nginx":    {registry: "docker.io/library", name: "nginx", version: "1.14-alpine"},
+		"NginxNew": {registry: "docker.io/library", name: "nginx", version: "1.15-alpine"},
+		"Mirror":   {registry: "gcr.io/mirror", name: "etcd", version: "3.3.10"},
+	}
+	sizes := map[string]int64{
+		"k8s.gcr.io/etcd:3.3.10":              200,
+		"gcr.io/mirror/etcd:3.3.10":           200,
+		"docker.io/library/nginx:1.14-alpine": 50,
+	}
+
+	tests := map[string]struct {
+		order SortOrder
+		want  []string
+	}{
+		"by name": {
+			order: SortByName,
+			want: []string{
+				"gcr.io/mirror/etcd:3.3.10",
+				"k8s.gcr.io/etcd:3.3.10",
+				"docker.io/library/nginx:1.14-alpine",
+				"docker.io/library/nginx:1.15-alpine",
+				"k8s.gcr.io/pause:3.1",
+			},
+		},
+		"by registry": {
+			order: SortByRegistry,
+			want: []string{
+				"docker.io/library/nginx:1.14-alpine",
+				"docker.io/library/nginx:1.15-alpine",
+				"gcr.io/mirror/etcd:3.3.10",
+				"k8s.gcr.io/etcd:3.3.10",
+				"k8s.gcr.io/pause:3.1",
+			},
+		},
+		"by size": {
+			order: SortBySize,
+			want: []string{
+				"gcr.io/mirror/etcd:3.3.10",
+				"k8s.gcr.io/etcd:3.3.10",
+				"docker.io/library/nginx:1.14-alpine",
+				"docker.io/library/nginx:1.15-alpine",
+				"k8s.gcr.io/pause:3.1",
+			},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			// Map iteration order varies, so check the result doesn't
+			for n := 0; n < 5; n++ {
+				if got := SortedImages(images, tc.order, sizes); !reflect.DeepEqual(got, tc.want) {
+					t.Fatalf("Expected images %v but got %v", tc.want, got)
+				}
+			}
+		})
+	}
+}
+
+func TestParseSortOrder(t *testing.T) {
+	if order, err := ParseSortOrder("size"); err != nil || order != SortBySize {
+		t.Errorf("Expected %v but got %v, %v", SortBySize, order, err)
+	}
+	if _, err := ParseSortOrder("age"); err == nil {
+		t.Error("Expected error for an unknown sort order but got nil")
+	}
+}
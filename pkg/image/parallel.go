@@ -0,0 +1,156 @@
+/*
+Copyright the Sonobuoy contributors 2019
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package image
+
+import (
+	"sync"
+
+	"github.com/heptio/sonobuoy/pkg/image/docker"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// WithParallel returns a copy of the client which pulls or pushes up to n images at
+// once. If the docker daemon or a registry refuses a transfer because too many are
+// running, the client lowers how many it runs at once and retries the image.
+func (i ImageClient) WithParallel(n int) ImageClient {
+	if n > 1 {
+		i.limiter = newConcurrencyLimiter(n)
+	}
+	return i
+}
+
+// ParallelWithinDaemonLimit returns parallel, lowered if needed so that that many
+// images, each transferring layersPerImage layers at once, fit within the docker
+// daemon's limit on layers transferred at once. At least one image is transferred.
+func ParallelWithinDaemonLimit(parallel, layersPerImage, daemonLimit int) int {
+	if layersPerImage < 1 {
+		return parallel
+	}
+	max := daemonLimit / layersPerImage
+	if max < 1 {
+		max = 1
+	}
+	if parallel > max {
+		return max
+	}
+	return parallel
+}
+
+// concurrencyLimiter bounds how many transfers run at once. The limit can be
+// lowered while transfers are running, and is respected as they finish.
+type concurrencyLimiter struct {
+	mu     sync.Mutex
+	cond   *sync.Cond
+	limit  int
+	active int
+}
+
+func newConcurrencyLimiter(limit int) *concurrencyLimiter {
+	l := &concurrencyLimiter{limit: limit}
+	l.cond = sync.NewCond(&l.mu)
+	return l
+}
+
+// acquire waits until fewer transfers than the limit are running, then starts one
+func (l *concurrencyLimiter) acquire() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for l.active >= l.limit {
+		l.cond.Wait()
+	}
+	l.active++
+}
+
+// release finishes a transfer started by acquire
+func (l *concurrencyLimiter) release() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.active--
+	l.cond.Broadcast()
+}
+
+// backOff lowers the limit by one, unless it is already one
+func (l *concurrencyLimiter) backOff() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.limit > 1 {
+		l.limit--
+		log.Warnf("Too many concurrent transfers; lowering the images transferred at once to %d", l.limit)
+	}
+}
+
+// alone reports whether the caller's transfer is the only one allowed to run
+func (l *concurrencyLimiter) alone() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.limit == 1 && l.active == 1
+}
+
+// forEachImage calls fn with the index of each of n images, running up to the
+// client's parallelism at once and stopping before the next image once aborted
+// reports true. Without WithParallel the images are worked through in order.
+// Each call of fn is recorded by the client's ConcurrencyRecorder, if any.
+func (i ImageClient) forEachImage(n int, aborted func() bool, fn func(k int)) {
+	if i.concurrency != nil {
+		work := fn
+		fn = func(k int) {
+			worker, started := i.concurrency.begin()
+			defer i.concurrency.finish(worker, started)
+			work(k)
+		}
+	}
+	if i.limiter == nil {
+		for k := 0; k < n && !aborted(); k++ {
+			fn(k)
+		}
+		return
+	}
+
+	var wg sync.WaitGroup
+	for k := 0; k < n; k++ {
+		i.limiter.acquire()
+		if aborted() {
+			i.limiter.release()
+			break
+		}
+		wg.Add(1)
+		go func(k int) {
+			defer wg.Done()
+			defer i.limiter.release()
+			fn(k)
+		}(k)
+	}
+	wg.Wait()
+}
+
+// transfer runs op, which pulls or pushes an image from within a forEachImage fn.
+// If it is refused because too many transfers are running and the client runs
+// several at once, the parallelism is lowered and op is retried once the others
+// allow, until it is refused while running alone.
+func (i ImageClient) transfer(op func() error) error {
+	for {
+		alone := i.limiter == nil || i.limiter.alone()
+		err := op()
+		if alone || errors.Cause(err) != docker.ErrTooManyConcurrent {
+			return err
+		}
+		i.limiter.backOff()
+		i.limiter.release()
+		i.limiter.acquire()
+	}
+}
@@ -0,0 +1,152 @@
+/*
+Copyright the Sonobuoy contributors 2019
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package image
+
+import (
+	"fmt"
+	"io/ioutil"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/heptio/sonobuoy/pkg/image/docker"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// concurrentDocker tracks how many pulls run at once, refusing those beyond refuseAbove
+type concurrentDocker struct {
+	FakeDockerClient
+	mu          *sync.Mutex
+	active      *int
+	maxActive   *int
+	refused     *int
+	refuseAbove int
+}
+
+func (c concurrentDocker) PullIfNotPresent(image string, opts docker.PullOptions, retries int) (bool, error) {
+	c.mu.Lock()
+	*c.active++
+	if *c.active > *c.maxActive {
+		*c.maxActive = *c.active
+	}
+	refuse := c.refuseAbove > 0 && *c.active > c.refuseAbove
+	if refuse {
+		*c.refused++
+	}
+	c.mu.Unlock()
+
+	time.Sleep(10 * time.Millisecond)
+
+	c.mu.Lock()
+	*c.active--
+	c.mu.Unlock()
+	if refuse {
+		return false, errors.WithMessage(docker.ErrTooManyConcurrent, "pull failed")
+	}
+	return true, nil
+}
+
+func newConcurrentDocker(refuseAbove int) concurrentDocker {
+	return concurrentDocker{mu: &sync.Mutex{}, active: new(int), maxActive: new(int), refused: new(int), refuseAbove: refuseAbove}
+}
+
+func TestPullImagesParallel(t *testing.T) {
+	logrus.SetOutput(ioutil.Discard)
+
+	images := map[string]Config{}
+	for n := 0; n < 8; n++ {
+		images[fmt.Sprintf("Image%d", n)] = Config{name: fmt.Sprintf("image%d", n), registry: "foo.io/sonobuoy", version: "1.0"}
+	}
+
+	tests := map[string]struct {
+		parallel      int
+		refuseAbove   int
+		wantMaxActive int
+		wantRefused   bool
+	}{
+		"sequential": {
+			parallel:      1,
+			wantMaxActive: 1,
+		},
+		"parallel": {
+			parallel:      3,
+			wantMaxActive: 3,
+		},
+		"backs off when too many run at once": {
+			parallel:      4,
+			refuseAbove:   2,
+			wantMaxActive: 4,
+			wantRefused:   true,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			d := newConcurrentDocker(tc.refuseAbove)
+			imgClient := ImageClient{dockerClient: d}.WithParallel(tc.parallel)
+
+			var mu sync.Mutex
+			done := 0
+			imgClient = imgClient.WithProgress(func(p ImageProgress) {
+				mu.Lock()
+				defer mu.Unlock()
+				if p.Status == ProgressDone {
+					done++
+				}
+			})
+
+			pulled, errs := imgClient.PullImages(images, docker.PullOptions{}, 0)
+			if len(errs) > 0 {
+				t.Fatalf("Expected no errors but got %v", errs)
+			}
+			if len(pulled) != len(images) || done != len(images) {
+				t.Errorf("Expected %d images pulled but got %d, with %d reported done", len(images), len(pulled), done)
+			}
+			if *d.maxActive > tc.wantMaxActive {
+				t.Errorf("Expected at most %d pulls at once but got %d", tc.wantMaxActive, *d.maxActive)
+			}
+			if (*d.refused > 0) != tc.wantRefused {
+				t.Errorf("Expected refused pulls %v but got %d", tc.wantRefused, *d.refused)
+			}
+			if tc.wantRefused && imgClient.limiter.limit >= tc.parallel {
+				t.Errorf("Expected parallelism lowered from %d but got %d", tc.parallel, imgClient.limiter.limit)
+			}
+		})
+	}
+}
+
+func TestParallelWithinDaemonLimit(t *testing.T) {
+	tests := map[string]struct {
+		parallel, layersPerImage, daemonLimit int
+		want                                  int
+	}{
+		"layers not set":       {parallel: 8, layersPerImage: 0, daemonLimit: 3, want: 8},
+		"within limit":         {parallel: 2, layersPerImage: 2, daemonLimit: 5, want: 2},
+		"lowered":              {parallel: 8, layersPerImage: 2, daemonLimit: 5, want: 2},
+		"layers exceed limit":  {parallel: 4, layersPerImage: 6, daemonLimit: 3, want: 1},
+		"exactly at the limit": {parallel: 3, layersPerImage: 1, daemonLimit: 3, want: 3},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := ParallelWithinDaemonLimit(tc.parallel, tc.layersPerImage, tc.daemonLimit); got != tc.want {
+				t.Errorf("Expected %d but got %d", tc.want, got)
+			}
+		})
+	}
+}
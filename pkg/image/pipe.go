@@ -0,0 +1,70 @@
+/*
+Copyright the Sonobuoy contributors 2019
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package image
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/heptio/sonobuoy/pkg/image/exec"
+	"github.com/pkg/errors"
+)
+
+// WithPipeThrough returns a copy of the client which streams saved images through
+// command, e.g. "zstd -T0", writing its output to the tar file instead of the tar
+// itself. The command is split on whitespace and run without a shell.
+func (i ImageClient) WithPipeThrough(command string) ImageClient {
+	i.pipeThrough = strings.Fields(command)
+	return i
+}
+
+// savePiped saves the images through the pipe-through command to fileName
+func (i ImageClient) savePiped(images []string, fileName string) error {
+	f, err := os.Create(fileName)
+	if err != nil {
+		return errors.Wrap(err, "couldn't create tar file")
+	}
+	defer f.Close()
+
+	pr, pw := io.Pipe()
+	var stderr bytes.Buffer
+	cmd := exec.Command(i.pipeThrough[0], i.pipeThrough[1:]...).
+		SetStdin(pr).
+		SetStdout(f).
+		SetStderr(&stderr)
+
+	done := make(chan error, 1)
+	go func() {
+		err := cmd.Run()
+		// Unblock the save if the command exits without reading all of its input
+		pr.CloseWithError(errors.New("pipe-through command exited"))
+		done <- err
+	}()
+
+	saveErr := i.dockerClient.SaveTo(images, i.limitWriter(pw))
+	pw.CloseWithError(saveErr)
+
+	if err := <-done; err != nil {
+		return errors.Wrapf(err, "%v failed: %v", strings.Join(i.pipeThrough, " "), strings.TrimSpace(stderr.String()))
+	}
+	if saveErr != nil {
+		return saveErr
+	}
+	return errors.Wrap(f.Close(), "couldn't write tar file")
+}
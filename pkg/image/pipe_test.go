@@ -0,0 +1,119 @@
+/*
+Copyright the Sonobuoy contributors 2019
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package image
+
+import (
+	"io/ioutil"
+	"os"
+	osexec "os/exec"
+	"testing"
+)
+
+func TestDownloadPipeThrough(t *testing.T) {
+	if _, err := osexec.LookPath("tr"); err != nil {
+		t.Skip("tr isn't available")
+	}
+	images := []string{"foo.io/sonobuoy/a:1.0", "foo.io/sonobuoy/b:1.0"}
+
+	tests := map[string]struct {
+		command   string
+		saveFails bool
+		want      string
+		wantErr   bool
+	}{
+		"output of command is written": {
+			command: "tr a-z A-Z",
+			want:    "FOO.IO/SONOBUOY/A:1.0\nFOO.IO/SONOBUOY/B:1.0",
+		},
+		"command fails": {
+			command: "tr --no-such-flag",
+			wantErr: true,
+		},
+		"save fails": {
+			command:   "tr a-z A-Z",
+			saveFails: true,
+			wantErr:   true,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			defer chdirTemp(t)()
+
+			imgClient := ImageClient{dockerClient: FakeDockerClient{saveFails: tc.saveFails}}.WithPipeThrough(tc.command)
+			fileName, err := imgClient.DownloadImages(images, "v1.14.0")
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("Expected error: %v, got %v", tc.wantErr, err)
+			}
+			if tc.wantErr {
+				if _, err := os.Stat(getTarFileName("v1.14.0", 0) + ".tmp"); !os.IsNotExist(err) {
+					t.Errorf("Expected the partial tar to be removed")
+				}
+				return
+			}
+
+			got, err := ioutil.ReadFile(fileName)
+			if err != nil {
+				t.Fatalf("Expected tar to be written: %v", err)
+			}
+			if string(got) != tc.want {
+				t.Errorf("Expected %q but got %q", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestLoadZstdPipedTar(t *testing.T) {
+	if _, err := osexec.LookPath("zstd"); err != nil {
+		t.Skip("zstd isn't available")
+	}
+	defer chdirTemp(t)()
+
+	images := []string{"foo.io/sonobuoy/a:1.0"}
+	fileName, err := ImageClient{dockerClient: FakeDockerClient{}}.WithPipeThrough("zstd -q").DownloadImages(images, "v1.14.0")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	f, err := os.Open(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	r, err := decompressed(f)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer r.Close()
+	got, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatalf("Unexpected error decompressing: %v", err)
+	}
+	if string(got) != images[0] {
+		t.Errorf("Expected %q but got %q", images[0], got)
+	}
+
+	// docker load can't read zstd, so the tar is streamed to it decompressed
+	loaded := []string{}
+	imgClient := ImageClient{dockerClient: FakeDockerClient{loaded: &loaded}}
+	if err := imgClient.LoadImages(fileName, ""); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(loaded) != 1 || loaded[0] != "-" {
+		t.Errorf("Expected the tar to be streamed to docker but got %v", loaded)
+	}
+}
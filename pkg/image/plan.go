@@ -0,0 +1,150 @@
+/*
+Copyright the Sonobuoy contributors 2019
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package image
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"text/tabwriter"
+)
+
+// PlanOptions selects the files a planned download saves the images to, as the
+// download flags do. With none set, the images are saved to the tar DownloadImages
+// writes for the version.
+type PlanOptions struct {
+	// FileName is the single tar, or OCI layout, the images are saved to
+	FileName string
+	// BatchSize is the most images in each part, as for DownloadImageBatches
+	BatchSize int
+	// MaxSize is the largest size of each part, as for DownloadImagesSplit
+	MaxSize int64
+	// Dir is the directory each image is saved to a tar of its own in, as for DownloadImagesToDir
+	Dir string
+}
+
+// PlannedImage is an image a download would save
+type PlannedImage struct {
+	Name string
+	// File is where the image would be saved
+	File string
+	// Size is the size of the image as reported by the local docker client. It's
+	// zero if the image isn't present locally, in which case saving it would fail.
+	Size    int64
+	Present bool
+}
+
+// DownloadPlan is the images a download would save, in the order it would save them
+type DownloadPlan []PlannedImage
+
+// PlanDownload returns which images a download with opts would save, their local
+// sizes and the files they'd be saved to, without saving anything.
+func (i ImageClient) PlanDownload(images []string, version string, opts PlanOptions) DownloadPlan {
+	sizes := map[string]int64{}
+	present := map[string]bool{}
+	for _, img := range images {
+		if info, err := i.dockerClient.Inspect(img); err == nil {
+			sizes[img], present[img] = info.Size, true
+		}
+	}
+
+	plan := DownloadPlan{}
+	add := func(imgs []string, file string) {
+		for _, img := range imgs {
+			plan = append(plan, PlannedImage{Name: img, File: file, Size: sizes[img], Present: present[img]})
+		}
+	}
+
+	switch {
+	case len(opts.Dir) > 0:
+		for _, img := range images {
+			add([]string{img}, filepath.Join(opts.Dir, tarFileNameForImage(img)))
+		}
+	case len(opts.FileName) > 0:
+		add(images, opts.FileName)
+	case opts.MaxSize > 0:
+		// Parts are packed by the images' sizes; the download may move images on
+		// once it measures the tars it writes
+		for n, part := range packImages(images, sizes, opts.MaxSize) {
+			add(part, getTarFileName(version, n+1))
+		}
+	case opts.BatchSize > 0:
+		for part, start := 1, 0; start < len(images); part, start = part+1, start+opts.BatchSize {
+			end := start + opts.BatchSize
+			if end > len(images) {
+				end = len(images)
+			}
+			add(images[start:end], getTarFileName(version, part))
+		}
+	default:
+		add(images, getTarFileName(version, 0))
+	}
+	return plan
+}
+
+// Size returns the total local size of the planned images
+func (p DownloadPlan) Size() int64 {
+	var size int64
+	for _, img := range p {
+		size += img.Size
+	}
+	return size
+}
+
+// Files returns the files the plan writes, in the order they're written
+func (p DownloadPlan) Files() []string {
+	files := []string{}
+	seen := map[string]bool{}
+	for _, img := range p {
+		if !seen[img.File] {
+			seen[img.File] = true
+			files = append(files, img.File)
+		}
+	}
+	return files
+}
+
+// Missing returns the planned images which aren't present locally
+func (p DownloadPlan) Missing() []string {
+	missing := []string{}
+	for _, img := range p {
+		if !img.Present {
+			missing = append(missing, img.Name)
+		}
+	}
+	return missing
+}
+
+// Write prints the plan as a table of the images, followed by their total size
+// and the files they'd be saved to.
+func (p DownloadPlan) Write(w io.Writer) {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "IMAGE\tSIZE\tFILE")
+	for _, img := range p {
+		size := humanSize(img.Size)
+		if !img.Present {
+			size = "missing"
+		}
+		fmt.Fprintf(tw, "%v\t%v\t%v\n", img.Name, size, img.File)
+	}
+	tw.Flush()
+
+	fmt.Fprintf(w, "Total: %d images, %v\n", len(p), humanSize(p.Size()))
+	for _, file := range p.Files() {
+		fmt.Fprintf(w, "Would write: %v\n", file)
+	}
+}
@@ -0,0 +1,99 @@
+/*
+Copyright the Sonobuoy contributors 2019
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package image
+
+import (
+	"bytes"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestPlanDownload(t *testing.T) {
+	const k8sVersion = "99.YY.ZZ"
+	images := []string{"foo.io/sonobuoy/a:1.0", "foo.io/sonobuoy/b:1.0", "foo.io/sonobuoy/c:1.0"}
+	imgClient := ImageClient{dockerClient: FakeDockerClient{missing: map[string]bool{"foo.io/sonobuoy/c:1.0": true}}}
+
+	tests := map[string]struct {
+		opts      PlanOptions
+		wantFiles []string
+	}{
+		"default tar": {
+			wantFiles: []string{getTarFileName(k8sVersion, 0)},
+		},
+		"named file": {
+			opts:      PlanOptions{FileName: "e2e.tar"},
+			wantFiles: []string{"e2e.tar"},
+		},
+		"batches": {
+			opts:      PlanOptions{BatchSize: 2},
+			wantFiles: []string{getTarFileName(k8sVersion, 1), getTarFileName(k8sVersion, 2)},
+		},
+		"split by size": {
+			opts:      PlanOptions{MaxSize: fakeImageSize},
+			wantFiles: []string{getTarFileName(k8sVersion, 1), getTarFileName(k8sVersion, 2)},
+		},
+		"output dir": {
+			opts: PlanOptions{Dir: "out"},
+			wantFiles: []string{
+				filepath.Join("out", "foo.io_sonobuoy_a_1.0.tar"),
+				filepath.Join("out", "foo.io_sonobuoy_b_1.0.tar"),
+				filepath.Join("out", "foo.io_sonobuoy_c_1.0.tar"),
+			},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			plan := imgClient.PlanDownload(images, k8sVersion, tc.opts)
+			if len(plan) != len(images) {
+				t.Fatalf("Expected %d planned images but got %+v", len(images), plan)
+			}
+			if got := plan.Files(); !reflect.DeepEqual(got, tc.wantFiles) {
+				t.Errorf("Expected files %v but got %v", tc.wantFiles, got)
+			}
+			if got := plan.Size(); got != 2*fakeImageSize {
+				t.Errorf("Expected total size %d but got %d", 2*fakeImageSize, got)
+			}
+			if want := []string{"foo.io/sonobuoy/c:1.0"}; !reflect.DeepEqual(plan.Missing(), want) {
+				t.Errorf("Expected missing images %v but got %v", want, plan.Missing())
+			}
+		})
+	}
+}
+
+func TestDownloadPlanWrite(t *testing.T) {
+	plan := DownloadPlan{
+		{Name: "foo.io/sonobuoy/a:1.0", File: "e2e.tar", Size: 3 << 20, Present: true},
+		{Name: "foo.io/sonobuoy/b:1.0", File: "e2e.tar"},
+	}
+
+	var buf bytes.Buffer
+	plan.Write(&buf)
+	want := strings.Join([]string{
+		"IMAGE                  SIZE     FILE",
+		"foo.io/sonobuoy/a:1.0  3.0 MB   e2e.tar",
+		"foo.io/sonobuoy/b:1.0  missing  e2e.tar",
+		"Total: 2 images, 3.0 MB",
+		"Would write: e2e.tar",
+		"",
+	}, "\n")
+	if buf.String() != want {
+		t.Errorf("Expected plan\n%v\nbut got\n%v", want, buf.String())
+	}
+}
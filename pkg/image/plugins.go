@@ -0,0 +1,183 @@
+/*
+Copyright the Sonobuoy contributors 2019
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package image
+
+import (
+	"github.com/pkg/errors"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// SystemdLogsImage is the image run by the systemd-logs plugin
+const SystemdLogsImage = "gcr.io/heptio-images/sonobuoy-plugin-systemd-logs:latest"
+
+// GetSystemdLogsImages returns the images used by the systemd-logs plugin, which
+// don't depend on the Kubernetes version.
+func GetSystemdLogsImages() map[string]Config {
+	c, err := configFromReference(SystemdLogsImage)
+	if err != nil {
+		panic(err)
+	}
+	return map[string]Config{"SystemdLogs": c}
+}
+
+// GetSonobuoyImages returns the image run by the sonobuoy aggregator and workers.
+// If repoConfig sets a sonobuoyRegistry, the image is returned as mirrored there,
+// under the same name and tag.
+func GetSonobuoyImages(repoConfig, image string) (map[string]Config, error) {
+	c, err := configFromReference(image)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid sonobuoy image")
+	}
+
+	if len(repoConfig) > 0 {
+		contents, err := ReadRepoConfig(repoConfig)
+		if err != nil {
+			return nil, err
+		}
+		r := &RegistryList{}
+		if err := yaml.Unmarshal(contents, r); err != nil {
+			return nil, errors.Wrapf(err, "couldn't parse repo-config %v", repoConfig)
+		}
+		r.trimRegistries()
+		if len(r.SonobuoyRegistry) > 0 {
+			c.registry = r.SonobuoyRegistry
+		}
+
+		parsed, err := parseRepoConfig(contents)
+		if err != nil {
+			return nil, errors.Wrapf(err, "couldn't parse repo-config %v", repoConfig)
+		}
+		if o, ok := parsed.Images[sonobuoyImageKey]; ok {
+			if err := o.validate(); err != nil {
+				return nil, errors.Wrapf(err, "invalid %v.%v in repo-config", repoConfigImagesKey, sonobuoyImageKey)
+			}
+			c.override = o
+		}
+	}
+	return map[string]Config{sonobuoyImageKey: c}, nil
+}
+
+// GetConformanceImages returns the conformance image the e2e plugin runs for the
+// given Kubernetes version, from the given repository, without its test dependencies.
+func GetConformanceImages(repository, version string) (map[string]Config, error) {
+	c, err := configFromReference(repository + ":" + version)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid conformance image")
+	}
+	return map[string]Config{"Conformance": c}, nil
+}
+
+// PluginImageProvider provides the images a plugin needs for a Kubernetes version
+type PluginImageProvider interface {
+	// Images returns the images the plugin lists, such as the e2e test images
+	Images(version string) (map[string]Config, error)
+	// Dependencies returns the images the plugin's pods run that it doesn't list,
+	// such as its own image and the sonobuoy worker sidecar
+	Dependencies(version string) (map[string]Config, error)
+}
+
+// E2EPluginImages provides the images of the e2e plugin
+type E2EPluginImages struct {
+	// RepoConfig is the repo-config the test images are mapped with, if any
+	RepoConfig string
+	// ConformanceRepository is the repository of the conformance image the plugin runs
+	ConformanceRepository string
+	// SonobuoyImage is the image of the worker sidecar
+	SonobuoyImage string
+}
+
+// Images returns the e2e test images for the version
+func (p E2EPluginImages) Images(version string) (map[string]Config, error) {
+	return GetImages(p.RepoConfig, version)
+}
+
+// Dependencies returns the conformance image for the version and the worker image
+func (p E2EPluginImages) Dependencies(version string) (map[string]Config, error) {
+	images, err := GetConformanceImages(p.ConformanceRepository, version)
+	if err != nil {
+		return nil, err
+	}
+	worker, err := GetSonobuoyImages("", p.SonobuoyImage)
+	if err != nil {
+		return nil, err
+	}
+	return mergeImages(images, worker), nil
+}
+
+// SystemdLogsPluginImages provides the images of the systemd-logs plugin
+type SystemdLogsPluginImages struct {
+	// SonobuoyImage is the image of the worker sidecar
+	SonobuoyImage string
+}
+
+// Images returns the systemd-logs image, which doesn't depend on the version
+func (p SystemdLogsPluginImages) Images(version string) (map[string]Config, error) {
+	return GetSystemdLogsImages(), nil
+}
+
+// Dependencies returns the worker image
+func (p SystemdLogsPluginImages) Dependencies(version string) (map[string]Config, error) {
+	return GetSonobuoyImages("", p.SonobuoyImage)
+}
+
+// MultiPluginImages provides the images of several plugins, merged into one set.
+// Images shared by plugins appear once in UniqueImages.
+type MultiPluginImages []PluginImageProvider
+
+// Images returns the images of every plugin
+func (m MultiPluginImages) Images(version string) (map[string]Config, error) {
+	return m.merge(func(p PluginImageProvider) (map[string]Config, error) { return p.Images(version) })
+}
+
+// Dependencies returns the dependencies of every plugin
+func (m MultiPluginImages) Dependencies(version string) (map[string]Config, error) {
+	return m.merge(func(p PluginImageProvider) (map[string]Config, error) { return p.Dependencies(version) })
+}
+
+func (m MultiPluginImages) merge(get func(PluginImageProvider) (map[string]Config, error)) (map[string]Config, error) {
+	merged := map[string]Config{}
+	for _, p := range m {
+		images, err := get(p)
+		if err != nil {
+			return nil, err
+		}
+		merged = mergeImages(merged, images)
+	}
+	return merged, nil
+}
+
+// PluginImagesWithDeps returns the images of the plugin for the version along
+// with their dependencies, so that the set is self-contained.
+func PluginImagesWithDeps(p PluginImageProvider, version string) (map[string]Config, error) {
+	images, err := p.Images(version)
+	if err != nil {
+		return nil, err
+	}
+	deps, err := p.Dependencies(version)
+	if err != nil {
+		return nil, errors.Wrap(err, "couldn't resolve the plugin's dependent images")
+	}
+	return mergeImages(images, deps), nil
+}
+
+// mergeImages adds the images of from to into, returning into
+func mergeImages(into, from map[string]Config) map[string]Config {
+	for k, v := range from {
+		into[k] = v
+	}
+	return into
+}
@@ -0,0 +1,119 @@
+/*
+Copyright the Sonobuoy contributors 2019
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package image
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestGetSonobuoyImages(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sonobuoy-repo-config")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	tests := map[string]struct {
+		repoConfig string
+		want       string
+	}{
+		"no repo-config": {
+			want: "gcr.io/heptio-images/sonobuoy:v0.14.0",
+		},
+		"repo-config without sonobuoyRegistry": {
+			repoConfig: "e2eRegistry: private.io/e2e\n",
+			want:       "gcr.io/heptio-images/sonobuoy:v0.14.0",
+		},
+		"repo-config with sonobuoyRegistry": {
+			repoConfig: "sonobuoyRegistry: private.io/heptio/\n",
+			want:       "private.io/heptio/sonobuoy:v0.14.0",
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			path := ""
+			if len(tc.repoConfig) > 0 {
+				path = filepath.Join(dir, name+".yaml")
+				if err := ioutil.WriteFile(path, []byte(tc.repoConfig), 0644); err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+			}
+
+			images, err := GetSonobuoyImages(path, "gcr.io/heptio-images/sonobuoy:v0.14.0")
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			img := images["Sonobuoy"]
+			if got := img.GetE2EImage(); got != tc.want {
+				t.Errorf("Expected %v but got %v", tc.want, got)
+			}
+		})
+	}
+
+	if _, err := GetSonobuoyImages("", "gcr.io/heptio-images/sonobuoy@sha256:abc"); err == nil {
+		t.Error("Expected error for invalid image but got nil")
+	}
+}
+
+func TestPluginImagesWithDeps(t *testing.T) {
+	const worker = "gcr.io/heptio-images/sonobuoy:v0.14.0"
+	e2e := E2EPluginImages{ConformanceRepository: "gcr.io/google-containers/conformance", SonobuoyImage: worker}
+	systemdLogs := SystemdLogsPluginImages{SonobuoyImage: worker}
+
+	tests := map[string]struct {
+		provider  PluginImageProvider
+		wantAdded []string
+	}{
+		"e2e": {
+			provider:  e2e,
+			wantAdded: []string{"gcr.io/google-containers/conformance:v1.14.0", worker},
+		},
+		"systemd-logs": {
+			provider:  systemdLogs,
+			wantAdded: []string{worker},
+		},
+		"all plugins": {
+			provider:  MultiPluginImages{e2e, systemdLogs},
+			wantAdded: []string{"gcr.io/google-containers/conformance:v1.14.0", worker},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			listed, err := tc.provider.Images("v1.14.0")
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			images, err := PluginImagesWithDeps(tc.provider, "v1.14.0")
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if got := UniqueImages(AddedImages(listed, images)); !reflect.DeepEqual(got, tc.wantAdded) {
+				t.Errorf("Expected dependencies %v to be added but got %v", tc.wantAdded, got)
+			}
+			if added := AddedImages(images, listed); len(added) > 0 {
+				t.Errorf("Expected every listed image to be kept but %v weren't", UniqueImages(added))
+			}
+		})
+	}
+}
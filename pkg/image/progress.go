@@ -0,0 +1,179 @@
+/*
+Copyright the Sonobuoy contributors 2019
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package image
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/heptio/sonobuoy/pkg/image/docker"
+)
+
+// Operation is the kind of work an ImageClient is doing on an image
+type Operation string
+
+const (
+	// OperationPull is pulling an image from its registry
+	OperationPull Operation = "pull"
+	// OperationPush is tagging and pushing an image to its private registry
+	OperationPush Operation = "push"
+	// OperationDownload is saving images to a tar file
+	OperationDownload Operation = "download"
+	// OperationDelete is removing an image from the local docker client
+	OperationDelete Operation = "delete"
+	// OperationLoad is loading an image from a tar file into the local docker client
+	OperationLoad Operation = "load"
+)
+
+// ProgressStatus is the state of an operation on an image
+type ProgressStatus string
+
+const (
+	// ProgressStarted is reported before an operation on an image begins
+	ProgressStarted ProgressStatus = "started"
+	// ProgressDone is reported when an operation on an image succeeded
+	ProgressDone ProgressStatus = "done"
+	// ProgressSkipped is reported when there was nothing to do for an image
+	ProgressSkipped ProgressStatus = "skipped"
+	// ProgressFailed is reported when an operation on an image failed
+	ProgressFailed ProgressStatus = "failed"
+)
+
+// ImageProgress is an event describing the progress of an operation on one image
+// (or one tar file, for downloads) out of the total for the current call.
+type ImageProgress struct {
+	// Name is the image reference, or the tar file name for downloads
+	Name      string
+	Operation Operation
+	Status    ProgressStatus
+	// Current is the 1-based position of Name among the Total items being processed
+	Current int
+	Total   int
+	// Err is the error the operation failed with, if Status is ProgressFailed
+	Err error
+	// Layers is how far docker got through the layers of a pull or push, reported
+	// when it has completed or failed
+	Layers docker.LayerProgress
+}
+
+// ProgressFunc is called synchronously with each progress event
+type ProgressFunc func(ImageProgress)
+
+// ProgressChannel returns a ProgressFunc sending each event on ch. The channel
+// must be drained while operations run, since sends block.
+func ProgressChannel(ch chan<- ImageProgress) ProgressFunc {
+	return func(p ImageProgress) {
+		ch <- p
+	}
+}
+
+// ProgressWriter returns a ProgressFunc writing a line for each event to w
+func ProgressWriter(w io.Writer) ProgressFunc {
+	return func(p ImageProgress) {
+		if p.Err != nil {
+			fmt.Fprintf(w, "[%d/%d] %s %s %s: %v\n", p.Current, p.Total, p.Operation, p.Name, p.Status, p.Err)
+			return
+		}
+		fmt.Fprintf(w, "[%d/%d] %s %s %s\n", p.Current, p.Total, p.Operation, p.Name, p.Status)
+	}
+}
+
+// MultiProgress returns a ProgressFunc sending each event to every fn, in order
+func MultiProgress(fns ...ProgressFunc) ProgressFunc {
+	return func(p ImageProgress) {
+		for _, fn := range fns {
+			fn(p)
+		}
+	}
+}
+
+// progressEvent is the JSON Lines schema of an ImageProgress event
+type progressEvent struct {
+	Time      string         `json:"time"`
+	Operation Operation      `json:"operation"`
+	Name      string         `json:"name"`
+	Status    ProgressStatus `json:"status"`
+	Current   int            `json:"current"`
+	Total     int            `json:"total"`
+	Error     string         `json:"error,omitempty"`
+	Layers    *layerSummary  `json:"layers,omitempty"`
+}
+
+// layerSummary is the JSON Lines schema of the layers of a pull or push
+type layerSummary struct {
+	Completed  int      `json:"completed"`
+	Total      int      `json:"total"`
+	Incomplete []string `json:"incomplete,omitempty"`
+}
+
+// progressLayersStatus is the status of the JSON Lines event summarizing the
+// layers of a pull or push, written before the event of its outcome
+const progressLayersStatus ProgressStatus = "layers"
+
+// now is the clock used to timestamp JSON progress events
+var now = time.Now
+
+// ProgressJSONWriter returns a ProgressFunc writing each event to w as a single
+// line of JSON, for consumption by log aggregation systems.
+func ProgressJSONWriter(w io.Writer) ProgressFunc {
+	enc := json.NewEncoder(w)
+	return func(p ImageProgress) {
+		e := progressEvent{
+			Time:      now().UTC().Format(time.RFC3339),
+			Operation: p.Operation,
+			Name:      p.Name,
+			Status:    p.Status,
+			Current:   p.Current,
+			Total:     p.Total,
+		}
+		if p.Layers.Total() > 0 {
+			layers := e
+			layers.Status = progressLayersStatus
+			layers.Layers = &layerSummary{Completed: len(p.Layers.Completed), Total: p.Layers.Total(), Incomplete: p.Layers.Incomplete}
+			enc.Encode(layers)
+		}
+		if p.Err != nil {
+			e.Error = p.Err.Error()
+		}
+		enc.Encode(e)
+	}
+}
+
+// WithProgress returns a copy of the client which reports the progress of its
+// operations to fn.
+func (i ImageClient) WithProgress(fn ProgressFunc) ImageClient {
+	i.progress = fn
+	return i
+}
+
+// report sends a progress event, if a ProgressFunc is configured
+func (i ImageClient) report(p ImageProgress) {
+	if i.progress != nil {
+		i.progress(p)
+	}
+}
+
+// reportResult reports the outcome of an operation started with ProgressStarted
+func (i ImageClient) reportResult(p ImageProgress, err error) {
+	p.Status = ProgressDone
+	if err != nil {
+		p.Status, p.Err = ProgressFailed, err
+	}
+	i.report(p)
+}
@@ -0,0 +1,161 @@
+/*
+Copyright the Sonobuoy contributors 2019
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package image
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/heptio/sonobuoy/pkg/image/docker"
+	"github.com/pkg/errors"
+)
+
+func TestProgressEvents(t *testing.T) {
+	images := map[string]Config{
+		"A": {name: "a", registry: "foo.io/sonobuoy", version: "1.0"},
+		"B": {name: "b", registry: "foo.io/sonobuoy", version: "1.0"},
+	}
+	private := map[string]Config{
+		"test": {name: "test1", registry: "private.io/sonobuoy", version: "x.y"},
+	}
+
+	tests := map[string]struct {
+		client FakeDockerClient
+		run    func(i ImageClient)
+		want   []ImageProgress
+	}{
+		"pull": {
+			client: FakeDockerClient{},
+			run:    func(i ImageClient) { i.PullImages(images, docker.PullOptions{}, 0) },
+			want: []ImageProgress{
+				{Name: "foo.io/sonobuoy/a:1.0", Operation: OperationPull, Status: ProgressStarted, Current: 1, Total: 2},
+				{Name: "foo.io/sonobuoy/a:1.0", Operation: OperationPull, Status: ProgressDone, Current: 1, Total: 2},
+				{Name: "foo.io/sonobuoy/b:1.0", Operation: OperationPull, Status: ProgressStarted, Current: 2, Total: 2},
+				{Name: "foo.io/sonobuoy/b:1.0", Operation: OperationPull, Status: ProgressDone, Current: 2, Total: 2},
+			},
+		},
+		"pull reports layers": {
+			client: FakeDockerClient{layers: []string{"a3ed95caeb02"}},
+			run:    func(i ImageClient) { i.PullImages(map[string]Config{"A": images["A"]}, docker.PullOptions{}, 0) },
+			want: []ImageProgress{
+				{Name: "foo.io/sonobuoy/a:1.0", Operation: OperationPull, Status: ProgressStarted, Current: 1, Total: 1},
+				{Name: "foo.io/sonobuoy/a:1.0", Operation: OperationPull, Status: ProgressDone, Current: 1, Total: 1,
+					Layers: docker.LayerProgress{Completed: []string{"a3ed95caeb02"}, Incomplete: []string{}}},
+			},
+		},
+		"push reports layers": {
+			client: FakeDockerClient{layers: []string{"5f70bf18a086"}},
+			run:    func(i ImageClient) { i.PushImages(imgs, private, nil, 0) },
+			want: []ImageProgress{
+				{Name: "private.io/sonobuoy/test1:x.y", Operation: OperationPush, Status: ProgressStarted, Current: 1, Total: 1},
+				{Name: "private.io/sonobuoy/test1:x.y", Operation: OperationPush, Status: ProgressDone, Current: 1, Total: 1,
+					Layers: docker.LayerProgress{Completed: []string{"5f70bf18a086"}, Incomplete: []string{}}},
+			},
+		},
+		"pull images present": {
+			client: FakeDockerClient{imageExists: true},
+			run:    func(i ImageClient) { i.PullImages(images, docker.PullOptions{}, 0) },
+			want: []ImageProgress{
+				{Name: "foo.io/sonobuoy/a:1.0", Operation: OperationPull, Status: ProgressStarted, Current: 1, Total: 2},
+				{Name: "foo.io/sonobuoy/a:1.0", Operation: OperationPull, Status: ProgressSkipped, Current: 1, Total: 2},
+				{Name: "foo.io/sonobuoy/b:1.0", Operation: OperationPull, Status: ProgressStarted, Current: 2, Total: 2},
+				{Name: "foo.io/sonobuoy/b:1.0", Operation: OperationPull, Status: ProgressSkipped, Current: 2, Total: 2},
+			},
+		},
+		"push": {
+			client: FakeDockerClient{},
+			run:    func(i ImageClient) { i.PushImages(imgs, private, []string{"stable"}, 0) },
+			want: []ImageProgress{
+				{Name: "private.io/sonobuoy/test1:x.y", Operation: OperationPush, Status: ProgressStarted, Current: 1, Total: 2},
+				{Name: "private.io/sonobuoy/test1:x.y", Operation: OperationPush, Status: ProgressDone, Current: 1, Total: 2},
+				{Name: "private.io/sonobuoy/test1:stable", Operation: OperationPush, Status: ProgressStarted, Current: 2, Total: 2},
+				{Name: "private.io/sonobuoy/test1:stable", Operation: OperationPush, Status: ProgressDone, Current: 2, Total: 2},
+			},
+		},
+		"delete fails": {
+			client: FakeDockerClient{deleteFails: true},
+			run:    func(i ImageClient) { i.DeleteImages(imgs, 0) },
+			want: []ImageProgress{
+				{Name: "foo.io/sonobuoy/test1:x.y", Operation: OperationDelete, Status: ProgressStarted, Current: 1, Total: 1},
+				{Name: "foo.io/sonobuoy/test1:x.y", Operation: OperationDelete, Status: ProgressFailed, Current: 1, Total: 1},
+			},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			got := []ImageProgress{}
+			imgClient := ImageClient{dockerClient: tc.client}.WithProgress(func(p ImageProgress) {
+				// Only the presence of an error is compared
+				if p.Err != nil {
+					p.Err = nil
+				}
+				got = append(got, p)
+			})
+
+			tc.run(imgClient)
+
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("Expected events %+v but got %+v", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestProgressChannel(t *testing.T) {
+	ch := make(chan ImageProgress, 1)
+	want := ImageProgress{Name: "foo.io/sonobuoy/test1:x.y", Operation: OperationPull, Status: ProgressDone, Current: 1, Total: 1}
+
+	ProgressChannel(ch)(want)
+
+	if got := <-ch; !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %+v but got %+v", want, got)
+	}
+}
+
+func TestProgressWriter(t *testing.T) {
+	var buf bytes.Buffer
+	fn := ProgressWriter(&buf)
+	fn(ImageProgress{Name: "foo.io/a:1.0", Operation: OperationPull, Status: ProgressDone, Current: 1, Total: 2})
+	fn(ImageProgress{Name: "foo.io/b:1.0", Operation: OperationPull, Status: ProgressFailed, Current: 2, Total: 2, Err: errors.New("pull failed")})
+
+	want := "[1/2] pull foo.io/a:1.0 done\n[2/2] pull foo.io/b:1.0 failed: pull failed\n"
+	if buf.String() != want {
+		t.Errorf("Expected %q but got %q", want, buf.String())
+	}
+}
+
+func TestProgressJSONWriter(t *testing.T) {
+	defer func(orig func() time.Time) { now = orig }(now)
+	now = func() time.Time { return time.Date(2019, 5, 1, 12, 0, 0, 0, time.UTC) }
+
+	var buf bytes.Buffer
+	fn := ProgressJSONWriter(&buf)
+	fn(ImageProgress{Name: "foo.io/a:1.0", Operation: OperationPull, Status: ProgressStarted, Current: 1, Total: 2})
+	fn(ImageProgress{Name: "foo.io/a:1.0", Operation: OperationPull, Status: ProgressFailed, Current: 1, Total: 2, Err: errors.New("pull failed"),
+		Layers: docker.LayerProgress{Completed: []string{"a3ed95caeb02"}, Incomplete: []string{"5f70bf18a086"}}})
+
+	want := `{"time":"2019-05-01T12:00:00Z","operation":"pull","name":"foo.io/a:1.0","status":"started","current":1,"total":2}
+{"time":"2019-05-01T12:00:00Z","operation":"pull","name":"foo.io/a:1.0","status":"layers","current":1,"total":2,"layers":{"completed":1,"total":2,"incomplete":["5f70bf18a086"]}}
+{"time":"2019-05-01T12:00:00Z","operation":"pull","name":"foo.io/a:1.0","status":"failed","current":1,"total":2,"error":"pull failed"}
+`
+	if buf.String() != want {
+		t.Errorf("Expected %q but got %q", want, buf.String())
+	}
+}
@@ -0,0 +1,431 @@
+/*
+Copyright the Sonobuoy contributors 2019
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package registry contains a minimal client for the Docker Registry HTTP API V2,
+// used to inspect images in a registry without involving the local docker daemon.
+package registry
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// dockerHubAPIHost is the host serving the registry API for DefaultHost
+const dockerHubAPIHost = "registry-1.docker.io"
+
+// manifestMediaTypes are the manifest formats accepted from registries, in order of preference
+var manifestMediaTypes = []string{
+	"application/vnd.docker.distribution.manifest.list.v2+json",
+	"application/vnd.docker.distribution.manifest.v2+json",
+	"application/vnd.oci.image.index.v1+json",
+	"application/vnd.oci.image.manifest.v1+json",
+}
+
+// ErrNotFound is returned when an image manifest doesn't exist in the registry
+var ErrNotFound = errors.New("manifest not found")
+
+var challengeParamRegexp = regexp.MustCompile(`(\w+)="([^"]*)"`)
+
+// Client queries image registries
+type Client struct {
+	HTTPClient *http.Client
+	// Credentials authenticate requests to the registries they're for. Registries
+	// without credentials are accessed anonymously.
+	Credentials CredentialStore
+	// Retries is how many times to retry a request that times out, by HTTP method,
+	// so that cheap checks can fail fast while heavier requests retry patiently.
+	// Requests of other methods aren't retried.
+	Retries map[string]int
+	// InsecureRegistries are the registries that may be reached over plain http,
+	// as host[:port] or CIDR entries like those of the docker daemon's
+	// insecure-registries setting. Loopback registries always may, as for the daemon.
+	InsecureRegistries []string
+}
+
+// NewClient returns a registry client using the default HTTP client
+func NewClient() *Client {
+	return &Client{
+		HTTPClient: http.DefaultClient,
+	}
+}
+
+// ClientOptions configure the HTTP transport of a registry client
+type ClientOptions struct {
+	// ConnectTimeout limits connecting to a registry, including the TLS handshake. Zero means no limit.
+	ConnectTimeout time.Duration
+	// ReadTimeout limits waiting for a response to a request. Zero means no limit.
+	ReadTimeout time.Duration
+	// RootCAs are the certificate authorities trusted for registries, or the system's if nil
+	RootCAs *x509.CertPool
+	// Retries is how many times to retry a request that times out, by HTTP method
+	Retries map[string]int
+}
+
+// NewClientWithOptions returns a registry client using a transport configured by opts
+func NewClientWithOptions(opts ClientOptions) *Client {
+	return &Client{
+		HTTPClient: &http.Client{
+			Transport: &http.Transport{
+				Proxy: http.ProxyFromEnvironment,
+				DialContext: (&net.Dialer{
+					Timeout:   opts.ConnectTimeout,
+					KeepAlive: 30 * time.Second,
+				}).DialContext,
+				TLSClientConfig:       &tls.Config{RootCAs: opts.RootCAs},
+				TLSHandshakeTimeout:   opts.ConnectTimeout,
+				ResponseHeaderTimeout: opts.ReadTimeout,
+			},
+		},
+		Retries: opts.Retries,
+	}
+}
+
+// retryMethods are the HTTP methods whose retries can be set by ParseRetries
+var retryMethods = []string{http.MethodHead, http.MethodGet}
+
+// ParseRetries parses retry counts per HTTP method given as method=count, e.g.
+// head=0 or get=5. Methods are case insensitive and may be HEAD or GET, the
+// methods the client sends.
+func ParseRetries(values []string) (map[string]int, error) {
+	retries := map[string]int{}
+	for _, v := range values {
+		parts := strings.SplitN(v, "=", 2)
+		if len(parts) != 2 {
+			return nil, errors.Errorf("invalid retries %q, expected method=count", v)
+		}
+		method := strings.ToUpper(strings.TrimSpace(parts[0]))
+		if !isRetryMethod(method) {
+			return nil, errors.Errorf("invalid retries %q, method must be one of %v", v, strings.Join(retryMethods, ", "))
+		}
+		n, err := strconv.Atoi(strings.TrimSpace(parts[1]))
+		if err != nil || n < 0 {
+			return nil, errors.Errorf("invalid retries %q, count must be a non-negative integer", v)
+		}
+		retries[method] = n
+	}
+	return retries, nil
+}
+
+func isRetryMethod(method string) bool {
+	for _, m := range retryMethods {
+		if m == method {
+			return true
+		}
+	}
+	return false
+}
+
+// send sends req, retrying it as many times as c.Retries allows for its method if
+// it times out. Only requests without a body are sent, so they can be resent as is.
+func (c *Client) send(req *http.Request) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		resp, err := c.HTTPClient.Do(req)
+		if err == nil || !isTimeout(err) || attempt >= c.Retries[req.Method] {
+			return resp, err
+		}
+	}
+}
+
+// isTimeout reports whether err is a timeout of a request
+func isTimeout(err error) bool {
+	netErr, ok := err.(net.Error)
+	return ok && netErr.Timeout()
+}
+
+// LoadCACert returns the system's certificate authorities along with those in the
+// PEM encoded file at path.
+func LoadCACert(path string) (*x509.CertPool, error) {
+	pem, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "couldn't read CA certificate")
+	}
+
+	pool, err := x509.SystemCertPool()
+	if err != nil || pool == nil {
+		pool = x509.NewCertPool()
+	}
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, errors.Errorf("no PEM encoded certificates found in %v", path)
+	}
+	return pool, nil
+}
+
+// Digest returns the digest of the manifest for the given image, or ErrNotFound
+// if the registry doesn't have it. Only the manifest is requested; no layers are fetched.
+func (c *Client) Digest(image string) (string, error) {
+	ref, err := ParseReference(image)
+	if err != nil {
+		return "", err
+	}
+
+	resp, err := c.do(http.MethodHead, ref)
+	if err != nil {
+		return "", errors.Wrapf(err, "couldn't get manifest for %v", image)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		if ref.Digest != "" {
+			return ref.Digest, nil
+		}
+		return resp.Header.Get("Docker-Content-Digest"), nil
+	case http.StatusNotFound:
+		return "", ErrNotFound
+	default:
+		return "", errors.Errorf("couldn't get manifest for %v: unexpected status %v", image, resp.Status)
+	}
+}
+
+// manifestListMediaTypes are the manifest formats that list a manifest per platform
+var manifestListMediaTypes = map[string]bool{
+	"application/vnd.docker.distribution.manifest.list.v2+json": true,
+	"application/vnd.oci.image.index.v1+json":                   true,
+}
+
+// PlatformDigests returns the digests of the platform manifests listed by the
+// manifest list of the given image, or none if its manifest isn't a list, such
+// as when it was mirrored by docker pull and push for a single platform.
+func (c *Client) PlatformDigests(image string) ([]string, error) {
+	ref, err := ParseReference(image)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.do(http.MethodGet, ref)
+	if err != nil {
+		return nil, errors.Wrapf(err, "couldn't get manifest for %v", image)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return nil, ErrNotFound
+	default:
+		return nil, errors.Errorf("couldn't get manifest for %v: unexpected status %v", image, resp.Status)
+	}
+
+	manifest := struct {
+		MediaType string `json:"mediaType"`
+		Manifests []struct {
+			Digest string `json:"digest"`
+		} `json:"manifests"`
+	}{}
+	if err := json.NewDecoder(resp.Body).Decode(&manifest); err != nil {
+		return nil, errors.Wrapf(err, "couldn't decode manifest for %v", image)
+	}
+	mediaType := manifest.MediaType
+	if len(mediaType) == 0 {
+		mediaType = resp.Header.Get("Content-Type")
+	}
+	if !manifestListMediaTypes[mediaType] {
+		return nil, nil
+	}
+
+	digests := make([]string, 0, len(manifest.Manifests))
+	for _, m := range manifest.Manifests {
+		digests = append(digests, m.Digest)
+	}
+	return digests, nil
+}
+
+// Ping checks that the registry API at host can be reached. Any response from
+// the API, including a challenge for credentials, counts as reachable. Insecure
+// registries are tried over plain http if they can't be reached over https.
+func (c *Client) Ping(host string) error {
+	err := c.ping("https", host)
+	if err != nil && c.insecure(host) {
+		if httpErr := c.ping("http", host); httpErr == nil {
+			return nil
+		}
+	}
+	return err
+}
+
+// ping checks that the registry API at host can be reached using scheme
+func (c *Client) ping(scheme, host string) error {
+	req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("%s://%s/v2/", scheme, apiHost(host)), nil)
+	if err != nil {
+		return errors.Wrapf(err, "couldn't reach registry %v", host)
+	}
+	resp, err := c.send(req)
+	if err != nil {
+		return errors.Wrapf(err, "couldn't reach registry %v", host)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusUnauthorized:
+		return nil
+	default:
+		return errors.Errorf("couldn't reach registry %v: unexpected status %v", host, resp.Status)
+	}
+}
+
+// insecure reports whether host may be reached over plain http: if it's loopback,
+// or listed in InsecureRegistries as is or by a CIDR range holding its IP address.
+func (c *Client) insecure(host string) bool {
+	hostname := host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		hostname = h
+	}
+	ip := net.ParseIP(hostname)
+	if hostname == "localhost" || (ip != nil && ip.IsLoopback()) {
+		return true
+	}
+	for _, entry := range c.InsecureRegistries {
+		if entry == host {
+			return true
+		}
+		if _, cidr, err := net.ParseCIDR(entry); err == nil && ip != nil && cidr.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// do performs a request against the manifest of ref, authenticating with a
+// bearer token if the registry challenges for one.
+func (c *Client) do(method string, ref Reference) (*http.Response, error) {
+	req, err := c.manifestRequest(method, ref)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.send(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusUnauthorized {
+		return resp, nil
+	}
+
+	challenge := resp.Header.Get("WWW-Authenticate")
+	resp.Body.Close()
+
+	req, err = c.manifestRequest(method, ref)
+	if err != nil {
+		return nil, err
+	}
+
+	creds, hasCreds := c.Credentials.Get(ref.Host)
+	if hasCreds && strings.HasPrefix(strings.ToLower(challenge), "basic ") {
+		req.SetBasicAuth(creds.Username, creds.Password)
+		return c.send(req)
+	}
+
+	token, err := c.token(challenge, ref)
+	if err != nil {
+		return nil, errors.Wrap(err, "couldn't authenticate with registry")
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	return c.send(req)
+}
+
+func (c *Client) manifestRequest(method string, ref Reference) (*http.Request, error) {
+	reference := ref.Tag
+	if ref.Digest != "" {
+		reference = ref.Digest
+	}
+
+	u := fmt.Sprintf("https://%s/v2/%s/manifests/%s", apiHost(ref.Host), ref.Repository, reference)
+	req, err := http.NewRequest(method, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", strings.Join(manifestMediaTypes, ", "))
+	return req, nil
+}
+
+// token requests a pull token as described by a bearer challenge, with the
+// registry's credentials if there are any or anonymously otherwise.
+func (c *Client) token(challenge string, ref Reference) (string, error) {
+	if !strings.HasPrefix(strings.ToLower(challenge), "bearer ") {
+		return "", errors.Errorf("unsupported authentication challenge %q", challenge)
+	}
+
+	params := map[string]string{}
+	for _, match := range challengeParamRegexp.FindAllStringSubmatch(challenge, -1) {
+		params[strings.ToLower(match[1])] = match[2]
+	}
+
+	realm, ok := params["realm"]
+	if !ok {
+		return "", errors.Errorf("authentication challenge %q has no realm", challenge)
+	}
+
+	query := url.Values{}
+	if service, ok := params["service"]; ok {
+		query.Set("service", service)
+	}
+	scope, ok := params["scope"]
+	if !ok {
+		scope = fmt.Sprintf("repository:%s:pull", ref.Repository)
+	}
+	query.Set("scope", scope)
+
+	req, err := http.NewRequest(http.MethodGet, realm+"?"+query.Encode(), nil)
+	if err != nil {
+		return "", err
+	}
+	if creds, ok := c.Credentials.Get(ref.Host); ok {
+		req.SetBasicAuth(creds.Username, creds.Password)
+	}
+
+	resp, err := c.send(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", errors.Errorf("token request failed: %v", resp.Status)
+	}
+
+	body := struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}{}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return "", errors.Wrap(err, "couldn't decode token response")
+	}
+
+	if body.Token != "" {
+		return body.Token, nil
+	}
+	return body.AccessToken, nil
+}
+
+// apiHost returns the host serving the registry API for an image host
+func apiHost(host string) string {
+	if host == DefaultHost {
+		return dockerHubAPIHost
+	}
+	return host
+}
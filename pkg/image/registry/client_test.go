@@ -0,0 +1,343 @@
+/*
+Copyright the Sonobuoy contributors 2019
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package registry
+
+import (
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const testDigest = "sha256:3f4b8d8f0cfc3b9e5f9a4714e2aba9f3c5b8c2c7c1d9e6f0a3b2c1d0e9f8a7b6"
+
+// newTestRegistry serves a single manifest that requires a bearer token.
+func newTestRegistry(t *testing.T) *httptest.Server {
+	var srv *httptest.Server
+	mux := http.NewServeMux()
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("scope") != "repository:e2e/dnsutils:pull" {
+			http.Error(w, "bad scope", http.StatusBadRequest)
+			return
+		}
+		fmt.Fprint(w, `{"token": "secret"}`)
+	})
+	mux.HandleFunc("/v2/", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="%s/token",service="test"`, srv.URL))
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.URL.Path != "/v2/e2e/dnsutils/manifests/1.1" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Docker-Content-Digest", testDigest)
+	})
+	srv = httptest.NewTLSServer(mux)
+	return srv
+}
+
+func TestDigest(t *testing.T) {
+	srv := newTestRegistry(t)
+	defer srv.Close()
+	host := strings.TrimPrefix(srv.URL, "https://")
+
+	tests := map[string]struct {
+		image      string
+		wantDigest string
+		wantErr    error
+	}{
+		"image exists": {
+			image:      host + "/e2e/dnsutils:1.1",
+			wantDigest: testDigest,
+		},
+		"tag missing": {
+			image:   host + "/e2e/dnsutils:1.2",
+			wantErr: ErrNotFound,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			c := &Client{HTTPClient: srv.Client()}
+			got, err := c.Digest(tc.image)
+			if errors.Cause(err) != tc.wantErr {
+				t.Fatalf("expected error %v, got %v", tc.wantErr, err)
+			}
+			if got != tc.wantDigest {
+				t.Errorf("expected digest %q, got %q", tc.wantDigest, got)
+			}
+		})
+	}
+}
+
+func TestPlatformDigests(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v2/e2e/multi/manifests/1.0":
+			fmt.Fprint(w, `{"mediaType": "application/vnd.docker.distribution.manifest.list.v2+json",
+				"manifests": [{"digest": "sha256:amd64"}, {"digest": "sha256:arm64"}]}`)
+		case "/v2/e2e/single/manifests/1.0":
+			fmt.Fprint(w, `{"mediaType": "application/vnd.docker.distribution.manifest.v2+json", "layers": []}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+	host := strings.TrimPrefix(srv.URL, "https://")
+
+	tests := map[string]struct {
+		image   string
+		want    []string
+		wantErr error
+	}{
+		"manifest list":   {image: host + "/e2e/multi:1.0", want: []string{"sha256:amd64", "sha256:arm64"}},
+		"single platform": {image: host + "/e2e/single:1.0"},
+		"missing":         {image: host + "/e2e/missing:1.0", wantErr: ErrNotFound},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			c := &Client{HTTPClient: srv.Client()}
+			got, err := c.PlatformDigests(tc.image)
+			if errors.Cause(err) != tc.wantErr {
+				t.Fatalf("expected error %v, got %v", tc.wantErr, err)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("expected digests %v, got %v", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestPing(t *testing.T) {
+	srv := newTestRegistry(t)
+	defer srv.Close()
+	notRegistry := httptest.NewTLSServer(http.NotFoundHandler())
+	defer notRegistry.Close()
+
+	tests := map[string]struct {
+		srv     *httptest.Server
+		wantErr bool
+	}{
+		"requires credentials": {
+			srv: srv,
+		},
+		"not a registry": {
+			srv:     notRegistry,
+			wantErr: true,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			c := &Client{HTTPClient: tc.srv.Client()}
+			err := c.Ping(strings.TrimPrefix(tc.srv.URL, "https://"))
+			if (err != nil) != tc.wantErr {
+				t.Errorf("expected error: %v, got %v", tc.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestPingInsecure(t *testing.T) {
+	plain := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer plain.Close()
+	host := strings.TrimPrefix(plain.URL, "http://")
+
+	// The test server listens on loopback, which is always insecure
+	if err := NewClient().Ping(host); err != nil {
+		t.Errorf("expected the plain http registry to be reachable, got %v", err)
+	}
+}
+
+func TestInsecure(t *testing.T) {
+	c := &Client{InsecureRegistries: []string{"registry.local:5000", "mirror.local", "10.0.0.0/8"}}
+
+	tests := map[string]bool{
+		"localhost:5000":      true,
+		"127.0.0.1:5000":      true,
+		"[::1]:5000":          true,
+		"registry.local:5000": true,
+		"registry.local:443":  false,
+		"mirror.local":        true,
+		"mirror.local:5000":   false,
+		"10.1.2.3:5000":       true,
+		"192.168.1.1:5000":    false,
+		"docker.io":           false,
+	}
+	for host, want := range tests {
+		if got := c.insecure(host); got != want {
+			t.Errorf("expected insecure(%v) %v, got %v", host, want, got)
+		}
+	}
+}
+
+func TestReadTimeout(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer srv.Close()
+	defer close(release)
+	host := strings.TrimPrefix(srv.URL, "https://")
+
+	c := NewClientWithOptions(ClientOptions{ReadTimeout: 50 * time.Millisecond})
+	c.HTTPClient.Transport.(*http.Transport).TLSClientConfig = srv.Client().Transport.(*http.Transport).TLSClientConfig
+
+	done := make(chan error)
+	go func() {
+		_, err := c.Digest(host + "/e2e/dnsutils:1.1")
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Fatal("expected a timeout error, got none")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the request to time out")
+	}
+}
+
+func TestTimeoutRetries(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+
+	tests := map[string]struct {
+		retries      map[string]int
+		slowRequests int
+		wantRequests int
+		wantErr      bool
+	}{
+		"not retried by default": {
+			slowRequests: 1,
+			wantRequests: 1,
+			wantErr:      true,
+		},
+		"retried until it responds": {
+			retries:      map[string]int{http.MethodHead: 2},
+			slowRequests: 2,
+			wantRequests: 3,
+		},
+		"gives up after the retries": {
+			retries:      map[string]int{http.MethodHead: 1},
+			slowRequests: 3,
+			wantRequests: 2,
+			wantErr:      true,
+		},
+		"other methods' retries don't apply": {
+			retries:      map[string]int{http.MethodGet: 2},
+			slowRequests: 1,
+			wantRequests: 1,
+			wantErr:      true,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			requests := make(chan struct{}, 10)
+			srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				requests <- struct{}{}
+				if len(requests) <= tc.slowRequests {
+					select {
+					case <-release:
+					case <-time.After(200 * time.Millisecond):
+					}
+					return
+				}
+				w.Header().Set("Docker-Content-Digest", testDigest)
+			}))
+			defer srv.Close()
+
+			c := NewClientWithOptions(ClientOptions{ReadTimeout: 50 * time.Millisecond, Retries: tc.retries})
+			c.HTTPClient.Transport.(*http.Transport).TLSClientConfig = srv.Client().Transport.(*http.Transport).TLSClientConfig
+
+			_, err := c.Digest(strings.TrimPrefix(srv.URL, "https://") + "/e2e/dnsutils:1.1")
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("expected error %v, got %v", tc.wantErr, err)
+			}
+			if len(requests) != tc.wantRequests {
+				t.Errorf("expected %d requests, got %d", tc.wantRequests, len(requests))
+			}
+		})
+	}
+}
+
+func TestParseRetries(t *testing.T) {
+	got, err := ParseRetries([]string{"head=0", " GET = 3 "})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := map[string]int{http.MethodHead: 0, http.MethodGet: 3}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected retries %v, got %v", want, got)
+	}
+
+	for _, invalid := range []string{"head", "post=1", "put=5", "get=-1", "get=many"} {
+		if _, err := ParseRetries([]string{invalid}); err == nil {
+			t.Errorf("expected error for %q, got none", invalid)
+		}
+	}
+}
+
+func TestLoadCACert(t *testing.T) {
+	srv := newTestRegistry(t)
+	defer srv.Close()
+	host := strings.TrimPrefix(srv.URL, "https://")
+
+	f, err := ioutil.TempFile("", "registry-ca")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer os.Remove(f.Name())
+	pem.Encode(f, &pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw})
+	f.Close()
+
+	// The test registry's certificate isn't trusted by default
+	if _, err := NewClientWithOptions(ClientOptions{}).Digest(host + "/e2e/dnsutils:1.1"); err == nil {
+		t.Fatal("expected an error for an untrusted certificate, got none")
+	}
+
+	pool, err := LoadCACert(f.Name())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	got, err := NewClientWithOptions(ClientOptions{RootCAs: pool}).Digest(host + "/e2e/dnsutils:1.1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got != testDigest {
+		t.Errorf("expected digest %q, got %q", testDigest, got)
+	}
+
+	if _, err := LoadCACert(os.DevNull); err == nil {
+		t.Error("expected an error for a file without certificates, got none")
+	}
+}
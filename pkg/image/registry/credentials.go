@@ -0,0 +1,279 @@
+/*
+Copyright the Sonobuoy contributors 2019
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package registry
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+	"k8s.io/client-go/util/homedir"
+)
+
+// dockerHubConfigKey is the key the docker CLI stores Docker Hub credentials under
+const dockerHubConfigKey = "https://index.docker.io/v1/"
+
+// Credentials are the username and password used to authenticate with a registry
+type Credentials struct {
+	Username string
+	Password string
+}
+
+// CredentialStore looks up the credentials for registry hosts
+type CredentialStore map[string]Credentials
+
+// Get returns the credentials for host, if any
+func (s CredentialStore) Get(host string) (Credentials, bool) {
+	if host == DefaultHost {
+		host = dockerHubConfigKey
+	}
+	creds, ok := s[host]
+	return creds, ok
+}
+
+// DockerConfigPath returns the path of the docker CLI's config file, honoring $DOCKER_CONFIG
+func DockerConfigPath() string {
+	dir := os.Getenv("DOCKER_CONFIG")
+	if dir == "" {
+		dir = filepath.Join(homedir.HomeDir(), ".docker")
+	}
+	return filepath.Join(dir, dockerConfigFileName)
+}
+
+// dockerConfigFileName is the name of the file the docker CLI reads credentials from
+const dockerConfigFileName = "config.json"
+
+// DockerConfigDir returns a docker config directory using the credentials in the
+// auth file at path, which is in the format of the docker CLI's config.json and of
+// podman and skopeo's auth.json, so it can be given to docker as $DOCKER_CONFIG.
+// If the file isn't named config.json, a temporary directory linking to it is made,
+// which cleanup removes.
+func DockerConfigDir(path string) (dir string, cleanup func(), err error) {
+	if _, err := LoadDockerConfig(path); err != nil {
+		return "", nil, err
+	}
+	if _, err := os.Stat(path); err != nil {
+		return "", nil, errors.Wrap(err, "couldn't read registry auth file")
+	}
+
+	path, err = filepath.Abs(path)
+	if err != nil {
+		return "", nil, errors.Wrap(err, "couldn't resolve registry auth file")
+	}
+	if filepath.Base(path) == dockerConfigFileName {
+		return filepath.Dir(path), func() {}, nil
+	}
+
+	dir, err = ioutil.TempDir("", "sonobuoy-docker-config")
+	if err != nil {
+		return "", nil, errors.Wrap(err, "couldn't create docker config directory")
+	}
+	cleanup = func() { os.RemoveAll(dir) }
+	if err := os.Symlink(path, filepath.Join(dir, dockerConfigFileName)); err != nil {
+		cleanup()
+		return "", nil, errors.Wrap(err, "couldn't link registry auth file")
+	}
+	return dir, cleanup, nil
+}
+
+// TemporaryDockerConfig is a copy of a docker config directory to log in under for
+// a single command, given to docker as $DOCKER_CONFIG, so that the credentials
+// don't outlive the command.
+type TemporaryDockerConfig struct {
+	// Dir is the temporary config directory
+	Dir string
+
+	mu sync.Mutex
+}
+
+// NewTemporaryDockerConfig copies the docker config file at path, if any, into a
+// new temporary directory. Everything else in its directory, such as docker
+// contexts, is linked in so docker otherwise behaves as before.
+func NewTemporaryDockerConfig(path string) (*TemporaryDockerConfig, error) {
+	contents, err := ioutil.ReadFile(path)
+	switch {
+	case os.IsNotExist(err):
+		contents = []byte("{}")
+	case err != nil:
+		return nil, errors.Wrap(err, "couldn't read docker config")
+	}
+
+	dir, err := ioutil.TempDir("", "sonobuoy-docker-config")
+	if err != nil {
+		return nil, errors.Wrap(err, "couldn't create docker config directory")
+	}
+	c := &TemporaryDockerConfig{Dir: dir}
+	if err := ioutil.WriteFile(c.path(), contents, 0600); err != nil {
+		c.Remove()
+		return nil, errors.Wrap(err, "couldn't copy docker config")
+	}
+
+	entries, err := ioutil.ReadDir(filepath.Dir(path))
+	if err != nil && !os.IsNotExist(err) {
+		c.Remove()
+		return nil, errors.Wrap(err, "couldn't read docker config directory")
+	}
+	for _, entry := range entries {
+		if entry.Name() == dockerConfigFileName {
+			continue
+		}
+		if err := os.Symlink(filepath.Join(filepath.Dir(path), entry.Name()), filepath.Join(dir, entry.Name())); err != nil {
+			c.Remove()
+			return nil, errors.Wrap(err, "couldn't link docker config directory")
+		}
+	}
+	return c, nil
+}
+
+// StoreInFile makes docker keep the credentials of a login to host in the
+// temporary config file, rather than in a credential helper the original config
+// uses, which would keep them after the command.
+func (c *TemporaryDockerConfig) StoreInFile(host string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	contents, err := ioutil.ReadFile(c.path())
+	if err != nil {
+		return errors.Wrap(err, "couldn't read docker config")
+	}
+	config := map[string]json.RawMessage{}
+	if err := json.Unmarshal(contents, &config); err != nil {
+		return errors.Wrapf(err, "couldn't parse docker config %v", c.path())
+	}
+	helpers := map[string]string{}
+	if raw, ok := config["credHelpers"]; ok {
+		if err := json.Unmarshal(raw, &helpers); err != nil {
+			return errors.Wrapf(err, "couldn't parse docker config %v", c.path())
+		}
+	}
+
+	if host == DefaultHost {
+		host = dockerHubConfigKey
+	}
+	// An empty helper for a host overrides credsStore, so docker uses the file
+	helpers[host] = ""
+	raw, err := json.Marshal(helpers)
+	if err != nil {
+		return errors.Wrap(err, "couldn't update docker config")
+	}
+	config["credHelpers"] = raw
+	contents, err = json.MarshalIndent(config, "", "\t")
+	if err != nil {
+		return errors.Wrap(err, "couldn't update docker config")
+	}
+	return errors.Wrap(ioutil.WriteFile(c.path(), contents, 0600), "couldn't update docker config")
+}
+
+// Remove deletes the temporary config, along with any credentials logged in with
+func (c *TemporaryDockerConfig) Remove() error {
+	return errors.Wrap(os.RemoveAll(c.Dir), "couldn't remove docker config directory")
+}
+
+// path returns the path of the temporary config file
+func (c *TemporaryDockerConfig) path() string {
+	return filepath.Join(c.Dir, dockerConfigFileName)
+}
+
+// LoadDockerConfig returns the credentials saved by `docker login` in the docker
+// config file at path. Credentials kept by credential helpers aren't included.
+// A missing file has no credentials.
+func LoadDockerConfig(path string) (CredentialStore, error) {
+	contents, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return CredentialStore{}, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "couldn't read docker config")
+	}
+
+	config := struct {
+		Auths map[string]struct {
+			Auth string `json:"auth"`
+		} `json:"auths"`
+	}{}
+	if err := json.Unmarshal(contents, &config); err != nil {
+		return nil, errors.Wrapf(err, "couldn't parse docker config %v", path)
+	}
+
+	store := CredentialStore{}
+	for host, entry := range config.Auths {
+		if entry.Auth == "" {
+			continue
+		}
+		decoded, err := base64.StdEncoding.DecodeString(entry.Auth)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid credentials for %v in docker config %v", host, path)
+		}
+		parts := strings.SplitN(string(decoded), ":", 2)
+		if len(parts) != 2 {
+			return nil, errors.Errorf("invalid credentials for %v in docker config %v", host, path)
+		}
+		store[configHost(host)] = Credentials{Username: parts[0], Password: parts[1]}
+	}
+	return store, nil
+}
+
+// HasLogin reports whether the docker config file at path provides credentials for
+// host, either saved by `docker login` or through a credential helper.
+func HasLogin(path, host string) bool {
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return false
+	}
+
+	config := struct {
+		Auths map[string]struct {
+			Auth string `json:"auth"`
+		} `json:"auths"`
+		CredsStore  string            `json:"credsStore"`
+		CredHelpers map[string]string `json:"credHelpers"`
+	}{}
+	if err := json.Unmarshal(contents, &config); err != nil {
+		return false
+	}
+
+	if host == DefaultHost {
+		host = dockerHubConfigKey
+	}
+	if _, ok := config.CredHelpers[host]; ok {
+		return true
+	}
+	for key, entry := range config.Auths {
+		if configHost(key) == host {
+			return entry.Auth != "" || config.CredsStore != ""
+		}
+	}
+	return false
+}
+
+// configHost returns the registry host of a docker config key, which may be a URL
+// such as https://registry.example.com/v2/. The Docker Hub key is kept as is.
+func configHost(key string) string {
+	if key == dockerHubConfigKey {
+		return key
+	}
+	key = strings.TrimPrefix(strings.TrimPrefix(key, "https://"), "http://")
+	if i := strings.Index(key, "/"); i >= 0 {
+		key = key[:i]
+	}
+	return key
+}
@@ -0,0 +1,252 @@
+/*
+Copyright the Sonobuoy contributors 2019
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package registry
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLoadDockerConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "docker-config")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	auth := func(s string) string { return base64.StdEncoding.EncodeToString([]byte(s)) }
+	path := filepath.Join(dir, "config.json")
+	config := `{"auths": {
+		"https://index.docker.io/v1/": {"auth": "` + auth("hub:secret") + `"},
+		"https://private.io/v2/": {"auth": "` + auth("user:pa:ss") + `"},
+		"helper.io": {}
+	}, "credsStore": "desktop"}`
+	if err := ioutil.WriteFile(path, []byte(config), 0600); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	got, err := LoadDockerConfig(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := CredentialStore{
+		dockerHubConfigKey: {Username: "hub", Password: "secret"},
+		"private.io":       {Username: "user", Password: "pa:ss"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+	if creds, ok := got.Get(DefaultHost); !ok || creds.Username != "hub" {
+		t.Errorf("expected Docker Hub credentials for %v, got %v", DefaultHost, creds)
+	}
+
+	missing, err := LoadDockerConfig(filepath.Join(dir, "missing.json"))
+	if err != nil || len(missing) != 0 {
+		t.Errorf("expected no credentials and no error for a missing config, got %v, %v", missing, err)
+	}
+}
+
+func TestDockerConfigDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "docker-config")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	auths := `{"auths": {"private.io": {"auth": "dXNlcjpzZWNyZXQ="}}}`
+	for _, name := range []string{"auth.json", "config.json", "invalid.json"} {
+		contents := auths
+		if name == "invalid.json" {
+			contents = "{"
+		}
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(contents), 0600); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	tests := map[string]struct {
+		path      string
+		wantDir   string
+		expectErr bool
+	}{
+		"auth file":     {path: filepath.Join(dir, "auth.json")},
+		"docker config": {path: filepath.Join(dir, "config.json"), wantDir: dir},
+		"invalid file":  {path: filepath.Join(dir, "invalid.json"), expectErr: true},
+		"missing file":  {path: filepath.Join(dir, "missing.json"), expectErr: true},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, cleanup, err := DockerConfigDir(tc.path)
+			if tc.expectErr {
+				if err == nil {
+					t.Fatal("expected an error, got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			defer cleanup()
+
+			if tc.wantDir != "" && got != tc.wantDir {
+				t.Errorf("expected directory %v, got %v", tc.wantDir, got)
+			}
+			creds, err := LoadDockerConfig(filepath.Join(got, "config.json"))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if c, ok := creds.Get("private.io"); !ok || c.Username != "user" {
+				t.Errorf("expected credentials for private.io, got %v", creds)
+			}
+		})
+	}
+}
+
+func TestTemporaryDockerConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "docker-config")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	original := `{"auths": {"private.io": {}}, "credsStore": "desktop", "currentContext": "remote"}`
+	path := filepath.Join(dir, "config.json")
+	if err := ioutil.WriteFile(path, []byte(original), 0600); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := os.Mkdir(filepath.Join(dir, "contexts"), 0700); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	config, err := NewTemporaryDockerConfig(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(config.Dir, "contexts")); err != nil {
+		t.Errorf("expected the contexts directory to be linked: %v", err)
+	}
+	for _, host := range []string{"private.io", DefaultHost} {
+		if err := config.StoreInFile(host); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	contents, err := ioutil.ReadFile(filepath.Join(config.Dir, "config.json"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	got := struct {
+		CredsStore     string            `json:"credsStore"`
+		CredHelpers    map[string]string `json:"credHelpers"`
+		CurrentContext string            `json:"currentContext"`
+	}{}
+	if err := json.Unmarshal(contents, &got); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	wantHelpers := map[string]string{"private.io": "", dockerHubConfigKey: ""}
+	if got.CredsStore != "desktop" || got.CurrentContext != "remote" || !reflect.DeepEqual(got.CredHelpers, wantHelpers) {
+		t.Errorf("unexpected temporary config %s", contents)
+	}
+
+	if contents, _ := ioutil.ReadFile(path); string(contents) != original {
+		t.Errorf("expected the original config to be unchanged, got %s", contents)
+	}
+	if err := config.Remove(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := os.Stat(config.Dir); !os.IsNotExist(err) {
+		t.Errorf("expected %v to be removed, got %v", config.Dir, err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "contexts")); err != nil {
+		t.Errorf("expected the original contexts directory to be kept: %v", err)
+	}
+}
+
+func TestHasLogin(t *testing.T) {
+	dir, err := ioutil.TempDir("", "docker-config")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "config.json")
+	config := `{"auths": {
+		"https://index.docker.io/v1/": {"auth": "aHViOnNlY3JldA=="},
+		"https://private.io/v2/": {"auth": "dXNlcjpzZWNyZXQ="},
+		"empty.io": {}
+	}, "credHelpers": {"123.dkr.ecr.us-east-1.amazonaws.com": "ecr-login"}}`
+	if err := ioutil.WriteFile(path, []byte(config), 0600); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	tests := map[string]struct {
+		path string
+		host string
+		want bool
+	}{
+		"docker hub":        {path: path, host: DefaultHost, want: true},
+		"private registry":  {path: path, host: "private.io", want: true},
+		"credential helper": {path: path, host: "123.dkr.ecr.us-east-1.amazonaws.com", want: true},
+		"empty entry":       {path: path, host: "empty.io", want: false},
+		"not logged in":     {path: path, host: "other.io", want: false},
+		"missing config":    {path: filepath.Join(dir, "missing.json"), host: "private.io", want: false},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := HasLogin(tc.path, tc.host); got != tc.want {
+				t.Errorf("expected %v, got %v", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestBasicAuth(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, pass, ok := r.BasicAuth(); !ok || user != "user" || pass != "secret" {
+			w.Header().Set("WWW-Authenticate", `Basic realm="test"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("Docker-Content-Digest", testDigest)
+	}))
+	defer srv.Close()
+	host := strings.TrimPrefix(srv.URL, "https://")
+
+	c := &Client{HTTPClient: srv.Client()}
+	if _, err := c.Digest(host + "/e2e/dnsutils:1.1"); err == nil {
+		t.Fatal("expected an error without credentials, got none")
+	}
+
+	c.Credentials = CredentialStore{host: {Username: "user", Password: "secret"}}
+	got, err := c.Digest(host + "/e2e/dnsutils:1.1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got != testDigest {
+		t.Errorf("expected digest %q, got %q", testDigest, got)
+	}
+}
@@ -0,0 +1,123 @@
+/*
+Copyright the Sonobuoy contributors 2019
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package registry
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// DefaultHost is the registry used when an image reference doesn't specify one
+	DefaultHost = "docker.io"
+
+	// defaultTag is the tag used when an image reference doesn't specify one
+	defaultTag = "latest"
+)
+
+var (
+	componentRegexp = regexp.MustCompile(`^[a-z0-9]+(?:(?:[._]|__|[-]*)[a-z0-9]+)*$`)
+	tagRegexp       = regexp.MustCompile(`^[\w][\w.-]{0,127}$`)
+	digestRegexp    = regexp.MustCompile(`^[a-z0-9]+(?:[.+_-][a-z0-9]+)*:[a-zA-Z0-9=_-]{32,}$`)
+)
+
+// Reference is a parsed docker image reference
+type Reference struct {
+	// Host is the registry host (and optional port), e.g. gcr.io
+	Host string
+	// Repository is the path of the image within the registry, e.g. google-samples/gb-frontend
+	Repository string
+	// Tag is the image tag, if any
+	Tag string
+	// Digest is the image digest, if any
+	Digest string
+}
+
+// ParseReference parses an image reference of the form [host[:port]/]repository[:tag][@digest].
+// As with the docker CLI, images without a host are assumed to be on Docker Hub and
+// images without a tag or digest are assumed to be tagged latest.
+func ParseReference(image string) (Reference, error) {
+	ref := Reference{}
+	remainder := image
+
+	if i := strings.Index(remainder, "@"); i >= 0 {
+		ref.Digest = remainder[i+1:]
+		remainder = remainder[:i]
+		if !digestRegexp.MatchString(ref.Digest) {
+			return Reference{}, errors.Errorf("invalid digest %q in image reference %q", ref.Digest, image)
+		}
+	}
+
+	if i := strings.LastIndex(remainder, ":"); i >= 0 && !strings.Contains(remainder[i+1:], "/") {
+		ref.Tag = remainder[i+1:]
+		remainder = remainder[:i]
+		if !tagRegexp.MatchString(ref.Tag) {
+			return Reference{}, errors.Errorf("invalid tag %q in image reference %q", ref.Tag, image)
+		}
+	}
+
+	components := strings.Split(remainder, "/")
+	if len(components) > 1 && isHost(components[0]) {
+		ref.Host = components[0]
+		components = components[1:]
+	} else {
+		ref.Host = DefaultHost
+	}
+
+	if ref.Host == DefaultHost && len(components) == 1 {
+		components = append([]string{"library"}, components...)
+	}
+
+	for _, c := range components {
+		if !componentRegexp.MatchString(c) {
+			return Reference{}, errors.Errorf("invalid repository %q in image reference %q", remainder, image)
+		}
+	}
+	ref.Repository = strings.Join(components, "/")
+
+	if ref.Tag == "" && ref.Digest == "" {
+		ref.Tag = defaultTag
+	}
+
+	return ref, nil
+}
+
+// isHost reports whether the first component of a reference names a registry
+// host rather than a path in Docker Hub.
+func isHost(component string) bool {
+	return strings.ContainsAny(component, ".:") || component == "localhost"
+}
+
+// Name returns the fully qualified repository name, without tag or digest
+func (r Reference) Name() string {
+	return fmt.Sprintf("%s/%s", r.Host, r.Repository)
+}
+
+// String returns the fully qualified image reference
+func (r Reference) String() string {
+	s := r.Name()
+	if r.Tag != "" {
+		s += ":" + r.Tag
+	}
+	if r.Digest != "" {
+		s += "@" + r.Digest
+	}
+	return s
+}
@@ -0,0 +1,105 @@
+/*
+Copyright the Sonobuoy contributors 2019
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package registry
+
+import (
+	"testing"
+)
+
+func TestParseReference(t *testing.T) {
+	const digest = "sha256:6cc4d2d2bc89b6e0963bd29640d3c34251a3a01e1f831e1d5a2d6f7cd3b1b3a6"
+
+	tests := map[string]struct {
+		image      string
+		want       Reference
+		wantString string
+		wantErr    bool
+	}{
+		"full reference": {
+			image:      "gcr.io/kubernetes-e2e-test-images/dnsutils:1.1",
+			want:       Reference{Host: "gcr.io", Repository: "kubernetes-e2e-test-images/dnsutils", Tag: "1.1"},
+			wantString: "gcr.io/kubernetes-e2e-test-images/dnsutils:1.1",
+		},
+		"docker hub library image": {
+			image:      "busybox:1.29",
+			want:       Reference{Host: "docker.io", Repository: "library/busybox", Tag: "1.29"},
+			wantString: "docker.io/library/busybox:1.29",
+		},
+		"docker hub user image": {
+			image:      "sonobuoy/systemd-logs:v0.1",
+			want:       Reference{Host: "docker.io", Repository: "sonobuoy/systemd-logs", Tag: "v0.1"},
+			wantString: "docker.io/sonobuoy/systemd-logs:v0.1",
+		},
+		"host with port": {
+			image:      "localhost:5000/volume/nfs:1.0",
+			want:       Reference{Host: "localhost:5000", Repository: "volume/nfs", Tag: "1.0"},
+			wantString: "localhost:5000/volume/nfs:1.0",
+		},
+		"no tag defaults to latest": {
+			image:      "k8s.gcr.io/pause",
+			want:       Reference{Host: "k8s.gcr.io", Repository: "pause", Tag: "latest"},
+			wantString: "k8s.gcr.io/pause:latest",
+		},
+		"digest": {
+			image:      "quay.io/coreos/etcd@" + digest,
+			want:       Reference{Host: "quay.io", Repository: "coreos/etcd", Digest: digest},
+			wantString: "quay.io/coreos/etcd@" + digest,
+		},
+		"tag and digest": {
+			image:      "quay.io/coreos/etcd:v3.3.10@" + digest,
+			want:       Reference{Host: "quay.io", Repository: "coreos/etcd", Tag: "v3.3.10", Digest: digest},
+			wantString: "quay.io/coreos/etcd:v3.3.10@" + digest,
+		},
+		"uppercase repository": {
+			image:   "gcr.io/Foo/bar:1.0",
+			wantErr: true,
+		},
+		"invalid tag": {
+			image:   "gcr.io/foo/bar:1.0$",
+			wantErr: true,
+		},
+		"invalid digest": {
+			image:   "gcr.io/foo/bar@sha256:abc",
+			wantErr: true,
+		},
+		"empty": {
+			image:   "",
+			wantErr: true,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := ParseReference(tc.image)
+			if tc.wantErr {
+				if err == nil {
+					t.Fatalf("expected error, got %v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tc.want {
+				t.Errorf("expected %+v, got %+v", tc.want, got)
+			}
+			if got.String() != tc.wantString {
+				t.Errorf("expected string %q, got %q", tc.wantString, got.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,115 @@
+/*
+Copyright the Sonobuoy contributors 2019
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package image
+
+import (
+	"io/ioutil"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// registryMapSeparator separates the source and destination of a registry map rule
+const registryMapSeparator = "->"
+
+// registryMapRule maps the images matching source to the reference made by
+// expanding dest with the submatches of source, e.g. $1 or ${name}.
+type registryMapRule struct {
+	source *regexp.Regexp
+	dest   string
+}
+
+// RegistryMap maps image references to their destinations by the first matching
+// rule. Unlike an e2e repo-config, it applies to any image, not only the upstream
+// e2e test registries.
+type RegistryMap []registryMapRule
+
+// ParseRegistryMap parses rules of the form `source-regex -> dest-template`, one
+// per line. Blank lines and lines starting with # are ignored. Each source must
+// match the whole reference of an image, e.g. `k8s.gcr.io/(.*) -> mirror.corp/k8s/$1`.
+func ParseRegistryMap(contents string) (RegistryMap, error) {
+	m := RegistryMap{}
+	for n, line := range strings.Split(contents, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		parts := strings.SplitN(line, registryMapSeparator, 2)
+		if len(parts) != 2 {
+			return nil, errors.Errorf("invalid rule on line %d: expected source-regex %v dest-template", n+1, registryMapSeparator)
+		}
+		source, dest := strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1])
+		if source == "" || dest == "" {
+			return nil, errors.Errorf("invalid rule on line %d: expected source-regex %v dest-template", n+1, registryMapSeparator)
+		}
+
+		re, err := regexp.Compile("^(?:" + source + ")$")
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid source on line %d", n+1)
+		}
+		m = append(m, registryMapRule{source: re, dest: dest})
+	}
+	return m, nil
+}
+
+// LoadRegistryMap reads the registry map rules in the file at path
+func LoadRegistryMap(path string) (RegistryMap, error) {
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "couldn't read registry map %v", path)
+	}
+	m, err := ParseRegistryMap(string(contents))
+	if err != nil {
+		return nil, errors.Wrapf(err, "couldn't parse registry map %v", path)
+	}
+	return m, nil
+}
+
+// Map returns the destination of image by the first rule matching it, and
+// whether any rule did.
+func (m RegistryMap) Map(image string) (string, bool) {
+	for _, rule := range m {
+		match := rule.source.FindStringSubmatchIndex(image)
+		if match == nil {
+			continue
+		}
+		return string(rule.source.ExpandString(nil, rule.dest, image, match)), true
+	}
+	return image, false
+}
+
+// Apply returns a copy of images with each image replaced by its destination.
+// Images that no rule matches are unchanged.
+func (m RegistryMap) Apply(images map[string]Config) (map[string]Config, error) {
+	mapped := make(map[string]Config, len(images))
+	for k, v := range images {
+		dest, ok := m.Map(v.GetE2EImage())
+		if !ok {
+			mapped[k] = v
+			continue
+		}
+
+		c, err := configFromReference(dest)
+		if err != nil {
+			return nil, errors.Wrapf(err, "registry map made an invalid image reference for %v", v.GetE2EImage())
+		}
+		mapped[k] = c
+	}
+	return mapped, nil
+}
@@ -0,0 +1,114 @@
+/*
+Copyright the Sonobuoy contributors 2019
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package image
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseRegistryMap(t *testing.T) {
+	tests := map[string]struct {
+		contents  string
+		wantRules int
+		expectErr bool
+	}{
+		"rules with comments": {
+			contents: `
+# mirror the e2e images
+k8s.gcr.io/(.*) -> mirror.corp/k8s/$1
+
+gcr.io/kubernetes-e2e-test-images/(.*) -> mirror.corp/e2e/$1
+`,
+			wantRules: 2,
+		},
+		"missing separator": {
+			contents:  "k8s.gcr.io/(.*) mirror.corp/$1",
+			expectErr: true,
+		},
+		"missing destination": {
+			contents:  "k8s.gcr.io/(.*) ->",
+			expectErr: true,
+		},
+		"invalid regex": {
+			contents:  "k8s.gcr.io/(.* -> mirror.corp/$1",
+			expectErr: true,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			m, err := ParseRegistryMap(tc.contents)
+			if tc.expectErr {
+				if err == nil {
+					t.Fatal("Expected an error but got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if len(m) != tc.wantRules {
+				t.Errorf("Expected %d rules but got %d", tc.wantRules, len(m))
+			}
+		})
+	}
+}
+
+func TestRegistryMapApply(t *testing.T) {
+	images := map[string]Config{
+		"Pause":    {name: "pause", registry: "k8s.gcr.io", version: "3.1"},
+		"Agnhost":  {name: "agnhost", registry: "gcr.io/kubernetes-e2e-test-images", version: "2.2"},
+		"Nginx":    {name: "nginx", registry: "docker.io/library", version: "1.14-alpine"},
+		"Sonobuoy": {name: "sonobuoy", registry: "gcr.io/heptio-images", version: "v0.15.0"},
+	}
+
+	m, err := ParseRegistryMap(`
+k8s.gcr.io/(.*) -> mirror.corp/k8s/$1
+gcr.io/(?P<project>[^/]+)/(?P<image>[^:]+):(?P<tag>.*) -> mirror.corp/${project}/${image}:${tag}-mirrored
+gcr.io/.* -> unreachable.corp/never
+`)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	got, err := m.Apply(images)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	want := map[string]string{
+		"Pause":    "mirror.corp/k8s/pause:3.1",
+		"Agnhost":  "mirror.corp/kubernetes-e2e-test-images/agnhost:2.2-mirrored",
+		"Nginx":    "docker.io/library/nginx:1.14-alpine",
+		"Sonobuoy": "mirror.corp/heptio-images/sonobuoy:v0.15.0-mirrored",
+	}
+	gotRefs := map[string]string{}
+	for k, v := range got {
+		gotRefs[k] = v.GetE2EImage()
+	}
+	if !reflect.DeepEqual(gotRefs, want) {
+		t.Errorf("Expected %v but got %v", want, gotRefs)
+	}
+
+	invalid, err := ParseRegistryMap("k8s.gcr.io/(.*) -> Mirror.Corp/$1:bad:tag")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := invalid.Apply(images); err == nil {
+		t.Error("Expected an error for an invalid destination but got none")
+	}
+}
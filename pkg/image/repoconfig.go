@@ -0,0 +1,340 @@
+/*
+Copyright the Sonobuoy contributors 2019
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package image
+
+import (
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/heptio/sonobuoy/pkg/image/registry"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	yaml "gopkg.in/yaml.v2"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	corev1client "k8s.io/client-go/kubernetes/typed/core/v1"
+)
+
+const (
+	// RepoConfigStdin is the repo-config source meaning the config is read from stdin
+	RepoConfigStdin = "-"
+
+	// RepoConfigMapScheme prefixes repo-config sources naming a cluster ConfigMap,
+	// as configmap://namespace/name[/key]. The key may be left out for ConfigMaps
+	// holding a single key.
+	RepoConfigMapScheme = "configmap://"
+
+	// repoConfigFetchTimeout limits fetching a repo-config given as a URL, so an
+	// unresponsive server fails the command rather than hanging it
+	repoConfigFetchTimeout = 30 * time.Second
+)
+
+var (
+	// repoConfigStdin is where a repo-config given as RepoConfigStdin is read from
+	repoConfigStdin io.Reader = os.Stdin
+
+	// repoConfigHTTPClient fetches repo-configs given as URLs
+	repoConfigHTTPClient = &http.Client{Timeout: repoConfigFetchTimeout}
+
+	// RepoConfigStrictEnv makes reading a repo-config fail if it references an
+	// environment variable that isn't set, rather than expanding it to nothing.
+	RepoConfigStrictEnv bool
+
+	// RepoConfigMapClient reads repo-configs given as ConfigMaps. It must be set
+	// before reading one, since only those repo-configs need a cluster.
+	RepoConfigMapClient corev1client.ConfigMapsGetter
+
+	// repoConfigs caches the contents of repo-configs read from stdin or URLs, since
+	// stdin can only be read once and the config is needed by several steps.
+	repoConfigs   = map[string][]byte{}
+	repoConfigsMu sync.Mutex
+)
+
+// ReadRepoConfig returns the contents of a repo-config, which may be a file path,
+// an http(s) URL, a ConfigMap under RepoConfigMapScheme, or RepoConfigStdin.
+// References to environment variables, as ${VAR} or $VAR, are expanded so that one
+// templated repo-config can serve several environments. The expanded contents are
+// checked to be a YAML map of registry keys to registries, along with any images
+// section of per-image attributes.
+func ReadRepoConfig(source string) ([]byte, error) {
+	repoConfigsMu.Lock()
+	defer repoConfigsMu.Unlock()
+
+	if contents, ok := repoConfigs[source]; ok {
+		return contents, nil
+	}
+
+	contents, err := fetchRepoConfig(source)
+	if err != nil {
+		return nil, err
+	}
+
+	contents, err = expandEnv(contents, source)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := parseRepoConfig(contents); err != nil {
+		return nil, errors.Wrapf(err, "couldn't parse repo-config %v as a YAML map of registries", source)
+	}
+
+	if !isLocalRepoConfig(source) {
+		repoConfigs[source] = contents
+	}
+	return contents, nil
+}
+
+// repoConfigImagesKey is the repo-config section of per-image attributes. The e2e
+// tests ignore it, like any key they don't know.
+const repoConfigImagesKey = "images"
+
+// sonobuoyImageKey is the name of the sonobuoy image among the images
+const sonobuoyImageKey = "Sonobuoy"
+
+// ImageOverride is how the repo-config says to pull and push one image, for mirrors
+// that need some images handled differently from the rest, e.g.
+//
+//	images:
+//	  Nginx:
+//	    platform: linux/arm64
+//	    digest: sha256:...
+//	    authRef: NGINX_MIRROR_AUTH
+type ImageOverride struct {
+	// Platform is the os/arch[/variant] to pull the image for. Pushes check the
+	// image to push is for it.
+	Platform string `yaml:"platform,omitempty"`
+	// Digest pins the image: it's pulled by digest and tagged as usual, and pushes
+	// check the image to push has it.
+	Digest string `yaml:"digest,omitempty"`
+	// AuthRef names the environment variable holding the credentials for the
+	// image's registry, as username:password or an access token, which docker logs
+	// in with before pulling or pushing it.
+	AuthRef string `yaml:"authRef,omitempty"`
+}
+
+// validate returns an error if any of the attributes is malformed
+func (o ImageOverride) validate() error {
+	if len(o.Platform) > 0 {
+		if err := validatePlatform(o.Platform); err != nil {
+			return err
+		}
+	}
+	if len(o.Digest) > 0 {
+		if parts := strings.SplitN(o.Digest, ":", 2); len(parts) != 2 || len(parts[0]) == 0 || len(parts[1]) == 0 {
+			return errors.Errorf("invalid digest %q, expected algorithm:hex such as sha256:...", o.Digest)
+		}
+	}
+	return nil
+}
+
+// WithImageOverrides returns a copy of images with the attributes the images section
+// of the repo-config sets for them, leaving their registries as they are, e.g. to
+// pull the upstream images as the mirrors they're pushed to need. Attributes of
+// images not among images are ignored.
+func WithImageOverrides(images map[string]Config, repoConfig string) (map[string]Config, error) {
+	contents, err := ReadRepoConfig(repoConfig)
+	if err != nil {
+		return nil, err
+	}
+	parsed, err := parseRepoConfig(contents)
+	if err != nil {
+		return nil, errors.Wrapf(err, "couldn't parse repo-config %v", repoConfig)
+	}
+
+	overridden := make(map[string]Config, len(images))
+	for key, img := range images {
+		if o, ok := parsed.Images[key]; ok {
+			if err := o.validate(); err != nil {
+				return nil, errors.Wrapf(err, "invalid %v.%v in repo-config %v", repoConfigImagesKey, key, repoConfig)
+			}
+			img.override = o
+		}
+		overridden[key] = img
+	}
+	return overridden, nil
+}
+
+// repoConfigFile is a repo-config: the registries by key and any images section
+type repoConfigFile struct {
+	Registries map[string]string        `yaml:",inline"`
+	Images     map[string]ImageOverride `yaml:"images,omitempty"`
+}
+
+// parseRepoConfig parses the contents of a repo-config
+func parseRepoConfig(contents []byte) (repoConfigFile, error) {
+	parsed := repoConfigFile{}
+	if err := yaml.Unmarshal(contents, &parsed); err != nil {
+		return repoConfigFile{}, err
+	}
+	if parsed.Registries == nil {
+		parsed.Registries = map[string]string{}
+	}
+	return parsed, nil
+}
+
+func sortedOverrideKeys(overrides map[string]ImageOverride) []string {
+	keys := make([]string, 0, len(overrides))
+	for key := range overrides {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// expandEnv expands the environment variables referenced by a repo-config
+func expandEnv(contents []byte, source string) ([]byte, error) {
+	undefined := []string{}
+	expanded := os.Expand(string(contents), func(name string) string {
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			undefined = append(undefined, name)
+		}
+		return value
+	})
+
+	if len(undefined) > 0 {
+		if RepoConfigStrictEnv {
+			return nil, errors.Errorf("repo-config %v references undefined environment variables: %v", source, strings.Join(undefined, ", "))
+		}
+		logrus.Warningf("repo-config %v references undefined environment variables, which were left empty: %v", source, strings.Join(undefined, ", "))
+	}
+	return []byte(expanded), nil
+}
+
+// EffectiveRepoConfig returns the repo-config the images of the Kubernetes version
+// are resolved with, as YAML setting every registry key: those the repo-config
+// (which may be empty) sets, and the defaults for the rest.
+func EffectiveRepoConfig(repoConfig, version string) ([]byte, error) {
+	reg, err := NewRegistryList(repoConfig, version)
+	if err != nil {
+		return nil, errors.Wrap(err, "couldn't init Registry List")
+	}
+
+	registries := map[string]string{}
+	for key, field := range reg.registryFields() {
+		registries[key] = field.String()
+	}
+	contents, err := yaml.Marshal(repoConfigFile{Registries: registries, Images: reg.ImageOverrides})
+	return contents, errors.Wrap(err, "couldn't encode repo-config")
+}
+
+// RepoConfigHosts returns the sorted registry hosts the registries of a repo-config's
+// contents are on, e.g. gcr.io for gcr.io/kubernetes-e2e-test-images.
+func RepoConfigHosts(contents []byte) ([]string, error) {
+	parsed, err := parseRepoConfig(contents)
+	if err != nil {
+		return nil, errors.Wrap(err, "couldn't parse repo-config as a YAML map of registries")
+	}
+	registries := parsed.Registries
+
+	seen := map[string]bool{}
+	hosts := []string{}
+	for key, reg := range registries {
+		ref, err := registry.ParseReference(reg + "/image")
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid registry %q for %v", reg, key)
+		}
+		if !seen[ref.Host] {
+			seen[ref.Host] = true
+			hosts = append(hosts, ref.Host)
+		}
+	}
+	sort.Strings(hosts)
+	return hosts, nil
+}
+
+// isLocalRepoConfig reports whether a repo-config source is a file path
+func isLocalRepoConfig(source string) bool {
+	return source != RepoConfigStdin && !isURL(source)
+}
+
+// IsRepoConfigMap reports whether a repo-config source names a ConfigMap
+func IsRepoConfigMap(source string) bool {
+	return strings.HasPrefix(source, RepoConfigMapScheme)
+}
+
+func isURL(source string) bool {
+	return strings.HasPrefix(source, "http://") || strings.HasPrefix(source, "https://")
+}
+
+func fetchRepoConfig(source string) ([]byte, error) {
+	switch {
+	case source == RepoConfigStdin:
+		contents, err := ioutil.ReadAll(repoConfigStdin)
+		return contents, errors.Wrap(err, "couldn't read repo-config from stdin")
+
+	case IsRepoConfigMap(source):
+		return readRepoConfigMap(source)
+
+	case isURL(source):
+		resp, err := repoConfigHTTPClient.Get(source)
+		if err != nil {
+			return nil, errors.Wrapf(err, "couldn't fetch repo-config %v", source)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return nil, errors.Errorf("couldn't fetch repo-config %v: unexpected status %v", source, resp.Status)
+		}
+		contents, err := ioutil.ReadAll(resp.Body)
+		return contents, errors.Wrapf(err, "couldn't fetch repo-config %v", source)
+
+	default:
+		contents, err := ioutil.ReadFile(source)
+		return contents, errors.Wrapf(err, "couldn't read repo-config %v", source)
+	}
+}
+
+// readRepoConfigMap returns the repo-config held by the ConfigMap named by source
+func readRepoConfigMap(source string) ([]byte, error) {
+	parts := strings.Split(strings.TrimPrefix(source, RepoConfigMapScheme), "/")
+	if len(parts) < 2 || len(parts) > 3 || parts[0] == "" || parts[1] == "" {
+		return nil, errors.Errorf("invalid repo-config %v, expected %vnamespace/name[/key]", source, RepoConfigMapScheme)
+	}
+	if RepoConfigMapClient == nil {
+		return nil, errors.Errorf("couldn't read repo-config %v: no cluster client", source)
+	}
+
+	cm, err := RepoConfigMapClient.ConfigMaps(parts[0]).Get(parts[1], metav1.GetOptions{})
+	if err != nil {
+		return nil, errors.Wrapf(err, "couldn't read repo-config %v", source)
+	}
+
+	if len(parts) == 3 {
+		contents, ok := cm.Data[parts[2]]
+		if !ok {
+			return nil, errors.Errorf("couldn't read repo-config %v: ConfigMap has no key %v", source, parts[2])
+		}
+		return []byte(contents), nil
+	}
+	if len(cm.Data) != 1 {
+		keys := []string{}
+		for k := range cm.Data {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		return nil, errors.Errorf("couldn't read repo-config %v: ConfigMap has keys %v, name the one to use as %v/key", source, keys, source)
+	}
+	for _, contents := range cm.Data {
+		return []byte(contents), nil
+	}
+	return nil, nil
+}
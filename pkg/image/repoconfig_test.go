@@ -0,0 +1,295 @@
+/*
+Copyright the Sonobuoy contributors 2019
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package image
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	corev1client "k8s.io/client-go/kubernetes/typed/core/v1"
+)
+
+const testRepoConfig = "dockerLibraryRegistry: private.io/library\n"
+
+func TestReadRepoConfig(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/repo-config.yaml":
+			fmt.Fprint(w, testRepoConfig)
+		case "/invalid.yaml":
+			fmt.Fprint(w, "- not\n- a map\n")
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	f, err := ioutil.TempFile("", "repo-config")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.WriteString(testRepoConfig); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	f.Close()
+
+	defer func(r io.Reader) { repoConfigStdin = r }(repoConfigStdin)
+	defer func(c map[string][]byte) { repoConfigs = c }(repoConfigs)
+
+	tests := map[string]struct {
+		source  string
+		stdin   string
+		want    string
+		wantErr bool
+	}{
+		"file": {
+			source: f.Name(),
+			want:   testRepoConfig,
+		},
+		"stdin": {
+			source: RepoConfigStdin,
+			stdin:  testRepoConfig,
+			want:   testRepoConfig,
+		},
+		"url": {
+			source: srv.URL + "/repo-config.yaml",
+			want:   testRepoConfig,
+		},
+		"url not found": {
+			source:  srv.URL + "/missing.yaml",
+			wantErr: true,
+		},
+		"invalid yaml": {
+			source:  srv.URL + "/invalid.yaml",
+			wantErr: true,
+		},
+		"missing file": {
+			source:  "does-not-exist.yaml",
+			wantErr: true,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			repoConfigs = map[string][]byte{}
+			repoConfigStdin = strings.NewReader(tc.stdin)
+
+			got, err := ReadRepoConfig(tc.source)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("Expected error %v but got %v", tc.wantErr, err)
+			}
+			if tc.want != "" && string(got) != tc.want {
+				t.Errorf("Expected %q but got %q", tc.want, string(got))
+			}
+
+			// Stdin and URLs are only read once, so they can be used by every step
+			if !tc.wantErr {
+				again, err := ReadRepoConfig(tc.source)
+				if err != nil || string(again) != string(got) {
+					t.Errorf("Expected the config to be read again from the cache, got %q, %v", string(again), err)
+				}
+			}
+		})
+	}
+}
+
+func TestNewRegistryListInvalidConfig(t *testing.T) {
+	if _, err := NewRegistryList("does-not-exist.yaml", "v1.14.0"); err == nil {
+		t.Error("Expected an error for a missing repo-config")
+	}
+}
+
+func TestRepoConfigHosts(t *testing.T) {
+	contents := "dockerLibraryRegistry: private.io/library\n" +
+		"e2eRegistry: private.io/e2e\n" +
+		"gcRegistry: localhost:5000/k8s\n" +
+		"sampleRegistry: samples\n"
+
+	got, err := RepoConfigHosts([]byte(contents))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []string{"docker.io", "localhost:5000", "private.io"}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("expected hosts %v, got %v", want, got)
+	}
+}
+
+func TestEffectiveRepoConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sonobuoy-repo-config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "repo-config.yaml")
+	if err := ioutil.WriteFile(path, []byte("e2eRegistry: private.io/e2e/\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := EffectiveRepoConfig(path, "v1.14.0")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := `dockerLibraryRegistry: docker.io/library
+e2eRegistry: private.io/e2e
+etcdRegistry: quay.io/coreos
+gcRegistry: k8s.gcr.io
+privateRegistry: gcr.io/k8s-authenticated-test
+sampleRegistry: gcr.io/google-samples
+sonobuoyRegistry: gcr.io/heptio-images
+`
+	if string(got) != want {
+		t.Errorf("Expected repo-config:\n%s\nbut got:\n%s", want, got)
+	}
+}
+
+// fakeConfigMaps serves ConfigMaps keyed by namespace/name
+type fakeConfigMaps map[string]map[string]string
+
+func (f fakeConfigMaps) ConfigMaps(namespace string) corev1client.ConfigMapInterface {
+	return fakeConfigMapClient{configMaps: f, namespace: namespace}
+}
+
+type fakeConfigMapClient struct {
+	corev1client.ConfigMapInterface
+	configMaps fakeConfigMaps
+	namespace  string
+}
+
+func (f fakeConfigMapClient) Get(name string, options metav1.GetOptions) (*corev1.ConfigMap, error) {
+	data, ok := f.configMaps[f.namespace+"/"+name]
+	if !ok {
+		return nil, errors.Errorf("configmap %v not found", name)
+	}
+	return &corev1.ConfigMap{Data: data}, nil
+}
+
+func TestReadRepoConfigMap(t *testing.T) {
+	defer func(c corev1client.ConfigMapsGetter) { RepoConfigMapClient = c }(RepoConfigMapClient)
+	defer func(c map[string][]byte) { repoConfigs = c }(repoConfigs)
+
+	RepoConfigMapClient = fakeConfigMaps{
+		"mirror/repos": {"repo-list.yaml": testRepoConfig},
+		"mirror/many":  {"a.yaml": testRepoConfig, "b.yaml": "e2eRegistry: other.io/e2e\n"},
+	}
+
+	tests := map[string]struct {
+		source  string
+		want    string
+		wantErr bool
+	}{
+		"single key": {
+			source: "configmap://mirror/repos",
+			want:   testRepoConfig,
+		},
+		"named key": {
+			source: "configmap://mirror/many/b.yaml",
+			want:   "e2eRegistry: other.io/e2e\n",
+		},
+		"several keys": {
+			source:  "configmap://mirror/many",
+			wantErr: true,
+		},
+		"missing key": {
+			source:  "configmap://mirror/repos/other.yaml",
+			wantErr: true,
+		},
+		"missing configmap": {
+			source:  "configmap://mirror/missing",
+			wantErr: true,
+		},
+		"no name": {
+			source:  "configmap://mirror",
+			wantErr: true,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			repoConfigs = map[string][]byte{}
+
+			got, err := ReadRepoConfig(tc.source)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("Expected error %v but got %v", tc.wantErr, err)
+			}
+			if string(got) != tc.want {
+				t.Errorf("Expected %q but got %q", tc.want, string(got))
+			}
+		})
+	}
+}
+
+func TestReadRepoConfigExpandsEnv(t *testing.T) {
+	defer func(strict bool) { RepoConfigStrictEnv = strict }(RepoConfigStrictEnv)
+	defer func(r io.Reader) { repoConfigStdin = r }(repoConfigStdin)
+	defer func(c map[string][]byte) { repoConfigs = c }(repoConfigs)
+	os.Setenv("SONOBUOY_TEST_REGISTRY", "internal.io")
+	defer os.Unsetenv("SONOBUOY_TEST_REGISTRY")
+
+	tests := map[string]struct {
+		config  string
+		strict  bool
+		want    string
+		wantErr bool
+	}{
+		"braced and bare references": {
+			config: "e2eRegistry: ${SONOBUOY_TEST_REGISTRY}/e2e\ngcRegistry: $SONOBUOY_TEST_REGISTRY/k8s\n",
+			want:   "e2eRegistry: internal.io/e2e\ngcRegistry: internal.io/k8s\n",
+		},
+		"undefined left empty": {
+			config: "e2eRegistry: ${SONOBUOY_TEST_UNDEFINED}private.io/e2e\n",
+			want:   "e2eRegistry: private.io/e2e\n",
+		},
+		"undefined in strict mode": {
+			config:  "e2eRegistry: ${SONOBUOY_TEST_UNDEFINED}/e2e\n",
+			strict:  true,
+			wantErr: true,
+		},
+		"defined in strict mode": {
+			config: "e2eRegistry: ${SONOBUOY_TEST_REGISTRY}/e2e\n",
+			strict: true,
+			want:   "e2eRegistry: internal.io/e2e\n",
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			repoConfigs = map[string][]byte{}
+			repoConfigStdin = strings.NewReader(tc.config)
+			RepoConfigStrictEnv = tc.strict
+
+			got, err := ReadRepoConfig(RepoConfigStdin)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("Expected error %v but got %v", tc.wantErr, err)
+			}
+			if string(got) != tc.want {
+				t.Errorf("Expected %q but got %q", tc.want, string(got))
+			}
+		})
+	}
+}
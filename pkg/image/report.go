@@ -0,0 +1,110 @@
+/*
+Copyright the Sonobuoy contributors 2019
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package image
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/c2h5oh/datasize"
+)
+
+// Report accumulates the outcome of an images operation from the progress events
+// of its ImageClients, along with the bytes of image files the command wrote,
+// so that every command closes with the same summary.
+type Report struct {
+	mu        sync.Mutex
+	now       func() time.Time
+	start     time.Time
+	succeeded int
+	skipped   int
+	failed    []string
+	bytes     int64
+}
+
+// ReportSummary is the closing summary of an images operation
+type ReportSummary struct {
+	Total     int `json:"total"`
+	Succeeded int `json:"succeeded"`
+	Failed    int `json:"failed"`
+	// FailedImages are the images that failed, in the order they completed
+	FailedImages []string `json:"failedImages,omitempty"`
+	Skipped      int      `json:"skipped"`
+	Bytes        int64    `json:"bytes"`
+	Elapsed      string   `json:"elapsed"`
+}
+
+// NewReport returns an empty Report, timing the operation from now
+func NewReport() *Report {
+	return &Report{now: time.Now, start: time.Now(), failed: []string{}}
+}
+
+// Record is a ProgressFunc counting the operations it is told have completed
+func (r *Report) Record(p ImageProgress) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	switch p.Status {
+	case ProgressDone:
+		r.succeeded++
+	case ProgressSkipped:
+		r.skipped++
+	case ProgressFailed:
+		r.failed = append(r.failed, p.Name)
+	}
+}
+
+// AddBytes adds n to the bytes of image files the operation wrote
+func (r *Report) AddBytes(n int64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.bytes += n
+}
+
+// Empty reports whether nothing has been recorded, as for commands that don't
+// operate on images
+func (r *Report) Empty() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.succeeded+r.skipped+len(r.failed) == 0 && r.bytes == 0
+}
+
+// Summary returns the summary of what has been recorded so far
+func (r *Report) Summary() ReportSummary {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return ReportSummary{
+		Total:        r.succeeded + r.skipped + len(r.failed),
+		Succeeded:    r.succeeded,
+		Failed:       len(r.failed),
+		FailedImages: append([]string{}, r.failed...),
+		Skipped:      r.skipped,
+		Bytes:        r.bytes,
+		Elapsed:      roundElapsed(r.now().Sub(r.start)).String(),
+	}
+}
+
+// Write writes the summary to w as text, followed by a line for each failed image
+func (s ReportSummary) Write(w io.Writer) {
+	fmt.Fprintf(w, "Summary: %d images, %d succeeded, %d failed, %d skipped, %v written in %v\n",
+		s.Total, s.Succeeded, s.Failed, s.Skipped, datasize.ByteSize(s.Bytes).HumanReadable(), s.Elapsed)
+	if len(s.FailedImages) > 0 {
+		fmt.Fprintf(w, "Failed: %v\n", strings.Join(s.FailedImages, ", "))
+	}
+}
@@ -0,0 +1,70 @@
+/*
+Copyright the Sonobuoy contributors 2019
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package image
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+func TestReport(t *testing.T) {
+	start := time.Unix(1500000000, 0)
+	r := NewReport()
+	r.start = start
+	r.now = func() time.Time { return start.Add(61*time.Second + 240*time.Millisecond) }
+
+	if !r.Empty() {
+		t.Fatal("Expected a new report to be empty")
+	}
+
+	events := []ImageProgress{
+		{Name: "a:1.0", Operation: OperationPull, Status: ProgressStarted},
+		{Name: "a:1.0", Operation: OperationPull, Status: ProgressDone},
+		{Name: "b:1.0", Operation: OperationPull, Status: ProgressSkipped},
+		{Name: "c:1.0", Operation: OperationPull, Status: ProgressFailed, Err: errors.New("not found")},
+		{Name: "d:1.0", Operation: OperationPull, Status: ProgressDone},
+	}
+	for _, e := range events {
+		r.Record(e)
+	}
+	r.AddBytes(1536)
+
+	want := ReportSummary{
+		Total:        4,
+		Succeeded:    2,
+		Failed:       1,
+		FailedImages: []string{"c:1.0"},
+		Skipped:      1,
+		Bytes:        1536,
+		Elapsed:      "1m1.2s",
+	}
+	got := r.Summary()
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("Expected summary %+v but got %+v", want, got)
+	}
+
+	var buf bytes.Buffer
+	got.Write(&buf)
+	wantText := "Summary: 4 images, 2 succeeded, 1 failed, 1 skipped, 1.5 KB written in 1m1.2s\nFailed: c:1.0\n"
+	if buf.String() != wantText {
+		t.Errorf("Expected %q but got %q", wantText, buf.String())
+	}
+}
@@ -0,0 +1,200 @@
+/*
+Copyright the Sonobuoy contributors 2019
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package image
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/heptio/sonobuoy/pkg/image/exec"
+	"github.com/heptio/sonobuoy/pkg/image/registry"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// RepoCreator creates repositories in a type of registry which rejects pushes to
+// repositories that don't exist yet.
+type RepoCreator interface {
+	// Supports reports whether the registry at host is of the type the creator handles
+	Supports(host string) bool
+	// Create creates the repository in the registry at host, doing nothing if it
+	// already exists
+	Create(host, repository string) error
+}
+
+// WithRepoCreators returns a copy of the client which, before pushing, creates the
+// repository of each destination image using the first of creators that supports
+// its registry. Registries no creator supports are pushed to as is, with a warning.
+func (i ImageClient) WithRepoCreators(creators ...RepoCreator) ImageClient {
+	i.repoCreators = creators
+	return i
+}
+
+// createRepositories creates the repositories of images, if the client has any
+// RepoCreators. Each image whose repository couldn't be created is returned with
+// the reason, so that it isn't pushed.
+func (i ImageClient) createRepositories(images []string) map[string]error {
+	errs := map[string]error{}
+	if len(i.repoCreators) == 0 {
+		return errs
+	}
+
+	creators := map[string]RepoCreator{}
+	created := map[string]error{}
+	for _, img := range images {
+		ref, err := registry.ParseReference(img)
+		if err != nil {
+			errs[img] = errors.Wrapf(err, "couldn't parse destination image %v", img)
+			continue
+		}
+
+		creator, checked := creators[ref.Host]
+		if !checked {
+			creator = i.repoCreatorFor(ref.Host)
+			creators[ref.Host] = creator
+			if creator == nil {
+				log.Warnf("Can't create repositories in registry %v, which isn't of a supported type; pushing to it without creating them", ref.Host)
+			}
+		}
+		if creator == nil {
+			continue
+		}
+
+		name := ref.Name()
+		err, done := created[name]
+		if !done {
+			log.Infof("Creating repository: %s ...", name)
+			err = creator.Create(ref.Host, ref.Repository)
+			created[name] = err
+		}
+		if err != nil {
+			errs[img] = errors.Wrapf(err, "couldn't create repository %v", name)
+		}
+	}
+	return errs
+}
+
+// repoCreatorFor returns the first of the client's RepoCreators supporting the
+// registry at host, or nil if none do.
+func (i ImageClient) repoCreatorFor(host string) RepoCreator {
+	for _, c := range i.repoCreators {
+		if c.Supports(host) {
+			return c
+		}
+	}
+	return nil
+}
+
+// ecrHostRegexp matches the hosts of Amazon ECR registries, capturing the account and region
+var ecrHostRegexp = regexp.MustCompile(`^(\d{12})\.dkr\.ecr(?:-fips)?\.([a-z0-9-]+)\.amazonaws\.com(?:\.cn)?$`)
+
+// ECRRepoCreator creates repositories in Amazon ECR by running the aws CLI, which
+// must be installed and configured with credentials for the registry's account.
+type ECRRepoCreator struct {
+	// Cmder creates the aws commands to run. If nil, exec.DefaultCmder is used.
+	Cmder exec.Cmder
+}
+
+// Supports reports whether host is an ECR registry
+func (c ECRRepoCreator) Supports(host string) bool {
+	return ecrHostRegexp.MatchString(host)
+}
+
+// Create runs aws ecr create-repository for the repository
+func (c ECRRepoCreator) Create(host, repository string) error {
+	cmder := c.Cmder
+	if cmder == nil {
+		cmder = exec.DefaultCmder
+	}
+
+	m := ecrHostRegexp.FindStringSubmatch(host)
+	if m == nil {
+		return errors.Errorf("%v isn't an ECR registry", host)
+	}
+	cmd := cmder.Command("aws", "ecr", "create-repository",
+		"--registry-id", m[1], "--region", m[2], "--repository-name", repository)
+	_, err := exec.Output(cmd)
+	if err != nil && strings.Contains(err.Error(), "RepositoryAlreadyExistsException") {
+		return nil
+	}
+	return err
+}
+
+// harborSystemInfo is the part of Harbor's system info used to recognize it
+type harborSystemInfo struct {
+	HarborVersion string `json:"harbor_version"`
+}
+
+// HarborRepoCreator creates the projects of repositories in Harbor, which creates
+// repositories on push but only within existing projects. Its API is authenticated
+// with the credentials for the registry in the docker config.
+type HarborRepoCreator struct {
+	Client *registry.Client
+}
+
+// Supports reports whether host serves Harbor's API
+func (c HarborRepoCreator) Supports(host string) bool {
+	resp, err := c.Client.HTTPClient.Get(fmt.Sprintf("https://%s/api/v2.0/systeminfo", host))
+	if err != nil {
+		return false
+	}
+	defer resp.Body.Close()
+
+	var info harborSystemInfo
+	if resp.StatusCode != http.StatusOK || json.NewDecoder(resp.Body).Decode(&info) != nil {
+		return false
+	}
+	return len(info.HarborVersion) > 0
+}
+
+// Create creates the project the repository is in, which is the first component of
+// its path, if it doesn't already exist.
+func (c HarborRepoCreator) Create(host, repository string) error {
+	project := strings.SplitN(repository, "/", 2)[0]
+	body, err := json.Marshal(map[string]string{"project_name": project})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, fmt.Sprintf("https://%s/api/v2.0/projects", host), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if creds, ok := c.Client.Credentials.Get(host); ok {
+		req.SetBasicAuth(creds.Username, creds.Password)
+	}
+
+	resp, err := c.Client.HTTPClient.Do(req)
+	if err != nil {
+		return errors.Wrapf(err, "couldn't create project %v", project)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusCreated, http.StatusConflict:
+		return nil
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return errors.Errorf("couldn't create project %v: registry %v rejected the credentials; run 'docker login %v'", project, host, host)
+	default:
+		return errors.Errorf("couldn't create project %v: unexpected status %v", project, resp.Status)
+	}
+}
@@ -0,0 +1,213 @@
+/*
+Copyright the Sonobuoy contributors 2019
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package image
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/heptio/sonobuoy/pkg/image/exec"
+	"github.com/heptio/sonobuoy/pkg/image/registry"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// fakeRepoCreator records the repositories it creates in the registries it supports
+type fakeRepoCreator struct {
+	host    string
+	failing map[string]bool
+	created *[]string
+}
+
+func (f fakeRepoCreator) Supports(host string) bool {
+	return host == f.host
+}
+
+func (f fakeRepoCreator) Create(host, repository string) error {
+	*f.created = append(*f.created, host+"/"+repository)
+	if f.failing[repository] {
+		return errors.New("permission denied")
+	}
+	return nil
+}
+
+func TestPushImagesCreatesRepos(t *testing.T) {
+	logrus.SetOutput(ioutil.Discard)
+
+	upstream := map[string]Config{
+		"A": {name: "a", registry: "docker.io/library", version: "1.0"},
+		"B": {name: "b", registry: "docker.io/library", version: "1.0"},
+		"C": {name: "c", registry: "docker.io/library", version: "1.0"},
+	}
+	private := map[string]Config{
+		"A": {name: "a", registry: "harbor.corp/e2e", version: "1.0"},
+		"B": {name: "b", registry: "harbor.corp/e2e", version: "1.0"},
+		"C": {name: "c", registry: "other.corp/e2e", version: "1.0"},
+	}
+
+	created := []string{}
+	creator := fakeRepoCreator{host: "harbor.corp", failing: map[string]bool{"e2e/b": true}, created: &created}
+	imgClient := ImageClient{dockerClient: FakeDockerClient{}}.WithRepoCreators(creator)
+
+	pushed, errs := imgClient.PushImages(upstream, private, []string{"stable"}, 0)
+	if len(errs) != 2 || !strings.Contains(errs[0].Error(), "couldn't create repository harbor.corp/e2e/b") {
+		t.Fatalf("Expected an error for each push to the repository that couldn't be created but got %v", errs)
+	}
+
+	wantCreated := []string{"harbor.corp/e2e/a", "harbor.corp/e2e/b"}
+	if !reflect.DeepEqual(created, wantCreated) {
+		t.Errorf("Expected created repositories %v but got %v", wantCreated, created)
+	}
+	pushes := []string{}
+	for _, r := range pushed {
+		pushes = append(pushes, r.Image)
+	}
+	wantPushes := []string{"harbor.corp/e2e/a:1.0", "harbor.corp/e2e/a:stable", "other.corp/e2e/c:1.0", "other.corp/e2e/c:stable"}
+	if !reflect.DeepEqual(pushes, wantPushes) {
+		t.Errorf("Expected pushes %v but got %v", wantPushes, pushes)
+	}
+}
+
+// fakeAWS runs aws commands by recording them and failing with stderr, if set
+type fakeAWS struct {
+	runs   [][]string
+	stderr string
+}
+
+func (f *fakeAWS) Command(name string, args ...string) exec.Cmd {
+	return &fakeAWSCmd{aws: f, args: append([]string{name}, args...)}
+}
+
+type fakeAWSCmd struct {
+	aws    *fakeAWS
+	args   []string
+	stderr io.Writer
+}
+
+func (c *fakeAWSCmd) Run() error {
+	c.aws.runs = append(c.aws.runs, c.args)
+	if len(c.aws.stderr) > 0 {
+		io.WriteString(c.stderr, c.aws.stderr)
+		return errors.New("exit status 254")
+	}
+	return nil
+}
+
+func (c *fakeAWSCmd) SetEnv(...string) exec.Cmd      { return c }
+func (c *fakeAWSCmd) SetStdin(io.Reader) exec.Cmd    { return c }
+func (c *fakeAWSCmd) SetStdout(io.Writer) exec.Cmd   { return c }
+func (c *fakeAWSCmd) SetStderr(w io.Writer) exec.Cmd { c.stderr = w; return c }
+
+func TestECRRepoCreator(t *testing.T) {
+	for host, want := range map[string]bool{
+		"123456789012.dkr.ecr.us-west-2.amazonaws.com":      true,
+		"123456789012.dkr.ecr-fips.us-east-1.amazonaws.com": true,
+		"123456789012.dkr.ecr.cn-north-1.amazonaws.com.cn":  true,
+		"dkr.ecr.us-west-2.amazonaws.com":                   false,
+		"harbor.corp":                                       false,
+	} {
+		if got := (ECRRepoCreator{}).Supports(host); got != want {
+			t.Errorf("Expected Supports(%v) to be %v", host, want)
+		}
+	}
+
+	tests := map[string]struct {
+		stderr  string
+		wantErr bool
+	}{
+		"created":        {},
+		"already exists": {stderr: "An error occurred (RepositoryAlreadyExistsException) when calling the CreateRepository operation"},
+		"fails":          {stderr: "An error occurred (AccessDeniedException) when calling the CreateRepository operation", wantErr: true},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			aws := &fakeAWS{stderr: tc.stderr}
+			err := ECRRepoCreator{Cmder: aws}.Create("123456789012.dkr.ecr.us-west-2.amazonaws.com", "e2e/agnhost")
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("Expected error %v but got %v", tc.wantErr, err)
+			}
+
+			want := [][]string{{"aws", "ecr", "create-repository", "--registry-id", "123456789012", "--region", "us-west-2", "--repository-name", "e2e/agnhost"}}
+			if !reflect.DeepEqual(aws.runs, want) {
+				t.Errorf("Expected commands %v but got %v", want, aws.runs)
+			}
+		})
+	}
+}
+
+func TestHarborRepoCreator(t *testing.T) {
+	projects := map[string]bool{"existing": true}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v2.0/systeminfo", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"harbor_version": "v2.1.0"}`)
+	})
+	mux.HandleFunc("/api/v2.0/projects", func(w http.ResponseWriter, r *http.Request) {
+		if user, pass, ok := r.BasicAuth(); !ok || user != "admin" || pass != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		var body map[string]string
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if projects[body["project_name"]] {
+			w.WriteHeader(http.StatusConflict)
+			return
+		}
+		projects[body["project_name"]] = true
+		w.WriteHeader(http.StatusCreated)
+	})
+	srv := httptest.NewTLSServer(mux)
+	defer srv.Close()
+	host := srv.Listener.Addr().String()
+
+	creator := HarborRepoCreator{Client: &registry.Client{
+		HTTPClient:  srv.Client(),
+		Credentials: registry.CredentialStore{host: {Username: "admin", Password: "secret"}},
+	}}
+	if !creator.Supports(host) {
+		t.Fatal("Expected Harbor to be supported")
+	}
+	for _, repository := range []string{"e2e/agnhost", "existing/nginx"} {
+		if err := creator.Create(host, repository); err != nil {
+			t.Errorf("Unexpected error creating %v: %v", repository, err)
+		}
+	}
+	if !projects["e2e"] {
+		t.Error("Expected project e2e to be created")
+	}
+
+	anonymous := HarborRepoCreator{Client: &registry.Client{HTTPClient: srv.Client()}}
+	if err := anonymous.Create(host, "other/nginx"); err == nil || !strings.Contains(err.Error(), "rejected the credentials") {
+		t.Errorf("Expected credentials to be rejected but got %v", err)
+	}
+
+	plain := httptest.NewTLSServer(http.NotFoundHandler())
+	defer plain.Close()
+	if (HarborRepoCreator{Client: &registry.Client{HTTPClient: plain.Client()}}).Supports(plain.Listener.Addr().String()) {
+		t.Error("Expected a registry without Harbor's API not to be supported")
+	}
+}
@@ -0,0 +1,131 @@
+/*
+Copyright the Sonobuoy contributors 2019
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package image
+
+import (
+	"archive/tar"
+	"io"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// reproducibleModTime is the modification time of every entry in a reproducible tar
+var reproducibleModTime = time.Unix(0, 0)
+
+// WithReproducible returns a copy of the client which repacks each saved tar so
+// that the same images always produce a byte-identical file: entries are sorted by
+// name and their timestamps and ownership are cleared. Repacking needs room for a
+// second copy of the tar while it runs, and can't be combined with WithPipeThrough.
+func (i ImageClient) WithReproducible() ImageClient {
+	i.reproducible = true
+	return i
+}
+
+// tarEntry is an entry of a tar being repacked, along with where its contents start
+type tarEntry struct {
+	header *tar.Header
+	offset int64
+}
+
+// countingReader counts the bytes read through it
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// repackTar rewrites the tar at path deterministically. The contents of each
+// entry are copied unchanged, so the images' layers and digests are unaffected.
+func repackTar(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return errors.Wrap(err, "couldn't open tar")
+	}
+	defer f.Close()
+
+	entries, err := readTarEntries(f)
+	if err != nil {
+		return errors.Wrapf(err, "couldn't read tar %v", path)
+	}
+	sort.Slice(entries, func(a, b int) bool { return entries[a].header.Name < entries[b].header.Name })
+
+	tmpPath := path + ".repack"
+	out, err := os.Create(tmpPath)
+	if err != nil {
+		return errors.Wrap(err, "couldn't create repacked tar")
+	}
+	err = writeTarEntries(out, f, entries)
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+		return errors.Wrapf(err, "couldn't repack tar %v", path)
+	}
+	return errors.Wrap(os.Rename(tmpPath, path), "couldn't move repacked tar into place")
+}
+
+// readTarEntries returns the entries of the tar read from r. The contents of an
+// entry aren't read until the next header is, so the bytes consumed once a header
+// has been read are the offset of its contents.
+func readTarEntries(r io.Reader) ([]tarEntry, error) {
+	cr := &countingReader{r: r}
+	tr := tar.NewReader(cr)
+	entries := []tarEntry{}
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return entries, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, tarEntry{header: hdr, offset: cr.n})
+	}
+}
+
+// writeTarEntries writes entries to w with normalized headers, copying the contents
+// of each from src.
+func writeTarEntries(w io.Writer, src io.ReaderAt, entries []tarEntry) error {
+	tw := tar.NewWriter(w)
+	for _, e := range entries {
+		hdr := &tar.Header{
+			Typeflag: e.header.Typeflag,
+			Name:     e.header.Name,
+			Linkname: e.header.Linkname,
+			Size:     e.header.Size,
+			Mode:     e.header.Mode,
+			ModTime:  reproducibleModTime,
+			Format:   tar.FormatPAX,
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if _, err := io.Copy(tw, io.NewSectionReader(src, e.offset, e.header.Size)); err != nil {
+			return err
+		}
+	}
+	return tw.Close()
+}
@@ -0,0 +1,123 @@
+/*
+Copyright the Sonobuoy contributors 2019
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package image
+
+import (
+	"archive/tar"
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type testTarEntry struct {
+	name     string
+	contents string
+}
+
+// writeOrderedTar writes a tar at path with the entries in order, all modified at modTime
+func writeOrderedTar(t *testing.T, path string, entries []testTarEntry, modTime time.Time) {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, e := range entries {
+		hdr := &tar.Header{Name: e.name, Mode: 0644, Size: int64(len(e.contents)), ModTime: modTime, Uid: 1000, Uname: "builder"}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(e.contents)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRepackTar(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sonobuoy-reproducible")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	entries := []testTarEntry{
+		{"manifest.json", `[{"Config":"abc.json"}]`},
+		{"abc.json", `{"architecture":"amd64"}`},
+		{"l1/layer.tar", "layer one"},
+		{"l1/VERSION", "1.0"},
+	}
+	reordered := []testTarEntry{entries[2], entries[0], entries[3], entries[1]}
+
+	first := filepath.Join(dir, "first.tar")
+	second := filepath.Join(dir, "second.tar")
+	writeOrderedTar(t, first, entries, time.Unix(1500000000, 0))
+	writeOrderedTar(t, second, reordered, time.Unix(1600000000, 0))
+
+	for _, path := range []string{first, second} {
+		if err := repackTar(path); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	a, err := ioutil.ReadFile(first)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := ioutil.ReadFile(second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(a, b) {
+		t.Error("Expected repacked tars to be identical")
+	}
+
+	got := []testTarEntry{}
+	tr := tar.NewReader(bytes.NewReader(a))
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !hdr.ModTime.Equal(reproducibleModTime) || hdr.Uid != 0 || hdr.Uname != "" {
+			t.Errorf("Expected normalized header for %v but got mtime %v, uid %v, uname %q", hdr.Name, hdr.ModTime, hdr.Uid, hdr.Uname)
+		}
+		contents, err := ioutil.ReadAll(tr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, testTarEntry{hdr.Name, string(contents)})
+	}
+
+	want := []testTarEntry{entries[1], entries[3], entries[2], entries[0]}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected entries %v but got %v", want, got)
+	}
+
+	if err := repackTar(filepath.Join(dir, "missing.tar")); err == nil {
+		t.Error("Expected error for missing tar but got nil")
+	}
+}
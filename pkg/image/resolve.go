@@ -0,0 +1,161 @@
+/*
+Copyright the Sonobuoy contributors 2019
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package image
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// ImageMapping describes where an image comes from and where a repo-config sends it
+type ImageMapping struct {
+	// Name is the image's name in the Kubernetes e2e image list, e.g. Nginx
+	Name string
+	// RegistryKey is the repo-config key of the image's registry, e.g. dockerLibraryRegistry
+	RegistryKey string
+	// Upstream is the upstream image reference
+	Upstream string
+	// Private is the image reference once the repo-config is applied
+	Private string
+}
+
+// ResolveMappings returns the mapping of each image for the Kubernetes version
+// from upstream to the registries in e2eRegistryConfig, sorted by name. Nothing
+// but the repo-config file is read.
+func ResolveMappings(e2eRegistryConfig, version string) ([]ImageMapping, error) {
+	upstreamImages, err := GetImages("", version)
+	if err != nil {
+		return nil, err
+	}
+	privateImages, err := GetImages(e2eRegistryConfig, version)
+	if err != nil {
+		return nil, err
+	}
+	keys, err := registryKeyConfigs(version)
+	if err != nil {
+		return nil, errors.Wrap(err, "couldn't get registry keys for version")
+	}
+
+	mappings := []ImageMapping{}
+	for _, k := range sortedKeys(upstreamImages) {
+		upstreamImg, privateImg := upstreamImages[k], privateImages[k]
+		mappings = append(mappings, ImageMapping{
+			Name:        k,
+			RegistryKey: keys[k].registry,
+			Upstream:    upstreamImg.GetE2EImage(),
+			Private:     privateImg.GetE2EImage(),
+		})
+	}
+	return mappings, nil
+}
+
+// Option configures how ResolveImages resolves the images for a Kubernetes version
+type Option func(*resolveOptions)
+
+type resolveOptions struct {
+	registries map[string]string
+	os         string
+	platform   string
+}
+
+// WithRegistries overrides the registries images are resolved to, keyed by their
+// repo-config keys (e.g. e2eRegistry), as a repo-config file would.
+func WithRegistries(registries map[string]string) Option {
+	return func(o *resolveOptions) {
+		o.registries = registries
+	}
+}
+
+// WithOS resolves the images for the nodes of an OS, OSLinux or OSWindows. Without
+// it (or WithPlatform) the Linux images are resolved.
+func WithOS(os string) Option {
+	return func(o *resolveOptions) {
+		o.os = os
+	}
+}
+
+// WithPlatform resolves the images for a platform, given as os/arch[/variant]. Its
+// OS selects the variants of the images, as WithOS does; the e2e images are
+// manifest lists, so they're referenced the same way on every architecture.
+func WithPlatform(platform string) Option {
+	return func(o *resolveOptions) {
+		o.platform = platform
+	}
+}
+
+// ResolveImages returns the images the e2e tests of the Kubernetes version need,
+// sorted by their name in the e2e image list. Unlike GetImages it's configured
+// entirely by opts; no repo-config or other file is read, and TargetOS is ignored.
+func ResolveImages(version string, opts ...Option) ([]Config, error) {
+	o := resolveOptions{os: OSLinux}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	targetOS := o.os
+	if len(o.platform) > 0 {
+		if err := validatePlatform(o.platform); err != nil {
+			return nil, err
+		}
+		targetOS = strings.Split(o.platform, "/")[0]
+	}
+
+	reg, err := newRegistryList("", version, targetOS)
+	if err != nil {
+		return nil, errors.Wrap(err, "couldn't init Registry List")
+	}
+	if err := reg.overrideRegistries(o.registries); err != nil {
+		return nil, err
+	}
+
+	imgs, err := reg.GetImageConfigs()
+	if err != nil {
+		return nil, errors.Wrap(err, "couldn't get images for version")
+	}
+	if err := checkImagesFound(imgs, version); err != nil {
+		return nil, err
+	}
+
+	configs := make([]Config, 0, len(imgs))
+	for _, k := range sortedKeys(imgs) {
+		configs = append(configs, imgs[k])
+	}
+	return configs, nil
+}
+
+// overrideRegistries sets the registries keyed by their repo-config keys, as
+// unmarshalling a repo-config does. Unknown keys are an error.
+func (r *RegistryList) overrideRegistries(registries map[string]string) error {
+	fields := r.registryFields()
+	keys := make([]string, 0, len(registries))
+	for key := range registries {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		field, ok := fields[key]
+		if !ok {
+			return errors.Errorf("unknown registry key %q", key)
+		}
+		if len(strings.TrimSpace(registries[key])) > 0 {
+			field.SetString(registries[key])
+		}
+	}
+	r.trimRegistries()
+	return nil
+}
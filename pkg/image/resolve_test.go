@@ -0,0 +1,178 @@
+/*
+Copyright the Sonobuoy contributors 2019
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package image
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestResolveMappings(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sonobuoy-repo-config")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "repo-config.yaml")
+	if err := ioutil.WriteFile(path, []byte("dockerLibraryRegistry: private.io/library\n"), 0644); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	mappings, err := ResolveMappings(path, "v1.14.0")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	found := map[string]ImageMapping{}
+	for n, m := range mappings {
+		if n > 0 && mappings[n-1].Name >= m.Name {
+			t.Errorf("Expected mappings sorted by name, got %v before %v", mappings[n-1].Name, m.Name)
+		}
+		found[m.Name] = m
+	}
+
+	want := map[string]ImageMapping{
+		"Nginx": {
+			Name:        "Nginx",
+			RegistryKey: "dockerLibraryRegistry",
+			Upstream:    "docker.io/library/nginx:1.14-alpine",
+			Private:     "private.io/library/nginx:1.14-alpine",
+		},
+		"Pause": {
+			Name:        "Pause",
+			RegistryKey: "gcRegistry",
+			Upstream:    "k8s.gcr.io/pause:3.1",
+			Private:     "k8s.gcr.io/pause:3.1",
+		},
+	}
+	for name, w := range want {
+		if found[name] != w {
+			t.Errorf("Expected mapping %+v but got %+v", w, found[name])
+		}
+	}
+}
+
+func TestResolveImages(t *testing.T) {
+	tests := map[string]struct {
+		opts    []Option
+		image   string
+		want    string
+		wantErr bool
+	}{
+		"defaults": {
+			image: "Nginx",
+			want:  "docker.io/library/nginx:1.14-alpine",
+		},
+		"registry override": {
+			opts:  []Option{WithRegistries(map[string]string{"dockerLibraryRegistry": "private.io/library/"})},
+			image: "Nginx",
+			want:  "private.io/library/nginx:1.14-alpine",
+		},
+		"empty override keeps default": {
+			opts:  []Option{WithRegistries(map[string]string{"gcRegistry": ""})},
+			image: "Pause",
+			want:  "k8s.gcr.io/pause:3.1",
+		},
+		"platform": {
+			opts:  []Option{WithPlatform("linux/arm64")},
+			image: "Nginx",
+			want:  "docker.io/library/nginx:1.14-alpine",
+		},
+		"windows platform": {
+			opts:  []Option{WithPlatform("windows/amd64")},
+			image: "Nginx",
+			want:  "docker.io/e2eteam/nginx:1.14-alpine",
+		},
+		"windows os": {
+			opts:  []Option{WithOS(OSWindows)},
+			image: "Nginx",
+			want:  "docker.io/e2eteam/nginx:1.14-alpine",
+		},
+		"platform os wins": {
+			opts:  []Option{WithOS(OSWindows), WithPlatform("linux/amd64")},
+			image: "Nginx",
+			want:  "docker.io/library/nginx:1.14-alpine",
+		},
+		"unknown os": {
+			opts:    []Option{WithOS("plan9")},
+			wantErr: true,
+		},
+		"unknown registry key": {
+			opts:    []Option{WithRegistries(map[string]string{"quayRegistry": "private.io"})},
+			wantErr: true,
+		},
+		"invalid platform": {
+			opts:    []Option{WithPlatform("arm64")},
+			wantErr: true,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			images, err := ResolveImages("v1.14.0", tc.opts...)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("expected error %v, got %v", tc.wantErr, err)
+			}
+			if tc.wantErr {
+				return
+			}
+
+			reg, err := NewRegistryList("", "v1.14.0")
+			if err != nil {
+				t.Fatal(err)
+			}
+			all, err := reg.GetImageConfigs()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(images) != len(all) {
+				t.Errorf("Expected %d images but got %d", len(all), len(images))
+			}
+
+			for n, key := range sortedKeys(all) {
+				if key != tc.image {
+					continue
+				}
+				if got := images[n].GetE2EImage(); got != tc.want {
+					t.Errorf("Expected image %v but got %v", tc.want, got)
+				}
+			}
+		})
+	}
+}
+
+func TestResolveImagesIgnoresTargetOS(t *testing.T) {
+	defer func(targetOS string) { TargetOS = targetOS }(TargetOS)
+	TargetOS = OSWindows
+
+	images, err := ResolveImages("v1.14.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, img := range images {
+		if img.Name() == "nginx" {
+			if img.Registry() != "docker.io/library" || img.Version() != "1.14-alpine" {
+				t.Errorf("Expected the linux nginx image but got %v", img.GetE2EImage())
+			}
+			return
+		}
+	}
+	t.Error("Expected an nginx image")
+}
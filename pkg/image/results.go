@@ -0,0 +1,62 @@
+/*
+Copyright the Sonobuoy contributors 2019
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package image
+
+import "sync"
+
+// ImageResult is the outcome of an operation on one image
+type ImageResult struct {
+	Image  string         `json:"image" yaml:"image"`
+	Action Operation      `json:"action" yaml:"action"`
+	Result ProgressStatus `json:"result" yaml:"result"`
+	Error  string         `json:"error,omitempty" yaml:"error,omitempty"`
+}
+
+// ResultRecorder collects the outcome of each operation from the progress events
+// of an ImageClient, in the order they completed.
+type ResultRecorder struct {
+	mu      sync.Mutex
+	results []ImageResult
+}
+
+// NewResultRecorder returns an empty ResultRecorder
+func NewResultRecorder() *ResultRecorder {
+	return &ResultRecorder{results: []ImageResult{}}
+}
+
+// Record is a ProgressFunc recording the operations it is told have completed
+func (r *ResultRecorder) Record(p ImageProgress) {
+	if p.Status == ProgressStarted {
+		return
+	}
+
+	result := ImageResult{Image: p.Name, Action: p.Operation, Result: p.Status}
+	if p.Err != nil {
+		result.Error = p.Err.Error()
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.results = append(r.results, result)
+}
+
+// Results returns the results recorded so far
+func (r *ResultRecorder) Results() []ImageResult {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]ImageResult{}, r.results...)
+}
@@ -0,0 +1,42 @@
+/*
+Copyright the Sonobuoy contributors 2019
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package image
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestResultRecorder(t *testing.T) {
+	r := NewResultRecorder()
+	imgClient := ImageClient{
+		dockerClient: FakeDockerClient{deleteFails: true},
+	}.WithProgress(r.Record)
+
+	imgClient.DeleteImages(map[string]Config{
+		"a": {registry: "foo.io/sonobuoy", name: "a", version: "1.0"},
+		"b": {registry: "foo.io/sonobuoy", name: "b", version: "1.0"},
+	}, 0)
+
+	want := []ImageResult{
+		{Image: "foo.io/sonobuoy/a:1.0", Action: OperationDelete, Result: ProgressFailed, Error: "couldn't delete image: foo.io/sonobuoy/a:1.0: delete failed"},
+		{Image: "foo.io/sonobuoy/b:1.0", Action: OperationDelete, Result: ProgressFailed, Error: "couldn't delete image: foo.io/sonobuoy/b:1.0: delete failed"},
+	}
+	if got := r.Results(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected results %+v but got %+v", want, got)
+	}
+}
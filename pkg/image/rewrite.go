@@ -0,0 +1,110 @@
+/*
+Copyright the Sonobuoy contributors 2019
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package image
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// tagTransformPlaceholderRegexp matches the placeholders of a tag transform
+var tagTransformPlaceholderRegexp = regexp.MustCompile(`\{[^{}]*\}`)
+
+// ParseRegistryRewrites parses rules of the form old=new, each rewriting the
+// registry host old to new.
+func ParseRegistryRewrites(rules []string) (map[string]string, error) {
+	rewrites := map[string]string{}
+	for _, rule := range rules {
+		parts := strings.SplitN(rule, "=", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" || strings.Contains(parts[0], "/") {
+			return nil, errors.Errorf("invalid registry rewrite %q, expected old-host=new-host", rule)
+		}
+		if _, ok := rewrites[parts[0]]; ok {
+			return nil, errors.Errorf("registry %v is rewritten more than once", parts[0])
+		}
+		rewrites[parts[0]] = parts[1]
+	}
+	return rewrites, nil
+}
+
+// RewriteRegistries returns a copy of images with the registry host of each
+// image replaced according to rewrites. Images on other hosts are unchanged.
+func RewriteRegistries(images map[string]Config, rewrites map[string]string) map[string]Config {
+	rewritten := make(map[string]Config, len(images))
+	for k, v := range images {
+		host, rest := splitRegistryHost(v.registry)
+		if newHost, ok := rewrites[host]; ok {
+			v.registry = newHost + rest
+		}
+		rewritten[k] = v
+	}
+	return rewritten
+}
+
+// RetargetRegistry returns a copy of images with every image moved to the registry
+// host, keeping its repository and tag, e.g. to mirror them into a pull-through cache.
+func RetargetRegistry(images map[string]Config, host string) map[string]Config {
+	retargeted := make(map[string]Config, len(images))
+	for k, v := range images {
+		_, rest := splitRegistryHost(v.registry)
+		v.registry = host + rest
+		retargeted[k] = v
+	}
+	return retargeted
+}
+
+// splitRegistryHost splits a registry into its host and the path following it, if any
+func splitRegistryHost(registry string) (string, string) {
+	if i := strings.Index(registry, "/"); i >= 0 {
+		return registry[:i], registry[i:]
+	}
+	return registry, ""
+}
+
+// TransformDestinations returns a copy of privateImages with each image that is
+// mirrored from upstreamImages rebuilt from template, in which {registry}, {repo} and
+// {tag} are replaced by the parts of the private image, e.g. {registry}/{repo}:{tag}-mirrored.
+// Images that aren't mirrored are left unchanged so they aren't pushed upstream.
+func TransformDestinations(upstreamImages, privateImages map[string]Config, template string) (map[string]Config, error) {
+	for _, placeholder := range tagTransformPlaceholderRegexp.FindAllString(template, -1) {
+		switch placeholder {
+		case "{registry}", "{repo}", "{tag}":
+		default:
+			return nil, errors.Errorf("invalid tag transform %q: unknown placeholder %v, expected {registry}, {repo} or {tag}", template, placeholder)
+		}
+	}
+
+	transformed := make(map[string]Config, len(privateImages))
+	for k, v := range privateImages {
+		upstream, ok := upstreamImages[k]
+		if ok && upstream.GetE2EImage() == v.GetE2EImage() {
+			transformed[k] = v
+			continue
+		}
+
+		ref := strings.NewReplacer("{registry}", v.registry, "{repo}", v.name, "{tag}", v.version).Replace(template)
+		c, err := configFromReference(ref)
+		if err != nil {
+			return nil, errors.Wrapf(err, "tag transform %q made an invalid image reference for %v", template, v.GetE2EImage())
+		}
+		c.override = v.override
+		transformed[k] = c
+	}
+	return transformed, nil
+}
@@ -0,0 +1,155 @@
+/*
+Copyright the Sonobuoy contributors 2019
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package image
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseRegistryRewrites(t *testing.T) {
+	tests := map[string]struct {
+		rules   []string
+		want    map[string]string
+		wantErr bool
+	}{
+		"no rules": {
+			rules: []string{},
+			want:  map[string]string{},
+		},
+		"rules": {
+			rules: []string{"private.io=mirror.corp:5000", "gcr.io=mirror.corp:5000/gcr"},
+			want:  map[string]string{"private.io": "mirror.corp:5000", "gcr.io": "mirror.corp:5000/gcr"},
+		},
+		"missing new host": {
+			rules:   []string{"private.io="},
+			wantErr: true,
+		},
+		"old host with path": {
+			rules:   []string{"private.io/library=mirror.corp"},
+			wantErr: true,
+		},
+		"duplicate": {
+			rules:   []string{"private.io=a.io", "private.io=b.io"},
+			wantErr: true,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := ParseRegistryRewrites(tc.rules)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("Expected error %v but got %v", tc.wantErr, err)
+			}
+			if !tc.wantErr && !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("Expected %v but got %v", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestRewriteRegistries(t *testing.T) {
+	images := map[string]Config{
+		"Nginx":  {name: "nginx", registry: "private.io/library", version: "1.14-alpine"},
+		"Pause":  {name: "pause", registry: "k8s.gcr.io", version: "3.1"},
+		"Webhok": {name: "webhook", registry: "other.io/e2e", version: "1.14v1"},
+	}
+	rewrites := map[string]string{"private.io": "mirror.corp:5000", "k8s.gcr.io": "mirror.corp:5000/gcr"}
+
+	got := RewriteRegistries(images, rewrites)
+	want := []string{
+		"mirror.corp:5000/gcr/pause:3.1",
+		"mirror.corp:5000/library/nginx:1.14-alpine",
+		"other.io/e2e/webhook:1.14v1",
+	}
+	if !reflect.DeepEqual(UniqueImages(got), want) {
+		t.Errorf("Expected %v but got %v", want, UniqueImages(got))
+	}
+
+	if images["Nginx"].registry != "private.io/library" {
+		t.Errorf("Expected the original images to be unchanged")
+	}
+}
+
+func TestRetargetRegistry(t *testing.T) {
+	images := map[string]Config{
+		"Nginx": {name: "nginx", registry: "docker.io/library", version: "1.14-alpine"},
+		"Pause": {name: "pause", registry: "k8s.gcr.io", version: "3.1"},
+	}
+
+	got := RetargetRegistry(images, "cache.corp:5000")
+	want := []string{
+		"cache.corp:5000/library/nginx:1.14-alpine",
+		"cache.corp:5000/pause:3.1",
+	}
+	if !reflect.DeepEqual(UniqueImages(got), want) {
+		t.Errorf("Expected %v but got %v", want, UniqueImages(got))
+	}
+}
+
+func TestTransformDestinations(t *testing.T) {
+	upstream := map[string]Config{
+		"A": {name: "a", registry: "foo.io/sonobuoy", version: "v1.0"},
+		"P": {name: "p", registry: "public.io/sonobuoy", version: "1.0"},
+	}
+	private := map[string]Config{
+		"A": {name: "a", registry: "private.io/sonobuoy", version: "v1.0"},
+		"P": {name: "p", registry: "public.io/sonobuoy", version: "1.0"},
+	}
+
+	tests := map[string]struct {
+		template string
+		want     map[string]string
+		wantErr  bool
+	}{
+		"tag suffix": {
+			template: "{registry}/{repo}:{tag}-mirrored",
+			want:     map[string]string{"A": "private.io/sonobuoy/a:v1.0-mirrored", "P": "public.io/sonobuoy/p:1.0"},
+		},
+		"team repository": {
+			template: "{registry}/team-x/{repo}:{tag}",
+			want:     map[string]string{"A": "private.io/sonobuoy/team-x/a:v1.0", "P": "public.io/sonobuoy/p:1.0"},
+		},
+		"unknown placeholder": {
+			template: "{registry}/{name}:{tag}",
+			wantErr:  true,
+		},
+		"invalid reference": {
+			template: "{registry}/{repo}:{tag}:extra",
+			wantErr:  true,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := TransformDestinations(upstream, private, tc.template)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("Expected error %v but got %v", tc.wantErr, err)
+			}
+			if tc.wantErr {
+				return
+			}
+			refs := map[string]string{}
+			for k, v := range got {
+				refs[k] = v.GetE2EImage()
+			}
+			if !reflect.DeepEqual(refs, tc.want) {
+				t.Errorf("Expected %v but got %v", tc.want, refs)
+			}
+		})
+	}
+}
@@ -0,0 +1,69 @@
+/*
+Copyright the Sonobuoy contributors 2019
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package image
+
+import (
+	"sort"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	corev1client "k8s.io/client-go/kubernetes/typed/core/v1"
+)
+
+// RunImage is the image of a container deployed by a sonobuoy run
+type RunImage struct {
+	Pod       string `json:"pod"`
+	Container string `json:"container"`
+	Image     string `json:"image"`
+	// ImageID is the image the container is running, as resolved by the kubelet.
+	// It is empty until the container has started.
+	ImageID string `json:"imageID,omitempty"`
+}
+
+// RunImages returns the images of the containers, including init containers, of
+// every pod in the namespace of a sonobuoy run: the aggregator, the plugins and
+// their sidecars. They're sorted by pod and container.
+func RunImages(pods corev1client.PodsGetter, namespace string) ([]RunImage, error) {
+	list, err := pods.Pods(namespace).List(metav1.ListOptions{})
+	if err != nil {
+		return nil, errors.Wrapf(err, "couldn't list pods in namespace %v", namespace)
+	}
+	if len(list.Items) == 0 {
+		return nil, errors.Errorf("no sonobuoy run found in namespace %v", namespace)
+	}
+
+	images := []RunImage{}
+	for _, pod := range list.Items {
+		ids := map[string]string{}
+		for _, status := range append(pod.Status.InitContainerStatuses, pod.Status.ContainerStatuses...) {
+			ids[status.Name] = status.ImageID
+		}
+
+		for _, c := range append(append([]corev1.Container{}, pod.Spec.InitContainers...), pod.Spec.Containers...) {
+			images = append(images, RunImage{Pod: pod.Name, Container: c.Name, Image: c.Image, ImageID: ids[c.Name]})
+		}
+	}
+
+	sort.Slice(images, func(a, b int) bool {
+		if images[a].Pod != images[b].Pod {
+			return images[a].Pod < images[b].Pod
+		}
+		return images[a].Container < images[b].Container
+	})
+	return images, nil
+}
@@ -0,0 +1,84 @@
+/*
+Copyright the Sonobuoy contributors 2019
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package image
+
+import (
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	corev1client "k8s.io/client-go/kubernetes/typed/core/v1"
+)
+
+// fakePods serves the pods of each namespace
+type fakePods map[string][]corev1.Pod
+
+func (f fakePods) Pods(namespace string) corev1client.PodInterface {
+	return fakePodClient{pods: f[namespace]}
+}
+
+type fakePodClient struct {
+	corev1client.PodInterface
+	pods []corev1.Pod
+}
+
+func (f fakePodClient) List(opts metav1.ListOptions) (*corev1.PodList, error) {
+	return &corev1.PodList{Items: f.pods}, nil
+}
+
+func TestRunImages(t *testing.T) {
+	pods := fakePods{
+		"sonobuoy": {
+			{
+				ObjectMeta: metav1.ObjectMeta{Name: "sonobuoy-e2e-job-abc"},
+				Spec: corev1.PodSpec{Containers: []corev1.Container{
+					{Name: "e2e", Image: "gcr.io/heptio-images/kube-conformance:v1.14.0"},
+					{Name: "sonobuoy-worker", Image: "gcr.io/heptio-images/sonobuoy:v0.14.0"},
+				}},
+				Status: corev1.PodStatus{ContainerStatuses: []corev1.ContainerStatus{
+					{Name: "e2e", ImageID: "docker-pullable://gcr.io/heptio-images/kube-conformance@sha256:abc"},
+				}},
+			},
+			{
+				ObjectMeta: metav1.ObjectMeta{Name: "sonobuoy"},
+				Spec: corev1.PodSpec{
+					InitContainers: []corev1.Container{{Name: "init", Image: "busybox:1.29"}},
+					Containers:     []corev1.Container{{Name: "kube-sonobuoy", Image: "gcr.io/heptio-images/sonobuoy:v0.14.0"}},
+				},
+			},
+		},
+	}
+
+	got, err := RunImages(pods, "sonobuoy")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []RunImage{
+		{Pod: "sonobuoy", Container: "init", Image: "busybox:1.29"},
+		{Pod: "sonobuoy", Container: "kube-sonobuoy", Image: "gcr.io/heptio-images/sonobuoy:v0.14.0"},
+		{Pod: "sonobuoy-e2e-job-abc", Container: "e2e", Image: "gcr.io/heptio-images/kube-conformance:v1.14.0", ImageID: "docker-pullable://gcr.io/heptio-images/kube-conformance@sha256:abc"},
+		{Pod: "sonobuoy-e2e-job-abc", Container: "sonobuoy-worker", Image: "gcr.io/heptio-images/sonobuoy:v0.14.0"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected images %+v but got %+v", want, got)
+	}
+
+	if _, err := RunImages(pods, "empty"); err == nil {
+		t.Error("Expected error for namespace without a run but got nil")
+	}
+}
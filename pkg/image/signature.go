@@ -0,0 +1,78 @@
+/*
+Copyright the Sonobuoy contributors 2019
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package image
+
+import (
+	osexec "os/exec"
+
+	"github.com/heptio/sonobuoy/pkg/image/exec"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// cosignBinary is the cosign CLI CosignVerifier runs
+const cosignBinary = "cosign"
+
+// lookPath finds executables on the PATH, and is replaced by tests
+var lookPath = osexec.LookPath
+
+// SignatureVerifier verifies the signature of an image in its registry
+type SignatureVerifier interface {
+	Verify(image string) error
+}
+
+// CosignVerifier verifies image signatures against a public key by running the
+// cosign CLI, which must be installed.
+type CosignVerifier struct {
+	// Key is the path to the public key the images must be signed with
+	Key string
+	// Cmder creates the cosign commands to run. If nil, exec.DefaultCmder is used.
+	Cmder exec.Cmder
+}
+
+// Check returns an error if the cosign CLI isn't on the PATH, so that a pull
+// verifying signatures can fail before pulling anything. Commands run by a
+// custom Cmder aren't checked.
+func (c CosignVerifier) Check() error {
+	if c.Cmder != nil {
+		return nil
+	}
+	if _, err := lookPath(cosignBinary); err != nil {
+		return errors.Errorf("verifying signatures requires the %v CLI, which isn't on the PATH; see https://github.com/sigstore/cosign#installation", cosignBinary)
+	}
+	return nil
+}
+
+// Verify runs cosign verify for the image
+func (c CosignVerifier) Verify(image string) error {
+	cmder := c.Cmder
+	if cmder == nil {
+		cmder = exec.DefaultCmder
+	}
+
+	log.Infof("Verifying signature of image: %s ...", image)
+	_, err := exec.Output(cmder.Command(cosignBinary, "verify", "--key", c.Key, image))
+	return errors.Wrapf(err, "signature verification failed for image %v", image)
+}
+
+// WithSignatureVerifier returns a copy of the client which verifies the signature
+// of every image it pulls, failing the pull of any image that doesn't pass. Images
+// pulled that don't pass are removed again.
+func (i ImageClient) WithSignatureVerifier(v SignatureVerifier) ImageClient {
+	i.signatureVerifier = v
+	return i
+}
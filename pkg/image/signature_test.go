@@ -0,0 +1,189 @@
+/*
+Copyright the Sonobuoy contributors 2019
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package image
+
+import (
+	"io"
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/heptio/sonobuoy/pkg/image/docker"
+	"github.com/heptio/sonobuoy/pkg/image/exec"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+type fakeVerifier struct {
+	unsigned map[string]bool
+}
+
+func (f fakeVerifier) Verify(image string) error {
+	if f.unsigned[image] {
+		return errors.Errorf("signature verification failed for image %v", image)
+	}
+	return nil
+}
+
+func TestPullImagesVerifiesSignatures(t *testing.T) {
+	logrus.SetOutput(ioutil.Discard)
+
+	images := map[string]Config{
+		"A": {name: "a", registry: "foo.io/sonobuoy", version: "1.0"},
+		"B": {name: "b", registry: "foo.io/sonobuoy", version: "1.0"},
+	}
+
+	tests := map[string]struct {
+		client          FakeDockerClient
+		unsigned        map[string]bool
+		wantErrorCount  int
+		wantTransferred int64
+		wantDeleted     []string
+	}{
+		"all signed": {
+			client:          FakeDockerClient{},
+			wantErrorCount:  0,
+			wantTransferred: 2 * fakeImageSize,
+			wantDeleted:     []string{},
+		},
+		"one unsigned": {
+			client:          FakeDockerClient{},
+			unsigned:        map[string]bool{"foo.io/sonobuoy/b:1.0": true},
+			wantErrorCount:  1,
+			wantTransferred: fakeImageSize,
+			wantDeleted:     []string{"foo.io/sonobuoy/b:1.0"},
+		},
+		"unsigned image already present": {
+			client:          FakeDockerClient{imageExists: true},
+			unsigned:        map[string]bool{"foo.io/sonobuoy/a:1.0": true},
+			wantErrorCount:  1,
+			wantTransferred: 0,
+			// Only images the pull brought in are removed
+			wantDeleted: []string{},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			deleted := []string{}
+			tc.client.deleted = &deleted
+			imgClient := ImageClient{dockerClient: tc.client}.WithSignatureVerifier(fakeVerifier{unsigned: tc.unsigned})
+
+			pulled, errs := imgClient.PullImages(images, docker.PullOptions{}, 0)
+			transferred := TotalSize(pulled)
+			if len(errs) != tc.wantErrorCount {
+				t.Fatalf("Expected errors: %d but got %v", tc.wantErrorCount, errs)
+			}
+			if transferred != tc.wantTransferred {
+				t.Errorf("Expected transferred bytes: %d but got %d", tc.wantTransferred, transferred)
+			}
+			if !reflect.DeepEqual(deleted, tc.wantDeleted) {
+				t.Errorf("Expected deleted images %v but got %v", tc.wantDeleted, deleted)
+			}
+		})
+	}
+}
+
+// fakeCosign runs cosign commands by recording them and failing with stderr, if set
+type fakeCosign struct {
+	runs   [][]string
+	stderr string
+}
+
+func (f *fakeCosign) Command(name string, args ...string) exec.Cmd {
+	return &fakeCosignCmd{cosign: f, args: append([]string{name}, args...)}
+}
+
+type fakeCosignCmd struct {
+	cosign *fakeCosign
+	args   []string
+	stderr io.Writer
+}
+
+func (c *fakeCosignCmd) Run() error {
+	c.cosign.runs = append(c.cosign.runs, c.args)
+	if len(c.cosign.stderr) > 0 {
+		io.WriteString(c.stderr, c.cosign.stderr)
+		return errors.New("exit status 1")
+	}
+	return nil
+}
+
+func (c *fakeCosignCmd) SetEnv(...string) exec.Cmd      { return c }
+func (c *fakeCosignCmd) SetStdin(io.Reader) exec.Cmd    { return c }
+func (c *fakeCosignCmd) SetStdout(io.Writer) exec.Cmd   { return c }
+func (c *fakeCosignCmd) SetStderr(w io.Writer) exec.Cmd { c.stderr = w; return c }
+
+func TestCosignVerifier(t *testing.T) {
+	logrus.SetOutput(ioutil.Discard)
+
+	tests := map[string]struct {
+		stderr  string
+		wantErr bool
+	}{
+		"verified": {},
+		"unsigned": {stderr: "Error: no matching signatures", wantErr: true},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			cosign := &fakeCosign{stderr: tc.stderr}
+			err := CosignVerifier{Key: "cosign.pub", Cmder: cosign}.Verify("foo.io/sonobuoy/a:1.0")
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("Expected error %v but got %v", tc.wantErr, err)
+			}
+			if err != nil && !strings.Contains(err.Error(), tc.stderr) {
+				t.Errorf("Expected the error to include cosign's output, got %v", err)
+			}
+
+			want := [][]string{{"cosign", "verify", "--key", "cosign.pub", "foo.io/sonobuoy/a:1.0"}}
+			if !reflect.DeepEqual(cosign.runs, want) {
+				t.Errorf("Expected commands %v but got %v", want, cosign.runs)
+			}
+		})
+	}
+}
+
+func TestCosignVerifierCheck(t *testing.T) {
+	defer func(f func(string) (string, error)) { lookPath = f }(lookPath)
+
+	tests := map[string]struct {
+		installed bool
+		cmder     exec.Cmder
+		wantErr   bool
+	}{
+		"installed":               {installed: true},
+		"not installed":           {wantErr: true},
+		"custom cmder, unchecked": {cmder: &fakeCosign{}},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			lookPath = func(file string) (string, error) {
+				if !tc.installed {
+					return "", errors.New("not found")
+				}
+				return "/usr/local/bin/" + file, nil
+			}
+			err := CosignVerifier{Key: "cosign.pub", Cmder: tc.cmder}.Check()
+			if (err != nil) != tc.wantErr {
+				t.Errorf("Expected error %v but got %v", tc.wantErr, err)
+			}
+		})
+	}
+}
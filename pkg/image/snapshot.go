@@ -0,0 +1,96 @@
+/*
+Copyright the Sonobuoy contributors 2019
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package image
+
+import (
+	"encoding/json"
+	"io"
+	"io/ioutil"
+
+	"github.com/pkg/errors"
+)
+
+// Snapshot is a pinned list of the images for a Kubernetes version. Loading the
+// images from a snapshot rather than computing them means the same images are
+// used no matter which Sonobuoy release is running.
+type Snapshot struct {
+	// Version is the Kubernetes version the images were computed for
+	Version string `json:"version"`
+	// Images maps each image's key to its fully qualified reference
+	Images map[string]string `json:"images"`
+}
+
+// NewSnapshot returns a snapshot of images for the given version
+func NewSnapshot(version string, images map[string]Config) Snapshot {
+	s := Snapshot{
+		Version: version,
+		Images:  map[string]string{},
+	}
+	for k, v := range images {
+		s.Images[k] = v.GetE2EImage()
+	}
+	return s
+}
+
+// Write writes the snapshot as JSON. Keys are written in sorted order so the
+// same snapshot always produces the same bytes.
+func (s Snapshot) Write(w io.Writer) error {
+	b, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "couldn't encode image snapshot")
+	}
+	_, err = w.Write(append(b, '\n'))
+	return err
+}
+
+// ImageConfigs returns the image Configs recorded in the snapshot
+func (s Snapshot) ImageConfigs() (map[string]Config, error) {
+	imgs := map[string]Config{}
+	for k, ref := range s.Images {
+		cfg, err := configFromReference(ref)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid image for %v", k)
+		}
+		imgs[k] = cfg
+	}
+	return imgs, nil
+}
+
+// LoadSnapshot reads a snapshot written by Snapshot.Write
+func LoadSnapshot(path string) (Snapshot, error) {
+	s := Snapshot{}
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return s, errors.Wrapf(err, "couldn't read image snapshot %v", path)
+	}
+	if err := json.Unmarshal(contents, &s); err != nil {
+		return s, errors.Wrapf(err, "couldn't decode image snapshot %v", path)
+	}
+	if len(s.Version) == 0 {
+		return s, errors.Errorf("image snapshot %v has no version", path)
+	}
+	return s, nil
+}
+
+// GetImagesFromSnapshot gets a map of image Configs from a snapshot file
+func GetImagesFromSnapshot(path string) (map[string]Config, error) {
+	s, err := LoadSnapshot(path)
+	if err != nil {
+		return nil, err
+	}
+	return s.ImageConfigs()
+}
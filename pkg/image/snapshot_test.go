@@ -0,0 +1,104 @@
+/*
+Copyright the Sonobuoy contributors 2019
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package image
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestSnapshotRoundTrip(t *testing.T) {
+	reg, err := NewRegistryList("", "v1.14.0")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want, err := reg.GetImageConfigs()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var first, second bytes.Buffer
+	if err := NewSnapshot("v1.14.0", want).Write(&first); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := NewSnapshot("v1.14.0", want).Write(&second); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !bytes.Equal(first.Bytes(), second.Bytes()) {
+		t.Fatalf("Expected snapshots to be identical")
+	}
+
+	dir, err := ioutil.TempDir("", "sonobuoy-snapshot")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "images.json")
+	if err := ioutil.WriteFile(path, first.Bytes(), 0644); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	snapshot, err := LoadSnapshot(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if snapshot.Version != "v1.14.0" {
+		t.Errorf("Expected version v1.14.0 but got %v", snapshot.Version)
+	}
+
+	got, err := GetImagesFromSnapshot(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(UniqueImages(got), UniqueImages(want)) {
+		t.Errorf("Expected images %v but got %v", UniqueImages(want), UniqueImages(got))
+	}
+	if len(got) != len(want) {
+		t.Errorf("Expected %d keys but got %d", len(want), len(got))
+	}
+}
+
+func TestLoadSnapshotErrors(t *testing.T) {
+	tests := map[string]string{
+		"invalid json":  `{"version": `,
+		"no version":    `{"images": {"Nginx": "docker.io/library/nginx:1.14-alpine"}}`,
+		"invalid image": `{"version": "v1.14.0", "images": {"Nginx": "Not An Image"}}`,
+	}
+
+	dir, err := ioutil.TempDir("", "sonobuoy-snapshot")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	for name, contents := range tests {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(dir, "images.json")
+			if err := ioutil.WriteFile(path, []byte(contents), 0644); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if _, err := GetImagesFromSnapshot(path); err == nil {
+				t.Error("Expected error but got nil")
+			}
+		})
+	}
+}
@@ -0,0 +1,174 @@
+/*
+Copyright the Sonobuoy contributors 2019
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package image
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// DownloadImagesSplit saves the images to numbered tar files named after the
+// version, each at most maxSize bytes, so that each part fits on size limited
+// media. Images are packed greedily, largest first, by their sizes as reported by
+// the local docker client, and an image larger than maxSize gets a part of its
+// own. Since a tar adds its own overhead to the images' sizes, each part is
+// measured once written, and a part that is still too large has its smallest
+// images moved to the next part and is written again. An index of which part
+// holds each image is written alongside the parts, so that they can all be loaded
+// with LoadImagesFromDir.
+func (i ImageClient) DownloadImagesSplit(images []string, version string, maxSize int64) (Index, []error) {
+	if maxSize <= 0 {
+		return nil, []error{errors.Errorf("split size must be positive, got %d", maxSize)}
+	}
+
+	ids := map[string]string{}
+	sizes := map[string]int64{}
+	for _, img := range images {
+		info, err := i.dockerClient.Inspect(img)
+		if err != nil {
+			return nil, []error{errors.Wrapf(err, "couldn't get size of image %v", img)}
+		}
+		ids[img], sizes[img] = info.ID, info.Size
+		if info.Size > maxSize {
+			logrus.Warningf("Image %v is %v, larger than the split size of %v; it's saved to a part of its own", img, humanSize(info.Size), humanSize(maxSize))
+		}
+	}
+
+	errs := []error{}
+	idx := Index{}
+	dir := filepath.Dir(getTarFileName(version, 1))
+	parts := packImages(images, sizes, maxSize)
+	for n := 0; n < len(parts); n++ {
+		if i.aborted(errs) {
+			break
+		}
+		fileName := getTarFileName(version, n+1)
+		var err error
+		parts, err = i.saveSplitPart(parts, n, fileName, sizes, maxSize)
+		if err != nil {
+			errs = append(errs, errors.Wrapf(err, "couldn't download part %d", n+1))
+			continue
+		}
+		for _, img := range parts[n] {
+			idx[img] = IndexEntry{File: filepath.Base(fileName), ID: ids[img]}
+		}
+	}
+
+	if err := idx.write(dir); err != nil {
+		errs = append(errs, err)
+	}
+	return idx, errs
+}
+
+// saveSplitPart saves part n of parts to fileName, moving its smallest images to
+// the next part until the tar written is at most maxSize bytes or holds a single
+// image. It returns the parts as updated, with part n holding the images saved.
+func (i ImageClient) saveSplitPart(parts [][]string, n int, fileName string, sizes map[string]int64, maxSize int64) ([][]string, error) {
+	for {
+		part := parts[n]
+		if _, err := i.saveTar(part, fileName, n+1, len(parts)); err != nil {
+			return parts, err
+		}
+		info, err := os.Stat(fileName)
+		if err != nil {
+			return parts, errors.Wrapf(err, "couldn't get size of %v", fileName)
+		}
+		if info.Size() <= maxSize || len(part) == 1 {
+			return parts, nil
+		}
+
+		// Leave room for the overhead the tar had over the images' sizes
+		overhead := info.Size() - totalSize(part, sizes)
+		kept, moved := splitSmallest(part, sizes, maxSize-overhead)
+		logrus.Infof("Part %v is %v, larger than the split size of %v; moving %d images to the next part", fileName, humanSize(info.Size()), humanSize(maxSize), len(moved))
+		if n+1 == len(parts) {
+			parts = append(parts, nil)
+		}
+		parts[n] = kept
+		parts[n+1] = append(parts[n+1], moved...)
+		sort.Strings(parts[n+1])
+	}
+}
+
+// splitSmallest removes the smallest images from part until the sizes of the rest
+// total at most budget, always keeping the largest image and moving at least one.
+func splitSmallest(part []string, sizes map[string]int64, budget int64) (kept, moved []string) {
+	sorted := append([]string{}, part...)
+	sort.Slice(sorted, func(a, b int) bool {
+		if sizes[sorted[a]] != sizes[sorted[b]] {
+			return sizes[sorted[a]] > sizes[sorted[b]]
+		}
+		return sorted[a] < sorted[b]
+	})
+
+	n := len(sorted) - 1
+	for n > 1 && totalSize(sorted[:n], sizes) > budget {
+		n--
+	}
+	kept, moved = sorted[:n], sorted[n:]
+	sort.Strings(kept)
+	return kept, moved
+}
+
+// totalSize returns the total of the sizes of images
+func totalSize(images []string, sizes map[string]int64) int64 {
+	var total int64
+	for _, img := range images {
+		total += sizes[img]
+	}
+	return total
+}
+
+// packImages packs images into parts whose sizes total at most maxSize, placing
+// each image, largest first, in the first part with room for it. The images of
+// each part are sorted.
+func packImages(images []string, sizes map[string]int64, maxSize int64) [][]string {
+	sorted := append([]string{}, images...)
+	sort.Slice(sorted, func(a, b int) bool {
+		if sizes[sorted[a]] != sizes[sorted[b]] {
+			return sizes[sorted[a]] > sizes[sorted[b]]
+		}
+		return sorted[a] < sorted[b]
+	})
+
+	parts := [][]string{}
+	totals := []int64{}
+	for _, img := range sorted {
+		placed := false
+		for n := range parts {
+			if totals[n]+sizes[img] <= maxSize {
+				parts[n] = append(parts[n], img)
+				totals[n] += sizes[img]
+				placed = true
+				break
+			}
+		}
+		if !placed {
+			parts = append(parts, []string{img})
+			totals = append(totals, sizes[img])
+		}
+	}
+
+	for _, part := range parts {
+		sort.Strings(part)
+	}
+	return parts
+}
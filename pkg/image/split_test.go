@@ -0,0 +1,129 @@
+/*
+Copyright the Sonobuoy contributors 2019
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package image
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+)
+
+func TestPackImages(t *testing.T) {
+	sizes := map[string]int64{"a": 6, "b": 5, "c": 4, "d": 3, "e": 2, "huge": 20}
+
+	tests := map[string]struct {
+		images  []string
+		maxSize int64
+		want    [][]string
+	}{
+		"largest first into the first part with room": {
+			images:  []string{"a", "b", "c", "d", "e"},
+			maxSize: 10,
+			want:    [][]string{{"a", "c"}, {"b", "d", "e"}},
+		},
+		"everything fits": {
+			images:  []string{"e", "d"},
+			maxSize: 10,
+			want:    [][]string{{"d", "e"}},
+		},
+		"oversized image alone": {
+			images:  []string{"a", "huge", "e"},
+			maxSize: 10,
+			want:    [][]string{{"huge"}, {"a", "e"}},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := packImages(tc.images, sizes, tc.maxSize); !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("Expected parts %v but got %v", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestDownloadImagesSplit(t *testing.T) {
+	defer chdirTemp(t)()
+	logrus.SetOutput(ioutil.Discard)
+
+	const k8sVersion = "99.YY.ZZ"
+	images := []string{"foo.io/sonobuoy/a:1.0", "foo.io/sonobuoy/b:1.0", "foo.io/sonobuoy/c:1.0"}
+	imgClient := ImageClient{dockerClient: FakeDockerClient{}}
+
+	idx, errs := imgClient.DownloadImagesSplit(images, k8sVersion, 2*fakeImageSize)
+	if len(errs) != 0 {
+		t.Fatalf("unexpected errors: %v", errs)
+	}
+	want := Index{
+		"foo.io/sonobuoy/a:1.0": {File: getTarFileName(k8sVersion, 1), ID: "sha256:foo.io/sonobuoy/a:1.0"},
+		"foo.io/sonobuoy/b:1.0": {File: getTarFileName(k8sVersion, 1), ID: "sha256:foo.io/sonobuoy/b:1.0"},
+		"foo.io/sonobuoy/c:1.0": {File: getTarFileName(k8sVersion, 2), ID: "sha256:foo.io/sonobuoy/c:1.0"},
+	}
+	if !reflect.DeepEqual(idx, want) {
+		t.Fatalf("Expected index %+v but got %+v", want, idx)
+	}
+	if written, err := ReadIndex("."); err != nil || !reflect.DeepEqual(written, want) {
+		t.Errorf("Expected written index %+v but got %+v, %v", want, written, err)
+	}
+
+	// Each part is loaded once, however many images it holds
+	loaded := []string{}
+	loader := ImageClient{dockerClient: FakeDockerClient{loaded: &loaded}}
+	if errs := loader.LoadImagesFromDir("."); len(errs) != 0 {
+		t.Fatalf("unexpected errors: %v", errs)
+	}
+	if len(loaded) != 2 {
+		t.Errorf("Expected 2 parts loaded but got %v", loaded)
+	}
+
+	if _, errs := imgClient.DownloadImagesSplit(images, k8sVersion, 0); len(errs) != 1 {
+		t.Errorf("Expected an error for an invalid split size but got %v", errs)
+	}
+}
+
+func TestDownloadImagesSplitMeasuresParts(t *testing.T) {
+	defer chdirTemp(t)()
+	logrus.SetOutput(ioutil.Discard)
+
+	const k8sVersion = "99.YY.ZZ"
+	images := []string{"foo.io/sonobuoy/a:1.0", "foo.io/sonobuoy/b:1.0", "foo.io/sonobuoy/c:1.0"}
+	// The tar of each image is larger than the image, so two images that fit by
+	// their sizes don't fit once saved
+	imgClient := ImageClient{dockerClient: FakeDockerClient{savedSize: fakeImageSize + 100}}
+	maxSize := int64(2*fakeImageSize + 50)
+
+	idx, errs := imgClient.DownloadImagesSplit(images, k8sVersion, maxSize)
+	if len(errs) != 0 {
+		t.Fatalf("unexpected errors: %v", errs)
+	}
+	want := Index{
+		"foo.io/sonobuoy/a:1.0": {File: getTarFileName(k8sVersion, 1), ID: "sha256:foo.io/sonobuoy/a:1.0"},
+		"foo.io/sonobuoy/b:1.0": {File: getTarFileName(k8sVersion, 2), ID: "sha256:foo.io/sonobuoy/b:1.0"},
+		"foo.io/sonobuoy/c:1.0": {File: getTarFileName(k8sVersion, 3), ID: "sha256:foo.io/sonobuoy/c:1.0"},
+	}
+	if !reflect.DeepEqual(idx, want) {
+		t.Fatalf("Expected index %+v but got %+v", want, idx)
+	}
+	for _, entry := range idx {
+		if info, err := os.Stat(entry.File); err != nil || info.Size() > maxSize {
+			t.Errorf("Expected %v to be at most %d bytes, got %v, %v", entry.File, maxSize, info, err)
+		}
+	}
+}
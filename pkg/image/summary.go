@@ -0,0 +1,92 @@
+/*
+Copyright the Sonobuoy contributors 2019
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package image
+
+import (
+	"sort"
+
+	"github.com/heptio/sonobuoy/pkg/image/docker"
+	"github.com/heptio/sonobuoy/pkg/image/registry"
+	"github.com/pkg/errors"
+)
+
+// RegistrySummary counts the images served by one registry host
+type RegistrySummary struct {
+	Host   string
+	Images []string
+	// Size is the total size of the Images present locally, if sizes were added
+	Size int64
+	// Missing is the number of Images not present locally, if sizes were added
+	Missing int
+}
+
+// SummarizeByRegistry groups the unique images by registry host, sorted by host
+func SummarizeByRegistry(images map[string]Config) ([]RegistrySummary, error) {
+	byHost := map[string]*RegistrySummary{}
+	for _, img := range UniqueImages(images) {
+		ref, err := registry.ParseReference(img)
+		if err != nil {
+			return nil, err
+		}
+		if byHost[ref.Host] == nil {
+			byHost[ref.Host] = &RegistrySummary{Host: ref.Host}
+		}
+		byHost[ref.Host].Images = append(byHost[ref.Host].Images, img)
+	}
+
+	summaries := make([]RegistrySummary, 0, len(byHost))
+	for _, s := range byHost {
+		summaries = append(summaries, *s)
+	}
+	sort.Slice(summaries, func(a, b int) bool { return summaries[a].Host < summaries[b].Host })
+	return summaries, nil
+}
+
+// AddSizes fills in the size of each summary from the images present in the local
+// docker client, counting those that aren't as missing. Any other inspect error,
+// such as the daemon being unreachable, is returned.
+func (i ImageClient) AddSizes(summaries []RegistrySummary) ([]RegistrySummary, error) {
+	sized := make([]RegistrySummary, 0, len(summaries))
+	for _, s := range summaries {
+		s.Size, s.Missing = 0, 0
+		for _, img := range s.Images {
+			info, err := i.dockerClient.Inspect(img)
+			if errors.Cause(err) == docker.ErrImageNotFound {
+				s.Missing++
+				continue
+			}
+			if err != nil {
+				return nil, errors.Wrapf(err, "couldn't inspect image: %v", img)
+			}
+			s.Size += info.Size
+		}
+		sized = append(sized, s)
+	}
+	return sized, nil
+}
+
+// ImageSizes returns the size of each of the images present in the local docker
+// client. Images that aren't present are left out.
+func (i ImageClient) ImageSizes(images []string) map[string]int64 {
+	sizes := map[string]int64{}
+	for _, img := range images {
+		if info, err := i.dockerClient.Inspect(img); err == nil {
+			sizes[img] = info.Size
+		}
+	}
+	return sizes
+}
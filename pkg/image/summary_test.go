@@ -0,0 +1,68 @@
+/*
+Copyright the Sonobuoy contributors 2019
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package image
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSummarizeByRegistry(t *testing.T) {
+	images := map[string]Config{
+		"Nginx":    {name: "nginx", registry: "docker.io/library", version: "1.14-alpine"},
+		"NginxNew": {name: "nginx", registry: "docker.io/library", version: "1.15-alpine"},
+		"Etcd":     {name: "etcd", registry: "k8s.gcr.io", version: "3.3.10"},
+		"Pause":    {name: "pause", registry: "k8s.gcr.io", version: "3.1"},
+		"PauseDup": {name: "pause", registry: "k8s.gcr.io", version: "3.1"},
+		"Agnhost":  {name: "agnhost", registry: "gcr.io/kubernetes-e2e-test-images", version: "2.2"},
+	}
+
+	got, err := SummarizeByRegistry(images)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := []RegistrySummary{
+		{Host: "docker.io", Images: []string{"docker.io/library/nginx:1.14-alpine", "docker.io/library/nginx:1.15-alpine"}},
+		{Host: "gcr.io", Images: []string{"gcr.io/kubernetes-e2e-test-images/agnhost:2.2"}},
+		{Host: "k8s.gcr.io", Images: []string{"k8s.gcr.io/etcd:3.3.10", "k8s.gcr.io/pause:3.1"}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("Expected %+v but got %+v", want, got)
+	}
+
+	imgClient := ImageClient{dockerClient: FakeDockerClient{missing: map[string]bool{"k8s.gcr.io/pause:3.1": true}}}
+	sized, err := imgClient.AddSizes(got)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	wantSizes := map[string][2]int64{
+		"docker.io":  {2 * fakeImageSize, 0},
+		"gcr.io":     {fakeImageSize, 0},
+		"k8s.gcr.io": {fakeImageSize, 1},
+	}
+	for _, s := range sized {
+		if w := wantSizes[s.Host]; s.Size != w[0] || int64(s.Missing) != w[1] {
+			t.Errorf("Expected %v size %d with %d missing but got %d with %d missing", s.Host, w[0], w[1], s.Size, s.Missing)
+		}
+	}
+
+	failing := ImageClient{dockerClient: FakeDockerClient{inspectFails: true}}
+	if _, err := failing.AddSizes(got); err == nil {
+		t.Error("Expected an error when the images can't be inspected")
+	}
+}
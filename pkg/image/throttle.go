@@ -0,0 +1,148 @@
+/*
+Copyright the Sonobuoy contributors 2019
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package image
+
+import (
+	"context"
+	"io"
+	"os"
+
+	"github.com/pkg/errors"
+	"golang.org/x/time/rate"
+)
+
+// maxThrottleChunk is the most bytes passed through a rate limiter at once
+const maxThrottleChunk = 32 * 1024
+
+// WithRateLimit returns a copy of the client which streams the tars it saves and
+// loads through itself, at no more than bytesPerSecond. Pulls and pushes are made
+// by the docker daemon, so they aren't limited; see the daemon's
+// max-concurrent-downloads and max-concurrent-uploads settings instead.
+func (i ImageClient) WithRateLimit(bytesPerSecond int64) ImageClient {
+	i.rateLimit = bytesPerSecond
+	return i
+}
+
+// newLimiter returns a limiter for the client's rate limit, or nil if there isn't one
+func (i ImageClient) newLimiter() *rate.Limiter {
+	if i.rateLimit <= 0 {
+		return nil
+	}
+	burst := maxThrottleChunk
+	if i.rateLimit < int64(burst) {
+		burst = int(i.rateLimit)
+	}
+	return rate.NewLimiter(rate.Limit(i.rateLimit), burst)
+}
+
+// contextOrBackground returns the client's context, or the background context if it has none
+func (i ImageClient) contextOrBackground() context.Context {
+	if i.ctx == nil {
+		return context.Background()
+	}
+	return i.ctx
+}
+
+// limitWriter returns w limited to the client's rate limit, if it has one
+func (i ImageClient) limitWriter(w io.Writer) io.Writer {
+	limiter := i.newLimiter()
+	if limiter == nil {
+		return w
+	}
+	return &throttledWriter{w: w, limiter: limiter, ctx: i.contextOrBackground()}
+}
+
+// limitReader returns r limited to the client's rate limit, if it has one
+func (i ImageClient) limitReader(r io.Reader) io.Reader {
+	limiter := i.newLimiter()
+	if limiter == nil {
+		return r
+	}
+	return &throttledReader{r: r, limiter: limiter, ctx: i.contextOrBackground()}
+}
+
+// throttledWriter writes to w at the rate allowed by limiter
+type throttledWriter struct {
+	w       io.Writer
+	limiter *rate.Limiter
+	ctx     context.Context
+}
+
+func (t *throttledWriter) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		chunk := p
+		if len(chunk) > t.limiter.Burst() {
+			chunk = chunk[:t.limiter.Burst()]
+		}
+		if err := t.limiter.WaitN(t.ctx, len(chunk)); err != nil {
+			return written, err
+		}
+		n, err := t.w.Write(chunk)
+		written += n
+		if err != nil {
+			return written, err
+		}
+		p = p[n:]
+	}
+	return written, nil
+}
+
+// throttledReader reads from r at the rate allowed by limiter
+type throttledReader struct {
+	r       io.Reader
+	limiter *rate.Limiter
+	ctx     context.Context
+}
+
+func (t *throttledReader) Read(p []byte) (int, error) {
+	if len(p) > t.limiter.Burst() {
+		p = p[:t.limiter.Burst()]
+	}
+	n, err := t.r.Read(p)
+	if n > 0 {
+		if waitErr := t.limiter.WaitN(t.ctx, n); waitErr != nil {
+			return n, waitErr
+		}
+	}
+	return n, err
+}
+
+// saveLimited saves the images to fileName, streaming them through the client's rate limit
+func (i ImageClient) saveLimited(images []string, fileName string) error {
+	f, err := os.Create(fileName)
+	if err != nil {
+		return errors.Wrap(err, "couldn't create tar file")
+	}
+	defer f.Close()
+
+	if err := i.dockerClient.SaveTo(images, i.limitWriter(f)); err != nil {
+		return err
+	}
+	return errors.Wrap(f.Close(), "couldn't write tar file")
+}
+
+// loadLimited loads the tar at path, streaming it through the client's rate limit
+func (i ImageClient) loadLimited(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return errors.Wrap(err, "couldn't open tar file")
+	}
+	defer f.Close()
+
+	return i.dockerClient.LoadFrom(i.limitReader(f))
+}
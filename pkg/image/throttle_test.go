@@ -0,0 +1,85 @@
+/*
+Copyright the Sonobuoy contributors 2019
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package image
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestRateLimit(t *testing.T) {
+	data := bytes.Repeat([]byte("sonobuoy"), 5000)
+	imgClient := ImageClient{}.WithRateLimit(20000)
+
+	tests := map[string]func(dst io.Writer, src io.Reader) (int64, error){
+		"writer": func(dst io.Writer, src io.Reader) (int64, error) {
+			return io.Copy(imgClient.limitWriter(dst), src)
+		},
+		"reader": func(dst io.Writer, src io.Reader) (int64, error) {
+			return io.Copy(dst, imgClient.limitReader(src))
+		},
+	}
+
+	for name, copyLimited := range tests {
+		t.Run(name, func(t *testing.T) {
+			var out bytes.Buffer
+			start := time.Now()
+			if _, err := copyLimited(&out, bytes.NewReader(data)); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			// The first 20000 bytes are allowed at once, the remaining 20000 take a second
+			if elapsed := time.Since(start); elapsed < 900*time.Millisecond {
+				t.Errorf("Expected copying %d bytes at 20000 bytes/s to take about a second, took %v", len(data), elapsed)
+			}
+			if !bytes.Equal(out.Bytes(), data) {
+				t.Error("Expected rate limited copy to be unchanged")
+			}
+		})
+	}
+
+	if w := (ImageClient{}).limitWriter(ioutil.Discard); w != ioutil.Discard {
+		t.Error("Expected writer to be unlimited without a rate limit")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	limited := imgClient.WithContext(ctx)
+	if _, err := io.Copy(limited.limitWriter(ioutil.Discard), bytes.NewReader(data)); err == nil {
+		t.Error("Expected error writing with a cancelled context but got nil")
+	}
+}
+
+func TestLoadImagesRateLimited(t *testing.T) {
+	defer chdirTemp(t)()
+	if err := ioutil.WriteFile("images.tar", []byte("tar"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded := []string{}
+	imgClient := ImageClient{dockerClient: FakeDockerClient{loaded: &loaded}}.WithRateLimit(1024)
+	if err := imgClient.LoadImages("images.tar", ""); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := []string{"-"}; !reflect.DeepEqual(loaded, want) {
+		t.Errorf("Expected tar streamed to docker load, got loads %v", loaded)
+	}
+}
@@ -0,0 +1,105 @@
+/*
+Copyright the Sonobuoy contributors 2019
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package image
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"text/tabwriter"
+	"time"
+)
+
+// pastTense is how a completed operation is described in timings
+var pastTense = map[Operation]string{
+	OperationPull:     "pulled",
+	OperationPush:     "pushed",
+	OperationDownload: "downloaded",
+	OperationDelete:   "deleted",
+	OperationLoad:     "loaded",
+}
+
+// ImageTiming is how long an operation on an image took
+type ImageTiming struct {
+	Name      string
+	Operation Operation
+	Status    ProgressStatus
+	Elapsed   time.Duration
+}
+
+// TimingRecorder times each operation from the progress events of an ImageClient,
+// writing a line to w as each one completes. Images with nothing to do aren't timed.
+type TimingRecorder struct {
+	Timings []ImageTiming
+
+	w       io.Writer
+	now     func() time.Time
+	started map[string]time.Time
+}
+
+// NewTimingRecorder returns a TimingRecorder writing to w
+func NewTimingRecorder(w io.Writer) *TimingRecorder {
+	return &TimingRecorder{w: w, now: time.Now, started: map[string]time.Time{}}
+}
+
+// Record is a ProgressFunc timing the operations it is told about
+func (r *TimingRecorder) Record(p ImageProgress) {
+	key := string(p.Operation) + " " + p.Name
+	if p.Status == ProgressStarted {
+		r.started[key] = r.now()
+		return
+	}
+
+	start, ok := r.started[key]
+	if !ok {
+		return
+	}
+	delete(r.started, key)
+	if p.Status == ProgressSkipped {
+		return
+	}
+
+	t := ImageTiming{Name: p.Name, Operation: p.Operation, Status: p.Status, Elapsed: r.now().Sub(start)}
+	r.Timings = append(r.Timings, t)
+	if p.Status == ProgressFailed {
+		fmt.Fprintf(r.w, "failed to %s %s after %v\n", p.Operation, p.Name, roundElapsed(t.Elapsed))
+		return
+	}
+	fmt.Fprintf(r.w, "%s %s in %v\n", pastTense[p.Operation], p.Name, roundElapsed(t.Elapsed))
+}
+
+// WriteSummary writes a table of the recorded timings to w, slowest first, followed
+// by the total time spent.
+func (r *TimingRecorder) WriteSummary(w io.Writer) {
+	timings := make([]ImageTiming, len(r.Timings))
+	copy(timings, r.Timings)
+	sort.SliceStable(timings, func(a, b int) bool { return timings[a].Elapsed > timings[b].Elapsed })
+
+	var total time.Duration
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "IMAGE\tOPERATION\tSTATUS\tELAPSED")
+	for _, t := range timings {
+		fmt.Fprintf(tw, "%v\t%v\t%v\t%v\n", t.Name, t.Operation, t.Status, roundElapsed(t.Elapsed))
+		total += t.Elapsed
+	}
+	fmt.Fprintf(tw, "TOTAL\t\t\t%v\n", roundElapsed(total))
+	tw.Flush()
+}
+
+func roundElapsed(d time.Duration) time.Duration {
+	return d.Round(100 * time.Millisecond)
+}
@@ -0,0 +1,65 @@
+/*
+Copyright the Sonobuoy contributors 2019
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package image
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+func TestTimingRecorder(t *testing.T) {
+	var lines, summary bytes.Buffer
+	r := NewTimingRecorder(&lines)
+
+	clock := time.Date(2019, 5, 1, 12, 0, 0, 0, time.UTC)
+	r.now = func() time.Time { return clock }
+	advance := func(d time.Duration) { clock = clock.Add(d) }
+
+	events := []struct {
+		p       ImageProgress
+		advance time.Duration
+	}{
+		{p: ImageProgress{Name: "foo.io/a:1.0", Operation: OperationPull, Status: ProgressStarted}, advance: 2 * time.Second},
+		{p: ImageProgress{Name: "foo.io/a:1.0", Operation: OperationPull, Status: ProgressDone}},
+		{p: ImageProgress{Name: "foo.io/b:1.0", Operation: OperationPull, Status: ProgressStarted}, advance: 12340 * time.Millisecond},
+		{p: ImageProgress{Name: "foo.io/b:1.0", Operation: OperationPull, Status: ProgressFailed, Err: errors.New("pull failed")}},
+		{p: ImageProgress{Name: "foo.io/c:1.0", Operation: OperationPull, Status: ProgressStarted}, advance: time.Second},
+		{p: ImageProgress{Name: "foo.io/c:1.0", Operation: OperationPull, Status: ProgressSkipped}},
+	}
+	for _, e := range events {
+		r.Record(e.p)
+		advance(e.advance)
+	}
+
+	wantLines := "pulled foo.io/a:1.0 in 2s\nfailed to pull foo.io/b:1.0 after 12.3s\n"
+	if lines.String() != wantLines {
+		t.Errorf("Expected lines %q but got %q", wantLines, lines.String())
+	}
+
+	r.WriteSummary(&summary)
+	wantSummary := `IMAGE         OPERATION  STATUS  ELAPSED
+foo.io/b:1.0  pull       failed  12.3s
+foo.io/a:1.0  pull       done    2s
+TOTAL                            14.3s
+`
+	if summary.String() != wantSummary {
+		t.Errorf("Expected summary:\n%s\nbut got:\n%s", wantSummary, summary.String())
+	}
+}
@@ -24,52 +24,52 @@ func (r *RegistryList) v1_14() map[string]Config {
 	gcRegistry := r.GcRegistry
 
 	configs := map[string]Config{}
-	configs["CRDConversionWebhook"] = Config{e2eRegistry, "crd-conversion-webhook", "1.13rev2"}
-	configs["AdmissionWebhook"] = Config{e2eRegistry, "webhook", "1.14v1"}
-	configs["APIServer"] = Config{e2eRegistry, "sample-apiserver", "1.10"}
-	configs["AppArmorLoader"] = Config{e2eRegistry, "apparmor-loader", "1.0"}
-	configs["AuditProxy"] = Config{e2eRegistry, "audit-proxy", "1.0"}
-	configs["BusyBox"] = Config{dockerLibraryRegistry, "busybox", "1.29"}
-	configs["CheckMetadataConcealment"] = Config{e2eRegistry, "metadata-concealment", "1.2"}
-	configs["CudaVectorAdd"] = Config{e2eRegistry, "cuda-vector-add", "1.0"}
-	configs["CudaVectorAdd2"] = Config{e2eRegistry, "cuda-vector-add", "2.0"}
-	configs["Dnsutils"] = Config{e2eRegistry, "dnsutils", "1.1"}
-	configs["EchoServer"] = Config{e2eRegistry, "echoserver", "2.2"}
-	configs["EntrypointTester"] = Config{e2eRegistry, "entrypoint-tester", "1.0"}
-	configs["Etcd"] = Config{etcdRegistry, "etcd", "v3.3.10"}
-	configs["Fakegitserver"] = Config{e2eRegistry, "fakegitserver", "1.0"}
-	configs["GBFrontend"] = Config{sampleRegistry, "gb-frontend", "v6"}
-	configs["GBRedisSlave"] = Config{sampleRegistry, "gb-redisslave", "v3"}
-	configs["Hostexec"] = Config{e2eRegistry, "hostexec", "1.1"}
-	configs["IpcUtils"] = Config{e2eRegistry, "ipc-utils", "1.0"}
-	configs["Iperf"] = Config{e2eRegistry, "iperf", "1.0"}
-	configs["JessieDnsutils"] = Config{e2eRegistry, "jessie-dnsutils", "1.0"}
-	configs["Kitten"] = Config{e2eRegistry, "kitten", "1.0"}
-	configs["Liveness"] = Config{e2eRegistry, "liveness", "1.1"}
-	configs["LogsGenerator"] = Config{e2eRegistry, "logs-generator", "1.0"}
-	configs["Mounttest"] = Config{e2eRegistry, "mounttest", "1.0"}
-	configs["MounttestUser"] = Config{e2eRegistry, "mounttest-user", "1.0"}
-	configs["Nautilus"] = Config{e2eRegistry, "nautilus", "1.0"}
-	configs["Net"] = Config{e2eRegistry, "net", "1.0"}
-	configs["Netexec"] = Config{e2eRegistry, "netexec", "1.1"}
-	configs["Nettest"] = Config{e2eRegistry, "nettest", "1.0"}
-	configs["Nginx"] = Config{dockerLibraryRegistry, "nginx", "1.14-alpine"}
-	configs["NginxNew"] = Config{dockerLibraryRegistry, "nginx", "1.15-alpine"}
-	configs["Nonewprivs"] = Config{e2eRegistry, "nonewprivs", "1.0"}
-	configs["NoSnatTest"] = Config{e2eRegistry, "no-snat-test", "1.0"}
-	configs["NoSnatTestProxy"] = Config{e2eRegistry, "no-snat-test-proxy", "1.0"}
+	configs["CRDConversionWebhook"] = Config{registry: e2eRegistry, name: "crd-conversion-webhook", version: "1.13rev2"}
+	configs["AdmissionWebhook"] = Config{registry: e2eRegistry, name: "webhook", version: "1.14v1"}
+	configs["APIServer"] = Config{registry: e2eRegistry, name: "sample-apiserver", version: "1.10"}
+	configs["AppArmorLoader"] = Config{registry: e2eRegistry, name: "apparmor-loader", version: "1.0"}
+	configs["AuditProxy"] = Config{registry: e2eRegistry, name: "audit-proxy", version: "1.0"}
+	configs["BusyBox"] = Config{registry: dockerLibraryRegistry, name: "busybox", version: "1.29"}
+	configs["CheckMetadataConcealment"] = Config{registry: e2eRegistry, name: "metadata-concealment", version: "1.2"}
+	configs["CudaVectorAdd"] = Config{registry: e2eRegistry, name: "cuda-vector-add", version: "1.0"}
+	configs["CudaVectorAdd2"] = Config{registry: e2eRegistry, name: "cuda-vector-add", version: "2.0"}
+	configs["Dnsutils"] = Config{registry: e2eRegistry, name: "dnsutils", version: "1.1"}
+	configs["EchoServer"] = Config{registry: e2eRegistry, name: "echoserver", version: "2.2"}
+	configs["EntrypointTester"] = Config{registry: e2eRegistry, name: "entrypoint-tester", version: "1.0"}
+	configs["Etcd"] = Config{registry: etcdRegistry, name: "etcd", version: "v3.3.10"}
+	configs["Fakegitserver"] = Config{registry: e2eRegistry, name: "fakegitserver", version: "1.0"}
+	configs["GBFrontend"] = Config{registry: sampleRegistry, name: "gb-frontend", version: "v6"}
+	configs["GBRedisSlave"] = Config{registry: sampleRegistry, name: "gb-redisslave", version: "v3"}
+	configs["Hostexec"] = Config{registry: e2eRegistry, name: "hostexec", version: "1.1"}
+	configs["IpcUtils"] = Config{registry: e2eRegistry, name: "ipc-utils", version: "1.0"}
+	configs["Iperf"] = Config{registry: e2eRegistry, name: "iperf", version: "1.0"}
+	configs["JessieDnsutils"] = Config{registry: e2eRegistry, name: "jessie-dnsutils", version: "1.0"}
+	configs["Kitten"] = Config{registry: e2eRegistry, name: "kitten", version: "1.0"}
+	configs["Liveness"] = Config{registry: e2eRegistry, name: "liveness", version: "1.1"}
+	configs["LogsGenerator"] = Config{registry: e2eRegistry, name: "logs-generator", version: "1.0"}
+	configs["Mounttest"] = Config{registry: e2eRegistry, name: "mounttest", version: "1.0"}
+	configs["MounttestUser"] = Config{registry: e2eRegistry, name: "mounttest-user", version: "1.0"}
+	configs["Nautilus"] = Config{registry: e2eRegistry, name: "nautilus", version: "1.0"}
+	configs["Net"] = Config{registry: e2eRegistry, name: "net", version: "1.0"}
+	configs["Netexec"] = Config{registry: e2eRegistry, name: "netexec", version: "1.1"}
+	configs["Nettest"] = Config{registry: e2eRegistry, name: "nettest", version: "1.0"}
+	configs["Nginx"] = Config{registry: dockerLibraryRegistry, name: "nginx", version: "1.14-alpine"}
+	configs["NginxNew"] = Config{registry: dockerLibraryRegistry, name: "nginx", version: "1.15-alpine"}
+	configs["Nonewprivs"] = Config{registry: e2eRegistry, name: "nonewprivs", version: "1.0"}
+	configs["NoSnatTest"] = Config{registry: e2eRegistry, name: "no-snat-test", version: "1.0"}
+	configs["NoSnatTestProxy"] = Config{registry: e2eRegistry, name: "no-snat-test-proxy", version: "1.0"}
 	// Pause - when these values are updated, also update cmd/kubelet/app/options/container_runtime.go
-	configs["Pause"] = Config{gcRegistry, "pause", "3.1"}
-	configs["Porter"] = Config{e2eRegistry, "porter", "1.0"}
-	configs["PortForwardTester"] = Config{e2eRegistry, "port-forward-tester", "1.0"}
-	configs["Redis"] = Config{e2eRegistry, "redis", "1.0"}
-	configs["ResourceConsumer"] = Config{e2eRegistry, "resource-consumer", "1.5"}
-	configs["ResourceController"] = Config{e2eRegistry, "resource-consumer/controller", "1.0"}
-	configs["ServeHostname"] = Config{e2eRegistry, "serve-hostname", "1.1"}
-	configs["TestWebserver"] = Config{e2eRegistry, "test-webserver", "1.0"}
-	configs["VolumeNFSServer"] = Config{e2eRegistry, "volume/nfs", "1.0"}
-	configs["VolumeISCSIServer"] = Config{e2eRegistry, "volume/iscsi", "1.0"}
-	configs["VolumeGlusterServer"] = Config{e2eRegistry, "volume/gluster", "1.0"}
-	configs["VolumeRBDServer"] = Config{e2eRegistry, "volume/rbd", "1.0.1"}
+	configs["Pause"] = Config{registry: gcRegistry, name: "pause", version: "3.1"}
+	configs["Porter"] = Config{registry: e2eRegistry, name: "porter", version: "1.0"}
+	configs["PortForwardTester"] = Config{registry: e2eRegistry, name: "port-forward-tester", version: "1.0"}
+	configs["Redis"] = Config{registry: e2eRegistry, name: "redis", version: "1.0"}
+	configs["ResourceConsumer"] = Config{registry: e2eRegistry, name: "resource-consumer", version: "1.5"}
+	configs["ResourceController"] = Config{registry: e2eRegistry, name: "resource-consumer/controller", version: "1.0"}
+	configs["ServeHostname"] = Config{registry: e2eRegistry, name: "serve-hostname", version: "1.1"}
+	configs["TestWebserver"] = Config{registry: e2eRegistry, name: "test-webserver", version: "1.0"}
+	configs["VolumeNFSServer"] = Config{registry: e2eRegistry, name: "volume/nfs", version: "1.0"}
+	configs["VolumeISCSIServer"] = Config{registry: e2eRegistry, name: "volume/iscsi", version: "1.0"}
+	configs["VolumeGlusterServer"] = Config{registry: e2eRegistry, name: "volume/gluster", version: "1.0"}
+	configs["VolumeRBDServer"] = Config{registry: e2eRegistry, name: "volume/rbd", version: "1.0.1"}
 	return configs
 }
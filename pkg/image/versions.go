@@ -0,0 +1,88 @@
+/*
+Copyright the Sonobuoy contributors 2019
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package image
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// DownloadVersions saves the images of each Kubernetes version to its own tar
+// named after the version, as DownloadImages does, exporting up to concurrency
+// versions at once. The files written are returned by version.
+func (i ImageClient) DownloadVersions(images map[string][]string, concurrency int) (map[string]string, []error) {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	if i.progress != nil {
+		i.progress = synchronized(i.progress)
+	}
+
+	versions := make([]string, 0, len(images))
+	for version := range images {
+		versions = append(versions, version)
+	}
+	sort.Strings(versions)
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	fileNames := map[string]string{}
+	errs := []error{}
+	sem := make(chan struct{}, concurrency)
+
+	for n, version := range versions {
+		sem <- struct{}{}
+		mu.Lock()
+		aborted := i.aborted(errs)
+		mu.Unlock()
+		if aborted {
+			<-sem
+			break
+		}
+
+		wg.Add(1)
+		go func(version string, part int) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			fileName, err := i.saveTar(images[version], getTarFileName(version, 0), part, len(versions))
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				errs = append(errs, errors.Wrapf(err, "couldn't download images for %v", version))
+				return
+			}
+			fileNames[version] = fileName
+		}(version, n+1)
+	}
+	wg.Wait()
+
+	return fileNames, errs
+}
+
+// synchronized returns a ProgressFunc calling fn for one event at a time, so that
+// operations running concurrently still report progress synchronously.
+func synchronized(fn ProgressFunc) ProgressFunc {
+	var mu sync.Mutex
+	return func(p ImageProgress) {
+		mu.Lock()
+		defer mu.Unlock()
+		fn(p)
+	}
+}
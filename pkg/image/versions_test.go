@@ -0,0 +1,90 @@
+/*
+Copyright the Sonobuoy contributors 2019
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package image
+
+import (
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestDownloadVersions(t *testing.T) {
+	images := map[string][]string{
+		"v1.13.0": {"foo.io/sonobuoy/test:1.0"},
+		"v1.14.0": {"foo.io/sonobuoy/test:1.0", "foo.io/sonobuoy/test:2.0"},
+		"v1.15.0": {"foo.io/sonobuoy/test:2.0"},
+	}
+
+	tests := map[string]struct {
+		client      FakeDockerClient
+		concurrency int
+		want        map[string]string
+		wantErrors  int
+	}{
+		"sequential": {
+			client:      FakeDockerClient{},
+			concurrency: 1,
+			want: map[string]string{
+				"v1.13.0": getTarFileName("v1.13.0", 0),
+				"v1.14.0": getTarFileName("v1.14.0", 0),
+				"v1.15.0": getTarFileName("v1.15.0", 0),
+			},
+		},
+		"concurrent": {
+			client:      FakeDockerClient{},
+			concurrency: 3,
+			want: map[string]string{
+				"v1.13.0": getTarFileName("v1.13.0", 0),
+				"v1.14.0": getTarFileName("v1.14.0", 0),
+				"v1.15.0": getTarFileName("v1.15.0", 0),
+			},
+		},
+		"save fails": {
+			client:      FakeDockerClient{saveFails: true},
+			concurrency: 2,
+			want:        map[string]string{},
+			wantErrors:  3,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			defer chdirTemp(t)()
+
+			var events []ImageProgress
+			imgClient := ImageClient{dockerClient: tc.client}.WithProgress(func(p ImageProgress) {
+				events = append(events, p)
+			})
+
+			got, errs := imgClient.DownloadVersions(images, tc.concurrency)
+			if len(errs) != tc.wantErrors {
+				t.Fatalf("Expected %d errors but got %v", tc.wantErrors, errs)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("Expected files %v but got %v", tc.want, got)
+			}
+			for _, fileName := range got {
+				if _, err := os.Stat(fileName); err != nil {
+					t.Errorf("Expected %v to be written: %v", fileName, err)
+				}
+			}
+			if len(events) != 2*len(images) {
+				t.Errorf("Expected %d progress events but got %d", 2*len(images), len(events))
+			}
+		})
+	}
+}